@@ -0,0 +1,56 @@
+"""A minimal Python client for the environment server (see pkg/EnvironmentServer).
+
+Start the server with `go run ./cmd/envserver`, then run this script to play pong
+with paddles that follow the ball.
+"""
+
+import json
+import socket
+
+
+class EnvironmentClient:
+    def __init__(self, system, host="127.0.0.1", port=5555):
+        self.socket = socket.create_connection((host, port))
+        self.file = self.socket.makefile("rw")
+        self.spaces = self.send(Command="make", System=system)["Spaces"]
+
+    def send(self, **request):
+        self.file.write(json.dumps(request) + "\n")
+        self.file.flush()
+        response = json.loads(self.file.readline())
+        if "Error" in response:
+            raise RuntimeError(response["Error"])
+        return response
+
+    def reset(self, seed=None):
+        request = {"Command": "reset"}
+        if seed is not None:
+            request["Seed"] = seed
+        return self.send(**request)["Observations"]
+
+    def step(self, actions):
+        response = self.send(Command="step", Actions=actions)
+        return response["Observations"], response["Rewards"], response["Terminal"], response["Truncated"], response.get("Info")
+
+    def render(self):
+        return self.send(Command="render")["State"]
+
+    def close(self):
+        self.socket.close()
+
+
+if __name__ == "__main__":
+    client = EnvironmentClient("pong")
+    print("Spaces:", client.spaces)
+    observations = client.reset(seed=1)
+    returns = [0.0] * client.spaces["NumAgents"]
+    terminal = truncated = False
+    while not (terminal or truncated):
+        # Move each paddle towards the ball, finding the percepts by name
+        percepts = [dict(zip(client.spaces["PerceptNames"], observation)) for observation in observations]
+        actions = [[percept["BallY"] - percept["PaddlePosition"]] for percept in percepts]
+        observations, rewards, terminal, truncated, info = client.step(actions)
+        returns = [total + reward for total, reward in zip(returns, rewards)]
+    finalState = dict(zip(client.spaces["StateNames"], client.render()["StateVector"]))
+    print("Returns:", returns, "final state:", finalState)
+    client.close()
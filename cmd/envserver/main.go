@@ -0,0 +1,36 @@
+// Serve the bundled systems over a local socket, so agents written in other languages can play them.
+// See pkg/EnvironmentServer for the protocol, and client.py for a minimal Python client.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	// Imported for their side effect of registering each system by name
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/basicSystem"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/flyingAgents"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/multiAgentSystem"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/pongSystem"
+	environmentserver "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/EnvironmentServer"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+)
+
+func main() {
+	network := flag.String("network", "tcp", "network to listen on: tcp or unix")
+	address := flag.String("address", "127.0.0.1:5555", "address to listen on, or the socket path for a unix network")
+	flag.Parse()
+
+	server, err := environmentserver.NewServer(*network, *address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Serving %v at %v\n", system.RegisteredNames(), server.Address())
+
+	// Stop on keyboard interrupt
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+	server.Close()
+}
@@ -2,6 +2,7 @@ package basicsystem
 
 import (
 	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
 	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
 
 	"gonum.org/v1/gonum/mat"
@@ -16,6 +17,10 @@ const (
 type BasicSystem struct {
 }
 
+func init() {
+	system.Register("basic", func() system.System { return &BasicSystem{} })
+}
+
 func (system *BasicSystem) NumPercepts() int {
 	return NUM_PERCEPTS
 }
@@ -26,6 +31,17 @@ func (system *BasicSystem) NumAgentsPerSimulation() int {
 	return NUM_AGENTS_PER_SIMULATION
 }
 
+func (system *BasicSystem) Name() string {
+	return "basic"
+}
+func (system *BasicSystem) Constants() map[string]interface{} {
+	return map[string]interface{}{
+		"NUM_PERCEPTS":              NUM_PERCEPTS,
+		"NUM_ACTIONS":               NUM_ACTIONS,
+		"NUM_AGENTS_PER_SIMULATION": NUM_AGENTS_PER_SIMULATION,
+	}
+}
+
 // Returns the initial state of the system
 //
 // In this case it is very boring - the state is always 1.0 flat
@@ -36,22 +52,31 @@ func (system *BasicSystem) InitializeState() *systemstate.SystemState {
 	}
 }
 
-// Defines the behavior of the system
-//
-// This method should take the current system state and agents, find the agent actions,
-// then apply those actions to the state to update it.
-//
-// This method is also responsible for updating the agent scores!
+// The state never changes, so the seed is ignored. See system.Environment
+func (system *BasicSystem) Reset(seed uint64) *systemstate.SystemState {
+	return system.InitializeState()
+}
+
+// Every agent perceives the whole state
+func (system *BasicSystem) Observe(state *systemstate.SystemState, agentIndex int, percepts *mat.VecDense) {
+	percepts.CopyVec(state.StateVector)
+}
+
+// Defines the behavior of the system, see system.Environment
 //
-// The implementation here is very boring - we immediately call the simulation done (terminal = true)
-// and set the score of the agent to the sum of the action vector.
-func (system *BasicSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
-	agentActions := agent.GetAllAgentActions(agents, state.StateVector)
-	state.TerminalState = true
-	state.StateIndex += 1
+// The implementation here is very boring - the simulation is immediately done (terminal = true)
+// and the agent is rewarded with the sum of its action vector.
+func (system *BasicSystem) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
 	agentScore := 0.0
-	for _, elem := range agentActions[0].RawVector().Data {
+	for _, elem := range actions[0].RawVector().Data {
 		agentScore += elem
 	}
-	agents[0].Score += agentScore
+	rewards[0] = agentScore
+	return true, false, nil
+}
+
+// Advance the state a single step, by observing the agents' percepts,
+// getting their actions and stepping the system (see Step)
+func (targetSystem *BasicSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
+	system.AdvanceEnvironmentState(targetSystem, state, agents, system.StateStepBuffers(targetSystem, state))
 }
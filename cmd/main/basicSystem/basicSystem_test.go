@@ -1,15 +1,17 @@
 package basicsystem
 
 import (
+	"context"
 	"math"
-	"os"
 	"testing"
 	"time"
 
 	"golang.org/x/exp/rand"
 
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
 	geneticbreeder "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/GeneticBreeder"
 	manager "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Manager"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
 )
 
 func TestBasicSystem(t *testing.T) {
@@ -20,9 +22,21 @@ func TestBasicSystem(t *testing.T) {
 		[]float64{0.0, 0.0, 0.0, 0.2, 0.2, 0.2, 0.2, 0.2},
 		0,
 		math.Pow10(-6))
-	manager := manager.NewManager(&targetSystem, 100, 100, 8, geneticBreeder, false)
-	manager.SimulateManyGenerations(100)
+	testManager := manager.NewManager(&targetSystem, 100, 100, 8, geneticBreeder, false, manager.WithOutputRoot(t.TempDir()))
+	defer testManager.WriteStop()
+	if _, err := testManager.SimulateManyGenerations(context.Background(), 100); err != nil {
+		t.Fatal(err)
+	}
+}
 
-	os.RemoveAll("data")
-	os.RemoveAll("logs")
+func BenchmarkBasicSystemStep(b *testing.B) {
+	targetSystem := &BasicSystem{}
+	agents := []*agent.Agent{agent.NewRandomGaussianAgent(NUM_ACTIONS, NUM_PERCEPTS)}
+	buffers := system.NewStepBuffers(targetSystem)
+	state := targetSystem.Reset(0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for iteration := 0; iteration < b.N; iteration++ {
+		system.AdvanceEnvironmentState(targetSystem, state, agents, buffers)
+	}
 }
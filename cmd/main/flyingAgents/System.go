@@ -8,9 +8,11 @@ package flyingagents
 
 import (
 	"math"
+	"sync"
 	"time"
 
 	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
 	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
 	"github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/utils"
 	"golang.org/x/exp/rand"
@@ -53,17 +55,17 @@ const (
 	// If an agent reaches this bound (in ANY direction, positive and negative X and Y) then the agent "loses"
 	SIMULATION_BOUND = 100.0
 
-	// Defines how large each step is
+	// Defines how large each step is by default, see FlyingAgentParameters
 	TIME_DELTA = 0.05
 
-	// Defines how strong gravity is - each frame, the agents Y velocity is decremented by some amount to simulate this.
+	// Defines how strong gravity is by default - each frame, the agents Y velocity is decremented by some amount to simulate this.
 	GRAVITY = 0.0
 
-	// Defines the friction term for the agent.
+	// Defines the default friction term for the agent.
 	// The agents velocity is multiplied by 1-FRICTION_CONSTANT at each step.
 	FRICTION_CONSTANT = 0.0
 
-	// Defines how powerful the agents thrust is allowed to be.
+	// Defines how powerful the agents thrust is allowed to be by default.
 	MAX_THRUST = 5.0
 
 	// Defines the radius in which the agent can pick up the reward.
@@ -92,18 +94,79 @@ const (
 
 // ------------------------------------------------------------------------------------------------
 
+// The physical parameters of the simulation. Each system has its own (see NewFlyingAgentSystemWithParameters),
+// so that agents can be evolved against many variations of the physics rather than a single one.
+type FlyingAgentParameters struct {
+	// How large each step is, see TIME_DELTA
+	TimeDelta float64
+
+	// How strong gravity is, see GRAVITY
+	Gravity float64
+
+	// The friction term for the agent, see FRICTION_CONSTANT
+	FrictionConstant float64
+
+	// How powerful the agents thrust is allowed to be, see MAX_THRUST
+	MaxThrust float64
+}
+
+// The parameters of the simulation as it has always been run, given by the constants above
+func DefaultFlyingAgentParameters() FlyingAgentParameters {
+	return FlyingAgentParameters{
+		TimeDelta:        TIME_DELTA,
+		Gravity:          GRAVITY,
+		FrictionConstant: FRICTION_CONSTANT,
+		MaxThrust:        MAX_THRUST,
+	}
+}
+
+// Describes each parameter, in the order of the FlyingAgentParameters fields, see system.ParameterizedEnvironment
+func flyingAgentParameterFields() []system.Field {
+	return []system.Field{
+		{Name: "TimeDelta", Unit: "s", Minimum: 0, Maximum: math.Inf(1)},
+		system.UnboundedField("Gravity", "units/s^2"),
+		{Name: "FrictionConstant", Unit: "", Minimum: 0, Maximum: 1},
+		{Name: "MaxThrust", Unit: "units/s^2", Minimum: 0, Maximum: math.Inf(1)},
+	}
+}
+
+// The value of each parameter, in the order of the fields
+func (parameters FlyingAgentParameters) values() []float64 {
+	return []float64{parameters.TimeDelta, parameters.Gravity, parameters.FrictionConstant, parameters.MaxThrust}
+}
+
 type FlyingAgentSystem struct {
-	randomGenerator *rand.Rand
+	parameters FlyingAgentParameters
+
+	// Only used to seed each episode when none is given, see InitializeState
+	randomGenerator      *rand.Rand
+	randomSource         *rand.PCGSource
+	randomGeneratorMutex sync.Mutex
 }
 
+// Create a flying agent system with the default parameters, see DefaultFlyingAgentParameters
 func NewFlyingAgentSystem() *FlyingAgentSystem {
-	randomGenerator := rand.New(rand.NewSource(uint64(time.Now().Nanosecond())))
+	return NewFlyingAgentSystemWithParameters(DefaultFlyingAgentParameters())
+}
+
+// Create a flying agent system with the given parameters. Panics if any parameter is out of its bounds
+// (see system.ParameterizedEnvironment).
+func NewFlyingAgentSystemWithParameters(parameters FlyingAgentParameters) *FlyingAgentSystem {
+	system.CheckParameterValues(flyingAgentParameterFields(), parameters.values())
+	randomSource := &rand.PCGSource{}
+	randomSource.Seed(uint64(time.Now().Nanosecond()))
 
 	return &FlyingAgentSystem{
-		randomGenerator: randomGenerator,
+		parameters:      parameters,
+		randomGenerator: rand.New(randomSource),
+		randomSource:    randomSource,
 	}
 }
 
+func init() {
+	system.Register("flyingAgents", func() system.System { return NewFlyingAgentSystem() })
+}
+
 func (system *FlyingAgentSystem) NumPercepts() int {
 	return NUM_PERCEPTS
 }
@@ -114,23 +177,107 @@ func (system *FlyingAgentSystem) NumAgentsPerSimulation() int {
 	return NUM_AGENTS_PER_SIMULATION
 }
 
+func (system *FlyingAgentSystem) Name() string {
+	return "flyingAgents"
+}
+
+// The constants of the system, with the parameters being those of this system rather than the defaults
+func (system *FlyingAgentSystem) Constants() map[string]interface{} {
+	return map[string]interface{}{
+		"SIMULATION_BOUND":                 SIMULATION_BOUND,
+		"TIME_DELTA":                       system.parameters.TimeDelta,
+		"GRAVITY":                          system.parameters.Gravity,
+		"FRICTION_CONSTANT":                system.parameters.FrictionConstant,
+		"MAX_THRUST":                       system.parameters.MaxThrust,
+		"AGENT_RADIUS":                     AGENT_RADIUS,
+		"MIN_NEXT_TARGET_LOCATION_RADIUS":  MIN_NEXT_TARGET_LOCATION_RADIUS,
+		"MAX_LOCATIONS":                    MAX_LOCATIONS,
+		"LOSING_PENALTY":                   LOSING_PENALTY,
+		"TARGET_LOCATION_REWARD":           TARGET_LOCATION_REWARD,
+		"MOVEMENT_TOWARDS_LOCATION_REWARD": MOVEMENT_TOWARDS_LOCATION_REWARD,
+		"STEP_PENALTY":                     STEP_PENALTY,
+	}
+}
+
+// Names the elements of the state, percept and action vectors, see system.SchemaSystem
+func (flyingAgentSystem *FlyingAgentSystem) Schema() system.Schema {
+	maxThrust := flyingAgentSystem.parameters.MaxThrust
+	// The agent sees everything but the progress through the episode
+	percepts := []system.Field{
+		system.UnboundedField("AgentX", "units"),
+		system.UnboundedField("AgentY", "units"),
+		system.UnboundedField("AgentVelX", "units/s"),
+		system.UnboundedField("AgentVelY", "units/s"),
+		{Name: "TargetLocationX", Unit: "units", Minimum: -SIMULATION_BOUND, Maximum: SIMULATION_BOUND},
+		{Name: "TargetLocationY", Unit: "units", Minimum: -SIMULATION_BOUND, Maximum: SIMULATION_BOUND},
+	}
+	return system.Schema{
+		State: append(percepts,
+			system.Field{Name: "NumTargetLocationsVisited", Unit: "targets", Minimum: 0, Maximum: MAX_LOCATIONS},
+			system.Field{Name: "MinimumDistanceToCurrentTargetLocation", Unit: "units", Minimum: 0, Maximum: math.Inf(1)},
+		),
+		Percepts: percepts,
+		// Thrusts beyond the maximum are clipped
+		Actions: []system.Field{
+			{Name: "VerticalThruster", Unit: "units/s^2", Minimum: -maxThrust, Maximum: maxThrust},
+			{Name: "HorizontalThruster", Unit: "units/s^2", Minimum: -maxThrust, Maximum: maxThrust},
+		},
+	}
+}
+
+// The parameters of the system, see NewFlyingAgentSystemWithParameters
+func (system *FlyingAgentSystem) Parameters() FlyingAgentParameters {
+	return system.parameters
+}
+
+// Describes each parameter, in the order of the FlyingAgentParameters fields, see system.ParameterizedEnvironment
+func (flyingAgentSystem *FlyingAgentSystem) ParameterFields() []system.Field {
+	return flyingAgentParameterFields()
+}
+
+// The value of each parameter, in the order of the FlyingAgentParameters fields, see system.ParameterizedEnvironment
+func (system *FlyingAgentSystem) ParameterValues() []float64 {
+	return system.parameters.values()
+}
+
+// Create a new system with the given value of each parameter, see system.ParameterizedEnvironment
+func (flyingAgentSystem *FlyingAgentSystem) WithParameterValues(values []float64) system.ParameterizedEnvironment {
+	system.CheckParameterValues(flyingAgentParameterFields(), values)
+	return NewFlyingAgentSystemWithParameters(FlyingAgentParameters{
+		TimeDelta:        values[0],
+		Gravity:          values[1],
+		FrictionConstant: values[2],
+		MaxThrust:        values[3],
+	})
+}
+
 // ------------------------------------------------------------------------------------------------
 
 // Determine the next location of the target location.
-func (system *FlyingAgentSystem) chooseNextTargetLocation(previousTargetLocationX, previousTargetLocationY float64) (float64, float64) {
+func (system *FlyingAgentSystem) chooseNextTargetLocation(randomGenerator *rand.Rand, previousTargetLocationX, previousTargetLocationY float64) (float64, float64) {
 	targetLocationX := previousTargetLocationX
 	targetLocationY := previousTargetLocationY
 	for math.Hypot(targetLocationX-previousTargetLocationX, targetLocationY-previousTargetLocationY) < MIN_NEXT_TARGET_LOCATION_RADIUS {
-		targetLocationX = 2*SIMULATION_BOUND*system.randomGenerator.Float64() - SIMULATION_BOUND
-		targetLocationY = 2*SIMULATION_BOUND*system.randomGenerator.Float64() - SIMULATION_BOUND
+		targetLocationX = 2*SIMULATION_BOUND*randomGenerator.Float64() - SIMULATION_BOUND
+		targetLocationY = 2*SIMULATION_BOUND*randomGenerator.Float64() - SIMULATION_BOUND
 	}
 	return targetLocationX, targetLocationY
 }
 
 // Give the initial state of a system
 //
-// We must position the agent, as well as determine the first target location
+// We must position the agent, as well as determine the first target location.
+// The episode is seeded from the system's own generator.
 func (system *FlyingAgentSystem) InitializeState() *systemstate.SystemState {
+	// Simulations run concurrently, so the shared generator must be locked
+	system.randomGeneratorMutex.Lock()
+	episodeSeed := system.randomGenerator.Uint64()
+	system.randomGeneratorMutex.Unlock()
+	return systemstate.NewSeededState(episodeSeed, system.InitializeSeededState)
+}
+
+// Give the initial state of a system, drawing every target location of the episode from randomGenerator
+func (system *FlyingAgentSystem) InitializeSeededState(randomGenerator *rand.Rand) *systemstate.SystemState {
 	// agent always starts in the middle of the simulation with 0 orientation and 0 velocity
 	agentX := 0.0
 	agentY := 0.0
@@ -138,7 +285,7 @@ func (system *FlyingAgentSystem) InitializeState() *systemstate.SystemState {
 	agentVelY := 0.0
 
 	// First target location is given by a random number chosen in the valid bounds
-	targetLocationX, targetLocationY := system.chooseNextTargetLocation(0.0, 0.0)
+	targetLocationX, targetLocationY := system.chooseNextTargetLocation(randomGenerator, 0.0, 0.0)
 	numTargetLocationsVisited := 0.0
 	minimumDistanceToCurrentTargetLocation := math.Hypot(agentX-targetLocationX, agentY-targetLocationY)
 
@@ -153,85 +300,160 @@ func (system *FlyingAgentSystem) InitializeState() *systemstate.SystemState {
 			numTargetLocationsVisited,
 			minimumDistanceToCurrentTargetLocation,
 		}),
-		TerminalState: false,
+		TerminalState:   false,
+		RandomGenerator: randomGenerator,
 	}
 }
 
-func (system *FlyingAgentSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
-	previousAgentX := state.StateVector.AtVec(0)
-	previousAgentY := state.StateVector.AtVec(1)
-	previousAgentVelX := state.StateVector.AtVec(2)
-	previousAgentVelY := state.StateVector.AtVec(3)
-	targetLocationX := state.StateVector.AtVec(4)
-	targetLocationY := state.StateVector.AtVec(5)
-	numTargetLocationsVisited := state.StateVector.AtVec(6)
-	minimumDistanceToCurrentTargetLocation := state.StateVector.AtVec(7)
-
-	// Craft the agent input vector
-	agentPercepts := mat.NewVecDense(NUM_PERCEPTS, []float64{
-		previousAgentX,
-		previousAgentY,
-		previousAgentVelX,
-		previousAgentVelY,
-		targetLocationX,
-		targetLocationY,
-	})
-	agent := agents[0]
-	agentAction := agent.GetAction(agentPercepts)
+// Returns the initial state of an episode seeded by the given seed, see system.Environment
+func (system *FlyingAgentSystem) Reset(seed uint64) *systemstate.SystemState {
+	return systemstate.NewSeededState(seed, system.InitializeSeededState)
+}
+
+// Captures the position of the generator seeding new episodes, see system.SnapshottableSystem
+func (system *FlyingAgentSystem) SnapshotSystem() ([]byte, error) {
+	system.randomGeneratorMutex.Lock()
+	defer system.randomGeneratorMutex.Unlock()
+	return system.randomSource.MarshalBinary()
+}
+
+// Returns the generator seeding new episodes to a position captured by SnapshotSystem, see system.SnapshottableSystem
+func (system *FlyingAgentSystem) RestoreSystem(data []byte) error {
+	system.randomGeneratorMutex.Lock()
+	defer system.randomGeneratorMutex.Unlock()
+	return system.randomSource.UnmarshalBinary(data)
+}
+
+// Writes the percepts of the agent, see system.Environment
+func (system *FlyingAgentSystem) Observe(state *systemstate.SystemState, agentIndex int, percepts *mat.VecDense) {
+	// The agent sees everything but the progress through the episode
+	for perceptIndex := 0; perceptIndex < NUM_PERCEPTS; perceptIndex++ {
+		percepts.SetVec(perceptIndex, state.StateVector.AtVec(perceptIndex))
+	}
+}
+
+// Defines the behavior of the system
+//
+// The agent's thrusters accelerate it, and it is rewarded for reaching each target location,
+// after which a new target location is chosen. The episode ends once MAX_LOCATIONS have been visited.
+// Flying agent episodes are never truncated.
+func (flyingAgentSystem *FlyingAgentSystem) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	var stateData [STATE_VECTOR_LEN]float64
+	for stateIndex := range stateData {
+		stateData[stateIndex] = state.StateVector.AtVec(stateIndex)
+	}
+	reward, terminal := flyingAgentSystem.stepEpisode(&stateData, state.RandomGenerator, actions[0].AtVec(0), actions[0].AtVec(1))
+	for stateIndex, value := range stateData {
+		state.StateVector.SetVec(stateIndex, value)
+	}
+	rewards[0] = reward
+	return terminal, false, nil
+}
+
+// Advance a single episode, whose state vector is given, a single step with the given thrusts.
+// Returns the reward of the agent, and whether the episode is over.
+//
+// This is shared by Step and StepBatch, so an episode plays out exactly the same whether simulated alone or in a batch.
+func (system *FlyingAgentSystem) stepEpisode(stateData *[STATE_VECTOR_LEN]float64, randomGenerator *rand.Rand, verticalThruster float64, horizontalThruster float64) (float64, bool) {
+	reward := 0.0
+	terminal := false
+
+	previousAgentX := stateData[0]
+	previousAgentY := stateData[1]
+	previousAgentVelX := stateData[2]
+	previousAgentVelY := stateData[3]
+	targetLocationX := stateData[4]
+	targetLocationY := stateData[5]
+	numTargetLocationsVisited := stateData[6]
+	minimumDistanceToCurrentTargetLocation := stateData[7]
 
-	// Decode the agent action
-	verticalThruster := agentAction.AtVec(0)
-	horizontalThruster := agentAction.AtVec(1)
 	// Ensure thrusters are in correct bound
-	verticalThruster = utils.ClipToBounds(verticalThruster, -MAX_THRUST, MAX_THRUST)
-	horizontalThruster = utils.ClipToBounds(horizontalThruster, -MAX_THRUST, MAX_THRUST)
+	maxThrust := system.parameters.MaxThrust
+	verticalThruster = utils.ClipToBounds(verticalThruster, -maxThrust, maxThrust)
+	horizontalThruster = utils.ClipToBounds(horizontalThruster, -maxThrust, maxThrust)
 
 	// Update the agents position and velocities --------------------------------------------------
 
-	newAgentX := previousAgentX + TIME_DELTA*previousAgentVelX
-	newAgentY := previousAgentY + TIME_DELTA*previousAgentVelY
+	timeDelta := system.parameters.TimeDelta
+	friction := system.parameters.FrictionConstant
+	newAgentX := previousAgentX + timeDelta*previousAgentVelX
+	newAgentY := previousAgentY + timeDelta*previousAgentVelY
 
-	newAgentVelY := (1 - FRICTION_CONSTANT) * (previousAgentVelY + TIME_DELTA*(verticalThruster-GRAVITY))
-	newAgentVelX := (1 - FRICTION_CONSTANT) * (previousAgentVelX + TIME_DELTA*horizontalThruster)
+	newAgentVelY := (1 - friction) * (previousAgentVelY + timeDelta*(verticalThruster-system.parameters.Gravity))
+	newAgentVelX := (1 - friction) * (previousAgentVelX + timeDelta*horizontalThruster)
 
 	// Check over agent rewards -------------------------------------------------------------------
 
 	// Check if agent have left simulation
 	// if newAgentX < -SIMULATION_BOUND || newAgentX > SIMULATION_BOUND || newAgentY < -SIMULATION_BOUND || newAgentY > SIMULATION_BOUND {
-	// 	agent.Score += LOSING_PENALTY
-	// 	state.TerminalState = true
+	// 	reward += LOSING_PENALTY
+	// 	terminal = true
 	// }
 
 	// Check if agent has moved towards the reward (in both directions)
 	currentDistanceToTargetLocation := math.Hypot(newAgentX-targetLocationX, newAgentY-targetLocationY)
 	if currentDistanceToTargetLocation < minimumDistanceToCurrentTargetLocation {
 		minimumDistanceToCurrentTargetLocation = currentDistanceToTargetLocation
-		agent.Score += MOVEMENT_TOWARDS_LOCATION_REWARD
+		reward += MOVEMENT_TOWARDS_LOCATION_REWARD
 	}
 
 	// Check if agent has collected the reward
 	if math.Hypot(targetLocationX-newAgentX, targetLocationY-newAgentY) < AGENT_RADIUS {
 		// fmt.Printf("%v, %v\n", targetLocationX-newAgentX, targetLocationY-newAgentY)
-		agent.Score += TARGET_LOCATION_REWARD
+		reward += TARGET_LOCATION_REWARD
 
-		targetLocationX, targetLocationY = system.chooseNextTargetLocation(targetLocationX, targetLocationY)
+		targetLocationX, targetLocationY = system.chooseNextTargetLocation(randomGenerator, targetLocationX, targetLocationY)
 		numTargetLocationsVisited += 1
 		minimumDistanceToCurrentTargetLocation = math.Hypot(newAgentX-targetLocationX, newAgentY-targetLocationY)
 		if numTargetLocationsVisited >= MAX_LOCATIONS {
-			state.TerminalState = true
+			terminal = true
 		}
 	}
 
-	agent.Score += STEP_PENALTY
+	reward += STEP_PENALTY
 
 	// Update state and finish up
-	state.StateIndex += 1
-	state.StateVector.SetVec(0, newAgentX)
-	state.StateVector.SetVec(1, newAgentY)
-	state.StateVector.SetVec(2, newAgentVelX)
-	state.StateVector.SetVec(3, newAgentVelY)
-	state.StateVector.SetVec(4, targetLocationX)
-	state.StateVector.SetVec(5, targetLocationY)
-	state.StateVector.SetVec(6, numTargetLocationsVisited)
-	state.StateVector.SetVec(7, minimumDistanceToCurrentTargetLocation)
+	stateData[0] = newAgentX
+	stateData[1] = newAgentY
+	stateData[2] = newAgentVelX
+	stateData[3] = newAgentVelY
+	stateData[4] = targetLocationX
+	stateData[5] = targetLocationY
+	stateData[6] = numTargetLocationsVisited
+	stateData[7] = minimumDistanceToCurrentTargetLocation
+	return reward, terminal
+}
+
+// Returns the initial states of a batch of episodes, see system.BatchedSystem
+func (flyingAgentSystem *FlyingAgentSystem) InitializeBatchState(randomGenerators []*rand.Rand) *systemstate.BatchState {
+	return system.InitializeBatchStateFromEpisodes(flyingAgentSystem, randomGenerators)
+}
+
+// Writes the percepts of the agent in every unfinished episode, as Observe does for a single episode
+func (system *FlyingAgentSystem) ObserveBatch(batch *systemstate.BatchState, agentIndex int, percepts *mat.Dense) {
+	for episodeIndex, terminal := range batch.TerminalMask {
+		if !terminal {
+			copy(percepts.RawRowView(episodeIndex), batch.StateMatrix.RawRowView(episodeIndex)[:NUM_PERCEPTS])
+		}
+	}
+}
+
+// Advances every unfinished episode a single step, as Step does for a single episode
+func (system *FlyingAgentSystem) StepBatch(batch *systemstate.BatchState, actions []*mat.Dense, rewards *mat.Dense) {
+	for episodeIndex, terminal := range batch.TerminalMask {
+		if terminal {
+			continue
+		}
+		stateData := (*[STATE_VECTOR_LEN]float64)(batch.StateMatrix.RawRowView(episodeIndex))
+		reward, terminal := system.stepEpisode(stateData, batch.RandomGenerators[episodeIndex],
+			actions[0].At(episodeIndex, 0), actions[0].At(episodeIndex, 1))
+		rewards.Set(episodeIndex, 0, reward)
+		batch.TerminalMask[episodeIndex] = terminal
+	}
+}
+
+// Advance the state a single step, by observing the agent's percepts,
+// getting its action and stepping the system (see Step)
+func (flyingAgentSystem *FlyingAgentSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
+	system.AdvanceEnvironmentState(flyingAgentSystem, state, agents, system.StateStepBuffers(flyingAgentSystem, state))
 }
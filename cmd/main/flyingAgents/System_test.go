@@ -0,0 +1,167 @@
+package flyingagents
+
+import (
+	"context"
+	"testing"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	simulator "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Simulator"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Create seeded jobs, where each of numAgents agents is evaluated in numJobs / numAgents of the jobs
+func newFlyingAgentJobs(numJobs int, numAgents int) []simulator.SimulationJob {
+	agents := make([]*agent.Agent, numAgents)
+	for agentIndex := range agents {
+		// Small chromosomes, so agents move slowly enough to sometimes reach their targets
+		agents[agentIndex] = agent.NewRandomGaussianAgent(NUM_ACTIONS, NUM_PERCEPTS)
+		agents[agentIndex].Chromosome.Scale(0.1, agents[agentIndex].Chromosome)
+	}
+	jobs := make([]simulator.SimulationJob, numJobs)
+	for jobIndex := range jobs {
+		jobs[jobIndex] = simulator.SimulationJob{
+			Agents: []*agent.Agent{agents[jobIndex%numAgents]},
+			Seed:   uint64(jobIndex),
+			Seeded: true,
+		}
+	}
+	return jobs
+}
+
+// Episodes simulated in lockstep must play out exactly as they do alone
+func TestFlyingAgentsLockstepMatchesSequential(t *testing.T) {
+	flyingAgentSystem := NewFlyingAgentSystem()
+	jobs := newFlyingAgentJobs(40, 8)
+	results := simulator.SimulateBatchInLockstep(context.Background(), flyingAgentSystem, jobs)
+	for jobIndex, job := range jobs {
+		agentCopy := agent.NewAgent(mat.DenseCopyOf(job.Agents[0].Chromosome))
+		sequentialResult := simulator.SimulateSystemWithSeed(context.Background(), flyingAgentSystem, []*agent.Agent{agentCopy}, job.Seed)
+		if results[jobIndex].EpisodeLength != sequentialResult.EpisodeLength || results[jobIndex].TerminalReason != sequentialResult.TerminalReason ||
+			results[jobIndex].Returns[0] != sequentialResult.Returns[0] {
+			t.Errorf("job %v: lockstep ran %v steps (%v) with return %v, sequential ran %v steps (%v) with return %v", jobIndex,
+				results[jobIndex].EpisodeLength, results[jobIndex].TerminalReason, results[jobIndex].Returns[0],
+				sequentialResult.EpisodeLength, sequentialResult.TerminalReason, sequentialResult.Returns[0])
+		}
+	}
+}
+
+func BenchmarkFlyingAgentsSequential(b *testing.B) {
+	flyingAgentSystem := NewFlyingAgentSystem()
+	jobs := newFlyingAgentJobs(64, 8)
+	b.ResetTimer()
+	for iteration := 0; iteration < b.N; iteration++ {
+		for _, job := range jobs {
+			simulator.SimulateSystemWithSeed(context.Background(), flyingAgentSystem, job.Agents, job.Seed)
+		}
+	}
+}
+
+func BenchmarkFlyingAgentsLockstep(b *testing.B) {
+	flyingAgentSystem := NewFlyingAgentSystem()
+	jobs := newFlyingAgentJobs(64, 8)
+	b.ResetTimer()
+	for iteration := 0; iteration < b.N; iteration++ {
+		simulator.SimulateBatchInLockstep(context.Background(), flyingAgentSystem, jobs)
+	}
+}
+
+// Fly an agent that steers towards each target, stepping with the same buffers throughout.
+// Each call steps once, restarting the episode from the same initial state once it is over.
+func newFlyingAgentStepper() func() {
+	flyingAgentSystem := NewFlyingAgentSystem()
+	// Thrust towards the target, damped by the agent's velocity
+	agents := []*agent.Agent{agent.NewAgent(mat.NewDense(NUM_ACTIONS, NUM_PERCEPTS, []float64{
+		0, -1, 0, -2, 0, 1,
+		-1, 0, -2, 0, 1, 0,
+	}))}
+	buffers := system.NewStepBuffers(flyingAgentSystem)
+	initialState := flyingAgentSystem.Reset(3)
+	state := initialState.DeepCopyState()
+	return func() {
+		if state.TerminalState {
+			state.StateVector.CopyVec(initialState.StateVector)
+			state.TerminalState = false
+		}
+		system.AdvanceEnvironmentState(flyingAgentSystem, state, agents, buffers)
+	}
+}
+
+// Stepping is the hot path of every simulation, so must not allocate
+func TestFlyingAgentsStepDoesNotAllocate(t *testing.T) {
+	// Enough steps to visit many targets
+	if allocations := testing.AllocsPerRun(10000, newFlyingAgentStepper()); allocations != 0 {
+		t.Errorf("expected no allocations per step, got %v", allocations)
+	}
+}
+
+func BenchmarkFlyingAgentsStep(b *testing.B) {
+	step := newFlyingAgentStepper()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for iteration := 0; iteration < b.N; iteration++ {
+		step()
+	}
+}
+
+// Targets are drawn from the episode's generator as they are visited, so a restored snapshot
+// must capture the generator to visit the same targets as the original
+func TestFlyingAgentsSnapshotCapturesTargets(t *testing.T) {
+	flyingAgentSystem := NewFlyingAgentSystem()
+	agents := []*agent.Agent{agent.NewAgent(mat.NewDense(NUM_ACTIONS, NUM_PERCEPTS, []float64{
+		0, -1, 0, -2, 0, 1,
+		-1, 0, -2, 0, 1, 0,
+	}))}
+	buffers := system.NewStepBuffers(flyingAgentSystem)
+	state := flyingAgentSystem.Reset(3)
+	snapshot, err := system.TakeSnapshot(flyingAgentSystem, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoredState, err := snapshot.Restore(flyingAgentSystem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copiedState := state.DeepCopyState()
+
+	for step := 0; step < 2000 && !state.TerminalState; step++ {
+		system.AdvanceEnvironmentState(flyingAgentSystem, state, agents, buffers)
+		system.AdvanceEnvironmentState(flyingAgentSystem, restoredState, agents, buffers)
+		system.AdvanceEnvironmentState(flyingAgentSystem, copiedState, agents, buffers)
+	}
+	if state.StateVector.AtVec(6) < 2 {
+		t.Fatalf("expected the agent to visit several targets, visited %v", state.StateVector.AtVec(6))
+	}
+	if !mat.Equal(restoredState.StateVector, state.StateVector) || !mat.Equal(copiedState.StateVector, state.StateVector) {
+		t.Errorf("expected the restored and copied states to end as %v, got %v and %v", state.StateVector.RawVector().Data,
+			restoredState.StateVector.RawVector().Data, copiedState.StateVector.RawVector().Data)
+	}
+}
+
+// The schema must describe every element of the state, percepts and actions
+func TestFlyingAgentsSchemaDescribesSystem(t *testing.T) {
+	flyingAgentSystem := NewFlyingAgentSystem()
+	schema := system.SchemaOf(flyingAgentSystem)
+	if err := schema.Check(flyingAgentSystem); err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.State) != STATE_VECTOR_LEN {
+		t.Errorf("expected %v state fields, got %v", STATE_VECTOR_LEN, len(schema.State))
+	}
+}
+
+// Each system must fly by its own parameters
+func TestFlyingAgentsParametersChangePhysics(t *testing.T) {
+	parameters := FlyingAgentParameters{TimeDelta: 0.1, Gravity: 2, FrictionConstant: 0.5, MaxThrust: 1}
+	flyingAgentSystem := NewFlyingAgentSystem().WithParameterValues(parameters.values()).(*FlyingAgentSystem)
+	if flyingAgentSystem.Parameters() != parameters {
+		t.Fatalf("expected the system to have the given parameters, got %+v", flyingAgentSystem.Parameters())
+	}
+	state := flyingAgentSystem.Reset(1)
+	rewards := make([]float64, NUM_AGENTS_PER_SIMULATION)
+	flyingAgentSystem.Step(state, []*mat.VecDense{mat.NewVecDense(NUM_ACTIONS, []float64{10, 10})}, rewards)
+	// Thrust is clipped to 1, gravity pulls down by 2, and friction halves the velocity
+	if velocityX, velocityY := state.StateVector.AtVec(2), state.StateVector.AtVec(3); velocityX != 0.5*0.1*1 || velocityY != 0.5*0.1*(1-2) {
+		t.Errorf("expected a velocity of (0.05, -0.05), got (%v, %v)", velocityX, velocityY)
+	}
+}
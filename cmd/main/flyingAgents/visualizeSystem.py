@@ -5,25 +5,28 @@ import pandas as pd
 import numpy as np
 from GonumMatrixIO import GonumIO
 import argparse
-
-simulationData = pd.read_parquet("data/BestAgentSimulation.pq")
-animationSavePath = "data/animation.mp4"
+import os
 
 GAME_DIMENSION = 1.5*100
 AGENT_RADIUS = 5
 TARGET_LOCATION_RADIUS = 2
 
 parser = argparse.ArgumentParser(description="Flying Agents Argument Parser")
+parser.add_argument("runDirectory", help="The output directory of the run to visualize, e.g. runs/run-20230101-120000")
 parser.add_argument("--save", help="Save animation to file, rather than showing", action="store_true")
 parser.add_argument("--numFrames", help="Determine the number of frames to render. If not given, render the entire simulation", action="store", type=int, default=None)
 args = parser.parse_args()
 
+dataDirectory = os.path.join(args.runDirectory, "data")
+simulationData = pd.read_parquet(os.path.join(dataDirectory, "BestAgentSimulation.pq"))
+animationSavePath = os.path.join(dataDirectory, "animation.mp4")
+
 if args.numFrames == None or args.numFrames > len(simulationData):
     numFrames = len(simulationData)
 else:
     numFrames = args.numFrames
 
-print(f"BEST CHROMOSOME:\n{GonumIO.loadMatrix('data/bestAgentChromosome.bin')}")
+print(f"BEST CHROMOSOME:\n{GonumIO.loadMatrix(os.path.join(dataDirectory, 'bestAgentChromosome.bin'))}")
     
 
 fig, ax = plt.subplots(figsize=(10,10))
@@ -36,13 +39,14 @@ ax.add_patch(agent)
 ax.add_patch(targetLocation)
 
 def update(index):
-    stateVector = simulationData.loc[index, "StateVector"]
-    agentX = stateVector[0]
-    agentY = stateVector[1]
-    agentVelX = stateVector[2]
-    agentVelY = stateVector[3]
-    targetLocationX = stateVector[4]
-    targetLocationY = stateVector[5]
+    # Each element of the state has its own column, named as in the system's schema
+    state = simulationData.loc[index]
+    agentX = state["AgentX"]
+    agentY = state["AgentY"]
+    agentVelX = state["AgentVelX"]
+    agentVelY = state["AgentVelY"]
+    targetLocationX = state["TargetLocationX"]
+    targetLocationY = state["TargetLocationY"]
 
     # xLim = max(GAME_DIMENSION, abs(agentX))
     # yLim = max(GAME_DIMENSION, abs(agentY))
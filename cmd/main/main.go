@@ -1,17 +1,31 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"log"
 	"math"
+	"os"
+	"os/signal"
 	"time"
 
 	"golang.org/x/exp/rand"
 
 	flyingagents "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/flyingAgents"
+	distributed "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Distributed"
 	geneticbreeder "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/GeneticBreeder"
 	manager "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Manager"
 )
 
 func main() {
+	listenAddress := flag.String("listen", "", "if given, serve simulations to workers (see cmd/worker) at this address, e.g. :8080, rather than simulating locally")
+	logFormat := flag.String("logFormat", "text", "format of the log: text or json")
+	showProgressBars := flag.Bool("progress", true, "show progress bars on stderr")
+	metricsAddress := flag.String("metrics", "", "if given, serve Prometheus metrics at this address, e.g. :9090")
+	dashboardAddress := flag.String("dashboard", "", "if given, serve a live dashboard of the run at this address, e.g. :8081")
+	maximumEpisodeLength := flag.Int("maxEpisodeLength", 0, "if positive, truncate every episode after this many steps, rather than at the system's limit")
+	flag.Parse()
+
 	targetSystem := flyingagents.NewFlyingAgentSystem()
 
 	geneticBreeder := geneticbreeder.NewGeneticBreeder(
@@ -20,7 +34,40 @@ func main() {
 		[]float64{0.0, 1.0, 1.0, 1.0},
 		1,
 		math.Pow10(-6))
-	manager := manager.NewManager(targetSystem, 2500, 10, 16, geneticBreeder, true)
-	manager.SimulateManyGenerations(50)
+	managerOptions := []manager.ManagerOption{
+		manager.WithRunName("flyingAgents"),
+		manager.WithProgressBars(*showProgressBars),
+		manager.WithMaximumEpisodeLength(*maximumEpisodeLength),
+	}
+	if *metricsAddress != "" {
+		managerOptions = append(managerOptions, manager.WithMetricsServer(*metricsAddress))
+	}
+	if *dashboardAddress != "" {
+		managerOptions = append(managerOptions, manager.WithDashboard(*dashboardAddress))
+	}
+	switch *logFormat {
+	case "text":
+		managerOptions = append(managerOptions, manager.WithLogFormat(manager.LogFormatText))
+	case "json":
+		managerOptions = append(managerOptions, manager.WithLogFormat(manager.LogFormatJSON))
+	default:
+		log.Fatalf("unknown log format %q", *logFormat)
+	}
+	if *listenAddress != "" {
+		coordinator, err := distributed.NewCoordinator(*listenAddress, targetSystem, 0, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Waiting for workers at %v\n", coordinator.Address())
+		managerOptions = append(managerOptions, manager.WithBatchSimulator(coordinator))
+	}
+	manager := manager.NewManager(targetSystem, 2500, 10, 16, geneticBreeder, true, managerOptions...)
+	// Stop the run gracefully on keyboard interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if _, err := manager.SimulateManyGenerations(ctx, 50); err != nil {
+		log.Println(err)
+	}
 	manager.WriteStop()
 }
@@ -2,6 +2,7 @@ package multiagentsystem
 
 import (
 	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
 	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
 
 	"gonum.org/v1/gonum/mat"
@@ -16,6 +17,10 @@ const (
 type MultiAgentSystem struct {
 }
 
+func init() {
+	system.Register("multiAgent", func() system.System { return &MultiAgentSystem{} })
+}
+
 func (system *MultiAgentSystem) NumPercepts() int {
 	return NUM_PERCEPTS
 }
@@ -26,6 +31,17 @@ func (system *MultiAgentSystem) NumAgentsPerSimulation() int {
 	return NUM_AGENTS_PER_SIMULATION
 }
 
+func (system *MultiAgentSystem) Name() string {
+	return "multiAgent"
+}
+func (system *MultiAgentSystem) Constants() map[string]interface{} {
+	return map[string]interface{}{
+		"NUM_PERCEPTS":              NUM_PERCEPTS,
+		"NUM_ACTIONS":               NUM_ACTIONS,
+		"NUM_AGENTS_PER_SIMULATION": NUM_AGENTS_PER_SIMULATION,
+	}
+}
+
 // Returns the initial state of the system
 //
 // In this case it is very boring - the state is always 1.0 flat across all percepts
@@ -35,24 +51,32 @@ func (system *MultiAgentSystem) InitializeState() *systemstate.SystemState {
 	}
 }
 
-// Defines the behavior of the system
-//
-// This method should take the current system state and agents, find the agent actions,
-// then apply those actions to the state to update it.
-//
-// This method is also responsible for updating the agent scores!
+// The state never changes, so the seed is ignored. See system.Environment
+func (system *MultiAgentSystem) Reset(seed uint64) *systemstate.SystemState {
+	return system.InitializeState()
+}
+
+// Every agent perceives the whole state
+func (system *MultiAgentSystem) Observe(state *systemstate.SystemState, agentIndex int, percepts *mat.VecDense) {
+	percepts.CopyVec(state.StateVector)
+}
+
+// Defines the behavior of the system, see system.Environment
 //
-// The implementation here is very boring - we immediately call the simulation done (terminal = true)
-// and set the score of the agent to the sum of the action vector. Importantly, we do this for EACH AGENT
-func (system *MultiAgentSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
-	agentActions := agent.GetAllAgentActions(agents, state.StateVector)
-	state.TerminalState = true
-	state.StateIndex += 1
-	for agentIndex := range agents {
-		agentScore := 0.0
-		for _, elem := range agentActions[agentIndex].RawVector().Data {
-			agentScore += elem
+// The implementation here is very boring - the simulation is immediately done (terminal = true)
+// and each agent is rewarded with the sum of its action vector. Importantly, we do this for EACH AGENT
+func (system *MultiAgentSystem) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	for agentIndex, action := range actions {
+		rewards[agentIndex] = 0.0
+		for _, elem := range action.RawVector().Data {
+			rewards[agentIndex] += elem
 		}
-		agents[agentIndex].Score += agentScore
 	}
+	return true, false, nil
+}
+
+// Advance the state a single step, by observing the agents' percepts,
+// getting their actions and stepping the system (see Step)
+func (targetSystem *MultiAgentSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
+	system.AdvanceEnvironmentState(targetSystem, state, agents, system.StateStepBuffers(targetSystem, state))
 }
@@ -1,9 +1,12 @@
 package pongsystem
 
 import (
+	"math"
+	"sync"
 	"time"
 
 	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
 	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
 	"github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/utils"
 	"golang.org/x/exp/rand"
@@ -71,15 +74,15 @@ const (
 	// This extends both positive and negative about 0.0
 	GAME_Y_DIMENSION = 0.5
 
-	// Sets how large the agent paddles are
+	// Sets how large the agent paddles are by default, see PongParameters
 	// Note the paddle extends half this amount above and below
 	// the paddle position. Remember the total Y distance is of size 1
 	PADDLE_SIZE = 0.2
 
-	// The velocity cap of the paddle
+	// The default velocity cap of the paddle, see PongParameters
 	MAX_PADDLE_VELOCITY = 1.0
 
-	// The time delta of the system
+	// The default time delta of the system, see PongParameters
 	// Defines how far to step the system physics each advancement
 	TIME_DELTA = 0.01
 
@@ -95,60 +98,240 @@ const (
 
 // Given a velocity vector that is bouncing off a surface (with given normal)
 // update the velocity vector to the velocity after bouncing
-func bounceSpecularly(velocityVector *mat.VecDense, reflectionNormal *mat.VecDense) {
+//
+// This is called on every bounce of every game, so works on arrays rather than allocating vectors and matrices
+func bounceSpecularly(velocityVector *[2]float64, reflectionNormal [2]float64) {
 	// Actually ensure the reflectionNormal is unit
-	reflectionNormal.ScaleVec(1/reflectionNormal.Norm(2), reflectionNormal)
+	normalScale := 1 / euclideanNorm(reflectionNormal)
+	reflectionNormal[0] *= normalScale
+	reflectionNormal[1] *= normalScale
 
 	// Get the unit direction vector of the velocity
-	velocityDirection := mat.VecDenseCopyOf(velocityVector)
-	velocityDirection.ScaleVec(1/velocityVector.Norm(2), velocityVector)
+	speed := euclideanNorm(*velocityVector)
+	directionScale := 1 / speed
+	velocityDirection := [2]float64{velocityVector[0] * directionScale, velocityVector[1] * directionScale}
 
 	// Find the new direction of the velocity after bouncing
 	// See https://en.wikipedia.org/wiki/Specular_reflection#Vector_formulation
-	identityMatrix := mat.NewDiagDense(2, []float64{1, 1})
-	householderTransformationMatrix := mat.NewDense(2, 2, nil)
-	householderTransformationMatrix.RankOne(identityMatrix, -2, reflectionNormal, reflectionNormal)
-	velocityDirection.MulVec(householderTransformationMatrix, velocityDirection)
+	// The Householder transformation is I - 2nn^T
+	var householderTransformationMatrix [2][2]float64
+	for row := range householderTransformationMatrix {
+		for col := range householderTransformationMatrix[row] {
+			if row == col {
+				householderTransformationMatrix[row][col] = 1
+			}
+			householderTransformationMatrix[row][col] += (-2 * reflectionNormal[row]) * reflectionNormal[col]
+		}
+	}
+	var bouncedDirection [2]float64
+	for row := range bouncedDirection {
+		bouncedDirection[row] = householderTransformationMatrix[row][0]*velocityDirection[0] + householderTransformationMatrix[row][1]*velocityDirection[1]
+	}
 
 	// Rescale to correct velocity after bounce
 	// Here is where we could also apply non-elastic collisions...
-	velocityVector.ScaleVec(velocityVector.Norm(2), velocityDirection)
+	velocityVector[0] = speed * bouncedDirection[0]
+	velocityVector[1] = speed * bouncedDirection[1]
+}
+
+// The length of a 2D vector, computed exactly as gonum computes it (scaling to avoid overflow),
+// so games play out the same as they did when bounces were computed with gonum vectors.
+// Slices passed to gonum's assembly routines escape to the heap, so this is done here instead.
+func euclideanNorm(vector [2]float64) float64 {
+	scale := 0.0
+	sumSquares := 1.0
+	for _, value := range vector {
+		if value == 0 {
+			continue
+		}
+		absoluteValue := math.Abs(value)
+		if math.IsNaN(absoluteValue) {
+			return math.NaN()
+		}
+		if scale < absoluteValue {
+			ratio := scale / absoluteValue
+			sumSquares = 1 + sumSquares*ratio*ratio
+			scale = absoluteValue
+		} else {
+			ratio := absoluteValue / scale
+			sumSquares += ratio * ratio
+		}
+	}
+	if math.IsInf(scale, 1) {
+		return math.Inf(1)
+	}
+	return scale * math.Sqrt(sumSquares)
+}
+
+// The physical parameters of a game of pong. Each system has its own (see NewPongSystemWithParameters),
+// so that agents can be evolved against many variations of the game rather than a single one.
+type PongParameters struct {
+	// How large the agent paddles are, see PADDLE_SIZE
+	PaddleSize float64
+
+	// The velocity cap of the paddles, see MAX_PADDLE_VELOCITY
+	MaxPaddleVelocity float64
+
+	// How far to step the system physics each advancement, see TIME_DELTA
+	TimeDelta float64
+}
+
+// The parameters of the game as it has always been played, given by the constants above
+func DefaultPongParameters() PongParameters {
+	return PongParameters{
+		PaddleSize:        PADDLE_SIZE,
+		MaxPaddleVelocity: MAX_PADDLE_VELOCITY,
+		TimeDelta:         TIME_DELTA,
+	}
+}
+
+// Describes each parameter, in the order of the PongParameters fields, see system.ParameterizedEnvironment
+func pongParameterFields() []system.Field {
+	return []system.Field{
+		{Name: "PaddleSize", Unit: "units", Minimum: 0, Maximum: 2 * GAME_Y_DIMENSION},
+		{Name: "MaxPaddleVelocity", Unit: "units/s", Minimum: 0, Maximum: math.Inf(1)},
+		{Name: "TimeDelta", Unit: "s", Minimum: 0, Maximum: math.Inf(1)},
+	}
+}
+
+// The value of each parameter, in the order of the fields
+func (parameters PongParameters) values() []float64 {
+	return []float64{parameters.PaddleSize, parameters.MaxPaddleVelocity, parameters.TimeDelta}
 }
 
 type PongSystem struct {
-	randomGenerator *rand.Rand
+	parameters PongParameters
+
+	// Only used to seed each episode when none is given, see InitializeState
+	randomGenerator      *rand.Rand
+	randomSource         *rand.PCGSource
+	randomGeneratorMutex sync.Mutex
 }
 
+// Create a system playing pong with the default parameters, see DefaultPongParameters
 func NewPongSystem() *PongSystem {
-	randomGenerator := rand.New(rand.NewSource(uint64(time.Now().Nanosecond())))
+	return NewPongSystemWithParameters(DefaultPongParameters())
+}
+
+// Create a system playing pong with the given parameters. Panics if any parameter is out of its bounds
+// (see system.ParameterizedEnvironment).
+func NewPongSystemWithParameters(parameters PongParameters) *PongSystem {
+	system.CheckParameterValues(pongParameterFields(), parameters.values())
+	randomSource := &rand.PCGSource{}
+	randomSource.Seed(uint64(time.Now().Nanosecond()))
 
 	return &PongSystem{
-		randomGenerator: randomGenerator,
+		parameters:      parameters,
+		randomGenerator: rand.New(randomSource),
+		randomSource:    randomSource,
 	}
 }
 
-func (system *PongSystem) NumPercepts() int {
+func init() {
+	system.Register("pong", func() system.System { return NewPongSystem() })
+}
+
+func (pongSystem *PongSystem) NumPercepts() int {
 	return NUM_PERCEPTS
 }
-func (system *PongSystem) NumActions() int {
+func (pongSystem *PongSystem) NumActions() int {
 	return NUM_ACTIONS
 }
-func (system *PongSystem) NumAgentsPerSimulation() int {
+func (pongSystem *PongSystem) NumAgentsPerSimulation() int {
 	return NUM_AGENTS_PER_SIMULATION
 }
 
-// Returns the initial state of the system
-func (system *PongSystem) InitializeState() *systemstate.SystemState {
+func (pongSystem *PongSystem) Name() string {
+	return "pong"
+}
+
+// The constants of the system, with the parameters being those of this system rather than the defaults
+func (pongSystem *PongSystem) Constants() map[string]interface{} {
+	return map[string]interface{}{
+		"GAME_X_DIMENSION":    GAME_X_DIMENSION,
+		"GAME_Y_DIMENSION":    GAME_Y_DIMENSION,
+		"PADDLE_SIZE":         pongSystem.parameters.PaddleSize,
+		"MAX_PADDLE_VELOCITY": pongSystem.parameters.MaxPaddleVelocity,
+		"TIME_DELTA":          pongSystem.parameters.TimeDelta,
+		"SCORING_SCORE":       SCORING_SCORE,
+		"BOUNCE_SCORE":        BOUNCE_SCORE,
+		"READY_SCORE":         READY_SCORE,
+	}
+}
+
+// Names the elements of the state, percept and action vectors, see system.SchemaSystem.
+// Distances are in the units of the game area, which spans GAME_X_DIMENSION either side of the centre.
+func (pongSystem *PongSystem) Schema() system.Schema {
+	return system.Schema{
+		State: []system.Field{
+			{Name: "BallX", Unit: "units", Minimum: -GAME_X_DIMENSION, Maximum: GAME_X_DIMENSION},
+			{Name: "BallY", Unit: "units", Minimum: -GAME_Y_DIMENSION, Maximum: GAME_Y_DIMENSION},
+			system.UnboundedField("BallXVelocity", "units/s"),
+			system.UnboundedField("BallYVelocity", "units/s"),
+			{Name: "Paddle0Position", Unit: "units", Minimum: -GAME_Y_DIMENSION, Maximum: GAME_Y_DIMENSION},
+			{Name: "Paddle1Position", Unit: "units", Minimum: -GAME_Y_DIMENSION, Maximum: GAME_Y_DIMENSION},
+		},
+		// Each agent sees the game as if it is playing on the left, see Observe
+		Percepts: []system.Field{
+			{Name: "BallX", Unit: "units", Minimum: -GAME_X_DIMENSION, Maximum: GAME_X_DIMENSION},
+			{Name: "BallY", Unit: "units", Minimum: -GAME_Y_DIMENSION, Maximum: GAME_Y_DIMENSION},
+			system.UnboundedField("BallXVelocity", "units/s"),
+			system.UnboundedField("BallYVelocity", "units/s"),
+			{Name: "PaddlePosition", Unit: "units", Minimum: -GAME_Y_DIMENSION, Maximum: GAME_Y_DIMENSION},
+		},
+		// Paddle velocities beyond the cap are clipped
+		Actions: []system.Field{
+			{Name: "PaddleVelocity", Unit: "units/s", Minimum: -pongSystem.parameters.MaxPaddleVelocity, Maximum: pongSystem.parameters.MaxPaddleVelocity},
+		},
+	}
+}
+
+// The parameters of the system, see NewPongSystemWithParameters
+func (pongSystem *PongSystem) Parameters() PongParameters {
+	return pongSystem.parameters
+}
+
+// Describes each parameter, in the order of the PongParameters fields, see system.ParameterizedEnvironment
+func (pongSystem *PongSystem) ParameterFields() []system.Field {
+	return pongParameterFields()
+}
+
+// The value of each parameter, in the order of the PongParameters fields, see system.ParameterizedEnvironment
+func (pongSystem *PongSystem) ParameterValues() []float64 {
+	return pongSystem.parameters.values()
+}
+
+// Create a new system with the given value of each parameter, see system.ParameterizedEnvironment
+func (pongSystem *PongSystem) WithParameterValues(values []float64) system.ParameterizedEnvironment {
+	system.CheckParameterValues(pongParameterFields(), values)
+	return NewPongSystemWithParameters(PongParameters{
+		PaddleSize:        values[0],
+		MaxPaddleVelocity: values[1],
+		TimeDelta:         values[2],
+	})
+}
+
+// Returns the initial state of the system, with an episode seed drawn from the system's own generator
+func (pongSystem *PongSystem) InitializeState() *systemstate.SystemState {
+	// Simulations run concurrently, so the shared generator must be locked
+	pongSystem.randomGeneratorMutex.Lock()
+	episodeSeed := pongSystem.randomGenerator.Uint64()
+	pongSystem.randomGeneratorMutex.Unlock()
+	return systemstate.NewSeededState(episodeSeed, pongSystem.InitializeSeededState)
+}
+
+// Returns the initial state of the system, drawing the random ball position and velocity from randomGenerator
+func (pongSystem *PongSystem) InitializeSeededState(randomGenerator *rand.Rand) *systemstate.SystemState {
 	// Ball always starts exactly halfway between agents
 	ballX := 0.0
 	// Ball starts at random Y position
-	ballY := (2*system.randomGenerator.Float64() - 1) * GAME_Y_DIMENSION
+	ballY := (2*randomGenerator.Float64() - 1) * GAME_Y_DIMENSION
 	// Ball has some random initial velocity in both Y direction [-1.5,-0.5] U [0.5,1.5]
-	ballYVelocity := (0.5 * (system.randomGenerator.Float64() + 1)) * GAME_Y_DIMENSION
+	ballYVelocity := (0.5 * (randomGenerator.Float64() + 1)) * GAME_Y_DIMENSION
 	// Ball has a larger velocity in the X direction, and is randomly set to
 	// either positive or negative X direction [-1.5,-0.5] U [0.5,1.5]
-	ballXVelocity := (0.5 * (system.randomGenerator.Float64() + 1)) * GAME_X_DIMENSION
-	if system.randomGenerator.NormFloat64() < 0 {
+	ballXVelocity := (0.5 * (randomGenerator.Float64() + 1)) * GAME_X_DIMENSION
+	if randomGenerator.NormFloat64() < 0 {
 		ballXVelocity *= -1
 	}
 	// Paddles start in neutral position
@@ -163,123 +346,202 @@ func (system *PongSystem) InitializeState() *systemstate.SystemState {
 			paddle0Position,
 			paddle1Position,
 		}),
-		TerminalState: false,
+		TerminalState:   false,
+		RandomGenerator: randomGenerator,
 	}
 }
 
-// Defines the behavior of the system
-//
-// This method should take the current system state and agents, find the agent actions,
-// then apply those actions to the state to update it.
-//
-// This method is also responsible for updating the agent scores!
-//
-// The implementation here is very boring - we immediately call the simulation done (terminal = true)
-// and set the score of the agent to the sum of the action vector.
-func (system *PongSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
-	// Get the data out of the state
+// Returns the initial state of an episode seeded by the given seed, see system.Environment
+func (pongSystem *PongSystem) Reset(seed uint64) *systemstate.SystemState {
+	return systemstate.NewSeededState(seed, pongSystem.InitializeSeededState)
+}
+
+// Captures the position of the generator seeding new episodes, see system.SnapshottableSystem
+func (pongSystem *PongSystem) SnapshotSystem() ([]byte, error) {
+	pongSystem.randomGeneratorMutex.Lock()
+	defer pongSystem.randomGeneratorMutex.Unlock()
+	return pongSystem.randomSource.MarshalBinary()
+}
+
+// Returns the generator seeding new episodes to a position captured by SnapshotSystem, see system.SnapshottableSystem
+func (pongSystem *PongSystem) RestoreSystem(data []byte) error {
+	pongSystem.randomGeneratorMutex.Lock()
+	defer pongSystem.randomGeneratorMutex.Unlock()
+	return pongSystem.randomSource.UnmarshalBinary(data)
+}
+
+// Writes the percepts of the given agent, see system.Environment
+func (pongSystem *PongSystem) Observe(state *systemstate.SystemState, agentIndex int, percepts *mat.VecDense) {
 	ballX := state.StateVector.AtVec(0)
 	ballY := state.StateVector.AtVec(1)
 	ballXVelocity := state.StateVector.AtVec(2)
 	ballYVelocity := state.StateVector.AtVec(3)
-	paddle0Position := state.StateVector.AtVec(4)
-	paddle1Position := state.StateVector.AtVec(5)
-
-	// Create the percept vectors
-	agent0PerceptVector := mat.NewVecDense(NUM_PERCEPTS, []float64{
-		ballX,
-		ballY,
-		ballXVelocity,
-		ballYVelocity,
-		paddle0Position,
-	})
+	paddlePosition := state.StateVector.AtVec(4 + agentIndex)
 
 	// Because the system is entirely symmetric on the X axis we can pass
 	// The inverse state to agent1 and ensure that all agents
 	// are always playing on the "left"
-	agent1PerceptVector := mat.NewVecDense(NUM_PERCEPTS, []float64{
-		-1.0 * ballX,
-		ballY,
-		-1.0 * ballXVelocity,
-		ballYVelocity,
-		paddle1Position,
-	})
+	if agentIndex == 1 {
+		ballX *= -1.0
+		ballXVelocity *= -1.0
+	}
+	percepts.SetVec(0, ballX)
+	percepts.SetVec(1, ballY)
+	percepts.SetVec(2, ballXVelocity)
+	percepts.SetVec(3, ballYVelocity)
+	percepts.SetVec(4, paddlePosition)
+}
+
+// Defines the behavior of the system
+//
+// The paddles are moved with the velocities given by the agents' actions, and the ball is moved and bounced.
+// Each agent is rewarded for having its paddle in front of the ball, and the episode ends once either agent scores.
+// Pong episodes are never truncated.
+func (pongSystem *PongSystem) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	var stateData [STATE_VECTOR_LEN]float64
+	for stateIndex := range stateData {
+		stateData[stateIndex] = state.StateVector.AtVec(stateIndex)
+	}
+	stepRewards, scoringAgent := pongSystem.parameters.stepPong(&stateData, actions[0].AtVec(0), actions[1].AtVec(0))
+	for stateIndex, value := range stateData {
+		state.StateVector.SetVec(stateIndex, value)
+	}
+	copy(rewards, stepRewards[:])
+
+	if scoringAgent >= 0 {
+		return true, false, scoringInfo[scoringAgent]
+	}
+	return false, false, nil
+}
 
-	// Get agent actions
-	agent0Action := agents[0].GetAction(agent0PerceptVector)
-	agent1Action := agents[1].GetAction(agent1PerceptVector)
+// The info of a step in which each agent scored, made once so that stepping does not allocate
+var scoringInfo = [NUM_AGENTS_PER_SIMULATION]system.StepInfo{
+	{"scoringAgent": 0},
+	{"scoringAgent": 1},
+}
 
-	paddle0Velocity := agent0Action.AtVec(0)
-	paddle1Velocity := agent1Action.AtVec(0)
+// Advance a single game of pong, whose state vector is given, a single step with the given paddle velocities.
+// Returns the reward of each agent, and the index of the agent that scored (or -1 if neither did, and the game goes on).
+//
+// This is shared by Step and StepBatch, so a game plays out exactly the same whether simulated alone or in a batch.
+func (parameters PongParameters) stepPong(stateData *[STATE_VECTOR_LEN]float64, paddle0Velocity float64, paddle1Velocity float64) ([NUM_AGENTS_PER_SIMULATION]float64, int) {
+	var rewards [NUM_AGENTS_PER_SIMULATION]float64
+
+	// Get the data out of the state
+	ballX := stateData[0]
+	ballY := stateData[1]
+	ballXVelocity := stateData[2]
+	ballYVelocity := stateData[3]
+	paddle0Position := stateData[4]
+	paddle1Position := stateData[5]
 
 	// Check if ball is "scored"
 	if ballX >= 1.0 {
-		agents[0].Score += SCORING_SCORE
-		state.TerminalState = true
-		return
+		rewards[0] += SCORING_SCORE
+		return rewards, 0
 	}
 
 	if ballX <= -1.0 {
-		agents[1].Score += SCORING_SCORE
-		state.TerminalState = true
-		return
+		rewards[1] += SCORING_SCORE
+		return rewards, 1
 	}
 
 	// Update the objects in the system
-	ballPosition := mat.NewVecDense(2, []float64{ballX, ballY})
-	ballVelocity := mat.NewVecDense(2, []float64{ballXVelocity, ballYVelocity})
-	ballPosition.AddScaledVec(ballPosition, TIME_DELTA, ballVelocity)
-	ballX = ballPosition.AtVec(0)
-	ballY = ballPosition.AtVec(1)
+	ballVelocity := [2]float64{ballXVelocity, ballYVelocity}
+	ballX += parameters.TimeDelta * ballXVelocity
+	ballY += parameters.TimeDelta * ballYVelocity
 
-	paddle0Velocity = utils.ClipToBounds(paddle0Velocity, -MAX_PADDLE_VELOCITY, MAX_PADDLE_VELOCITY)
-	paddle1Velocity = utils.ClipToBounds(paddle1Velocity, -MAX_PADDLE_VELOCITY, MAX_PADDLE_VELOCITY)
-	paddle0Position = utils.ClipToBounds(paddle0Position+TIME_DELTA*paddle0Velocity, -GAME_Y_DIMENSION, GAME_Y_DIMENSION)
-	paddle1Position = utils.ClipToBounds(paddle1Position+TIME_DELTA*paddle1Velocity, -GAME_Y_DIMENSION, GAME_Y_DIMENSION)
+	paddle0Velocity = utils.ClipToBounds(paddle0Velocity, -parameters.MaxPaddleVelocity, parameters.MaxPaddleVelocity)
+	paddle1Velocity = utils.ClipToBounds(paddle1Velocity, -parameters.MaxPaddleVelocity, parameters.MaxPaddleVelocity)
+	paddle0Position = utils.ClipToBounds(paddle0Position+parameters.TimeDelta*paddle0Velocity, -GAME_Y_DIMENSION, GAME_Y_DIMENSION)
+	paddle1Position = utils.ClipToBounds(paddle1Position+parameters.TimeDelta*paddle1Velocity, -GAME_Y_DIMENSION, GAME_Y_DIMENSION)
 
 	// Reflect ball off bottom wall
 	if ballY <= -0.5 {
-		bounceSpecularly(ballVelocity, mat.NewVecDense(2, []float64{0.0, 1.0}))
+		bounceSpecularly(&ballVelocity, [2]float64{0.0, 1.0})
 	}
 	// Reflect ball off top wall
 	if ballY >= 0.5 {
-		bounceSpecularly(ballVelocity, mat.NewVecDense(2, []float64{0.0, -1.0}))
+		bounceSpecularly(&ballVelocity, [2]float64{0.0, -1.0})
 	}
 	// Reflect ball off left paddle if and only if paddle0 is in the way
-	if ballX <= -1.0 && (paddle0Position-PADDLE_SIZE < ballY && ballY < paddle0Position+PADDLE_SIZE) {
-		bounceSpecularly(ballVelocity, mat.NewVecDense(2, []float64{1.0, 0.0}))
-		agents[0].Score += BOUNCE_SCORE
+	if ballX <= -1.0 && (paddle0Position-parameters.PaddleSize < ballY && ballY < paddle0Position+parameters.PaddleSize) {
+		bounceSpecularly(&ballVelocity, [2]float64{1.0, 0.0})
+		rewards[0] += BOUNCE_SCORE
 		ballX = -0.9
 	}
 	// Reflect ball off right paddle if and only if paddle1 is in the way
-	if ballX >= 1.0 && (paddle1Position-PADDLE_SIZE < ballY && ballY < paddle1Position+PADDLE_SIZE) {
-		bounceSpecularly(ballVelocity, mat.NewVecDense(2, []float64{-1.0, 0.0}))
-		agents[1].Score += BOUNCE_SCORE
+	if ballX >= 1.0 && (paddle1Position-parameters.PaddleSize < ballY && ballY < paddle1Position+parameters.PaddleSize) {
+		bounceSpecularly(&ballVelocity, [2]float64{-1.0, 0.0})
+		rewards[1] += BOUNCE_SCORE
 		ballX = 0.9
 	}
 
-	ballXVelocity = ballVelocity.AtVec(0)
-	ballYVelocity = ballVelocity.AtVec(1)
+	ballXVelocity = ballVelocity[0]
+	ballYVelocity = ballVelocity[1]
 
 	// Check if agent has paddle in front of ball
-	if paddle0Position-PADDLE_SIZE < ballY && ballY < paddle0Position+PADDLE_SIZE {
-		agents[0].Score += READY_SCORE
+	if paddle0Position-parameters.PaddleSize < ballY && ballY < paddle0Position+parameters.PaddleSize {
+		rewards[0] += READY_SCORE
 	}
-	if paddle1Position-PADDLE_SIZE < ballY && ballY < paddle1Position+PADDLE_SIZE {
-		agents[1].Score += READY_SCORE
+	if paddle1Position-parameters.PaddleSize < ballY && ballY < paddle1Position+parameters.PaddleSize {
+		rewards[1] += READY_SCORE
 	}
 
 	ballX = utils.ClipToBounds(ballX, -GAME_X_DIMENSION, GAME_X_DIMENSION)
 	ballY = utils.ClipToBounds(ballY, -GAME_Y_DIMENSION, GAME_Y_DIMENSION)
 
 	// Update the state with new data
-	state.StateIndex += 1
-	state.StateVector.SetVec(0, ballX)
-	state.StateVector.SetVec(1, ballY)
-	state.StateVector.SetVec(2, ballXVelocity)
-	state.StateVector.SetVec(3, ballYVelocity)
-	state.StateVector.SetVec(4, paddle0Position)
-	state.StateVector.SetVec(5, paddle1Position)
-
-	// fmt.Printf("%v %v\n", state.TerminalState, mat.Formatted(state.StateVector.T(), mat.Squeeze()))
+	stateData[0] = ballX
+	stateData[1] = ballY
+	stateData[2] = ballXVelocity
+	stateData[3] = ballYVelocity
+	stateData[4] = paddle0Position
+	stateData[5] = paddle1Position
+	return rewards, -1
+}
+
+// Returns the initial states of a batch of games, see system.BatchedSystem
+func (pongSystem *PongSystem) InitializeBatchState(randomGenerators []*rand.Rand) *systemstate.BatchState {
+	return system.InitializeBatchStateFromEpisodes(pongSystem, randomGenerators)
+}
+
+// Writes the percepts of the given agent in every unfinished game, as Observe does for a single game
+func (pongSystem *PongSystem) ObserveBatch(batch *systemstate.BatchState, agentIndex int, percepts *mat.Dense) {
+	// Agent 1 sees the game mirrored, as in Observe
+	mirror := 1.0
+	if agentIndex == 1 {
+		mirror = -1.0
+	}
+	for episodeIndex, terminal := range batch.TerminalMask {
+		if terminal {
+			continue
+		}
+		stateRow := batch.StateMatrix.RawRowView(episodeIndex)
+		perceptRow := percepts.RawRowView(episodeIndex)
+		perceptRow[0] = mirror * stateRow[0]
+		perceptRow[1] = stateRow[1]
+		perceptRow[2] = mirror * stateRow[2]
+		perceptRow[3] = stateRow[3]
+		perceptRow[4] = stateRow[4+agentIndex]
+	}
+}
+
+// Advances every unfinished game a single step, as Step does for a single game
+func (pongSystem *PongSystem) StepBatch(batch *systemstate.BatchState, actions []*mat.Dense, rewards *mat.Dense) {
+	for episodeIndex, terminal := range batch.TerminalMask {
+		if terminal {
+			continue
+		}
+		stateData := (*[STATE_VECTOR_LEN]float64)(batch.StateMatrix.RawRowView(episodeIndex))
+		episodeRewards, scoringAgent := pongSystem.parameters.stepPong(stateData, actions[0].At(episodeIndex, 0), actions[1].At(episodeIndex, 0))
+		copy(rewards.RawRowView(episodeIndex), episodeRewards[:])
+		batch.TerminalMask[episodeIndex] = scoringAgent >= 0
+	}
+}
+
+// Advance the state a single step, by observing the agents' percepts,
+// getting their actions and stepping the system (see Step)
+func (pongSystem *PongSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
+	system.AdvanceEnvironmentState(pongSystem, state, agents, system.StateStepBuffers(pongSystem, state))
 }
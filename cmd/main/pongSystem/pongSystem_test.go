@@ -0,0 +1,328 @@
+package pongsystem
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	simulator "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Simulator"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Both agents must see the game as if they are playing on the left
+func TestPongObservationsAreMirrored(t *testing.T) {
+	pongSystem := NewPongSystem()
+	state := pongSystem.Reset(1)
+	state.StateVector.SetVec(4, 0.1)
+	state.StateVector.SetVec(5, -0.2)
+
+	agent0Percepts := mat.NewVecDense(NUM_PERCEPTS, nil)
+	agent1Percepts := mat.NewVecDense(NUM_PERCEPTS, nil)
+	pongSystem.Observe(state, 0, agent0Percepts)
+	pongSystem.Observe(state, 1, agent1Percepts)
+	if agent0Percepts.AtVec(0) != -agent1Percepts.AtVec(0) || agent0Percepts.AtVec(2) != -agent1Percepts.AtVec(2) {
+		t.Errorf("expected the ball X position and velocity to be mirrored, got %v and %v", agent0Percepts.RawVector().Data, agent1Percepts.RawVector().Data)
+	}
+	if agent0Percepts.AtVec(4) != 0.1 || agent1Percepts.AtVec(4) != -0.2 {
+		t.Errorf("expected each agent to see its own paddle, got %v and %v", agent0Percepts.AtVec(4), agent1Percepts.AtVec(4))
+	}
+}
+
+// Simulating pong through the environment adapter must be reproducible from the seed alone
+func TestPongEnvironmentIsReproducible(t *testing.T) {
+	environmentSystem := system.NewEnvironmentSystem(NewPongSystem())
+	for seed := uint64(0); seed < 20; seed++ {
+		agents := []*agent.Agent{
+			agent.NewRandomGaussianAgent(NUM_ACTIONS, NUM_PERCEPTS),
+			agent.NewRandomGaussianAgent(NUM_ACTIONS, NUM_PERCEPTS),
+		}
+		agentCopies := []*agent.Agent{
+			agent.NewAgent(mat.DenseCopyOf(agents[0].Chromosome)),
+			agent.NewAgent(mat.DenseCopyOf(agents[1].Chromosome)),
+		}
+
+		result := simulator.SimulateSystemWithSeed(context.Background(), environmentSystem, agents, seed)
+		repeatResult := simulator.SimulateSystemWithSeed(context.Background(), environmentSystem, agentCopies, seed)
+		if result.TerminalReason != simulator.TerminalReasonTerminal {
+			t.Errorf("seed %v: expected the episode to end with a point scored, got %v", seed, result.TerminalReason)
+		}
+		if result.EpisodeLength != repeatResult.EpisodeLength || result.Returns[0] != repeatResult.Returns[0] || result.Returns[1] != repeatResult.Returns[1] {
+			t.Errorf("seed %v: ran %v steps with returns %v, then %v steps with returns %v", seed,
+				result.EpisodeLength, result.Returns, repeatResult.EpisodeLength, repeatResult.Returns)
+		}
+	}
+}
+
+// Create seeded jobs in which the first agent of every job is the same, and the second is new to each job
+func newPongJobs(numJobs int) []simulator.SimulationJob {
+	sharedAgent := agent.NewRandomGaussianAgent(NUM_ACTIONS, NUM_PERCEPTS)
+	jobs := make([]simulator.SimulationJob, numJobs)
+	for jobIndex := range jobs {
+		jobs[jobIndex] = simulator.SimulationJob{
+			Agents: []*agent.Agent{sharedAgent, agent.NewRandomGaussianAgent(NUM_ACTIONS, NUM_PERCEPTS)},
+			Seed:   uint64(jobIndex),
+			Seeded: true,
+		}
+	}
+	return jobs
+}
+
+// Games simulated in lockstep must play out exactly as they do alone
+func TestPongLockstepMatchesSequential(t *testing.T) {
+	pongSystem := NewPongSystem()
+	jobs := newPongJobs(50)
+	results := simulator.SimulateBatchInLockstep(context.Background(), pongSystem, jobs)
+	for jobIndex, job := range jobs {
+		agentCopies := []*agent.Agent{agent.NewAgent(job.Agents[0].Chromosome), agent.NewAgent(job.Agents[1].Chromosome)}
+		sequentialResult := simulator.SimulateSystemWithSeed(context.Background(), pongSystem, agentCopies, job.Seed)
+		if results[jobIndex].EpisodeLength != sequentialResult.EpisodeLength || results[jobIndex].TerminalReason != sequentialResult.TerminalReason ||
+			results[jobIndex].Returns[0] != sequentialResult.Returns[0] || results[jobIndex].Returns[1] != sequentialResult.Returns[1] {
+			t.Errorf("job %v: lockstep ran %v steps (%v) with returns %v, sequential ran %v steps (%v) with returns %v", jobIndex,
+				results[jobIndex].EpisodeLength, results[jobIndex].TerminalReason, results[jobIndex].Returns,
+				sequentialResult.EpisodeLength, sequentialResult.TerminalReason, sequentialResult.Returns)
+		}
+	}
+	if len(jobs[0].Agents[0].EpisodeReturns) != len(jobs) {
+		t.Errorf("expected the shared agent to record %v returns, got %v", len(jobs), len(jobs[0].Agents[0].EpisodeReturns))
+	}
+}
+
+func BenchmarkPongSequential(b *testing.B) {
+	pongSystem := NewPongSystem()
+	jobs := newPongJobs(64)
+	b.ResetTimer()
+	for iteration := 0; iteration < b.N; iteration++ {
+		for _, job := range jobs {
+			simulator.SimulateSystemWithSeed(context.Background(), pongSystem, job.Agents, job.Seed)
+		}
+	}
+}
+
+func BenchmarkPongLockstep(b *testing.B) {
+	pongSystem := NewPongSystem()
+	jobs := newPongJobs(64)
+	b.ResetTimer()
+	for iteration := 0; iteration < b.N; iteration++ {
+		simulator.SimulateBatchInLockstep(context.Background(), pongSystem, jobs)
+	}
+}
+
+// Play games of pong with random agents, stepping with the same buffers throughout.
+// Each call steps once, restarting the game from the same initial state once it is over.
+func newPongStepper() func() {
+	pongSystem := NewPongSystem()
+	agents := []*agent.Agent{
+		agent.NewRandomGaussianAgent(NUM_ACTIONS, NUM_PERCEPTS),
+		agent.NewRandomGaussianAgent(NUM_ACTIONS, NUM_PERCEPTS),
+	}
+	buffers := system.NewStepBuffers(pongSystem)
+	initialState := pongSystem.Reset(3)
+	state := initialState.DeepCopyState()
+	return func() {
+		if state.TerminalState {
+			state.StateVector.CopyVec(initialState.StateVector)
+			state.TerminalState = false
+		}
+		system.AdvanceEnvironmentState(pongSystem, state, agents, buffers)
+	}
+}
+
+// Stepping is the hot path of every simulation, so must not allocate
+func TestPongStepDoesNotAllocate(t *testing.T) {
+	// Enough steps for many games, with bounces off the walls and paddles
+	if allocations := testing.AllocsPerRun(10000, newPongStepper()); allocations != 0 {
+		t.Errorf("expected no allocations per step, got %v", allocations)
+	}
+}
+
+func BenchmarkPongStep(b *testing.B) {
+	step := newPongStepper()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for iteration := 0; iteration < b.N; iteration++ {
+		step()
+	}
+}
+
+// A recorded game must replay exactly, even once saved and read back, and any tampering must be caught
+func TestPongRecordingReplaysExactly(t *testing.T) {
+	pongSystem := NewPongSystem()
+	agents := []*agent.Agent{
+		agent.NewRandomGaussianAgent(NUM_ACTIONS, NUM_PERCEPTS),
+		agent.NewRandomGaussianAgent(NUM_ACTIONS, NUM_PERCEPTS),
+	}
+	recording, result := simulator.RecordEpisode(context.Background(), pongSystem, simulator.SimulationJob{Agents: agents, Seed: 11, Seeded: true})
+
+	// Recording must not change how the game plays out
+	agentCopies := []*agent.Agent{agent.NewAgent(agents[0].Chromosome), agent.NewAgent(agents[1].Chromosome)}
+	unrecordedResult := simulator.SimulateSystemWithSeed(context.Background(), pongSystem, agentCopies, 11)
+	if result.EpisodeLength != unrecordedResult.EpisodeLength || result.Returns[0] != unrecordedResult.Returns[0] || result.Returns[1] != unrecordedResult.Returns[1] {
+		t.Fatalf("recorded game ran %v steps with returns %v, unrecorded game ran %v steps with returns %v",
+			result.EpisodeLength, result.Returns, unrecordedResult.EpisodeLength, unrecordedResult.Returns)
+	}
+	if len(recording.Steps) != result.EpisodeLength || len(recording.Steps[0].Actions) != NUM_AGENTS_PER_SIMULATION {
+		t.Fatalf("expected %v steps with the actions of both agents, got %v steps", result.EpisodeLength, len(recording.Steps))
+	}
+
+	recordingFilePath := filepath.Join(t.TempDir(), "episode.gob")
+	if err := recording.WriteFile(recordingFilePath); err != nil {
+		t.Fatal(err)
+	}
+	readRecording, err := simulator.ReadEpisodeRecording(recordingFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := simulator.ReplayEpisode(context.Background(), pongSystem, readRecording); err != nil {
+		t.Errorf("expected the replay to match, got %v", err)
+	}
+
+	readRecording.Steps[5].Rewards[1] += 1.0
+	_, err = simulator.ReplayEpisode(context.Background(), pongSystem, readRecording)
+	var mismatchError *simulator.ReplayMismatchError
+	if !errors.As(err, &mismatchError) || mismatchError.StepIndex != 5 || mismatchError.Quantity != "Rewards" {
+		t.Errorf("expected a mismatch in the rewards of step 5, got %v", err)
+	}
+}
+
+// Play a game of pong to the end from the given state, with agent 0's first action replaced by firstAction
+// if it is given, returning the return of each agent from the state onwards and the final state index
+func playPongFrom(pongSystem *PongSystem, state *systemstate.SystemState, agents []*agent.Agent, firstAction *float64) ([]float64, int) {
+	buffers := system.NewStepBuffers(pongSystem)
+	returns := make([]float64, len(agents))
+	for !state.TerminalState {
+		for agentIndex, pongAgent := range agents {
+			pongSystem.Observe(state, agentIndex, buffers.Percepts[agentIndex])
+			pongAgent.GetActionInto(buffers.Percepts[agentIndex], buffers.Actions[agentIndex])
+		}
+		if firstAction != nil {
+			buffers.Actions[0].SetVec(0, *firstAction)
+			firstAction = nil
+		}
+		terminal, truncated, _ := pongSystem.Step(state, buffers.Actions, buffers.Rewards)
+		for agentIndex := range returns {
+			returns[agentIndex] += buffers.Rewards[agentIndex]
+		}
+		state.StateIndex += 1
+		state.TerminalState = terminal || truncated
+	}
+	return returns, state.StateIndex
+}
+
+// A snapshot taken part way through a game must fork it: every restored state plays out exactly as the
+// original does, independently of the others, so the difference made by a single paddle move can be measured
+func TestPongSnapshotForksGame(t *testing.T) {
+	pongSystem := NewPongSystem()
+	// Both agents follow the ball with their paddles, and agent 1 sluggishly, so the game is the same every run.
+	// In the game of this seed, a single move of paddle 0 the other way at step 20 changes agent 0's return.
+	agents := []*agent.Agent{
+		agent.NewAgent(mat.NewDense(NUM_ACTIONS, NUM_PERCEPTS, []float64{0, 1, 0, 0, -1})),
+		agent.NewAgent(mat.NewDense(NUM_ACTIONS, NUM_PERCEPTS, []float64{0, 0.5, 0, 0, -0.5})),
+	}
+	state := pongSystem.Reset(8)
+	buffers := system.NewStepBuffers(pongSystem)
+	for step := 0; step < 20; step++ {
+		system.AdvanceEnvironmentState(pongSystem, state, agents, buffers)
+	}
+	if state.TerminalState {
+		t.Fatal("expected the game to still be going after 20 steps")
+	}
+
+	snapshot, err := system.TakeSnapshot(pongSystem, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextSeedStates := []*systemstate.SystemState{pongSystem.InitializeState(), pongSystem.InitializeState()}
+	returns, finalStateIndex := playPongFrom(pongSystem, state, agents, nil)
+
+	for fork := 0; fork < 2; fork++ {
+		forkedState, err := snapshot.Restore(pongSystem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forkedReturns, forkedFinalStateIndex := playPongFrom(pongSystem, forkedState, agents, nil)
+		if forkedFinalStateIndex != finalStateIndex || forkedReturns[0] != returns[0] || forkedReturns[1] != returns[1] {
+			t.Errorf("fork %v: ended at step %v with returns %v, but the original ended at step %v with returns %v",
+				fork, forkedFinalStateIndex, forkedReturns, finalStateIndex, returns)
+		}
+	}
+
+	// Restoring also returns the system's own generator to where it was, so the same episodes come next
+	if _, err := snapshot.Restore(pongSystem); err != nil {
+		t.Fatal(err)
+	}
+	for _, nextSeedState := range nextSeedStates {
+		if restoredState := pongSystem.InitializeState(); !mat.Equal(restoredState.StateVector, nextSeedState.StateVector) {
+			t.Errorf("expected the next episode to start from %v after restoring, got %v",
+				nextSeedState.StateVector.RawVector().Data, restoredState.StateVector.RawVector().Data)
+		}
+	}
+
+	// Moving paddle 0 the other way for a single step
+	movedState, err := snapshot.Restore(pongSystem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pongSystem.Observe(movedState, 0, buffers.Percepts[0])
+	agents[0].GetActionInto(buffers.Percepts[0], buffers.Actions[0])
+	alternativeAction := -buffers.Actions[0].AtVec(0)
+	movedReturns, movedFinalStateIndex := playPongFrom(pongSystem, movedState, agents, &alternativeAction)
+	t.Logf("moving paddle 0 the other way at step %v changed the returns from %v to %v, and the game's end from step %v to %v",
+		snapshot.State.StateIndex, returns, movedReturns, finalStateIndex, movedFinalStateIndex)
+	if movedFinalStateIndex == finalStateIndex && movedReturns[0] == returns[0] && movedReturns[1] == returns[1] {
+		t.Errorf("expected moving paddle 0 the other way at step %v to change the game, but it still ended at step %v with returns %v",
+			snapshot.State.StateIndex, finalStateIndex, returns)
+	}
+}
+
+// The schema must describe every element of the state, percepts and actions
+func TestPongSchemaDescribesSystem(t *testing.T) {
+	pongSystem := NewPongSystem()
+	schema := system.SchemaOf(pongSystem)
+	if err := schema.Check(pongSystem); err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.State) != STATE_VECTOR_LEN {
+		t.Errorf("expected %v state fields, got %v", STATE_VECTOR_LEN, len(schema.State))
+	}
+}
+
+// Each system must play by its own parameters, and systems made from parameter values must have those values
+func TestPongParametersChangePhysics(t *testing.T) {
+	fastSystem := NewPongSystemWithParameters(PongParameters{PaddleSize: PADDLE_SIZE, MaxPaddleVelocity: 3, TimeDelta: 2 * TIME_DELTA})
+	if fastSystem.Constants()["TIME_DELTA"] != 2*TIME_DELTA {
+		t.Errorf("expected the constants to give the system's time delta, got %v", fastSystem.Constants()["TIME_DELTA"])
+	}
+	actions := []*mat.VecDense{mat.NewVecDense(NUM_ACTIONS, []float64{5}), mat.NewVecDense(NUM_ACTIONS, []float64{-5})}
+	rewards := make([]float64, NUM_AGENTS_PER_SIMULATION)
+	for _, pongSystem := range []*PongSystem{NewPongSystem(), fastSystem} {
+		state := pongSystem.Reset(1)
+		initialBallX := state.StateVector.AtVec(0)
+		pongSystem.Step(state, actions, rewards)
+		parameters := pongSystem.Parameters()
+		expectedPaddlePosition := parameters.TimeDelta * parameters.MaxPaddleVelocity
+		if state.StateVector.AtVec(4) != expectedPaddlePosition || state.StateVector.AtVec(5) != -expectedPaddlePosition {
+			t.Errorf("expected the paddles to move %v, got %v", expectedPaddlePosition, state.StateVector.RawVector().Data[4:])
+		}
+		if ballX := state.StateVector.AtVec(0); ballX != initialBallX+parameters.TimeDelta*state.StateVector.AtVec(2) {
+			t.Errorf("expected the ball to move for %v, moved from %v to %v", parameters.TimeDelta, initialBallX, ballX)
+		}
+	}
+
+	madeSystem := NewPongSystem().WithParameterValues([]float64{0.1, 2, 0.02}).(*PongSystem)
+	if madeSystem.Parameters() != (PongParameters{PaddleSize: 0.1, MaxPaddleVelocity: 2, TimeDelta: 0.02}) {
+		t.Errorf("expected the system to have the given parameters, got %+v", madeSystem.Parameters())
+	}
+	if err := system.SchemaOf(madeSystem).Check(madeSystem); err != nil || system.SchemaOf(madeSystem).Actions[0].Maximum != 2 {
+		t.Errorf("expected the schema to give the system's velocity cap, got %v (%v)", system.SchemaOf(madeSystem).Actions[0], err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for a negative time delta")
+		}
+	}()
+	NewPongSystem().WithParameterValues([]float64{0.1, 2, -0.02})
+}
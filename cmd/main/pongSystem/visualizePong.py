@@ -3,35 +3,39 @@ import matplotlib.animation as animation
 import pandas as pd
 from GonumMatrixIO import GonumIO
 import argparse
-
-simulationData = pd.read_parquet("data/BestAgentSimulation.pq")
-animationSavePath = "data/animation.mp4"
+import os
 
 GAME_X_DIMENSION = 1.0
 GAME_Y_DIMENSION = 0.5
 PADDLE_SIZE = 0.2
 
 parser = argparse.ArgumentParser(description="Pong Visualization Argument Parser")
+parser.add_argument("runDirectory", help="The output directory of the run to visualize, e.g. runs/run-20230101-120000")
 parser.add_argument("--save", help="Save animation to file, rather than showing", action="store_true")
 parser.add_argument("--numFrames", help="Determine the number of frames to render. If not given, render the entire simulation", action="store", type=int, default=None)
 args = parser.parse_args()
 
+dataDirectory = os.path.join(args.runDirectory, "data")
+simulationData = pd.read_parquet(os.path.join(dataDirectory, "BestAgentSimulation.pq"))
+animationSavePath = os.path.join(dataDirectory, "animation.mp4")
+
 if args.numFrames == None or args.numFrames > len(simulationData):
     numFrames = len(simulationData)
 else:
     numFrames = args.numFrames
 
-print(f"BEST CHROMOSOME:\n{GonumIO.loadMatrix('data/bestAgentChromosome.bin')}")
+print(f"BEST CHROMOSOME:\n{GonumIO.loadMatrix(os.path.join(dataDirectory, 'bestAgentChromosome.bin'))}")
 
 
 def update(index):
-    stateVector = simulationData.loc[index, "StateVector"]
-    ballX = stateVector[0]
-    ballY = stateVector[1]
-    ballXVelocity = stateVector[2]
-    ballYVelocity = stateVector[3]
-    paddle0Position = stateVector[4]
-    paddle1Position = stateVector[5]
+    # Each element of the state has its own column, named as in the system's schema
+    state = simulationData.loc[index]
+    ballX = state["BallX"]
+    ballY = state["BallY"]
+    ballXVelocity = state["BallXVelocity"]
+    ballYVelocity = state["BallYVelocity"]
+    paddle0Position = state["Paddle0Position"]
+    paddle1Position = state["Paddle1Position"]
     # print(ballX,ballY,ballXVelocity,ballYVelocity,paddle0Position,paddle1Position,)
 
     ball.set_xdata([ballX])
@@ -0,0 +1,75 @@
+// Replay a recorded episode (see simulator.EpisodeRecording), checking that it plays out exactly as recorded,
+// and print what happened at each step. Use this to debug surprising scores, for example:
+//
+//	go run ./cmd/replay -steps runs/<run>/data/BestAgentEpisode.gob
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	// Imported for their side effect of registering each system by name
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/basicSystem"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/flyingAgents"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/multiAgentSystem"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/pongSystem"
+	simulator "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Simulator"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+)
+
+func main() {
+	printSteps := flag.Bool("steps", false, "print the actions, rewards and state of every step")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %v [-steps] recording.gob\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	recording, err := simulator.ReadEpisodeRecording(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	targetSystem, err := system.NewSystem(recording.SystemName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("System:         %v\n", recording.SystemName)
+	fmt.Printf("Seed:           %v (seeded %v)\n", recording.Seed, recording.Seeded)
+	fmt.Printf("Episode length: %v (%v)\n", recording.EpisodeLength, recording.TerminalReason)
+	fmt.Printf("Returns:        %v\n", recording.Returns)
+	if recording.ErrorMessage != "" {
+		fmt.Printf("Error:          %v\n", recording.ErrorMessage)
+	}
+	if *printSteps {
+		// States and actions are labelled with the names and units of the system's schema
+		schema := system.SchemaOf(targetSystem)
+		fmt.Printf("Initial state:  %v\n", schema.FormatState(recording.InitialStateVector))
+		for stepIndex, step := range recording.Steps {
+			fmt.Printf("Step %v:\n", stepIndex)
+			for agentIndex, action := range step.Actions {
+				fmt.Printf("\tAgent %v action: %v\n", agentIndex, schema.FormatActions(action))
+			}
+			fmt.Printf("\tRewards: %v\n", step.Rewards)
+			fmt.Printf("\tState:   %v\n", schema.FormatState(step.StateVector))
+		}
+	}
+
+	_, err = simulator.ReplayEpisode(context.Background(), targetSystem, recording)
+	var mismatchError *simulator.ReplayMismatchError
+	if errors.As(err, &mismatchError) {
+		fmt.Println(err)
+		os.Exit(1)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Replay matches the recording exactly")
+}
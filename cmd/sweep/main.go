@@ -0,0 +1,121 @@
+// Run a hyperparameter sweep over one of the bundled systems.
+//
+// The parameter space is read from a JSON file containing a list of dimensions, for example
+//
+//	[
+//		{"Name": "mutationRate", "Min": 1e-7, "Max": 1e-3, "LogScale": true},
+//		{"Name": "numCarryover", "Values": [0, 1, 5, 10]},
+//		{"Name": "maxNumParents", "Min": 2, "Max": 6, "Integer": true}
+//	]
+//
+// See the PARAMETER_ constants in pkg/Sweep for the parameters that can be varied.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/exp/rand"
+
+	// Imported for their side effect of registering each system by name
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/basicSystem"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/flyingAgents"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/multiAgentSystem"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/pongSystem"
+	rundirectory "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/RunDirectory"
+	sweep "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Sweep"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+)
+
+func main() {
+	defaults := sweep.DefaultTrialSettings()
+	systemName := flag.String("system", "pong", fmt.Sprintf("the system to train, one of %v", system.RegisteredNames()))
+	spacePath := flag.String("space", "", "path to a JSON file describing the parameter space (required)")
+	mode := flag.String("mode", "lhs", "how to pick configurations from the space: grid, random or lhs (Latin hypercube)")
+	numSamples := flag.Int("samples", 10, "number of configurations to sample in random and lhs modes")
+	numGridPoints := flag.Int("gridPoints", 3, "number of values of each continuous parameter in grid mode")
+	numSeeds := flag.Int("seeds", 3, "number of seeds to run each configuration with")
+	threadBudget := flag.Int("threads", 16, "maximum number of simulation threads across all concurrent runs")
+	threadsPerRun := flag.Int("threadsPerRun", defaults.NumThreads, "number of simulation threads used by each run")
+	numGenerations := flag.Int("generations", defaults.NumGenerations, "number of generations in each run")
+	numAgents := flag.Int("agents", defaults.NumAgents, "number of agents, unless varied by the parameter space")
+	numSimulations := flag.Int("simulations", defaults.NumSimulationsPerGeneration, "number of simulations per generation, unless varied by the parameter space")
+	outputRoot := flag.String("output", "", "directory to write the sweep to (default: a new timestamped directory in runs)")
+	samplingSeed := flag.Uint64("samplingSeed", uint64(time.Now().UnixNano()), "seed used to sample configurations in random and lhs modes")
+	flag.Parse()
+
+	if *spacePath == "" {
+		log.Fatal("a parameter space must be given with -space")
+	}
+	spaceFile, err := os.ReadFile(*spacePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var space sweep.ParameterSpace
+	if err := json.Unmarshal(spaceFile, &space); err != nil {
+		log.Fatal("could not parse parameter space: ", err)
+	}
+	if err := space.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	randomGenerator := rand.New(rand.NewSource(*samplingSeed))
+	var configurations []sweep.Configuration
+	switch *mode {
+	case "grid":
+		configurations = space.GridConfigurations(*numGridPoints)
+	case "random":
+		configurations = space.RandomConfigurations(*numSamples, randomGenerator)
+	case "lhs":
+		configurations = space.LatinHypercubeConfigurations(*numSamples, randomGenerator)
+	default:
+		log.Fatalf("unknown sampling mode %q", *mode)
+	}
+
+	if *outputRoot == "" {
+		*outputRoot = filepath.Join(rundirectory.DEFAULT_RUNS_DIRECTORY, fmt.Sprintf("sweep-%v-%v", *systemName, time.Now().Format("20060102-150405")))
+	}
+
+	seeds := make([]uint64, *numSeeds)
+	for seedIndex := range seeds {
+		seeds[seedIndex] = uint64(seedIndex + 1)
+	}
+
+	baseSettings := defaults
+	baseSettings.NumThreads = *threadsPerRun
+	baseSettings.NumGenerations = *numGenerations
+	baseSettings.NumAgents = *numAgents
+	baseSettings.NumSimulationsPerGeneration = *numSimulations
+
+	parameterSweep := &sweep.Sweep{
+		SystemName:     *systemName,
+		Configurations: configurations,
+		Seeds:          seeds,
+		BaseSettings:   baseSettings,
+		ThreadBudget:   *threadBudget,
+		OutputRoot:     *outputRoot,
+	}
+
+	// Stop the sweep gracefully on keyboard interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	log.Printf("Running %v configurations with %v seeds each, writing to %v\n", len(configurations), len(seeds), *outputRoot)
+	results, err := parameterSweep.Run(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, result := range results {
+		log.Printf("configuration %v %v: final best %.4g ± %.4g, best %.4g (%v failed)\n",
+			result.ConfigurationIndex, result.Configuration,
+			result.MeanFinalBestScore, result.StdDevFinalBestScore,
+			result.MaxBestScore, result.NumFailedTrials)
+	}
+}
@@ -0,0 +1,101 @@
+// Tune breeder and Manager hyperparameters of one of the bundled systems with Bayesian optimisation.
+//
+// The parameter space is read from a JSON file in the same format as for cmd/sweep. Running again
+// with the same -output directory resumes from the history recorded there, so -evaluations can be
+// raised to continue a finished tuning run.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	// Imported for their side effect of registering each system by name
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/basicSystem"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/flyingAgents"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/multiAgentSystem"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/pongSystem"
+	rundirectory "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/RunDirectory"
+	sweep "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Sweep"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+)
+
+func main() {
+	defaults := sweep.DefaultTrialSettings()
+	systemName := flag.String("system", "pong", fmt.Sprintf("the system to train, one of %v", system.RegisteredNames()))
+	spacePath := flag.String("space", "", "path to a JSON file describing the parameter space (required)")
+	numInitialEvaluations := flag.Int("initial", 8, "number of Latin hypercube configurations evaluated before using the surrogate")
+	numEvaluations := flag.Int("evaluations", 30, "total number of configurations to evaluate, including any resumed from the history")
+	numSeeds := flag.Int("seeds", 2, "number of seeds to run each configuration with")
+	threadBudget := flag.Int("threads", 16, "maximum number of simulation threads across all concurrent runs")
+	threadsPerRun := flag.Int("threadsPerRun", defaults.NumThreads, "number of simulation threads used by each run")
+	numGenerations := flag.Int("generations", defaults.NumGenerations, "number of generations in each run")
+	numAgents := flag.Int("agents", defaults.NumAgents, "number of agents, unless tuned")
+	numSimulations := flag.Int("simulations", defaults.NumSimulationsPerGeneration, "number of simulations per generation, unless tuned")
+	tunerSeed := flag.Uint64("tunerSeed", 1, "seed for the tuner's choice of configurations")
+	outputRoot := flag.String("output", "", "directory to write the tuning run to, or to resume from (default: a new timestamped directory in runs)")
+	flag.Parse()
+
+	if *spacePath == "" {
+		log.Fatal("a parameter space must be given with -space")
+	}
+	spaceFile, err := os.ReadFile(*spacePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var space sweep.ParameterSpace
+	if err := json.Unmarshal(spaceFile, &space); err != nil {
+		log.Fatal("could not parse parameter space: ", err)
+	}
+
+	if *outputRoot == "" {
+		*outputRoot = filepath.Join(rundirectory.DEFAULT_RUNS_DIRECTORY, fmt.Sprintf("tune-%v-%v", *systemName, time.Now().Format("20060102-150405")))
+	}
+
+	seeds := make([]uint64, *numSeeds)
+	for seedIndex := range seeds {
+		seeds[seedIndex] = uint64(seedIndex + 1)
+	}
+
+	baseSettings := defaults
+	baseSettings.NumThreads = *threadsPerRun
+	baseSettings.NumGenerations = *numGenerations
+	baseSettings.NumAgents = *numAgents
+	baseSettings.NumSimulationsPerGeneration = *numSimulations
+
+	tuner := &sweep.Tuner{
+		SystemName:            *systemName,
+		Space:                 space,
+		Seeds:                 seeds,
+		BaseSettings:          baseSettings,
+		ThreadBudget:          *threadBudget,
+		NumInitialEvaluations: *numInitialEvaluations,
+		NumEvaluations:        *numEvaluations,
+		Seed:                  *tunerSeed,
+		OutputRoot:            *outputRoot,
+	}
+
+	// Stop tuning gracefully on keyboard interrupt. The interrupted evaluation is repeated on resume.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	log.Printf("Tuning %v, writing to %v\n", *systemName, *outputRoot)
+	history, err := tuner.Run(ctx)
+	if err != nil {
+		log.Println(err)
+	}
+	for _, evaluation := range history {
+		log.Printf("evaluation %v %v: objective %.4g\n", evaluation.EvaluationIndex, evaluation.Configuration, evaluation.Objective)
+	}
+	if best, ok := sweep.BestEvaluation(history); ok {
+		log.Printf("Best configuration (evaluation %v): %v with objective %.4g\n", best.EvaluationIndex, best.Configuration, best.Objective)
+	} else {
+		log.Println("No configuration was evaluated successfully")
+	}
+}
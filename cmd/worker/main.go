@@ -0,0 +1,34 @@
+// Run simulations for a distributed Manager (see pkg/Distributed).
+//
+// Start the main program with -listen, then start any number of workers (on any machines) with
+// -coordinator set to the main program's address.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"runtime"
+
+	// Imported for their side effect of registering each system by name
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/basicSystem"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/flyingAgents"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/multiAgentSystem"
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/pongSystem"
+	distributed "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Distributed"
+)
+
+func main() {
+	hostname, _ := os.Hostname()
+	coordinatorAddress := flag.String("coordinator", "localhost:8080", "address of the coordinator to take simulations from")
+	numThreads := flag.Int("threads", runtime.NumCPU(), "number of simulations to run at once")
+	name := flag.String("name", hostname, "name of this worker in the coordinator's logs")
+	flag.Parse()
+
+	// Stop gracefully on keyboard interrupt. The coordinator re-queues any unfinished task.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	distributed.NewWorker(*coordinatorAddress, *name, *numThreads).Run(ctx)
+}
@@ -1,20 +1,21 @@
 module github.com/Otago-Computer-Science-Society/FoosballGeneticLearning
 
-go 1.20
+go 1.21
 
 require (
 	golang.org/x/exp v0.0.0-20230321023759-10a507213a29
 	gonum.org/v1/gonum v0.12.0
 )
 
-require github.com/hmcalister/gonum-matrix-io v0.0.0-20230404235649-bdcb5bf7e036
+require (
+	github.com/hmcalister/gonum-matrix-io v0.0.0-20230404235649-bdcb5bf7e036
+	github.com/schollz/progressbar/v3 v3.13.1
+)
 
 require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/mattn/go-runewidth v0.0.14 // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/rivo/uniseg v0.4.4 // indirect
-	github.com/schollz/progressbar/v3 v3.13.1 // indirect
 	golang.org/x/sys v0.7.0 // indirect
 	golang.org/x/term v0.7.0 // indirect
 )
@@ -1,19 +1,38 @@
 package agent
 
 import (
+	"sync/atomic"
+
+	"golang.org/x/exp/rand"
 	"gonum.org/v1/gonum/mat"
 	"gonum.org/v1/gonum/stat/distuv"
 )
 
+// The ID given to the most recently created agent
+var lastAgentID atomic.Uint64
+
 type Agent struct {
+	// A unique identifier for this agent, assigned on creation.
+	// IDs are unique within a process, and are useful for tracking agents in logs and errors.
+	ID uint64
+
 	Chromosome *mat.Dense
-	Score      float64
+
+	// During a simulation, Score is the return the agent has accumulated so far in the current episode.
+	// Once a generation has been fully simulated, the manager replaces this with the agent's
+	// aggregated fitness (see `pkg/Fitness`), which is what the breeder uses.
+	Score float64
+
+	// The return of every episode this agent has completed, in order
+	EpisodeReturns []float64
 }
 
 func NewAgent(chromosome *mat.Dense) *Agent {
 	return &Agent{
-		Chromosome: chromosome,
-		Score:      0.0,
+		ID:             lastAgentID.Add(1),
+		Chromosome:     chromosome,
+		Score:          0.0,
+		EpisodeReturns: []float64{},
 	}
 }
 
@@ -30,13 +49,40 @@ func NewRandomGaussianAgent(numActions int, numPercepts int) *Agent {
 	return NewAgent(chromosome)
 }
 
+// Return a new agent with a unit Gaussian random chromosome drawn from the given random generator,
+// so that the agent is reproducible from the generator's seed
+func NewSeededRandomGaussianAgent(randomGenerator *rand.Rand, numActions int, numPercepts int) *Agent {
+	chromosomeData := make([]float64, numActions*numPercepts)
+	for index := range chromosomeData {
+		chromosomeData[index] = randomGenerator.NormFloat64()
+	}
+	chromosome := mat.NewDense(numActions, numPercepts, chromosomeData)
+	return NewAgent(chromosome)
+}
+
+// Reset the agent score ready for a new episode
+func (agent *Agent) StartEpisode() {
+	agent.Score = 0.0
+}
+
+// Record the score accumulated during the current episode as that episode's return
+func (agent *Agent) EndEpisode() {
+	agent.EpisodeReturns = append(agent.EpisodeReturns, agent.Score)
+}
+
 func (agent *Agent) GetAction(stateVector *mat.VecDense) *mat.VecDense {
 	numActions, _ := agent.Chromosome.Dims()
 	actionVector := mat.NewVecDense(numActions, nil)
-	actionVector.MulVec(agent.Chromosome, stateVector)
+	agent.GetActionInto(stateVector, actionVector)
 	return actionVector
 }
 
+// Compute the agent's action as in GetAction, writing it to actionVector rather than allocating a new vector.
+// actionVector must have a length of the number of actions, and must not share memory with stateVector.
+func (agent *Agent) GetActionInto(stateVector *mat.VecDense, actionVector *mat.VecDense) {
+	actionVector.MulVec(agent.Chromosome, stateVector)
+}
+
 func GetAllAgentActions(agents []*Agent, stateVector *mat.VecDense) []*mat.VecDense {
 	agentActions := make([]*mat.VecDense, len(agents))
 	for agentIndex := range agents {
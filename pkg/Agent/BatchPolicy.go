@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/mat"
+)
+
+// A BatchPolicy computes the actions of many agents at once, for simulations run in lockstep
+// (see system.BatchedSystem). Row i of the percept matrix is perceived by agents[i], whose action
+// is written to row i of the action matrix.
+//
+// Rows that share an agent (for example when one agent is evaluated over many episodes) have their
+// actions computed with a single matrix product. The policy reuses the same memory for every step.
+type BatchPolicy struct {
+	percepts *mat.Dense
+	actions  *mat.Dense
+	groups   []batchPolicyGroup
+}
+
+// The rows acted in by a single agent
+type batchPolicyGroup struct {
+	agent      *Agent
+	rowIndices []int
+
+	// Views of the group's row of the percept and action matrices, used if it has only a single row
+	perceptRow *mat.VecDense
+	actionRow  *mat.VecDense
+
+	// The percepts and actions of the group's unfinished rows, gathered together, used if it has many rows
+	perceptData    []float64
+	actionData     []float64
+	groupPercepts  mat.Dense
+	groupActions   mat.Dense
+	chromosomeView mat.Matrix
+}
+
+// Create a policy for the given agents, which perceive the rows of percepts and act in the rows of actions.
+// The matrices must have a row per agent, and NumPercepts and NumActions columns respectively.
+func NewBatchPolicy(agents []*Agent, percepts *mat.Dense, actions *mat.Dense) *BatchPolicy {
+	numRows, numPercepts := percepts.Dims()
+	numActionRows, numActions := actions.Dims()
+	if numRows != len(agents) || numActionRows != len(agents) {
+		panic("Percept and action matrices must have a row per agent!")
+	}
+
+	policy := &BatchPolicy{percepts: percepts, actions: actions}
+	groupIndices := make(map[*Agent]int)
+	for rowIndex, rowAgent := range agents {
+		groupIndex, exists := groupIndices[rowAgent]
+		if !exists {
+			groupIndex = len(policy.groups)
+			groupIndices[rowAgent] = groupIndex
+			policy.groups = append(policy.groups, batchPolicyGroup{agent: rowAgent})
+		}
+		policy.groups[groupIndex].rowIndices = append(policy.groups[groupIndex].rowIndices, rowIndex)
+	}
+
+	for groupIndex := range policy.groups {
+		group := &policy.groups[groupIndex]
+		if len(group.rowIndices) == 1 {
+			group.perceptRow = mat.NewVecDense(numPercepts, percepts.RawRowView(group.rowIndices[0]))
+			group.actionRow = mat.NewVecDense(numActions, actions.RawRowView(group.rowIndices[0]))
+			continue
+		}
+		group.perceptData = make([]float64, len(group.rowIndices)*numPercepts)
+		group.actionData = make([]float64, len(group.rowIndices)*numActions)
+		group.chromosomeView = group.agent.Chromosome.T()
+	}
+	return policy
+}
+
+// Compute the action of every row whose mask is false (every row if the mask is nil)
+func (policy *BatchPolicy) GetActions(mask []bool) {
+	_, numPercepts := policy.percepts.Dims()
+	_, numActions := policy.actions.Dims()
+	for groupIndex := range policy.groups {
+		group := &policy.groups[groupIndex]
+		if group.perceptRow != nil {
+			if mask == nil || !mask[group.rowIndices[0]] {
+				group.actionRow.MulVec(group.agent.Chromosome, group.perceptRow)
+			}
+			continue
+		}
+
+		// Gather the percepts of the unfinished rows, act on them all at once, then scatter the actions back
+		numActiveRows := 0
+		for _, rowIndex := range group.rowIndices {
+			if mask == nil || !mask[rowIndex] {
+				copy(group.perceptData[numActiveRows*numPercepts:], policy.percepts.RawRowView(rowIndex))
+				numActiveRows++
+			}
+		}
+		if numActiveRows == 0 {
+			continue
+		}
+		group.groupPercepts.SetRawMatrix(blas64.General{Rows: numActiveRows, Cols: numPercepts, Stride: numPercepts, Data: group.perceptData[:numActiveRows*numPercepts]})
+		group.groupActions.SetRawMatrix(blas64.General{Rows: numActiveRows, Cols: numActions, Stride: numActions, Data: group.actionData[:numActiveRows*numActions]})
+		group.groupActions.Mul(&group.groupPercepts, group.chromosomeView)
+
+		activeRowIndex := 0
+		for _, rowIndex := range group.rowIndices {
+			if mask == nil || !mask[rowIndex] {
+				copy(policy.actions.RawRowView(rowIndex), group.actionData[activeRowIndex*numActions:(activeRowIndex+1)*numActions])
+				activeRowIndex++
+			}
+		}
+	}
+}
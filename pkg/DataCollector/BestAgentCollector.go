@@ -4,6 +4,7 @@ import (
 	"path"
 
 	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	rundirectory "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/RunDirectory"
 	"github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/utils"
 
 	"github.com/hmcalister/gonum-matrix-io/pkg/gonumio"
@@ -27,7 +28,10 @@ type BestAgentDataCollector struct {
 }
 
 // Create a new BestAgentDataCollector for storing information on the best agent in a generation
-func NewBestAgentDataCollector(dataDirectory string) *BestAgentDataCollector {
+//
+// Data is written to the data directory of the given run directory
+func NewBestAgentDataCollector(runDirectory *rundirectory.RunDirectory) *BestAgentDataCollector {
+	dataDirectory := runDirectory.DataDirectory()
 	fileHandle, dataWriter := utils.NewParquetWriter(path.Join(dataDirectory, bestAgentDataFile), new(bestAgentData))
 	return &BestAgentDataCollector{
 		dataDirectory: dataDirectory,
@@ -45,6 +49,11 @@ func (dc *BestAgentDataCollector) CollectBestAgentData(bestAgent *agent.Agent) {
 	gonumio.SaveMatrix(bestAgent.Chromosome, path.Join(dc.dataDirectory, bestAgentChromosomeFile))
 }
 
+// Write any buffered data to disk, without closing the file
+func (dc *BestAgentDataCollector) Flush() error {
+	return dc.dataWriter.Flush(true)
+}
+
 func (dc *BestAgentDataCollector) WriteStop() error {
 	if err := dc.dataWriter.WriteStop(); err != nil {
 		return err
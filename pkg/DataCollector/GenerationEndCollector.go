@@ -4,6 +4,7 @@ import (
 	"path"
 
 	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	rundirectory "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/RunDirectory"
 	"github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/utils"
 
 	"github.com/xitongsys/parquet-go/source"
@@ -14,8 +15,15 @@ const (
 	generationEndDataFile = "generationEndData.pq"
 )
 
+// Scores holds the aggregated fitness of each agent.
+//
+// The per-episode returns of every agent are flattened into EpisodeReturns, in the same agent order as Scores.
+// NumEpisodes gives how many of those returns belong to each agent, so agent i owns
+// EpisodeReturns[sum(NumEpisodes[:i]) : sum(NumEpisodes[:i+1])]
 type generationEndData struct {
-	Scores []float64 `parquet:"name=Scores, type=DOUBLE, repetitiontype=REPEATED"`
+	Scores         []float64 `parquet:"name=Scores, type=DOUBLE, repetitiontype=REPEATED"`
+	NumEpisodes    []int32   `parquet:"name=NumEpisodes, type=INT32, repetitiontype=REPEATED"`
+	EpisodeReturns []float64 `parquet:"name=EpisodeReturns, type=DOUBLE, repetitiontype=REPEATED"`
 }
 
 type GenerationEndDataCollector struct {
@@ -23,8 +31,11 @@ type GenerationEndDataCollector struct {
 	fileHandle *source.ParquetFile
 }
 
-func NewGenerationEndCollector(dataDirectory string) *GenerationEndDataCollector {
-	fileHandle, dataWriter := utils.NewParquetWriter(path.Join(dataDirectory, generationEndDataFile), new(generationEndData))
+// Create a new GenerationEndDataCollector for storing the scores of every generation
+//
+// Data is written to the data directory of the given run directory
+func NewGenerationEndCollector(runDirectory *rundirectory.RunDirectory) *GenerationEndDataCollector {
+	fileHandle, dataWriter := utils.NewParquetWriter(path.Join(runDirectory.DataDirectory(), generationEndDataFile), new(generationEndData))
 	return &GenerationEndDataCollector{
 		dataWriter: dataWriter,
 		fileHandle: fileHandle,
@@ -33,15 +44,26 @@ func NewGenerationEndCollector(dataDirectory string) *GenerationEndDataCollector
 
 func (dc *GenerationEndDataCollector) CollectGenerationEndData(agents []*agent.Agent) {
 	scores := make([]float64, len(agents))
+	numEpisodes := make([]int32, len(agents))
+	episodeReturns := []float64{}
 	for agentIndex := range agents {
 		scores[agentIndex] = agents[agentIndex].Score
+		numEpisodes[agentIndex] = int32(len(agents[agentIndex].EpisodeReturns))
+		episodeReturns = append(episodeReturns, agents[agentIndex].EpisodeReturns...)
 	}
 
 	dc.dataWriter.Write(generationEndData{
-		Scores: scores,
+		Scores:         scores,
+		NumEpisodes:    numEpisodes,
+		EpisodeReturns: episodeReturns,
 	})
 }
 
+// Write any buffered data to disk, without closing the file
+func (dc *GenerationEndDataCollector) Flush() error {
+	return dc.dataWriter.Flush(true)
+}
+
 func (dc *GenerationEndDataCollector) WriteStop() error {
 	if err := dc.dataWriter.WriteStop(); err != nil {
 		return err
@@ -1,8 +1,10 @@
 package datacollector
 
 import (
+	"fmt"
 	"path"
 
+	rundirectory "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/RunDirectory"
 	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
 	"github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/utils"
 
@@ -10,37 +12,65 @@ import (
 	"github.com/xitongsys/parquet-go/writer"
 )
 
-type simulationData struct {
-	StateIndex  int       `parquet:"name=StateIndex, type=INT32"`
-	StateVector []float64 `parquet:"name=StateVector, type=DOUBLE, repetitiontype=REPEATED"`
-}
+// Every state is written as a row with a StateIndex column, followed by one column per element of the state vector
+const stateIndexColumn = "name=StateIndex, type=INT32"
 
 type SimulationDataCollector struct {
 	dataDirectory string
 	dataFile      string
-	dataWriter    *writer.ParquetWriter
+	dataWriter    *writer.CSVWriter
 	fileHandle    *source.ParquetFile
+
+	// The name of each element of the state vector, and so of each column after StateIndex
+	stateNames []string
+
+	// Every state vector collected so far, kept in memory as well as written to the file
+	stateVectors [][]float64
 }
 
-// Create a new BestAgentDataCollector for storing information on the best agent in a generation
-func NewSimulationDataCollector(dataDirectory string, dataFile string) *SimulationDataCollector {
-	fileHandle, dataWriter := utils.NewParquetWriter(path.Join(dataDirectory, dataFile), new(simulationData))
+// Create a new SimulationDataCollector for storing every state of a simulation
+//
+// Data is written to the given file in the data directory of the given run directory,
+// with a column for each element of the state vector named by stateNames (see system.Schema.StateNames).
+// Every state collected must have exactly len(stateNames) elements.
+func NewSimulationDataCollector(runDirectory *rundirectory.RunDirectory, dataFile string, stateNames []string) *SimulationDataCollector {
+	dataDirectory := runDirectory.DataDirectory()
+	columns := []string{stateIndexColumn}
+	for _, stateName := range stateNames {
+		columns = append(columns, fmt.Sprintf("name=%v, type=DOUBLE", stateName))
+	}
+	fileHandle, dataWriter := utils.NewParquetColumnWriter(path.Join(dataDirectory, dataFile), columns)
 	return &SimulationDataCollector{
 		dataDirectory: dataDirectory,
 		dataFile:      dataFile,
 		dataWriter:    dataWriter,
 		fileHandle:    fileHandle,
+		stateNames:    stateNames,
+		stateVectors:  [][]float64{},
 	}
 }
 
-// Save all relevant information about the best agent to a parquet file
-// as well as saving the best agent chromosome to a binary file
+// Save the state as a row of the parquet file, and keep its state vector in memory (see StateVectors)
 func (dc *SimulationDataCollector) CollectSimulationData(state *systemstate.SystemState) {
+	if state.StateVector.Len() != len(dc.stateNames) {
+		panic(fmt.Sprintf("State vector has %v elements, but the collector has %v state names!", state.StateVector.Len(), len(dc.stateNames)))
+	}
+	stateVector := make([]float64, state.StateVector.Len())
+	copy(stateVector, state.StateVector.RawVector().Data)
+	dc.stateVectors = append(dc.stateVectors, stateVector)
+
+	row := make([]interface{}, 1+len(stateVector))
+	row[0] = int32(state.StateIndex)
+	for elementIndex, value := range stateVector {
+		row[1+elementIndex] = value
+	}
+	dc.dataWriter.Write(row)
+}
 
-	dc.dataWriter.Write(simulationData{
-		StateIndex:  state.StateIndex,
-		StateVector: state.StateVector.RawVector().Data,
-	})
+// Get every state vector collected so far, in order.
+// The returned slice must not be modified.
+func (dc *SimulationDataCollector) StateVectors() [][]float64 {
+	return dc.stateVectors
 }
 
 func (dc *SimulationDataCollector) WriteStop() error {
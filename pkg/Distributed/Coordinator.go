@@ -0,0 +1,498 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	simulator "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Simulator"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	DEFAULT_JOBS_PER_TASK     = 16
+	DEFAULT_HEARTBEAT_TIMEOUT = 10 * time.Second
+)
+
+// Returned (as the Err of unfinished simulations) if the coordinator is closed part way through a batch
+var ErrCoordinatorClosed = errors.New("coordinator closed")
+
+// A Coordinator hands simulations out to worker processes over HTTP. It implements simulator.BatchSimulator,
+// so it can replace the Manager's local worker pool with manager.WithBatchSimulator.
+//
+// SimulateBatch splits the jobs into tasks of jobsPerTask simulations, and waits until workers have returned
+// a result for every task. Tasks held by workers that stop sending heartbeats are re-queued for other workers.
+// If no workers are connected, SimulateBatch waits until one connects (or the context is cancelled).
+type Coordinator struct {
+	system           SystemDescription
+	jobsPerTask      int
+	heartbeatTimeout time.Duration
+
+	listener net.Listener
+	server   *http.Server
+	logger   *slog.Logger
+
+	mutex sync.Mutex
+	// Tasks waiting for a worker, in order
+	queue []*pendingTask
+	// Every task not yet finished, whether queued or held by a worker
+	outstandingTasks map[uint64]*pendingTask
+	workers          map[uint64]*workerRecord
+	lastTaskID       uint64
+	lastWorkerID     uint64
+	// Closed (and replaced) whenever tasks are queued, to wake workers waiting for a task
+	queueChanged chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// A task that has been handed out, or is waiting to be
+type pendingTask struct {
+	task  Task
+	batch *pendingBatch
+	// Index of the task's first job within the batch
+	startIndex int
+	// The worker currently simulating the task, or 0 if it is queued
+	workerID uint64
+}
+
+// The state of a single call to SimulateBatch
+type pendingBatch struct {
+	jobs          []simulator.SimulationJob
+	results       []simulator.SimulationResult
+	numUnfinished int
+	finished      []bool
+	allTasksDone  chan struct{}
+}
+
+type workerRecord struct {
+	name       string
+	numThreads int
+	lastSeen   time.Time
+}
+
+// Create a coordinator for the given system, serving workers at listenAddress (for example ":8080",
+// or "127.0.0.1:0" to pick any free port, see Address). The system must be the one the Manager simulates.
+//
+// Workers build the system from the registry by its name (see system.DescribedSystem), so an error is
+// returned if the registry cannot build a system with the same constants and parameter values,
+// as would be the case for a wrapped system or one created with non-default parameters.
+//
+// jobsPerTask is the number of simulations handed to a worker at once, and heartbeatTimeout is how
+// long a worker may go without contacting the coordinator before its tasks are re-queued.
+// Zero values select DEFAULT_JOBS_PER_TASK and DEFAULT_HEARTBEAT_TIMEOUT.
+func NewCoordinator(listenAddress string, targetSystem system.System, jobsPerTask int, heartbeatTimeout time.Duration) (*Coordinator, error) {
+	if jobsPerTask == 0 {
+		jobsPerTask = DEFAULT_JOBS_PER_TASK
+	}
+	if heartbeatTimeout == 0 {
+		heartbeatTimeout = DEFAULT_HEARTBEAT_TIMEOUT
+	}
+	if jobsPerTask < 0 || heartbeatTimeout < 0 {
+		panic("jobsPerTask and heartbeatTimeout must be positive!")
+	}
+
+	systemDescription, err := describeSystem(targetSystem)
+	if err != nil {
+		return nil, err
+	}
+	registeredSystem, err := system.NewSystem(systemDescription.Name)
+	if err != nil {
+		return nil, err
+	}
+	registeredDescription, err := describeSystem(registeredSystem)
+	if err != nil {
+		return nil, err
+	}
+	if err := registeredDescription.compare(systemDescription); err != nil {
+		return nil, fmt.Errorf("workers cannot build the system: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	coordinator := &Coordinator{
+		system:           systemDescription,
+		jobsPerTask:      jobsPerTask,
+		heartbeatTimeout: heartbeatTimeout,
+		listener:         listener,
+		logger:           slog.Default().With("component", "coordinator"),
+		queue:            []*pendingTask{},
+		outstandingTasks: make(map[uint64]*pendingTask),
+		workers:          make(map[uint64]*workerRecord),
+		queueChanged:     make(chan struct{}),
+		closed:           make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(REGISTER_PATH, coordinator.handleRegister)
+	mux.HandleFunc(TASK_PATH, coordinator.handleTask)
+	mux.HandleFunc(RESULT_PATH, coordinator.handleResult)
+	mux.HandleFunc(HEARTBEAT_PATH, coordinator.handleHeartbeat)
+	coordinator.server = &http.Server{Handler: mux}
+
+	go coordinator.server.Serve(listener)
+	go coordinator.monitorWorkers()
+	return coordinator, nil
+}
+
+// The address the coordinator is listening on, for example "127.0.0.1:40123"
+func (coordinator *Coordinator) Address() string {
+	return coordinator.listener.Addr().String()
+}
+
+// The number of workers currently connected
+func (coordinator *Coordinator) NumWorkers() int {
+	coordinator.mutex.Lock()
+	defer coordinator.mutex.Unlock()
+	return len(coordinator.workers)
+}
+
+// Stop serving workers. Any batch still being simulated finishes with ErrCoordinatorClosed.
+func (coordinator *Coordinator) Close() {
+	coordinator.closeOnce.Do(func() {
+		close(coordinator.closed)
+		coordinator.server.Close()
+	})
+}
+
+// Simulate every job on the connected workers, blocking until all are finished.
+// See simulator.BatchSimulator.
+//
+// If the context is cancelled (or the coordinator closed), unfinished jobs have a TerminalReason of
+// TerminalReasonCancelled and the context error (or ErrCoordinatorClosed) as Err. Results that
+// arrive from workers afterwards are discarded.
+func (coordinator *Coordinator) SimulateBatch(ctx context.Context, jobs []simulator.SimulationJob) []simulator.SimulationResult {
+	batch := &pendingBatch{
+		jobs:         jobs,
+		results:      make([]simulator.SimulationResult, len(jobs)),
+		finished:     make([]bool, len(jobs)),
+		allTasksDone: make(chan struct{}),
+	}
+	if len(jobs) == 0 {
+		return batch.results
+	}
+
+	coordinator.mutex.Lock()
+	for startIndex := 0; startIndex < len(jobs); startIndex += coordinator.jobsPerTask {
+		endIndex := startIndex + coordinator.jobsPerTask
+		if endIndex > len(jobs) {
+			endIndex = len(jobs)
+		}
+		coordinator.lastTaskID += 1
+		pending := &pendingTask{
+			task: Task{
+				TaskID: coordinator.lastTaskID,
+				System: coordinator.system,
+				Jobs:   make([]Job, endIndex-startIndex),
+			},
+			batch:      batch,
+			startIndex: startIndex,
+		}
+		for jobIndex := range pending.task.Jobs {
+			pending.task.Jobs[jobIndex] = newJob(jobs[startIndex+jobIndex])
+		}
+		coordinator.outstandingTasks[pending.task.TaskID] = pending
+		coordinator.queue = append(coordinator.queue, pending)
+		batch.numUnfinished += 1
+	}
+	coordinator.notifyQueueChangedLocked()
+	coordinator.mutex.Unlock()
+
+	var cancellationErr error
+	select {
+	case <-batch.allTasksDone:
+		return batch.results
+	case <-ctx.Done():
+		cancellationErr = ctx.Err()
+	case <-coordinator.closed:
+		cancellationErr = ErrCoordinatorClosed
+	}
+
+	// Withdraw every unfinished task of this batch, so late results are ignored
+	coordinator.mutex.Lock()
+	defer coordinator.mutex.Unlock()
+	remainingQueue := coordinator.queue[:0]
+	for _, pending := range coordinator.queue {
+		if pending.batch != batch {
+			remainingQueue = append(remainingQueue, pending)
+		}
+	}
+	coordinator.queue = remainingQueue
+	for taskID, pending := range coordinator.outstandingTasks {
+		if pending.batch == batch {
+			delete(coordinator.outstandingTasks, taskID)
+		}
+	}
+	for jobIndex := range batch.results {
+		if !batch.finished[jobIndex] {
+			batch.results[jobIndex] = simulator.SimulationResult{
+				Returns:        make([]float64, len(jobs[jobIndex].Agents)),
+				TerminalReason: simulator.TerminalReasonCancelled,
+				Err:            cancellationErr,
+			}
+		}
+	}
+	return batch.results
+}
+
+// Describe a simulation job in a form that can be sent to a worker
+func newJob(simulationJob simulator.SimulationJob) Job {
+	job := Job{
+		Chromosomes: make([]Chromosome, len(simulationJob.Agents)),
+		Seed:        simulationJob.Seed,
+		Seeded:      simulationJob.Seeded,
+
+		MaximumEpisodeLength: simulationJob.MaximumEpisodeLength,
+	}
+	for agentIndex, simulationAgent := range simulationJob.Agents {
+		rows, cols := simulationAgent.Chromosome.Dims()
+		data := make([]float64, rows*cols)
+		mat.NewDense(rows, cols, data).Copy(simulationAgent.Chromosome)
+		job.Chromosomes[agentIndex] = Chromosome{Rows: rows, Cols: cols, Data: data}
+	}
+	return job
+}
+
+// Wake any workers waiting for a task. The mutex must be held.
+func (coordinator *Coordinator) notifyQueueChangedLocked() {
+	close(coordinator.queueChanged)
+	coordinator.queueChanged = make(chan struct{})
+}
+
+// Look up a worker, and record that it is still alive. The mutex must be held.
+func (coordinator *Coordinator) touchWorkerLocked(workerID uint64) *workerRecord {
+	worker, exists := coordinator.workers[workerID]
+	if exists {
+		worker.lastSeen = time.Now()
+	}
+	return worker
+}
+
+// Periodically look for workers that have stopped sending heartbeats, and re-queue their tasks
+func (coordinator *Coordinator) monitorWorkers() {
+	ticker := time.NewTicker(coordinator.heartbeatTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-coordinator.closed:
+			return
+		case <-ticker.C:
+		}
+
+		coordinator.mutex.Lock()
+		for workerID, worker := range coordinator.workers {
+			if time.Since(worker.lastSeen) <= coordinator.heartbeatTimeout {
+				continue
+			}
+			delete(coordinator.workers, workerID)
+
+			// Lost tasks go to the front of the queue, as the rest of their batch is likely done already
+			lostTasks := []*pendingTask{}
+			for _, pending := range coordinator.outstandingTasks {
+				if pending.workerID == workerID {
+					pending.workerID = 0
+					lostTasks = append(lostTasks, pending)
+				}
+			}
+			coordinator.queue = append(lostTasks, coordinator.queue...)
+			coordinator.logger.Warn("LOST WORKER", "workerID", workerID, "workerName", worker.name, "numRequeuedTasks", len(lostTasks))
+		}
+		if len(coordinator.queue) > 0 {
+			coordinator.notifyQueueChangedLocked()
+		}
+		coordinator.mutex.Unlock()
+	}
+}
+
+func (coordinator *Coordinator) handleRegister(responseWriter http.ResponseWriter, request *http.Request) {
+	var registerRequest RegisterRequest
+	if err := readGob(request.Body, &registerRequest); err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	coordinator.mutex.Lock()
+	coordinator.lastWorkerID += 1
+	workerID := coordinator.lastWorkerID
+	coordinator.workers[workerID] = &workerRecord{
+		name:       registerRequest.Name,
+		numThreads: registerRequest.NumThreads,
+		lastSeen:   time.Now(),
+	}
+	coordinator.mutex.Unlock()
+	coordinator.logger.Info("REGISTERED WORKER", "workerID", workerID, "workerName", registerRequest.Name, "numThreads", registerRequest.NumThreads)
+
+	writeGobResponse(responseWriter, RegisterResponse{
+		WorkerID:                     workerID,
+		HeartbeatIntervalNanoseconds: int64(coordinator.heartbeatTimeout / 4),
+	})
+}
+
+func (coordinator *Coordinator) handleHeartbeat(responseWriter http.ResponseWriter, request *http.Request) {
+	var workerRequest WorkerRequest
+	if err := readGob(request.Body, &workerRequest); err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	coordinator.mutex.Lock()
+	worker := coordinator.touchWorkerLocked(workerRequest.WorkerID)
+	coordinator.mutex.Unlock()
+	if worker == nil {
+		// The worker was presumed lost, so must register again
+		http.Error(responseWriter, "unknown worker", http.StatusGone)
+	}
+}
+
+// Hand the next queued task to a worker, waiting a while for one if the queue is empty
+func (coordinator *Coordinator) handleTask(responseWriter http.ResponseWriter, request *http.Request) {
+	var workerRequest WorkerRequest
+	if err := readGob(request.Body, &workerRequest); err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Wait less than the heartbeat timeout, so a waiting worker is never presumed lost
+	pollTimer := time.NewTimer(coordinator.heartbeatTimeout / 2)
+	defer pollTimer.Stop()
+	for {
+		coordinator.mutex.Lock()
+		if coordinator.touchWorkerLocked(workerRequest.WorkerID) == nil {
+			coordinator.mutex.Unlock()
+			http.Error(responseWriter, "unknown worker", http.StatusGone)
+			return
+		}
+		if len(coordinator.queue) > 0 {
+			pending := coordinator.queue[0]
+			coordinator.queue = coordinator.queue[1:]
+			pending.workerID = workerRequest.WorkerID
+			// The task is only read from here on, so can be encoded without the lock
+			task := pending.task
+			coordinator.mutex.Unlock()
+			writeGobResponse(responseWriter, task)
+			return
+		}
+		queueChanged := coordinator.queueChanged
+		coordinator.mutex.Unlock()
+
+		select {
+		case <-queueChanged:
+		case <-pollTimer.C:
+			responseWriter.WriteHeader(http.StatusNoContent)
+			return
+		case <-request.Context().Done():
+			return
+		case <-coordinator.closed:
+			responseWriter.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+}
+
+// Record the results of a task, and apply the returns to the agents of its batch
+func (coordinator *Coordinator) handleResult(responseWriter http.ResponseWriter, request *http.Request) {
+	var taskResult TaskResult
+	if err := readGob(request.Body, &taskResult); err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	coordinator.mutex.Lock()
+	defer coordinator.mutex.Unlock()
+	worker := coordinator.touchWorkerLocked(taskResult.WorkerID)
+	workerName := fmt.Sprint(taskResult.WorkerID)
+	if worker != nil {
+		workerName = worker.name
+	}
+
+	// Results are accepted from any worker, even one presumed lost, as long as nobody has finished the task yet
+	pending, outstanding := coordinator.outstandingTasks[taskResult.TaskID]
+	if outstanding {
+		if err := checkTaskResult(pending, taskResult); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+		coordinator.finishTaskLocked(pending, taskResult, workerName)
+	}
+
+	if worker == nil {
+		http.Error(responseWriter, "unknown worker", http.StatusGone)
+	}
+}
+
+func checkTaskResult(pending *pendingTask, taskResult TaskResult) error {
+	if len(taskResult.Results) != len(pending.task.Jobs) {
+		return fmt.Errorf("task %v has %v jobs, but %v results were given", taskResult.TaskID, len(pending.task.Jobs), len(taskResult.Results))
+	}
+	for jobIndex, jobResult := range taskResult.Results {
+		if len(jobResult.Returns) != len(pending.task.Jobs[jobIndex].Chromosomes) {
+			return fmt.Errorf("job %v of task %v has %v agents, but %v returns were given",
+				jobIndex, taskResult.TaskID, len(pending.task.Jobs[jobIndex].Chromosomes), len(jobResult.Returns))
+		}
+	}
+	return nil
+}
+
+// Copy the results of a task into its batch, updating the agents as a local simulation would.
+// The mutex must be held.
+func (coordinator *Coordinator) finishTaskLocked(pending *pendingTask, taskResult TaskResult, workerName string) {
+	delete(coordinator.outstandingTasks, pending.task.TaskID)
+	for queueIndex, queued := range coordinator.queue {
+		if queued == pending {
+			coordinator.queue = append(coordinator.queue[:queueIndex], coordinator.queue[queueIndex+1:]...)
+			break
+		}
+	}
+
+	batch := pending.batch
+	for resultIndex, jobResult := range taskResult.Results {
+		jobIndex := pending.startIndex + resultIndex
+		result := simulator.SimulationResult{
+			Returns:        jobResult.Returns,
+			EpisodeLength:  jobResult.EpisodeLength,
+			TerminalReason: jobResult.TerminalReason,
+		}
+		if jobResult.ErrorMessage != "" {
+			remoteError := &RemoteSimulationError{WorkerName: workerName, Message: jobResult.ErrorMessage}
+			if jobResult.Panic != nil {
+				simulationError := &simulator.SimulationError{
+					AgentIDs:    make([]uint64, len(batch.jobs[jobIndex].Agents)),
+					StateIndex:  jobResult.Panic.StateIndex,
+					StateVector: jobResult.Panic.StateVector,
+					PanicValue:  jobResult.Panic.PanicMessage,
+					Stack:       jobResult.Panic.Stack,
+				}
+				for agentIndex, simulationAgent := range batch.jobs[jobIndex].Agents {
+					simulationError.AgentIDs[agentIndex] = simulationAgent.ID
+				}
+				remoteError.Err = simulationError
+			}
+			result.Err = remoteError
+		}
+
+		for agentIndex, simulationAgent := range batch.jobs[jobIndex].Agents {
+			simulationAgent.StartEpisode()
+			simulationAgent.Score = jobResult.Returns[agentIndex]
+			if result.Err == nil {
+				simulationAgent.EndEpisode()
+			}
+		}
+		batch.results[jobIndex] = result
+		batch.finished[jobIndex] = true
+	}
+
+	batch.numUnfinished -= 1
+	if batch.numUnfinished == 0 {
+		close(batch.allTasksDone)
+	}
+}
@@ -0,0 +1,274 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	basicsystem "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/basicSystem"
+	pongsystem "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/pongSystem"
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	geneticbreeder "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/GeneticBreeder"
+	manager "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Manager"
+	simulator "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Simulator"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// A system whose every simulation panics at its first step
+type panickingSystem struct {
+	basicsystem.BasicSystem
+}
+
+func init() {
+	system.Register("distributedTestPanicking", func() system.System { return &panickingSystem{} })
+}
+
+func (targetSystem *panickingSystem) Name() string {
+	return "distributedTestPanicking"
+}
+func (targetSystem *panickingSystem) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	panic("test panic")
+}
+func (targetSystem *panickingSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
+	panic("test panic")
+}
+
+// Start the given number of workers for the coordinator, stopping them when the test ends
+func startWorkers(t *testing.T, coordinator *Coordinator, numWorkers int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	for workerIndex := 0; workerIndex < numWorkers; workerIndex++ {
+		worker := NewWorker(coordinator.Address(), fmt.Sprintf("test-%v", workerIndex), 2)
+		go worker.Run(ctx)
+	}
+}
+
+// Create pong simulation jobs, and an identical copy of them with separate agents
+func newPongJobs(numJobs int) ([]simulator.SimulationJob, []simulator.SimulationJob) {
+	jobs := make([]simulator.SimulationJob, numJobs)
+	jobCopies := make([]simulator.SimulationJob, numJobs)
+	for jobIndex := range jobs {
+		jobs[jobIndex] = simulator.SimulationJob{Seed: uint64(jobIndex), Seeded: true}
+		jobCopies[jobIndex] = simulator.SimulationJob{Seed: uint64(jobIndex), Seeded: true}
+		for agentIndex := 0; agentIndex < pongsystem.NUM_AGENTS_PER_SIMULATION; agentIndex++ {
+			simulationAgent := agent.NewRandomGaussianAgent(pongsystem.NUM_ACTIONS, pongsystem.NUM_PERCEPTS)
+			jobs[jobIndex].Agents = append(jobs[jobIndex].Agents, simulationAgent)
+			jobCopies[jobIndex].Agents = append(jobCopies[jobIndex].Agents, agent.NewAgent(mat.DenseCopyOf(simulationAgent.Chromosome)))
+		}
+	}
+	return jobs, jobCopies
+}
+
+func TestDistributedMatchesLocal(t *testing.T) {
+	coordinator, err := NewCoordinator("127.0.0.1:0", pongsystem.NewPongSystem(), 3, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coordinator.Close()
+	startWorkers(t, coordinator, 3)
+
+	distributedJobs, localJobs := newPongJobs(20)
+	distributedResults := coordinator.SimulateBatch(context.Background(), distributedJobs)
+
+	localPool := simulator.NewWorkerPool(pongsystem.NewPongSystem(), 2)
+	defer localPool.Close()
+	localResults := localPool.SimulateBatch(context.Background(), localJobs)
+
+	for jobIndex := range distributedJobs {
+		if distributedResults[jobIndex].Err != nil {
+			t.Fatalf("Job %v failed: %v", jobIndex, distributedResults[jobIndex].Err)
+		}
+		if distributedResults[jobIndex].EpisodeLength != localResults[jobIndex].EpisodeLength {
+			t.Errorf("Job %v ran for %v steps remotely but %v locally",
+				jobIndex, distributedResults[jobIndex].EpisodeLength, localResults[jobIndex].EpisodeLength)
+		}
+		for agentIndex, distributedAgent := range distributedJobs[jobIndex].Agents {
+			localAgent := localJobs[jobIndex].Agents[agentIndex]
+			if len(distributedAgent.EpisodeReturns) != 1 || distributedAgent.EpisodeReturns[0] != localAgent.EpisodeReturns[0] {
+				t.Errorf("Job %v agent %v has returns %v remotely but %v locally",
+					jobIndex, agentIndex, distributedAgent.EpisodeReturns, localAgent.EpisodeReturns)
+			}
+		}
+	}
+}
+
+func TestCoordinatorRefusesSystemsWorkersCannotBuild(t *testing.T) {
+	parameters := pongsystem.DefaultPongParameters()
+	parameters.PaddleSize /= 2
+	coordinator, err := NewCoordinator("127.0.0.1:0", pongsystem.NewPongSystemWithParameters(parameters), 3, time.Second)
+	if err == nil {
+		coordinator.Close()
+		t.Fatal("Expected an error for a system with non-default parameters")
+	}
+}
+
+func TestWorkerRefusesMismatchedSystem(t *testing.T) {
+	systemDescription, err := describeSystem(pongsystem.NewPongSystem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parameters := pongsystem.DefaultPongParameters()
+	parameters.PaddleSize /= 2
+	mismatchedDescription, err := describeSystem(pongsystem.NewPongSystemWithParameters(parameters))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worker := NewWorker("127.0.0.1:0", "test", 1)
+	jobs, _ := newPongJobs(2)
+	task := &Task{TaskID: 1, System: systemDescription, Jobs: []Job{newJob(jobs[0]), newJob(jobs[1])}}
+	for jobIndex, jobResult := range worker.simulateTask(context.Background(), task).Results {
+		if jobResult.ErrorMessage != "" {
+			t.Errorf("Job %v of a matching task failed: %v", jobIndex, jobResult.ErrorMessage)
+		}
+	}
+
+	task.System = mismatchedDescription
+	for jobIndex, jobResult := range worker.simulateTask(context.Background(), task).Results {
+		if jobResult.ErrorMessage == "" || jobResult.TerminalReason != simulator.TerminalReasonError {
+			t.Errorf("Expected job %v of a task for a different system to fail, got %v", jobIndex, jobResult.TerminalReason)
+		}
+	}
+	for _, workerPool := range worker.workerPools {
+		workerPool.Close()
+	}
+}
+
+func TestRemotePanicIsSimulationError(t *testing.T) {
+	coordinator, err := NewCoordinator("127.0.0.1:0", &panickingSystem{}, 2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coordinator.Close()
+	startWorkers(t, coordinator, 1)
+
+	jobs := make([]simulator.SimulationJob, 3)
+	for jobIndex := range jobs {
+		jobs[jobIndex].Agents = []*agent.Agent{agent.NewRandomGaussianAgent(basicsystem.NUM_ACTIONS, basicsystem.NUM_PERCEPTS)}
+	}
+	for jobIndex, result := range coordinator.SimulateBatch(context.Background(), jobs) {
+		var remoteError *RemoteSimulationError
+		if !errors.As(result.Err, &remoteError) {
+			t.Fatalf("Expected job %v to fail with a RemoteSimulationError, got %v", jobIndex, result.Err)
+		}
+		var simulationError *simulator.SimulationError
+		if !errors.As(result.Err, &simulationError) {
+			t.Fatalf("Expected job %v to fail with a SimulationError, got %v", jobIndex, result.Err)
+		}
+		if len(simulationError.AgentIDs) != 1 || simulationError.AgentIDs[0] != jobs[jobIndex].Agents[0].ID {
+			t.Errorf("Expected job %v to fail with the coordinator's agent ID %v, got %v", jobIndex, jobs[jobIndex].Agents[0].ID, simulationError.AgentIDs)
+		}
+		if simulationError.StateIndex != 0 || len(simulationError.StateVector) != basicsystem.NUM_PERCEPTS {
+			t.Errorf("Expected job %v to fail in the initial state, got state %v %v", jobIndex, simulationError.StateIndex, simulationError.StateVector)
+		}
+		if simulationError.PanicValue != "test panic" || len(simulationError.Stack) == 0 {
+			t.Errorf("Expected job %v to keep the panic and its stack, got %v", jobIndex, simulationError.PanicValue)
+		}
+	}
+}
+
+// Send a request to the coordinator as a worker would, decoding the response into response
+func postToCoordinator(t *testing.T, coordinator *Coordinator, path string, request interface{}, response interface{}) {
+	body := &bytes.Buffer{}
+	if err := writeGob(body, request); err != nil {
+		t.Fatal(err)
+	}
+	httpResponse, err := http.Post("http://"+coordinator.Address()+path, "application/x-gob", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != http.StatusOK {
+		t.Fatalf("Coordinator responded with %v", httpResponse.Status)
+	}
+	if err := readGob(httpResponse.Body, response); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLostWorkerTasksAreRequeued(t *testing.T) {
+	coordinator, err := NewCoordinator("127.0.0.1:0", pongsystem.NewPongSystem(), 5, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coordinator.Close()
+
+	jobs, _ := newPongJobs(10)
+	resultsChannel := make(chan []simulator.SimulationResult)
+	go func() {
+		resultsChannel <- coordinator.SimulateBatch(context.Background(), jobs)
+	}()
+
+	// A worker that takes a task, then disappears without a result or heartbeat
+	var registerResponse RegisterResponse
+	postToCoordinator(t, coordinator, REGISTER_PATH, RegisterRequest{Name: "lost"}, &registerResponse)
+	var lostTask Task
+	postToCoordinator(t, coordinator, TASK_PATH, WorkerRequest{WorkerID: registerResponse.WorkerID}, &lostTask)
+
+	startWorkers(t, coordinator, 1)
+	select {
+	case results := <-resultsChannel:
+		for jobIndex, result := range results {
+			if result.Err != nil {
+				t.Errorf("Job %v failed: %v", jobIndex, result.Err)
+			}
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("The lost worker's task was never re-queued")
+	}
+	if coordinator.NumWorkers() != 1 {
+		t.Errorf("Expected the lost worker to be dropped, leaving 1 worker, got %v", coordinator.NumWorkers())
+	}
+}
+
+func TestCancelledBatch(t *testing.T) {
+	coordinator, err := NewCoordinator("127.0.0.1:0", pongsystem.NewPongSystem(), 5, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coordinator.Close()
+
+	// With no workers connected nothing can finish before the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	jobs, _ := newPongJobs(4)
+	for jobIndex, result := range coordinator.SimulateBatch(ctx, jobs) {
+		if result.TerminalReason != simulator.TerminalReasonCancelled || result.Err == nil {
+			t.Errorf("Expected job %v to be cancelled, got %v (%v)", jobIndex, result.TerminalReason, result.Err)
+		}
+	}
+}
+
+func TestManagerWithWorkers(t *testing.T) {
+	coordinator, err := NewCoordinator("127.0.0.1:0", &basicsystem.BasicSystem{}, 4, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startWorkers(t, coordinator, 2)
+
+	geneticBreeder := geneticbreeder.NewGeneticBreeder(
+		rand.NewSource(1),
+		[]float64{0.0, 0.0, 1.0},
+		[]float64{0.0, 1.0},
+		1,
+		0.01)
+	distributedManager := manager.NewManager(&basicsystem.BasicSystem{}, 20, 2, 1, geneticBreeder, false,
+		manager.WithOutputRoot(t.TempDir()),
+		manager.WithBatchSimulator(coordinator))
+	defer distributedManager.WriteStop()
+
+	stopReason, err := distributedManager.SimulateManyGenerations(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopReason != manager.StopReasonGenerationLimit {
+		t.Errorf("Expected to stop at the generation limit, got %v", stopReason)
+	}
+}
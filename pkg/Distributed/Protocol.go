@@ -0,0 +1,207 @@
+// Package distributed spreads the simulations of a generation across worker processes,
+// which may be on other machines.
+//
+// A Coordinator runs alongside the Manager (see manager.WithBatchSimulator) and serves HTTP.
+// Workers register with the coordinator, then repeatedly ask it for a task: a batch of simulations,
+// each given as the chromosomes of its agents and a seed. The worker simulates the batch with its own
+// worker pool and posts back the return of every agent.
+//
+// Workers build the system from the registry (see system.Register), so each task describes the system
+// it is for, and a worker refuses tasks for a system that it would build with different constants or
+// parameter values.
+//
+// Workers send heartbeats while they are connected. If a worker misses heartbeats for longer than the
+// coordinator's heartbeat timeout, it is assumed lost and its unfinished tasks are given to other workers.
+//
+// Every message is gob encoded, so that returns such as NaN and infinities survive the trip.
+package distributed
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net/http"
+
+	simulator "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Simulator"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	"gonum.org/v1/gonum/floats"
+)
+
+// The HTTP endpoints served by the coordinator. All take a POST request with a gob encoded body.
+const (
+	// RegisterRequest -> RegisterResponse
+	REGISTER_PATH = "/register"
+	// WorkerRequest -> Task, or http.StatusNoContent if no task became available in time
+	TASK_PATH = "/task"
+	// TaskResult -> nothing
+	RESULT_PATH = "/result"
+	// WorkerRequest -> nothing
+	HEARTBEAT_PATH = "/heartbeat"
+)
+
+// Sent by a worker when it first connects
+type RegisterRequest struct {
+	// A human readable name for the worker, used in logs and errors
+	Name string
+
+	// The number of simulations the worker can run at once
+	NumThreads int
+}
+
+// Sent by the coordinator in response to a RegisterRequest
+type RegisterResponse struct {
+	// The worker must identify itself with this ID in every later request
+	WorkerID uint64
+
+	// How often the worker should send heartbeats
+	HeartbeatIntervalNanoseconds int64
+}
+
+// Sent by a worker to ask for a task, or as a heartbeat
+type WorkerRequest struct {
+	WorkerID uint64
+}
+
+// A batch of simulations for a worker to run
+type Task struct {
+	TaskID uint64
+
+	// The system to simulate
+	System SystemDescription
+
+	Jobs []Job
+}
+
+// Identifies a system, so that a worker can check that the system it builds is the one the coordinator simulates
+type SystemDescription struct {
+	// The name the system is registered with, see system.Register
+	Name string
+
+	// The system's constants (see system.DescribedSystem), formatted with fmt so that the keys are in sorted order
+	Constants string
+
+	// The parameter values of the system's environment, if it is a system.ParameterizedEnvironment
+	ParameterValues []float64
+}
+
+// A single simulation within a task
+type Job struct {
+	// The chromosome of each agent in the simulation, in order
+	Chromosomes []Chromosome
+
+	// The seed of the simulation's episode, see simulator.SimulateSystemWithSeed
+	Seed   uint64
+	Seeded bool
+
+	// See simulator.SimulationJob.MaximumEpisodeLength
+	MaximumEpisodeLength int
+}
+
+// The chromosome matrix of an agent, stored in row major order
+type Chromosome struct {
+	Rows int
+	Cols int
+	Data []float64
+}
+
+// The outcome of a task, sent by the worker once every job is simulated
+type TaskResult struct {
+	WorkerID uint64
+	TaskID   uint64
+
+	// The result of each job, in the same order as the task's jobs
+	Results []JobResult
+}
+
+// The outcome of a single simulation, mirroring simulator.SimulationResult
+type JobResult struct {
+	Returns        []float64
+	EpisodeLength  int
+	TerminalReason simulator.TerminalReason
+
+	// Set if the simulation failed
+	ErrorMessage string
+
+	// Set if the system panicked, describing the *simulator.SimulationError raised on the worker
+	Panic *JobPanic
+}
+
+// The fields of a *simulator.SimulationError that can be sent to the coordinator.
+// The agent IDs are not sent, as the worker's agents are copies with IDs of their own.
+type JobPanic struct {
+	StateIndex  int
+	StateVector []float64
+
+	// The value passed to panic, formatted with fmt
+	PanicMessage string
+	Stack        []byte
+}
+
+// A RemoteSimulationError is the error of a simulation that failed on a worker.
+//
+// If the system panicked, the error wraps a *simulator.SimulationError rebuilt from the worker's report,
+// with the IDs of the coordinator's agents, so errors.As finds it just as for a local simulation.
+type RemoteSimulationError struct {
+	WorkerName string
+	Message    string
+
+	// The rebuilt *simulator.SimulationError, or nil if the system did not panic
+	Err error
+}
+
+func (err *RemoteSimulationError) Error() string {
+	return fmt.Sprintf("simulation on worker %v failed: %v", err.WorkerName, err.Message)
+}
+
+func (err *RemoteSimulationError) Unwrap() error {
+	return err.Err
+}
+
+// Describe a system so that workers can check they simulate the same one.
+// Returns an error if the system has no name to build it from the registry with (see system.DescribedSystem).
+func describeSystem(targetSystem system.System) (SystemDescription, error) {
+	describedSystem, ok := targetSystem.(system.DescribedSystem)
+	if !ok {
+		return SystemDescription{}, fmt.Errorf("system %T has no name for workers to build it from", targetSystem)
+	}
+	description := SystemDescription{
+		Name:      describedSystem.Name(),
+		Constants: fmt.Sprint(describedSystem.Constants()),
+	}
+	if environment, ok := system.AsEnvironment(targetSystem); ok {
+		if parameterizedEnvironment, ok := environment.(system.ParameterizedEnvironment); ok {
+			description.ParameterValues = parameterizedEnvironment.ParameterValues()
+		}
+	}
+	return description, nil
+}
+
+// Returns an error describing the first difference between the two descriptions, or nil if they match
+func (description SystemDescription) compare(other SystemDescription) error {
+	if description.Name != other.Name {
+		return fmt.Errorf("system %q is not %q", description.Name, other.Name)
+	}
+	if description.Constants != other.Constants {
+		return fmt.Errorf("system %q has constants %v, not %v", description.Name, description.Constants, other.Constants)
+	}
+	if !floats.Same(description.ParameterValues, other.ParameterValues) {
+		return fmt.Errorf("system %q has parameter values %v, not %v", description.Name, description.ParameterValues, other.ParameterValues)
+	}
+	return nil
+}
+
+func writeGob(writer io.Writer, value interface{}) error {
+	return gob.NewEncoder(writer).Encode(value)
+}
+
+func readGob(reader io.Reader, value interface{}) error {
+	return gob.NewDecoder(reader).Decode(value)
+}
+
+// Write a gob encoded response, or an internal server error if encoding fails
+func writeGobResponse(responseWriter http.ResponseWriter, value interface{}) {
+	responseWriter.Header().Set("Content-Type", "application/x-gob")
+	if err := writeGob(responseWriter, value); err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+	}
+}
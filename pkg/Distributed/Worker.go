@@ -0,0 +1,300 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	simulator "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Simulator"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	"gonum.org/v1/gonum/mat"
+)
+
+// How long a worker waits before retrying after failing to reach the coordinator
+const WORKER_RETRY_INTERVAL = time.Second
+
+// Returned by requests to the coordinator when it no longer recognises the worker
+var errUnknownWorker = errors.New("coordinator does not recognise this worker")
+
+// A Worker runs simulations for a Coordinator, using a local worker pool of numThreads goroutines.
+//
+// Any system named by the coordinator must be registered in the worker's process (see system.Register),
+// usually by importing the system's package. Tasks for a system that the registry builds with different
+// constants or parameter values than the coordinator's are refused, with every simulation failing.
+type Worker struct {
+	coordinatorURL string
+	name           string
+	numThreads     int
+	client         *http.Client
+	logger         *slog.Logger
+
+	// Set on each registration with the coordinator
+	workerID          atomic.Uint64
+	heartbeatInterval time.Duration
+
+	// A worker pool for each system the coordinator has asked for, created on first use
+	workerPools map[string]*simulator.WorkerPool
+	// The description of the system each worker pool simulates
+	systemDescriptions map[string]SystemDescription
+}
+
+// Create a worker for the coordinator at the given address (for example "localhost:8080" or
+// "http://10.0.0.2:8080"). The name is only used to identify the worker in the coordinator's logs.
+func NewWorker(coordinatorAddress string, name string, numThreads int) *Worker {
+	if numThreads <= 0 {
+		panic("Number of threads must be a positive integer!")
+	}
+	if !strings.Contains(coordinatorAddress, "://") {
+		coordinatorAddress = "http://" + coordinatorAddress
+	}
+	return &Worker{
+		coordinatorURL: strings.TrimSuffix(coordinatorAddress, "/"),
+		name:           name,
+		numThreads:     numThreads,
+		client:         &http.Client{},
+		logger:         slog.Default().With("component", "worker", "workerName", name),
+		workerPools:    make(map[string]*simulator.WorkerPool),
+
+		systemDescriptions: make(map[string]SystemDescription),
+	}
+}
+
+// Run tasks from the coordinator until the context is cancelled.
+//
+// The worker registers with the coordinator, retrying until it is reachable, and registers again
+// if the coordinator ever presumes it lost. A task being simulated when the context is cancelled
+// is abandoned, and the coordinator re-queues it once the worker's heartbeats stop.
+func (worker *Worker) Run(ctx context.Context) {
+	defer func() {
+		for _, workerPool := range worker.workerPools {
+			workerPool.Close()
+		}
+	}()
+
+	for ctx.Err() == nil {
+		if err := worker.register(ctx); err != nil {
+			worker.logger.Warn("COULD NOT REGISTER WITH COORDINATOR", "error", err)
+			worker.wait(ctx)
+			continue
+		}
+		worker.runSession(ctx)
+	}
+}
+
+// Wait before retrying, or until the context is cancelled
+func (worker *Worker) wait(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(WORKER_RETRY_INTERVAL):
+	}
+}
+
+func (worker *Worker) register(ctx context.Context) error {
+	var registerResponse RegisterResponse
+	err := worker.post(ctx, REGISTER_PATH, RegisterRequest{Name: worker.name, NumThreads: worker.numThreads}, &registerResponse)
+	if err != nil {
+		return err
+	}
+	worker.workerID.Store(registerResponse.WorkerID)
+	worker.logger.Info("REGISTERED WITH COORDINATOR", "workerID", registerResponse.WorkerID)
+
+	heartbeatInterval := time.Duration(registerResponse.HeartbeatIntervalNanoseconds)
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = DEFAULT_HEARTBEAT_TIMEOUT / 4
+	}
+	worker.heartbeatInterval = heartbeatInterval
+	return nil
+}
+
+// Take and simulate tasks until the coordinator no longer recognises this worker or the context is cancelled.
+// Heartbeats are sent throughout, so long tasks do not cause the worker to be presumed lost.
+func (worker *Worker) runSession(ctx context.Context) {
+	sessionCtx, endSession := context.WithCancel(ctx)
+	defer endSession()
+	go worker.sendHeartbeats(sessionCtx, endSession)
+
+	for sessionCtx.Err() == nil {
+		task, err := worker.requestTask(sessionCtx)
+		if errors.Is(err, errUnknownWorker) {
+			return
+		}
+		if err != nil {
+			if sessionCtx.Err() == nil {
+				worker.logger.Warn("COULD NOT GET TASK", "error", err)
+				worker.wait(sessionCtx)
+			}
+			continue
+		}
+		if task == nil {
+			continue
+		}
+
+		taskResult := worker.simulateTask(sessionCtx, task)
+		// An abandoned task is incomplete, so is not worth returning
+		if sessionCtx.Err() != nil {
+			return
+		}
+		// Even if the coordinator has forgotten this worker it accepts the result, so only then start a new session
+		if err := worker.post(sessionCtx, RESULT_PATH, taskResult, nil); errors.Is(err, errUnknownWorker) {
+			return
+		} else if err != nil {
+			worker.logger.Warn("COULD NOT RETURN TASK RESULT", "taskID", task.TaskID, "error", err)
+		}
+	}
+}
+
+func (worker *Worker) sendHeartbeats(ctx context.Context, endSession context.CancelFunc) {
+	ticker := time.NewTicker(worker.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := worker.post(ctx, HEARTBEAT_PATH, WorkerRequest{WorkerID: worker.workerID.Load()}, nil)
+		if errors.Is(err, errUnknownWorker) {
+			worker.logger.Warn("COORDINATOR PRESUMED THIS WORKER LOST, REGISTERING AGAIN")
+			endSession()
+			return
+		}
+	}
+}
+
+// Ask the coordinator for a task. Returns a nil task if none became available in time.
+func (worker *Worker) requestTask(ctx context.Context) (*Task, error) {
+	task := &Task{}
+	err := worker.post(ctx, TASK_PATH, WorkerRequest{WorkerID: worker.workerID.Load()}, task)
+	if errors.Is(err, errNoContent) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// Simulate every job of a task. Any job that cannot be simulated (for example because the system
+// is not registered in this process, or differs from the coordinator's) is reported as a failed simulation.
+func (worker *Worker) simulateTask(ctx context.Context, task *Task) TaskResult {
+	taskResult := TaskResult{
+		WorkerID: worker.workerID.Load(),
+		TaskID:   task.TaskID,
+		Results:  make([]JobResult, len(task.Jobs)),
+	}
+
+	workerPool, err := worker.workerPool(task.System)
+	if err != nil {
+		for jobIndex, job := range task.Jobs {
+			taskResult.Results[jobIndex] = JobResult{
+				Returns:        make([]float64, len(job.Chromosomes)),
+				TerminalReason: simulator.TerminalReasonError,
+				ErrorMessage:   err.Error(),
+			}
+		}
+		return taskResult
+	}
+
+	simulationJobs := make([]simulator.SimulationJob, len(task.Jobs))
+	for jobIndex, job := range task.Jobs {
+		simulationJobs[jobIndex] = simulator.SimulationJob{
+			Agents: make([]*agent.Agent, len(job.Chromosomes)),
+			Seed:   job.Seed,
+			Seeded: job.Seeded,
+
+			MaximumEpisodeLength: job.MaximumEpisodeLength,
+		}
+		for agentIndex, chromosome := range job.Chromosomes {
+			simulationJobs[jobIndex].Agents[agentIndex] = agent.NewAgent(mat.NewDense(chromosome.Rows, chromosome.Cols, chromosome.Data))
+		}
+	}
+
+	for jobIndex, result := range workerPool.SimulateBatch(ctx, simulationJobs) {
+		jobResult := JobResult{
+			// The worker pool owns the returns buffer, so it must be copied
+			Returns:        append([]float64(nil), result.Returns...),
+			EpisodeLength:  result.EpisodeLength,
+			TerminalReason: result.TerminalReason,
+		}
+		if result.Err != nil {
+			jobResult.ErrorMessage = result.Err.Error()
+			var simulationError *simulator.SimulationError
+			if errors.As(result.Err, &simulationError) {
+				jobResult.Panic = &JobPanic{
+					StateIndex:   simulationError.StateIndex,
+					StateVector:  simulationError.StateVector,
+					PanicMessage: fmt.Sprint(simulationError.PanicValue),
+					Stack:        simulationError.Stack,
+				}
+			}
+		}
+		taskResult.Results[jobIndex] = jobResult
+	}
+	return taskResult
+}
+
+// Get the worker pool for the described system, refusing a system that this process builds differently
+func (worker *Worker) workerPool(systemDescription SystemDescription) (*simulator.WorkerPool, error) {
+	workerPool, exists := worker.workerPools[systemDescription.Name]
+	if !exists {
+		targetSystem, err := system.NewSystem(systemDescription.Name)
+		if err != nil {
+			return nil, err
+		}
+		workerDescription, err := describeSystem(targetSystem)
+		if err != nil {
+			return nil, err
+		}
+		workerPool = simulator.NewWorkerPool(targetSystem, worker.numThreads)
+		worker.workerPools[systemDescription.Name] = workerPool
+		worker.systemDescriptions[systemDescription.Name] = workerDescription
+	}
+
+	if err := worker.systemDescriptions[systemDescription.Name].compare(systemDescription); err != nil {
+		return nil, fmt.Errorf("worker %v cannot simulate the coordinator's system: %w", worker.name, err)
+	}
+	return workerPool, nil
+}
+
+// Returned by post when the coordinator responds with no content
+var errNoContent = errors.New("no content")
+
+// Send a gob encoded request to the coordinator, decoding the response into response if it is not nil
+func (worker *Worker) post(ctx context.Context, path string, request interface{}, response interface{}) error {
+	body := &bytes.Buffer{}
+	if err := writeGob(body, request); err != nil {
+		return err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, worker.coordinatorURL+path, body)
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/x-gob")
+
+	httpResponse, err := worker.client.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	switch httpResponse.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return errNoContent
+	case http.StatusGone:
+		return errUnknownWorker
+	default:
+		return fmt.Errorf("coordinator responded with %v", httpResponse.Status)
+	}
+	if response == nil {
+		return nil
+	}
+	return readGob(httpResponse.Body, response)
+}
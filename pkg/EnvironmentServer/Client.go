@@ -0,0 +1,114 @@
+package environmentserver
+
+import (
+	"encoding/json"
+	"net"
+)
+
+// A Client plays a single environment served by a Server. It is the reference implementation of the
+// protocol, and is not safe for concurrent use.
+type Client struct {
+	connection net.Conn
+	encoder    *json.Encoder
+	decoder    *json.Decoder
+	spaces     Spaces
+}
+
+// The outcome of a step, see system.Environment.Step
+type StepResult struct {
+	Observations [][]float64
+	Rewards      []float64
+	Terminal     bool
+	Truncated    bool
+	StateIndex   int
+	Info         map[string]interface{}
+}
+
+// Connect to the server at the given network and address (as given to NewServer),
+// and make an environment of the registered system with the given name
+func Dial(network string, address string, systemName string) (*Client, error) {
+	connection, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{
+		connection: connection,
+		encoder:    json.NewEncoder(connection),
+		decoder:    json.NewDecoder(connection),
+	}
+	response, err := client.send(Request{Command: COMMAND_MAKE, System: systemName})
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	client.spaces = *response.Spaces
+	return client, nil
+}
+
+// The sizes of the environment's percepts and actions
+func (client *Client) Spaces() Spaces {
+	return client.spaces
+}
+
+// Start a new episode with the given seed, returning the observation of each agent
+func (client *Client) Reset(seed uint64) ([][]float64, error) {
+	response, err := client.send(Request{Command: COMMAND_RESET, Seed: &seed})
+	if err != nil {
+		return nil, err
+	}
+	return response.Observations, nil
+}
+
+// Advance the episode a single step, given the action of each agent in order
+func (client *Client) Step(actions [][]float64) (StepResult, error) {
+	response, err := client.send(Request{Command: COMMAND_STEP, Actions: actions})
+	if err != nil {
+		return StepResult{}, err
+	}
+	return StepResult{
+		Observations: response.Observations,
+		Rewards:      response.Rewards,
+		Terminal:     response.Terminal,
+		Truncated:    response.Truncated,
+		StateIndex:   response.StateIndex,
+		Info:         response.Info,
+	}, nil
+}
+
+// Get the observation of each agent in the current state
+func (client *Client) Observe() ([][]float64, error) {
+	response, err := client.send(Request{Command: COMMAND_OBSERVE})
+	if err != nil {
+		return nil, err
+	}
+	return response.Observations, nil
+}
+
+// Get the full state of the episode
+func (client *Client) Render() (State, error) {
+	response, err := client.send(Request{Command: COMMAND_RENDER})
+	if err != nil {
+		return State{}, err
+	}
+	return *response.State, nil
+}
+
+// End the session
+func (client *Client) Close() error {
+	return client.connection.Close()
+}
+
+// Send a request and wait for its response, turning any error the server reports into a *ServerError
+func (client *Client) send(request Request) (Response, error) {
+	if err := client.encoder.Encode(request); err != nil {
+		return Response{}, err
+	}
+	var response Response
+	if err := client.decoder.Decode(&response); err != nil {
+		return Response{}, err
+	}
+	if response.Error != "" {
+		return Response{}, &ServerError{Command: request.Command, Message: response.Error}
+	}
+	return response, nil
+}
@@ -0,0 +1,116 @@
+package environmentserver
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/basicSystem"
+	pongsystem "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/pongSystem"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+)
+
+func startServer(t *testing.T, network string, address string) *Server {
+	server, err := NewServer(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+// A remote episode of pong must match the same episode played locally
+func TestRemotePongMatchesLocal(t *testing.T) {
+	for _, network := range []string{"tcp", "unix"} {
+		address := "127.0.0.1:0"
+		if network == "unix" {
+			address = filepath.Join(t.TempDir(), "environment.sock")
+		}
+		server := startServer(t, network, address)
+		client, err := Dial(network, server.Address(), "pong")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		spaces := client.Spaces()
+		if spaces.NumAgents != 2 || spaces.NumPercepts != pongsystem.NUM_PERCEPTS || spaces.NumActions != pongsystem.NUM_ACTIONS {
+			t.Errorf("unexpected spaces %+v", spaces)
+		}
+
+		localPong := pongsystem.NewPongSystem()
+		localState := localPong.Reset(7)
+		localBuffers := system.NewStepBuffers(localPong)
+		observations, err := client.Reset(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Each paddle follows the ball
+		for step := 0; ; step++ {
+			localPong.Observe(localState, 0, localBuffers.Percepts[0])
+			if observations[0][1] != localBuffers.Percepts[0].AtVec(1) {
+				t.Fatalf("%v step %v: remote observation %v does not match local", network, step, observations[0])
+			}
+			actions := [][]float64{{observations[0][1] - observations[0][4]}, {observations[1][1] - observations[1][4]}}
+			result, err := client.Step(actions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			localBuffers.Actions[0].SetVec(0, actions[0][0])
+			localBuffers.Actions[1].SetVec(0, actions[1][0])
+			localTerminal, _, _ := localPong.Step(localState, localBuffers.Actions, localBuffers.Rewards)
+			localRewards := localBuffers.Rewards
+			if result.Rewards[0] != localRewards[0] || result.Rewards[1] != localRewards[1] || result.Terminal != localTerminal {
+				t.Fatalf("%v step %v: remote rewards %v (terminal %v) do not match local %v (terminal %v)",
+					network, step, result.Rewards, result.Terminal, localRewards, localTerminal)
+			}
+			if result.Terminal {
+				break
+			}
+			observations = result.Observations
+		}
+
+		state, err := client.Render()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !state.Terminal || len(state.StateVector) != pongsystem.STATE_VECTOR_LEN {
+			t.Errorf("expected a terminal pong state, got %+v", state)
+		}
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	server := startServer(t, "tcp", "127.0.0.1:0")
+	var serverError *ServerError
+	if _, err := Dial("tcp", server.Address(), "notASystem"); !errors.As(err, &serverError) {
+		t.Errorf("expected a server error for an unknown system, got %v", err)
+	}
+
+	client, err := Dial("tcp", server.Address(), "basic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Step([][]float64{make([]float64, 10)}); !errors.As(err, &serverError) {
+		t.Errorf("expected a server error for a step before reset, got %v", err)
+	}
+	if _, err := client.Reset(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Step([][]float64{{1, 2}}); !errors.As(err, &serverError) {
+		t.Errorf("expected a server error for the wrong number of actions, got %v", err)
+	}
+
+	// The basic system rewards the sum of the actions, then ends
+	result, err := client.Step([][]float64{{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rewards[0] != 55 || !result.Terminal {
+		t.Errorf("expected a terminal step with reward 55, got %+v", result)
+	}
+	if _, err := client.Step([][]float64{make([]float64, 10)}); !errors.As(err, &serverError) {
+		t.Errorf("expected a server error for a step after the episode ended, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+// Package environmentserver exposes registered systems over a local socket, so agents written in
+// other languages (for example Python reinforcement learning agents) can play the Go simulations.
+//
+// The protocol is newline delimited JSON. A client connects (over TCP or a Unix socket), then sends one
+// Request per line, and the server replies to each with exactly one Response line. Each connection is a
+// separate session with its own environment, created by the first request:
+//
+//	-> {"Command": "make", "System": "pong"}
+//	<- {"Spaces": {"SystemName": "pong", "NumAgents": 2, "NumPercepts": 5, "NumActions": 1, ...}}
+//	-> {"Command": "reset", "Seed": 7}
+//	<- {"Observations": [[0, 0.12, -0.8, 0.3, 0], [0, 0.12, 0.8, 0.3, 0]], "StateIndex": 0}
+//	-> {"Command": "step", "Actions": [[0.5], [-0.1]]}
+//	<- {"Observations": [...], "Rewards": [1, 0], "Terminal": false, "Truncated": false, "StateIndex": 1}
+//
+// Any request that fails is answered with a Response holding only an Error, and the session carries on.
+// JSON cannot represent NaN or infinities, so a step producing them is reported as an error.
+//
+// Only systems implementing system.Environment can be served, as other systems fetch their agents'
+// actions themselves (see system.AsEnvironment).
+package environmentserver
+
+import (
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+)
+
+// The commands a client may send
+const (
+	// Create the session's environment from the registered system named by Request.System.
+	// Responds with the Spaces of the environment.
+	COMMAND_MAKE = "make"
+
+	// Responds with the Spaces of the session's environment
+	COMMAND_SPACES = "spaces"
+
+	// Start a new episode, seeded by Request.Seed if it is given.
+	// Responds with the Observations of the initial state.
+	COMMAND_RESET = "reset"
+
+	// Advance the episode a step with Request.Actions, the action of every agent in order.
+	// Responds with the Observations of the new state, the Rewards of the step, and whether the episode is over.
+	COMMAND_STEP = "step"
+
+	// Responds with the Observations of the current state
+	COMMAND_OBSERVE = "observe"
+
+	// Responds with the full State of the episode, for drawing it (e.g. with the visualize scripts)
+	COMMAND_RENDER = "render"
+)
+
+// A single request from a client
+type Request struct {
+	Command string
+
+	// For COMMAND_MAKE, the name the system is registered with (see system.Register)
+	System string `json:",omitempty"`
+
+	// For COMMAND_RESET, the seed of the episode. A random seed is used if this is not given.
+	Seed *uint64 `json:",omitempty"`
+
+	// For COMMAND_STEP, the action of each agent, each of length NumActions
+	Actions [][]float64 `json:",omitempty"`
+}
+
+// The sizes of an environment's percepts and actions
+type Spaces struct {
+	SystemName  string
+	NumAgents   int
+	NumPercepts int
+	NumActions  int
+
+	// The constants the system runs with, if the system describes them (see system.DescribedSystem)
+	Constants map[string]interface{} `json:",omitempty"`
+
+	// The name of each element of the percept and action vectors (see system.Schema),
+	// and of the state vector if the system declares its state
+	PerceptNames []string `json:",omitempty"`
+	ActionNames  []string `json:",omitempty"`
+	StateNames   []string `json:",omitempty"`
+}
+
+// The full state of an episode
+type State struct {
+	StateVector []float64
+	StateIndex  int
+	Terminal    bool
+	Truncated   bool
+}
+
+// The server's reply to a single request. Only the fields relevant to the command are set.
+type Response struct {
+	// Set if the request failed, in which case no other field is set
+	Error string `json:",omitempty"`
+
+	Spaces *Spaces `json:",omitempty"`
+
+	// The percepts of each agent in the current state
+	Observations [][]float64 `json:",omitempty"`
+
+	// The reward each agent earned in the step
+	Rewards []float64 `json:",omitempty"`
+
+	Terminal   bool
+	Truncated  bool
+	StateIndex int
+
+	// Extra information about the step, see system.StepInfo
+	Info system.StepInfo `json:",omitempty"`
+
+	State *State `json:",omitempty"`
+}
+
+// A ServerError is an error reported by the server in reply to a request
+type ServerError struct {
+	Command string
+	Message string
+}
+
+func (err *ServerError) Error() string {
+	return "environment server could not " + err.Command + ": " + err.Message
+}
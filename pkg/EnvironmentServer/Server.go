@@ -0,0 +1,282 @@
+package environmentserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// A Server serves environment sessions to clients, one session per connection (see the package documentation)
+type Server struct {
+	listener net.Listener
+	logger   *slog.Logger
+
+	mutex       sync.Mutex
+	connections map[net.Conn]struct{}
+	closed      bool
+	sessions    sync.WaitGroup
+}
+
+// Create a server listening on the given network and address, for example ("tcp", "127.0.0.1:5555"),
+// ("tcp", "127.0.0.1:0") to pick any free port (see Address), or ("unix", "/tmp/environment.sock").
+//
+// The server is only meant for local use: it has no authentication, so should not be exposed to other machines.
+func NewServer(network string, address string) (*Server, error) {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	server := &Server{
+		listener:    listener,
+		logger:      slog.Default().With("component", "environmentServer"),
+		connections: make(map[net.Conn]struct{}),
+	}
+	go server.serve()
+	return server, nil
+}
+
+// The address the server is listening on, for example "127.0.0.1:40123"
+func (server *Server) Address() string {
+	return server.listener.Addr().String()
+}
+
+// Stop the server, ending every session
+func (server *Server) Close() {
+	server.mutex.Lock()
+	server.closed = true
+	server.listener.Close()
+	for connection := range server.connections {
+		connection.Close()
+	}
+	server.mutex.Unlock()
+	server.sessions.Wait()
+}
+
+func (server *Server) serve() {
+	for {
+		connection, err := server.listener.Accept()
+		if err != nil {
+			server.mutex.Lock()
+			closed := server.closed
+			server.mutex.Unlock()
+			if closed {
+				return
+			}
+			server.logger.Warn("COULD NOT ACCEPT CONNECTION", "error", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		server.mutex.Lock()
+		if server.closed {
+			server.mutex.Unlock()
+			connection.Close()
+			return
+		}
+		server.connections[connection] = struct{}{}
+		server.sessions.Add(1)
+		server.mutex.Unlock()
+
+		go server.runSession(connection)
+	}
+}
+
+// The environment and episode of a single connection
+type session struct {
+	environment system.Environment
+	spaces      Spaces
+
+	// Reused for every step of every episode
+	buffers *system.StepBuffers
+
+	// Nil until the first reset
+	state *systemstate.SystemState
+
+	// Seeds episodes reset without a seed
+	randomGenerator *rand.Rand
+}
+
+// Answer requests from the connection until it is closed
+func (server *Server) runSession(connection net.Conn) {
+	defer func() {
+		server.mutex.Lock()
+		delete(server.connections, connection)
+		server.mutex.Unlock()
+		connection.Close()
+		server.sessions.Done()
+	}()
+	logger := server.logger.With("client", connection.RemoteAddr().String())
+	logger.Debug("SESSION STARTED")
+
+	decoder := json.NewDecoder(connection)
+	encoder := json.NewEncoder(connection)
+	session := &session{randomGenerator: rand.New(rand.NewSource(uint64(time.Now().UnixNano())))}
+	for {
+		var request Request
+		if err := decoder.Decode(&request); err != nil {
+			var syntaxError *json.SyntaxError
+			if errors.As(err, &syntaxError) {
+				// The rest of the stream cannot be trusted, so give up on the session
+				encoder.Encode(Response{Error: "malformed request: " + err.Error()})
+			}
+			logger.Debug("SESSION ENDED", "error", err)
+			return
+		}
+
+		response, err := session.handle(request)
+		if err != nil {
+			response = Response{Error: err.Error()}
+		}
+		if err := encoder.Encode(response); err != nil {
+			// Most likely a NaN or infinity, which JSON cannot represent
+			if err := encoder.Encode(Response{Error: "could not encode response: " + err.Error()}); err != nil {
+				logger.Debug("SESSION ENDED", "error", err)
+				return
+			}
+		}
+	}
+}
+
+func (session *session) handle(request Request) (Response, error) {
+	if request.Command == COMMAND_MAKE {
+		return session.make(request.System)
+	}
+	if session.environment == nil {
+		return Response{}, fmt.Errorf("no environment has been made, send %q first", COMMAND_MAKE)
+	}
+
+	switch request.Command {
+	case COMMAND_SPACES:
+		return Response{Spaces: &session.spaces}, nil
+	case COMMAND_RESET:
+		return session.reset(request.Seed), nil
+	case COMMAND_STEP:
+		return session.step(request.Actions)
+	case COMMAND_OBSERVE:
+		if session.state == nil {
+			return Response{}, fmt.Errorf("no episode has been started, send %q first", COMMAND_RESET)
+		}
+		return session.observationResponse(), nil
+	case COMMAND_RENDER:
+		if session.state == nil {
+			return Response{}, fmt.Errorf("no episode has been started, send %q first", COMMAND_RESET)
+		}
+		return Response{State: &State{
+			StateVector: mat.VecDenseCopyOf(session.state.StateVector).RawVector().Data,
+			StateIndex:  session.state.StateIndex,
+			Terminal:    session.endedWith(systemstate.TerminalReasonTerminal),
+			Truncated:   session.endedWith(systemstate.TerminalReasonTruncated),
+		}}, nil
+	default:
+		return Response{}, fmt.Errorf("unknown command %q", request.Command)
+	}
+}
+
+func (session *session) make(systemName string) (Response, error) {
+	targetSystem, err := system.NewSystem(systemName)
+	if err != nil {
+		return Response{}, err
+	}
+	environment, ok := system.AsEnvironment(targetSystem)
+	if !ok {
+		return Response{}, fmt.Errorf("system %q does not implement system.Environment, so cannot be served", systemName)
+	}
+
+	session.environment = environment
+	session.buffers = system.NewStepBuffers(environment)
+	session.state = nil
+	session.spaces = Spaces{
+		SystemName:  systemName,
+		NumAgents:   environment.NumAgentsPerSimulation(),
+		NumPercepts: environment.NumPercepts(),
+		NumActions:  environment.NumActions(),
+	}
+	if describedSystem, ok := targetSystem.(system.DescribedSystem); ok {
+		session.spaces.Constants = describedSystem.Constants()
+	}
+	schema := system.SchemaOf(targetSystem)
+	session.spaces.PerceptNames = fieldNames(schema.Percepts)
+	session.spaces.ActionNames = fieldNames(schema.Actions)
+	session.spaces.StateNames = fieldNames(schema.State)
+	return Response{Spaces: &session.spaces}, nil
+}
+
+func (session *session) reset(seed *uint64) Response {
+	episodeSeed := session.randomGenerator.Uint64()
+	if seed != nil {
+		episodeSeed = *seed
+	}
+	session.state = session.environment.Reset(episodeSeed)
+	return session.observationResponse()
+}
+
+func (session *session) step(actions [][]float64) (Response, error) {
+	if session.state == nil {
+		return Response{}, fmt.Errorf("no episode has been started, send %q first", COMMAND_RESET)
+	}
+	if session.state.TerminalState {
+		return Response{}, fmt.Errorf("the episode is over, send %q to start another", COMMAND_RESET)
+	}
+	if len(actions) != session.spaces.NumAgents {
+		return Response{}, fmt.Errorf("expected actions for %v agents, got %v", session.spaces.NumAgents, len(actions))
+	}
+	for agentIndex, action := range actions {
+		if len(action) != session.spaces.NumActions {
+			return Response{}, fmt.Errorf("expected %v actions for agent %v, got %v", session.spaces.NumActions, agentIndex, len(action))
+		}
+		copy(session.buffers.Actions[agentIndex].RawVector().Data, action)
+	}
+
+	terminal, truncated, info := session.environment.Step(session.state, session.buffers.Actions, session.buffers.Rewards)
+	session.state.StateIndex += 1
+	session.state.TerminalState = terminal || truncated
+	if truncated && !terminal {
+		session.state.TerminalReason = systemstate.TerminalReasonTruncated
+	}
+
+	response := session.observationResponse()
+	response.Rewards = append([]float64(nil), session.buffers.Rewards...)
+	response.Info = info
+	return response, nil
+}
+
+// Whether the episode is over for the given reason
+func (session *session) endedWith(terminalReason systemstate.TerminalReason) bool {
+	return session.state.TerminalState && session.state.TerminalReason == terminalReason
+}
+
+// A response holding the observations of every agent in the current state
+func (session *session) observationResponse() Response {
+	observations := make([][]float64, session.spaces.NumAgents)
+	for agentIndex := range observations {
+		session.environment.Observe(session.state, agentIndex, session.buffers.Percepts[agentIndex])
+		observations[agentIndex] = mat.VecDenseCopyOf(session.buffers.Percepts[agentIndex]).RawVector().Data
+	}
+	return Response{
+		Observations: observations,
+		Terminal:     session.endedWith(systemstate.TerminalReasonTerminal),
+		Truncated:    session.endedWith(systemstate.TerminalReasonTruncated),
+		StateIndex:   session.state.StateIndex,
+	}
+}
+
+// The names of the given schema fields, or nil if there are none
+func fieldNames(fields []system.Field) []string {
+	if len(fields) == 0 {
+		return nil
+	}
+	names := make([]string, len(fields))
+	for fieldIndex, field := range fields {
+		names[fieldIndex] = field.Name
+	}
+	return names
+}
@@ -0,0 +1,107 @@
+package fitness
+
+import (
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/stat"
+)
+
+// An Aggregator reduces the returns an agent earned over many episodes
+// into the single fitness value used for breeding.
+//
+// Aggregators must not modify the slice of returns they are given.
+// An agent with no recorded episodes is given a fitness of 0.0 by every aggregator.
+type Aggregator interface {
+	Aggregate(episodeReturns []float64) float64
+}
+
+// Fitness is the mean episode return.
+//
+// This is equivalent to the old behavior of summing scores over all repetitions,
+// up to a constant factor, when every agent is simulated the same number of times.
+type Mean struct{}
+
+func (Mean) Aggregate(episodeReturns []float64) float64 {
+	if len(episodeReturns) == 0 {
+		return 0.0
+	}
+	return stat.Mean(episodeReturns, nil)
+}
+
+// Fitness is the median episode return, which ignores a small number of lucky (or unlucky) episodes
+type Median struct{}
+
+func (Median) Aggregate(episodeReturns []float64) float64 {
+	if len(episodeReturns) == 0 {
+		return 0.0
+	}
+	sortedReturns := sortedCopy(episodeReturns)
+	numReturns := len(sortedReturns)
+	if numReturns%2 == 1 {
+		return sortedReturns[numReturns/2]
+	}
+	return (sortedReturns[numReturns/2-1] + sortedReturns[numReturns/2]) / 2.0
+}
+
+// Fitness is the mean episode return after discarding a fraction of the
+// lowest and highest returns.
+//
+// TrimFraction is the fraction removed from *each* end, and should be in [0, 0.5).
+// For example, a TrimFraction of 0.1 with 20 episodes discards the 2 best and 2 worst episodes.
+type TrimmedMean struct {
+	TrimFraction float64
+}
+
+func (aggregator TrimmedMean) Aggregate(episodeReturns []float64) float64 {
+	if len(episodeReturns) == 0 {
+		return 0.0
+	}
+	sortedReturns := sortedCopy(episodeReturns)
+	numTrimmed := int(aggregator.TrimFraction * float64(len(sortedReturns)))
+	// Always keep at least one episode, even if the trim fraction is silly
+	if 2*numTrimmed >= len(sortedReturns) {
+		numTrimmed = (len(sortedReturns) - 1) / 2
+	}
+	return stat.Mean(sortedReturns[numTrimmed:len(sortedReturns)-numTrimmed], nil)
+}
+
+// Fitness is the worst episode return. This rewards agents that are consistently okay
+// over agents that are occasionally brilliant.
+type Minimum struct{}
+
+func (Minimum) Aggregate(episodeReturns []float64) float64 {
+	if len(episodeReturns) == 0 {
+		return 0.0
+	}
+	return floats.Min(episodeReturns)
+}
+
+// Fitness is a lower confidence bound on the mean episode return,
+// i.e. mean - NumStandardErrors * (std / sqrt(numEpisodes)).
+//
+// This penalizes agents with highly variable returns, and agents that have been
+// evaluated only a few times. With fewer than two episodes the standard error is
+// unknown, and the mean is returned instead.
+type LowerConfidenceBound struct {
+	NumStandardErrors float64
+}
+
+func (aggregator LowerConfidenceBound) Aggregate(episodeReturns []float64) float64 {
+	if len(episodeReturns) == 0 {
+		return 0.0
+	}
+	if len(episodeReturns) < 2 {
+		return episodeReturns[0]
+	}
+	mean, std := stat.MeanStdDev(episodeReturns, nil)
+	return mean - aggregator.NumStandardErrors*std/math.Sqrt(float64(len(episodeReturns)))
+}
+
+func sortedCopy(slice []float64) []float64 {
+	sortedSlice := make([]float64, len(slice))
+	copy(sortedSlice, slice)
+	sort.Float64s(sortedSlice)
+	return sortedSlice
+}
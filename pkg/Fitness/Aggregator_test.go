@@ -0,0 +1,38 @@
+package fitness
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAggregators(t *testing.T) {
+	episodeReturns := []float64{4.0, -2.0, 100.0, 1.0, 2.0}
+	testCases := []struct {
+		name       string
+		aggregator Aggregator
+		expected   float64
+	}{
+		{"Mean", Mean{}, 21.0},
+		{"Median", Median{}, 2.0},
+		{"TrimmedMean", TrimmedMean{TrimFraction: 0.2}, 7.0 / 3.0},
+		{"Minimum", Minimum{}, -2.0},
+		{"LowerConfidenceBound", LowerConfidenceBound{NumStandardErrors: 0.0}, 21.0},
+	}
+
+	for _, testCase := range testCases {
+		result := testCase.aggregator.Aggregate(episodeReturns)
+		if math.Abs(result-testCase.expected) > 1e-9 {
+			t.Errorf("%v: expected %v, got %v", testCase.name, testCase.expected, result)
+		}
+		if testCase.aggregator.Aggregate([]float64{}) != 0.0 {
+			t.Errorf("%v: expected empty returns to aggregate to 0.0", testCase.name)
+		}
+	}
+
+	if (LowerConfidenceBound{NumStandardErrors: 2.0}).Aggregate(episodeReturns) >= 21.0 {
+		t.Errorf("LowerConfidenceBound: expected bound to be below the mean")
+	}
+	if episodeReturns[0] != 4.0 || episodeReturns[2] != 100.0 {
+		t.Errorf("aggregators must not modify the episode returns")
+	}
+}
@@ -1,6 +1,8 @@
 package geneticbreeder
 
 import (
+	"encoding"
+	"errors"
 	"sort"
 
 	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
@@ -12,6 +14,8 @@ import (
 )
 
 type GeneticBreeder struct {
+	parameters                  GeneticBreederParameters
+	randomSource                rand.Source
 	randomGenerator             *rand.Rand
 	numParentsDistribution      distuv.Rander
 	kCrossoverDistribution      distuv.Rander
@@ -20,9 +24,18 @@ type GeneticBreeder struct {
 	mutationSegmentDistribution distuv.Rander
 }
 
+// The parameters a GeneticBreeder was created with. See NewGeneticBreeder for their meaning.
+type GeneticBreederParameters struct {
+	NumParentsWeights []float64
+	KCrossoverWeights []float64
+	NumCarryover      int
+	MutationRate      float64
+}
+
 // Create a new genetic breeder with specific parameters
 //
-// randomSource is a random number generator that can be made, for example, with `rand.NewSource(uint64(time.Now().Nanosecond()))`
+// randomSource is a random number generator that can be made, for example, with `rand.NewSource(uint64(time.Now().Nanosecond()))`.
+// Every random choice made in breeding is drawn from it, so breeding is reproducible from its seed.
 //
 // numParentsWeights is the weightings for randomly picking the number of parents during breeding.
 // For example, []float64{0.0, 0.0, 0.5, 0.5} means half chance of 2 parents, and half chance of 3 parents
@@ -60,6 +73,13 @@ func NewGeneticBreeder(
 	mutationSegmentDistribution := distuv.NewCategorical(mutationSegmentWeights, randomSource)
 
 	return &GeneticBreeder{
+		parameters: GeneticBreederParameters{
+			NumParentsWeights: numParentsWeights,
+			KCrossoverWeights: kCrossoverWeights,
+			NumCarryover:      numCarryover,
+			MutationRate:      mutationRate,
+		},
+		randomSource:                randomSource,
 		randomGenerator:             rand.New(randomSource),
 		numParentsDistribution:      numParentsDistribution,
 		kCrossoverDistribution:      kCrossoverDistribution,
@@ -69,15 +89,38 @@ func NewGeneticBreeder(
 	}
 }
 
+// Get the parameters this breeder was created with
+func (gb *GeneticBreeder) Parameters() GeneticBreederParameters {
+	return gb.parameters
+}
+
+// Capture the position of the breeder's random source, so that breeding can later be resumed exactly (see RestoreRandomSource).
+// Returns nil if the source cannot be captured, i.e. does not implement encoding.BinaryMarshaler (as rand.PCGSource does).
+func (gb *GeneticBreeder) SnapshotRandomSource() ([]byte, error) {
+	if marshaler, ok := gb.randomSource.(encoding.BinaryMarshaler); ok {
+		return marshaler.MarshalBinary()
+	}
+	return nil, nil
+}
+
+// Return the breeder's random source to a position captured by SnapshotRandomSource. Nothing is done if data is nil.
+func (gb *GeneticBreeder) RestoreRandomSource(data []byte) error {
+	if data == nil {
+		return nil
+	}
+	unmarshaler, ok := gb.randomSource.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return errors.New("the breeder's random source cannot be restored")
+	}
+	return unmarshaler.UnmarshalBinary(data)
+}
+
 // Given the current generation of agents, as well as the agent scores,
 // calculate the next generation of agents. This is done by, for each new agent
 // 1. Finding the parents of the agent (based on fitness score)
 // 2. Combining those parents in some way (see combineAgents function)
 // 3. Applying any mutations.
 func (gb *GeneticBreeder) NextGeneration(currentGeneration []*agent.Agent) []*agent.Agent {
-	numAgents := len(currentGeneration)
-	newGeneration := make([]*agent.Agent, numAgents)
-
 	sort.Slice(currentGeneration, func(i, j int) bool {
 		return currentGeneration[i].Score > currentGeneration[j].Score
 	})
@@ -86,14 +129,30 @@ func (gb *GeneticBreeder) NextGeneration(currentGeneration []*agent.Agent) []*ag
 	for agentIndex := range currentGeneration {
 		generationScores[agentIndex] = currentGeneration[agentIndex].Score
 	}
+	return gb.NextGenerationWithScores(currentGeneration, generationScores)
+}
+
+// Calculate the next generation of agents as in NextGeneration, but breeding by the given scores
+// rather than each agent's Score (for example, when agents are ranked by more than their fitness).
+//
+// The agents must already be ranked, best first, with the scores in the same order and never increasing,
+// so that the carried over agents are the best. The agents' own Scores are left untouched.
+func (gb *GeneticBreeder) NextGenerationWithScores(rankedGeneration []*agent.Agent, breedingScores []float64) []*agent.Agent {
+	if len(breedingScores) != len(rankedGeneration) {
+		panic("There must be one breeding score per agent!")
+	}
+	currentGeneration := rankedGeneration
+	numAgents := len(currentGeneration)
+	newGeneration := make([]*agent.Agent, numAgents)
 
-	minimumScore := currentGeneration[len(currentGeneration)-1].Score
+	generationScores := append([]float64{}, breedingScores...)
+	minimumScore := generationScores[len(generationScores)-1]
 	if minimumScore < 0 {
 		for index := range generationScores {
 			generationScores[index] -= minimumScore
 		}
 	}
-	maximumScore := currentGeneration[0].Score
+	maximumScore := generationScores[0]
 	if maximumScore <= 0.0 {
 		for index := range generationScores {
 			generationScores[index] -= maximumScore
@@ -221,7 +280,7 @@ func (gb *GeneticBreeder) combineParents(parents []*agent.Agent) *agent.Agent {
 // and perhaps entire sections of a chromosome must be mutated...
 func (gb *GeneticBreeder) applyMutation(agent *agent.Agent) *agent.Agent {
 	// If we do not roll a mutation - don't do anything!
-	if distuv.UnitUniform.Rand() > gb.mutationRate {
+	if gb.randomGenerator.Float64() > gb.mutationRate {
 		return agent
 	}
 
@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+)
+
+// Configuration for evaluating a generation by successive halving, rather than simulating
+// every agent the same number of times.
+//
+// Every agent is first simulated InitialRepetitions times. The agents are then ranked by fitness,
+// and only the best KeepFraction of them survive to the next round. Survivors are simulated
+// InitialRepetitions / KeepFraction^round times in each later round, so each round costs roughly the same
+// number of episodes while concentrating them on the top candidates. Rounds continue until
+// too few agents would survive to fill a single simulation, or until EpisodeBudget is exhausted.
+//
+// An agent's fitness is aggregated over all of its own episodes, but the generation is ranked by the round
+// each agent was eliminated in first (survivors of the last round ranking highest), and only then by fitness.
+// An agent's fitness is left as aggregated, but an agent eliminated early is bred as if its fitness were
+// no higher than that of the agents that outlasted it.
+type SuccessiveHalvingConfig struct {
+	// Number of repetitions every agent receives in the first round. Must be at least 1.
+	InitialRepetitions int
+
+	// Fraction of agents kept after each round. Must be in (0, 1), e.g. 0.5 to halve the agents each round.
+	KeepFraction float64
+
+	// Maximum number of agent-episodes (one agent taking part in one simulation) per generation. Must be at least 1.
+	// The first round is always simulated in full, even if it alone exceeds this budget.
+	EpisodeBudget int
+}
+
+// Evaluate agents adaptively with successive halving. See SuccessiveHalvingConfig for details.
+//
+// Each round is made of full repetitions over the surviving agents, so the number of survivors is always
+// kept a multiple of system.NumAgentsPerSimulation.
+func (manager *Manager) simulateSuccessiveHalving(ctx context.Context) error {
+	config := manager.successiveHalvingConfig
+	numAgentsPerSimulation := manager.system.NumAgentsPerSimulation()
+
+	// Copy the generation, so we can sort and trim the survivors freely
+	activeAgents := make([]*agent.Agent, len(manager.currentGeneration))
+	copy(activeAgents, manager.currentGeneration)
+
+	numEpisodesUsed := 0
+	numRepetitions := 0
+	numRoundRepetitions := config.InitialRepetitions
+	for roundIndex := 0; ; roundIndex++ {
+		// After the first round, only simulate as many repetitions as the budget allows
+		if roundIndex > 0 {
+			affordableRepetitions := (config.EpisodeBudget - numEpisodesUsed) / len(activeAgents)
+			if affordableRepetitions < 1 {
+				break
+			}
+			if numRoundRepetitions > affordableRepetitions {
+				numRoundRepetitions = affordableRepetitions
+			}
+		}
+
+		manager.logger.Info("SUCCESSIVE HALVING ROUND",
+			"generation", manager.generationIndex,
+			"round", roundIndex,
+			"numAgents", len(activeAgents),
+			"numRepetitions", numRoundRepetitions)
+		for repetitionIndex := 0; repetitionIndex < numRoundRepetitions; repetitionIndex++ {
+			if err := manager.simulateRepetition(ctx, activeAgents); err != nil {
+				return err
+			}
+			manager.notifyRepetitionEnd(numRepetitions)
+			manager.logger.Debug("FINISHED REPETITION", "generation", manager.generationIndex, "repetition", numRepetitions)
+			numRepetitions += 1
+		}
+		numEpisodesUsed += len(activeAgents) * numRoundRepetitions
+		for _, activeAgent := range activeAgents {
+			manager.halvingRounds[activeAgent] = roundIndex
+		}
+
+		// Rank the agents that took part in this round, and eliminate the worst
+		manager.aggregateFitness(activeAgents)
+		sort.Slice(activeAgents, func(i, j int) bool {
+			return activeAgents[i].Score > activeAgents[j].Score
+		})
+		numSurvivors := int(float64(len(activeAgents)) * config.KeepFraction)
+		numSurvivors -= numSurvivors % numAgentsPerSimulation
+		if numSurvivors < numAgentsPerSimulation || numSurvivors == len(activeAgents) {
+			break
+		}
+		activeAgents = activeAgents[:numSurvivors]
+		numRoundRepetitions = int(math.Ceil(float64(numRoundRepetitions) / config.KeepFraction))
+	}
+
+	manager.logger.Info("SUCCESSIVE HALVING FINISHED", "generation", manager.generationIndex, "numEpisodes", numEpisodesUsed)
+	return nil
+}
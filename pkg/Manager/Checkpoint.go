@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Everything needed to resume a run from the start of a generation
+type checkpoint struct {
+	GenerationIndex int
+	Chromosomes     []*mat.Dense
+
+	// The positions of the manager's and breeder's random generators at the start of the generation.
+	// The breeder's is nil if its random source cannot be captured (see geneticbreeder.SnapshotRandomSource).
+	ManagerRandomSource []byte
+	BreederRandomSource []byte
+
+	// The system's own state (e.g. what it has learned, see system.GenerationalSystem) at the start of the generation,
+	// or nil if the system is not a system.SnapshottableSystem
+	System []byte
+}
+
+// Capture everything a checkpoint of the current generation needs, before anything in the generation is simulated.
+// Simulating a generation shuffles its agents and advances the random generators, so checkpoints written part way
+// through a generation (e.g. when it is cancelled) are made from what is captured here.
+func (manager *Manager) captureGenerationStart() {
+	generationStart := checkpoint{
+		GenerationIndex: manager.generationIndex,
+		Chromosomes:     make([]*mat.Dense, len(manager.currentGeneration)),
+	}
+	for agentIndex, generationAgent := range manager.currentGeneration {
+		generationStart.Chromosomes[agentIndex] = generationAgent.Chromosome
+	}
+
+	var err error
+	if generationStart.ManagerRandomSource, err = manager.randomSource.MarshalBinary(); err == nil {
+		if generationStart.BreederRandomSource, err = manager.geneticBreeder.SnapshotRandomSource(); err == nil {
+			if snapshottableSystem, ok := manager.system.(system.SnapshottableSystem); ok {
+				generationStart.System, err = snapshottableSystem.SnapshotSystem()
+			}
+		}
+	}
+	manager.generationStart = generationStart
+	manager.generationStartErr = err
+}
+
+// Write the current generation, as it was at the start of the generation, to the given file,
+// so the run can later be resumed with LoadCheckpoint.
+//
+// Along with the chromosomes, the positions of the manager's and breeder's random generators and the system's own state
+// are saved, so a resumed run simulates the generation exactly as it would have been simulated had the run not stopped.
+func (manager *Manager) WriteCheckpoint(checkpointFilePath string) error {
+	if manager.generationStartErr != nil {
+		return manager.generationStartErr
+	}
+
+	// Write to a temporary file first, so a failure part way through never destroys an older checkpoint
+	temporaryFilePath := checkpointFilePath + ".tmp"
+	checkpointFile, err := os.Create(temporaryFilePath)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(checkpointFile).Encode(manager.generationStart); err != nil {
+		checkpointFile.Close()
+		return err
+	}
+	if err := checkpointFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporaryFilePath, checkpointFilePath)
+}
+
+// Replace the current generation with the one saved in the given checkpoint file, and return the random generators
+// and the system to where they were at the start of that generation.
+//
+// The checkpoint must have been written for the same system (i.e. the chromosomes must be the right shape)
+// and the same number of agents, otherwise an error is returned and the manager is left unchanged.
+func (manager *Manager) LoadCheckpoint(checkpointFilePath string) error {
+	checkpointFile, err := os.Open(checkpointFilePath)
+	if err != nil {
+		return err
+	}
+	defer checkpointFile.Close()
+
+	var generationCheckpoint checkpoint
+	if err := gob.NewDecoder(checkpointFile).Decode(&generationCheckpoint); err != nil {
+		return err
+	}
+
+	if len(generationCheckpoint.Chromosomes) != len(manager.currentGeneration) {
+		return fmt.Errorf("checkpoint has %v agents, but the manager has %v", len(generationCheckpoint.Chromosomes), len(manager.currentGeneration))
+	}
+	numActions, numPercepts := manager.system.NumActions(), manager.system.NumPercepts()
+	for agentIndex, chromosome := range generationCheckpoint.Chromosomes {
+		if rows, cols := chromosome.Dims(); rows != numActions || cols != numPercepts {
+			return fmt.Errorf("checkpoint chromosome %v is %vx%v, but the system needs %vx%v", agentIndex, rows, cols, numActions, numPercepts)
+		}
+	}
+
+	if err := manager.randomSource.UnmarshalBinary(generationCheckpoint.ManagerRandomSource); err != nil {
+		return err
+	}
+	if err := manager.geneticBreeder.RestoreRandomSource(generationCheckpoint.BreederRandomSource); err != nil {
+		return err
+	}
+	if snapshottableSystem, ok := manager.system.(system.SnapshottableSystem); ok && generationCheckpoint.System != nil {
+		if err := snapshottableSystem.RestoreSystem(generationCheckpoint.System); err != nil {
+			return err
+		}
+	}
+
+	manager.generationIndex = generationCheckpoint.GenerationIndex
+	manager.currentGeneration = make([]*agent.Agent, len(generationCheckpoint.Chromosomes))
+	for agentIndex, chromosome := range generationCheckpoint.Chromosomes {
+		manager.currentGeneration[agentIndex] = agent.NewAgent(chromosome)
+	}
+	manager.captureGenerationStart()
+	return nil
+}
@@ -0,0 +1,280 @@
+package manager
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	"gonum.org/v1/gonum/stat"
+)
+
+const (
+	// The dashboard endpoints. The page itself is served at "/".
+	DASHBOARD_STATE_PATH  = "/api/state"
+	DASHBOARD_EVENTS_PATH = "/events"
+
+	// Number of buckets in the score histogram of each generation
+	DASHBOARD_HISTOGRAM_BUCKETS = 20
+
+	// Updates queued for a slow dashboard client before further updates to it are dropped
+	dashboardSubscriberBuffer = 4
+)
+
+//go:embed dashboard/index.html
+var dashboardPage []byte
+
+// Serve a live dashboard of the run at http://listenAddress/ while the manager exists.
+// Pass an address such as ":8081", or "127.0.0.1:0" to pick any free port (see DashboardAddress).
+//
+// The dashboard shows the score distribution of every generation, the chromosome of the current best agent
+// as a heatmap, and an animated replay of the latest best agent simulation. The page is updated through
+// server-sent events as each generation is scored, so there is no need to reload it.
+func WithDashboard(listenAddress string) ManagerOption {
+	return func(manager *Manager) {
+		manager.dashboardListenAddress = listenAddress
+	}
+}
+
+// The distribution of fitness within a single generation
+type ScoreDistribution struct {
+	GenerationIndex int
+
+	Min           float64
+	LowerQuartile float64
+	Median        float64
+	UpperQuartile float64
+	Max           float64
+	Mean          float64
+
+	// The number of agents with a score in each of DASHBOARD_HISTOGRAM_BUCKETS equal width buckets from Min to Max
+	Histogram []int
+}
+
+// A chromosome matrix, stored in row major order (rows are actions, columns are percepts)
+type DashboardChromosome struct {
+	Rows int
+	Cols int
+	Data []float64
+}
+
+// Everything the dashboard shows. The state endpoint serves the whole of this,
+// while each event carries only the newest ScoreDistribution.
+type DashboardState struct {
+	RunName    string
+	SystemName string
+
+	History        []ScoreDistribution
+	BestChromosome *DashboardChromosome
+
+	// The state vector at every step of the latest best agent simulation, and the name of each of its elements
+	Replay                [][]float64
+	ReplayStateNames      []string
+	ReplayGenerationIndex int
+}
+
+// The data pushed to the dashboard as each generation is scored
+type DashboardUpdate struct {
+	Distribution     ScoreDistribution
+	BestChromosome   *DashboardChromosome
+	Replay           [][]float64
+	ReplayStateNames []string
+}
+
+// Keeps the dashboard state up to date, and pushes updates to every connected page
+type dashboardObserver struct {
+	BaseObserver
+	manager *Manager
+
+	mutex       sync.Mutex
+	state       DashboardState
+	subscribers map[chan []byte]struct{}
+}
+
+func newDashboardObserver(manager *Manager) *dashboardObserver {
+	return &dashboardObserver{
+		manager: manager,
+		state: DashboardState{
+			RunName:          manager.runName,
+			SystemName:       manager.manifest.SystemName,
+			History:          []ScoreDistribution{},
+			Replay:           [][]float64{},
+			ReplayStateNames: []string{},
+		},
+		subscribers: make(map[chan []byte]struct{}),
+	}
+}
+
+// Summarise the scores of a population
+func newScoreDistribution(generationIndex int, population []*agent.Agent) ScoreDistribution {
+	scores := make([]float64, len(population))
+	for agentIndex, populationAgent := range population {
+		scores[agentIndex] = populationAgent.Score
+	}
+	sort.Float64s(scores)
+
+	distribution := ScoreDistribution{
+		GenerationIndex: generationIndex,
+		Histogram:       make([]int, DASHBOARD_HISTOGRAM_BUCKETS),
+	}
+	if len(scores) == 0 {
+		return distribution
+	}
+	distribution.Min = scores[0]
+	distribution.LowerQuartile = stat.Quantile(0.25, stat.Empirical, scores, nil)
+	distribution.Median = stat.Quantile(0.5, stat.Empirical, scores, nil)
+	distribution.UpperQuartile = stat.Quantile(0.75, stat.Empirical, scores, nil)
+	distribution.Max = scores[len(scores)-1]
+	distribution.Mean = stat.Mean(scores, nil)
+
+	bucketWidth := (distribution.Max - distribution.Min) / DASHBOARD_HISTOGRAM_BUCKETS
+	for _, score := range scores {
+		bucketIndex := 0
+		if bucketWidth > 0 {
+			bucketIndex = int((score - distribution.Min) / bucketWidth)
+		}
+		if bucketIndex >= DASHBOARD_HISTOGRAM_BUCKETS {
+			bucketIndex = DASHBOARD_HISTOGRAM_BUCKETS - 1
+		}
+		distribution.Histogram[bucketIndex] += 1
+	}
+	return distribution
+}
+
+// Record the newly scored generation (and the replay of its best agents, which the built in
+// replay observer has just simulated), then push the update to every connected page
+func (observer *dashboardObserver) OnScored(ctx context.Context, generationIndex int, population []*agent.Agent) {
+	update := DashboardUpdate{
+		Distribution: newScoreDistribution(generationIndex, population),
+		Replay:       observer.manager.latestReplay,
+	}
+	if len(update.Replay) > 0 {
+		update.ReplayStateNames = system.SchemaOf(observer.manager.system).StateNames(len(update.Replay[0]))
+	}
+	if len(population) > 0 {
+		rows, cols := population[0].Chromosome.Dims()
+		chromosome := &DashboardChromosome{Rows: rows, Cols: cols, Data: make([]float64, 0, rows*cols)}
+		for rowIndex := 0; rowIndex < rows; rowIndex++ {
+			for colIndex := 0; colIndex < cols; colIndex++ {
+				chromosome.Data = append(chromosome.Data, population[0].Chromosome.At(rowIndex, colIndex))
+			}
+		}
+		update.BestChromosome = chromosome
+	}
+
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+	observer.state.History = append(observer.state.History, update.Distribution)
+	observer.state.BestChromosome = update.BestChromosome
+	if update.Replay != nil {
+		observer.state.Replay = update.Replay
+		observer.state.ReplayStateNames = update.ReplayStateNames
+		observer.state.ReplayGenerationIndex = generationIndex
+	}
+
+	event, err := json.Marshal(update)
+	if err != nil {
+		observer.manager.logger.Warn("COULD NOT ENCODE DASHBOARD UPDATE", "generation", generationIndex, "error", err)
+		return
+	}
+	for subscriber := range observer.subscribers {
+		// Never let a slow page hold up training
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+func (observer *dashboardObserver) handlePage(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.URL.Path != "/" {
+		http.NotFound(responseWriter, request)
+		return
+	}
+	responseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	responseWriter.Write(dashboardPage)
+}
+
+func (observer *dashboardObserver) handleState(responseWriter http.ResponseWriter, request *http.Request) {
+	observer.mutex.Lock()
+	encodedState, err := json.Marshal(observer.state)
+	observer.mutex.Unlock()
+	if err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.Write(encodedState)
+}
+
+// Stream a DashboardUpdate event as each generation is scored, until the page disconnects
+func (observer *dashboardObserver) handleEvents(responseWriter http.ResponseWriter, request *http.Request) {
+	flusher, ok := responseWriter.(http.Flusher)
+	if !ok {
+		http.Error(responseWriter, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	responseWriter.Header().Set("Content-Type", "text/event-stream")
+	responseWriter.Header().Set("Cache-Control", "no-cache")
+	responseWriter.Header().Set("Connection", "keep-alive")
+
+	subscriber := make(chan []byte, dashboardSubscriberBuffer)
+	observer.mutex.Lock()
+	observer.subscribers[subscriber] = struct{}{}
+	observer.mutex.Unlock()
+	defer func() {
+		observer.mutex.Lock()
+		delete(observer.subscribers, subscriber)
+		observer.mutex.Unlock()
+	}()
+
+	// Send the headers now, so the page knows it is connected (and will receive every later update)
+	responseWriter.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case event := <-subscriber:
+			if _, err := fmt.Fprintf(responseWriter, "event: generation\ndata: %s\n\n", event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Start serving the dashboard, returning the observer that keeps it up to date
+func (manager *Manager) startDashboardServer() (*dashboardObserver, error) {
+	listener, err := net.Listen("tcp", manager.dashboardListenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	observer := newDashboardObserver(manager)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", observer.handlePage)
+	mux.HandleFunc(DASHBOARD_STATE_PATH, observer.handleState)
+	mux.HandleFunc(DASHBOARD_EVENTS_PATH, observer.handleEvents)
+	manager.dashboardListener = listener
+	manager.dashboardServer = &http.Server{Handler: mux}
+	go manager.dashboardServer.Serve(listener)
+
+	manager.logger.Info("SERVING DASHBOARD", "address", listener.Addr().String())
+	return observer, nil
+}
+
+// Get the address the dashboard is served at, or an empty string if the manager was not created with WithDashboard
+func (manager *Manager) DashboardAddress() string {
+	if manager.dashboardListener == nil {
+		return ""
+	}
+	return manager.dashboardListener.Addr().String()
+}
@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// The format of the manager's log records
+type LogFormat int
+
+const (
+	// Human readable key=value records (see slog.TextHandler). This is the default.
+	LogFormatText LogFormat = iota
+
+	// One JSON object per record (see slog.JSONHandler), for parsing by other tools
+	LogFormatJSON
+)
+
+// Set the format of the log, both in the log file and on stdout. See LogFormat.
+func WithLogFormat(format LogFormat) ManagerOption {
+	return func(manager *Manager) {
+		manager.logFormat = format
+	}
+}
+
+// Set the lowest level of log record that is written. Defaults to slog.LevelInfo.
+//
+// At slog.LevelDebug the end of every simulation repetition is also logged.
+func WithLogLevel(level slog.Level) ManagerOption {
+	return func(manager *Manager) {
+		manager.logLevel = level
+	}
+}
+
+// Show (or hide) progress bars while simulating. Progress bars are written to stderr, never to
+// the log, so stdout and the log file contain only log records.
+//
+// By default progress bars are shown only if the manager is verbose.
+func WithProgressBars(enabled bool) ManagerOption {
+	return func(manager *Manager) {
+		manager.showProgressBars = &enabled
+	}
+}
+
+// Create the handler for the manager's log records, writing to the given writer
+func (manager *Manager) newLogHandler(writer io.Writer) slog.Handler {
+	handlerOptions := &slog.HandlerOptions{Level: manager.logLevel}
+	if manager.logFormat == LogFormatJSON {
+		return slog.NewJSONHandler(writer, handlerOptions)
+	}
+	return slog.NewTextHandler(writer, handlerOptions)
+}
+
+// Create a progress bar counting up to max, which is silent unless progress bars are enabled
+func (manager *Manager) newProgressBar(max int, description string) *progressbar.ProgressBar {
+	if manager.showProgressBars == nil || !*manager.showProgressBars || max <= 1 {
+		return progressbar.DefaultSilent(int64(max))
+	}
+	return progressbar.Default(int64(max), description)
+}
+
+// Log the summary of a generation as a single record, so each generation can be parsed from the log
+func (manager *Manager) logGenerationSummary(summary GenerationSummary) {
+	manager.logger.Info("GENERATION SUMMARY",
+		"generation", summary.GenerationIndex,
+		"bestScore", summary.BestScore,
+		"meanScore", summary.MeanScore,
+		"medianScore", summary.MedianScore,
+		"diversity", summary.Diversity,
+		"numSimulations", summary.NumSimulations,
+		"numSimulationSteps", summary.NumSimulationSteps,
+		"numTruncatedSimulations", summary.NumTruncatedSimulations,
+		"numFailedAgents", summary.NumFailedAgents,
+		"workerUtilization", summary.WorkerUtilization,
+		"simulateDuration", summary.SimulateDuration,
+		"replayDuration", summary.ReplayDuration,
+		"collectDuration", summary.CollectDuration,
+		"breedDuration", summary.BreedDuration,
+	)
+}
@@ -1,39 +1,74 @@
 package manager
 
 import (
-	"errors"
+	"context"
 	"io"
-	"log"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
 	"os"
-	"os/signal"
-	"path"
 	"sort"
 	"time"
 
 	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
 	datacollector "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/DataCollector"
+	fitness "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Fitness"
 	geneticbreeder "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/GeneticBreeder"
+	rundirectory "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/RunDirectory"
 	simulator "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Simulator"
 	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
 	"github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/utils"
-	"github.com/schollz/progressbar/v3"
 	"golang.org/x/exp/rand"
 )
 
 const (
-	DATA_DIRECTORY = "data/"
-	LOG_FILE_PATH  = "logs/log"
+	// The name given to runs that are not named with WithRunName
+	DEFAULT_RUN_NAME = "run"
 )
 
 type Manager struct {
 	system                      system.System
-	logger                      *log.Logger
+	runName                     string
+	outputRoot                  string
+	runDirectory                *rundirectory.RunDirectory
+	logger                      *slog.Logger
+	logFormat                   LogFormat
+	logLevel                    slog.Level
+	showProgressBars            *bool
 	generationIndex             int
 	numSimulationsPerGeneration int
 	currentGeneration           []*agent.Agent
+	randomSource                *rand.PCGSource
 	randomGenerator             *rand.Rand
+	seed                        uint64
+	generationStart             checkpoint
+	generationStartErr          error
+	manifest                    Manifest
 	numThreads                  int
 	geneticBreeder              *geneticbreeder.GeneticBreeder
+	fitnessAggregator           fitness.Aggregator
+	successiveHalvingConfig     *SuccessiveHalvingConfig
+	wallClockBudget             time.Duration
+	stoppingCriteria            stoppingCriteria
+	stopReason                  StopReason
+	totalSimulationSteps        int
+	simulationErrorPolicy       SimulationErrorPolicy
+	maximumEpisodeLength        int
+	failedAgents                map[*agent.Agent]struct{}
+	halvingRounds               map[*agent.Agent]int
+	bestEpisodes                map[*agent.Agent]bestEpisode
+	batchSimulator              simulator.BatchSimulator
+	simulationJobs              []simulator.SimulationJob
+	generationSummary           GenerationSummary
+	observers                   []GenerationObserver
+	latestReplay                [][]float64
+	metricsListenAddress        string
+	metricsListener             net.Listener
+	metricsServer               *http.Server
+	dashboardListenAddress      string
+	dashboardListener           net.Listener
+	dashboardServer             *http.Server
 	bestAgentDataCollector      *datacollector.BestAgentDataCollector
 	generationEndDataCollector  *datacollector.GenerationEndDataCollector
 }
@@ -49,12 +84,61 @@ type Manager struct {
 // scores and breeding a new generation. A large number is better, as it averages agent
 // performance.
 //
-// verbose is a bool flag determining if logs are printed to stdout as well as the log file
-func NewManager(system system.System, numAgents int, numSimulationsPerGeneration int, numThreads int, geneticBreeder *geneticbreeder.GeneticBreeder, verbose bool) *Manager {
-	os.MkdirAll(path.Dir(DATA_DIRECTORY), 0700)
-	os.MkdirAll(path.Dir(LOG_FILE_PATH), 0700)
+// verbose is a bool flag determining if logs are printed to stdout as well as the log file,
+// and whether progress bars are shown (see WithProgressBars)
+//
+// Any number of ManagerOptions may be given after these to configure optional behavior (see `Options.go`)
+func NewManager(system system.System, numAgents int, numSimulationsPerGeneration int, numThreads int, geneticBreeder *geneticbreeder.GeneticBreeder, verbose bool, options ...ManagerOption) *Manager {
+	if numThreads <= 0 {
+		panic("Number of threads must be a positive integer!")
+	}
+
+	if numAgents%system.NumAgentsPerSimulation() != 0 {
+		panic("numAgents must be divisible by system.NumAgentsPerSimulation!")
+	}
+
+	manager := &Manager{
+		system:                      system,
+		generationIndex:             0,
+		numSimulationsPerGeneration: numSimulationsPerGeneration,
+		geneticBreeder:              geneticBreeder,
+		fitnessAggregator:           fitness.Mean{},
+		failedAgents:                make(map[*agent.Agent]struct{}),
+		numThreads:                  numThreads,
+		seed:                        uint64(time.Now().UnixNano()),
+		runName:                     DEFAULT_RUN_NAME,
+	}
+	for _, option := range options {
+		option(manager)
+	}
+	if manager.showProgressBars == nil {
+		manager.showProgressBars = &verbose
+	}
+	manager.randomSource = &rand.PCGSource{}
+	manager.randomSource.Seed(manager.seed)
+	manager.randomGenerator = rand.New(manager.randomSource)
+
+	// The initial population is drawn from the manager's generator, so that it is reproducible from the seed
+	manager.currentGeneration = make([]*agent.Agent, numAgents)
+	for agentIndex := range manager.currentGeneration {
+		manager.currentGeneration[agentIndex] = agent.NewSeededRandomGaussianAgent(manager.randomGenerator, system.NumActions(), system.NumPercepts())
+	}
+	manager.captureGenerationStart()
 
-	logFile, err := os.Create(LOG_FILE_PATH)
+	// Now the options are known, we can set up the output of the run
+	var runDirectory *rundirectory.RunDirectory
+	var err error
+	if manager.outputRoot != "" {
+		runDirectory, err = rundirectory.NewRunDirectory(manager.outputRoot)
+	} else {
+		runDirectory, err = rundirectory.NewTimestampedRunDirectory(manager.runName)
+	}
+	if err != nil {
+		panic("Could not create run directory! " + err.Error())
+	}
+	manager.runDirectory = runDirectory
+
+	logFile, err := os.Create(runDirectory.LogFilePath())
 	if err != nil {
 		panic("Could not open log file!")
 	}
@@ -65,159 +149,345 @@ func NewManager(system system.System, numAgents int, numSimulationsPerGeneration
 	} else {
 		multiWriter = io.MultiWriter(logFile)
 	}
-	logger := log.New(multiWriter, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	manager.logger = slog.New(manager.newLogHandler(multiWriter))
+	manager.logger.Info("WRITING RUN OUTPUT", "runDirectory", runDirectory.Root(), "seed", manager.seed)
 
-	currentGeneration := make([]*agent.Agent, numAgents)
-	for agentIndex := range currentGeneration {
-		currentGeneration[agentIndex] = agent.NewRandomGaussianAgent(system.NumActions(), system.NumPercepts())
+	// The manifest is only a record of the run, so failing to write it is not worth stopping for
+	manager.manifest = manager.newManifest()
+	if err := manager.writeManifest(); err != nil {
+		manager.logger.Warn("COULD NOT WRITE MANIFEST", "error", err)
 	}
 
-	if numThreads <= 0 {
-		panic("Number of threads must be a positive integer!")
+	manager.bestAgentDataCollector = datacollector.NewBestAgentDataCollector(runDirectory)
+	manager.generationEndDataCollector = datacollector.NewGenerationEndCollector(runDirectory)
+	if manager.batchSimulator == nil {
+		manager.batchSimulator = simulator.NewWorkerPool(system, numThreads)
 	}
 
-	if numAgents%system.NumAgentsPerSimulation() != 0 {
-		panic("numAgents must be divisible by system.NumAgentsPerSimulation!")
-	}
+	// The built in observers always run first, so user observers see the same data as is saved to disk
+	manager.observers = append([]GenerationObserver{
+		&bestAgentReplayObserver{manager: manager},
+		&dataCollectionObserver{manager: manager},
+	}, manager.observers...)
 
-	randomGenerator := rand.New(rand.NewSource(uint64(time.Now().Nanosecond())))
-
-	return &Manager{
-		system:                      system,
-		logger:                      logger,
-		generationIndex:             0,
-		numSimulationsPerGeneration: numSimulationsPerGeneration,
-		currentGeneration:           currentGeneration,
-		geneticBreeder:              geneticBreeder,
-		numThreads:                  numThreads,
-		randomGenerator:             randomGenerator,
-		bestAgentDataCollector:      datacollector.NewBestAgentDataCollector(DATA_DIRECTORY),
-		generationEndDataCollector:  datacollector.NewGenerationEndCollector(DATA_DIRECTORY),
+	if manager.metricsListenAddress != "" {
+		observer, err := manager.startMetricsServer()
+		if err != nil {
+			panic("Could not start metrics server! " + err.Error())
+		}
+		manager.observers = append(manager.observers, observer)
 	}
+	if manager.dashboardListenAddress != "" {
+		observer, err := manager.startDashboardServer()
+		if err != nil {
+			panic("Could not start dashboard server! " + err.Error())
+		}
+		manager.observers = append(manager.observers, observer)
+	}
+	return manager
+}
+
+// Get the directory that all output of this manager's run is written to
+func (manager *Manager) RunDirectory() *rundirectory.RunDirectory {
+	return manager.runDirectory
 }
 
 // Simulate a single repetition, of which there may be many (always at least one) within a generation
 // This method is not exposed publicly. The intention is for users to call SimulateGeneration instead.
-func (manager *Manager) simulateRepetition() error {
-	numSimulations := len(manager.currentGeneration) / manager.system.NumAgentsPerSimulation()
+//
+// Every agent given takes part in exactly one simulation. The slice is shuffled in place to decide
+// which agents share a simulation, so the number of agents must be divisible by system.NumAgentsPerSimulation.
+func (manager *Manager) simulateRepetition(ctx context.Context, agents []*agent.Agent) error {
+	numAgentsPerSimulation := manager.system.NumAgentsPerSimulation()
+	numSimulations := len(agents) / numAgentsPerSimulation
 
-	// Channel to send collections of agents through to simulation goroutines.
-	// The number of agents sent at once is equal to the number of agents required
-	// for one simulation.
-	agentChannel := make(chan []*agent.Agent, numSimulations)
-	// Channel to receive signals (hence generic struct{}) for when a simulation finishes.
-	simulationFinishedSignalChannel := make(chan struct{})
-	// A simple counter of how many simulations are running
-	simulationsRunningCounter := 0
+	// Shuffle the agents (to avoid bias)
+	utils.ShuffleSlice(manager.randomGenerator, agents)
 
-	// Create a number of goroutines to handle as simulations
-	for i := 0; i < manager.numThreads; i++ {
-		go simulator.ConcurrentSimulationRoutine(manager.system, agentChannel, simulationFinishedSignalChannel)
+	// Collect the agents for each simulation into a job, reusing the job slice between repetitions
+	if cap(manager.simulationJobs) < numSimulations {
+		manager.simulationJobs = make([]simulator.SimulationJob, numSimulations)
+	}
+	simulationJobs := manager.simulationJobs[:numSimulations]
+	for simulationIndex := range simulationJobs {
+		simulationJobs[simulationIndex].Agents = agents[numAgentsPerSimulation*simulationIndex : numAgentsPerSimulation*(simulationIndex+1)]
+		// Seed every simulation from the manager's generator, so the episodes are reproducible from the manager's seed
+		simulationJobs[simulationIndex].Seed = manager.randomGenerator.Uint64()
+		simulationJobs[simulationIndex].Seeded = true
+		simulationJobs[simulationIndex].MaximumEpisodeLength = manager.maximumEpisodeLength
 	}
 
-	// Shuffle the agents (to avoid bias)
-	utils.ShuffleSlice(manager.randomGenerator, manager.currentGeneration)
-
-	// Actually start all the simulations
-	for simulationIndex := 0; simulationIndex < numSimulations; simulationIndex++ {
-		simulationsRunningCounter += 1
-		// Find the agents to be used in this simulation
-		simulationAgents := manager.currentGeneration[manager.system.NumAgentsPerSimulation()*simulationIndex : manager.system.NumAgentsPerSimulation()*(simulationIndex+1)]
-		// Send the agents to the simulators - blocks until agents can be taken
-		agentChannel <- simulationAgents
-	}
-	close(agentChannel)
-
-	// Count any finished simulations and decrement the simulation counter
-	for range simulationFinishedSignalChannel {
-		simulationsRunningCounter -= 1
-		if simulationsRunningCounter <= 0 {
-			break
+	// Hand every simulation to the worker pool (or other batch simulator) at once, and wait for them all to finish
+	simulationResults := manager.batchSimulator.SimulateBatch(ctx, simulationJobs)
+	// A cancelled repetition is incomplete, so the results of the simulations are not worth inspecting
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var simulationErr error
+	for simulationIndex, result := range simulationResults {
+		manager.generationSummary.NumSimulations += 1
+		manager.generationSummary.NumSimulationSteps += result.EpisodeLength
+		if result.TerminalReason == simulator.TerminalReasonTruncated {
+			manager.generationSummary.NumTruncatedSimulations += 1
+		}
+		if result.Err == nil {
+			manager.recordBestEpisodes(simulationJobs[simulationIndex], result)
+			continue
+		}
+
+		manager.logger.Error("SIMULATION FAILED", "generation", manager.generationIndex, "error", result.Err)
+		if manager.simulationErrorPolicy == SimulationErrorPolicyAbort {
+			// Keep only the first error, the rest have already been logged
+			if simulationErr == nil {
+				simulationErr = result.Err
+			}
+			continue
+		}
+		for _, failedAgent := range simulationJobs[simulationIndex].Agents {
+			manager.failedAgents[failedAgent] = struct{}{}
 		}
 	}
 
-	return nil
+	return simulationErr
 }
 
-// Simulate a single generation of the system, updating the data writers and breeding the next generation
-//
-// simulationPerGeneration
-func (manager *Manager) SimulateGeneration() error {
-	defer func() { manager.generationIndex += 1 }()
-	sigintChannel := make(chan os.Signal, 1)
-	signal.Notify(sigintChannel, os.Interrupt)
-
-	manager.logger.Printf("STARTING SIMULATION OF GENERATION %v\n", manager.generationIndex)
-
-	// Use a progressbar to track how far through the simulations we are.
-	// If we are only doing a single generation, use a silent progress bar instead
-	var simulationRepeatsProgressBar *progressbar.ProgressBar
-	if manager.numSimulationsPerGeneration > 1 {
-		simulationRepeatsProgressBar = progressbar.Default(int64(manager.numSimulationsPerGeneration), "SIMULATION REPETITIONS")
-	} else {
-		simulationRepeatsProgressBar = progressbar.DefaultSilent(int64(manager.numSimulationsPerGeneration))
-	}
+// Simulate every agent in the current generation numSimulationsPerGeneration times
+func (manager *Manager) simulateFixedRepetitions(ctx context.Context) error {
+	// Use a progressbar (if enabled) to track how far through the simulations we are
+	simulationRepeatsProgressBar := manager.newProgressBar(manager.numSimulationsPerGeneration, "SIMULATION REPETITIONS")
 
 	// Simulate as many times as required, passing agents through channel to awaiting goroutines
 	for simulationRepeatIndex := 0; simulationRepeatIndex < manager.numSimulationsPerGeneration; simulationRepeatIndex++ {
-		// Handle any keyboard interrupts
-		select {
-		case <-sigintChannel:
-			manager.logger.Println("GOT KEYBOARD INTERRUPT")
-			return errors.New("got keyboard interrupt")
-		default:
-		}
-
-		err := manager.simulateRepetition()
+		err := manager.simulateRepetition(ctx, manager.currentGeneration)
 		if err != nil {
 			return err
 		}
+		manager.notifyRepetitionEnd(simulationRepeatIndex)
+		manager.logger.Debug("FINISHED REPETITION", "generation", manager.generationIndex, "repetition", simulationRepeatIndex)
 		simulationRepeatsProgressBar.Add(1)
 	}
-	manager.logger.Println("FINISHED SIMULATING GENERATION")
+	return nil
+}
+
+// Combine the returns from every simulation into a single fitness for each of the given agents
+//
+// Agents that took part in a failed simulation are given the minimum fitness of the other agents
+func (manager *Manager) aggregateFitness(agents []*agent.Agent) {
+	minimumScore := math.Inf(1)
+	for _, generationAgent := range agents {
+		generationAgent.Score = manager.fitnessAggregator.Aggregate(generationAgent.EpisodeReturns)
+		if _, failed := manager.failedAgents[generationAgent]; !failed {
+			minimumScore = math.Min(minimumScore, generationAgent.Score)
+		}
+	}
 
-	// Find the best agent by score
-	sort.Slice(manager.currentGeneration, func(i, j int) bool {
-		return manager.currentGeneration[i].Score < manager.currentGeneration[j].Score
+	if len(manager.failedAgents) == 0 {
+		return
+	}
+	// If every agent failed there is no sensible minimum, so fall back to zero
+	if math.IsInf(minimumScore, 1) {
+		minimumScore = 0.0
+	}
+	for _, generationAgent := range agents {
+		if _, failed := manager.failedAgents[generationAgent]; failed {
+			generationAgent.Score = minimumScore
+		}
+	}
+}
+
+// Sort the current generation from best to worst, returning the score each agent is bred by.
+//
+// With successive halving, agents that took part in more rounds rank above those eliminated earlier,
+// whatever their own scores, as an agent eliminated after a few lucky episodes must not outrank one that
+// was simulated more. Each agent's breeding score is then its fitness capped at the breeding score of the agent
+// ranked above it, so the breeder (which selects by score) ranks them the same way. The agents' fitness is left as aggregated.
+func (manager *Manager) rankGeneration() []float64 {
+	generation := manager.currentGeneration
+	sort.Slice(generation, func(i, j int) bool {
+		roundI, roundJ := manager.halvingRounds[generation[i]], manager.halvingRounds[generation[j]]
+		if roundI != roundJ {
+			return roundI > roundJ
+		}
+		return generation[i].Score > generation[j].Score
 	})
-	bestAgent := manager.currentGeneration[len(manager.currentGeneration)-1]
-
-	// With the best agent, simulate and save the result
-	manager.logger.Printf("BEST AGENT SCORE: %v\n", bestAgent.Score)
-	manager.logger.Printf("SIMULATING BEST AGENT(S) ")
-	// Get the top n agents, where n is the number of agents needed for the simulation
-	bestAgentArray := make([]*agent.Agent, manager.system.NumAgentsPerSimulation())
-	for bestAgentIndex := range bestAgentArray {
-		bestAgentArray[bestAgentIndex] = manager.currentGeneration[len(manager.currentGeneration)-bestAgentIndex-1]
-	}
-	// Then simulate these and put data into data collector
-	simulationDataCollector := datacollector.NewSimulationDataCollector(DATA_DIRECTORY, "BestAgentSimulation.pq")
-	simulator.SimulateSystemWithSave(manager.system, bestAgentArray, simulationDataCollector)
-	simulationDataCollector.WriteStop()
-	manager.logger.Printf("FINISHED BEST AGENT SIMULATION")
-
-	// Put data into parquet files
-	manager.generationEndDataCollector.CollectGenerationEndData(manager.currentGeneration)
-	manager.bestAgentDataCollector.CollectBestAgentData(bestAgent)
-
-	manager.currentGeneration = manager.geneticBreeder.NextGeneration(manager.currentGeneration)
-	manager.logger.Printf("--------------------------------------------------------------------------------")
-	return nil
+	breedingScores := make([]float64, len(generation))
+	for agentIndex, generationAgent := range generation {
+		breedingScores[agentIndex] = generationAgent.Score
+		if agentIndex > 0 {
+			breedingScores[agentIndex] = math.Min(breedingScores[agentIndex], breedingScores[agentIndex-1])
+		}
+	}
+	return breedingScores
+}
+
+// Flush the data collectors and write a checkpoint of the current generation,
+// so that a cancelled run loses as little as possible
+func (manager *Manager) handleCancellation(cancellationErr error) {
+	manager.logger.Warn("SIMULATION CANCELLED", "generation", manager.generationIndex, "error", cancellationErr)
+	if err := manager.bestAgentDataCollector.Flush(); err != nil {
+		manager.logger.Error("COULD NOT FLUSH BEST AGENT DATA", "error", err)
+	}
+	if err := manager.generationEndDataCollector.Flush(); err != nil {
+		manager.logger.Error("COULD NOT FLUSH GENERATION END DATA", "error", err)
+	}
+	checkpointFilePath := manager.runDirectory.CheckpointFilePath()
+	if err := manager.WriteCheckpoint(checkpointFilePath); err != nil {
+		manager.logger.Error("COULD NOT WRITE CHECKPOINT", "error", err)
+		return
+	}
+	manager.logger.Info("WROTE CHECKPOINT", "generation", manager.generationIndex, "path", checkpointFilePath)
 }
 
-// Simulate many generations in a loop
-func (manager *Manager) SimulateManyGenerations(numGenerations int) {
+// Simulate a single generation of the system, updating the data writers and breeding the next generation
+//
+// By default every agent is simulated numSimulationsPerGeneration times. If the manager was created
+// with WithSuccessiveHalving, the adaptive evaluation scheme is used instead (see `AdaptiveEvaluation.go`).
+//
+// If the context is cancelled the generation is abandoned part way through, the data collectors are flushed,
+// and a checkpoint of the (unscored) generation is written so the run can be resumed with LoadCheckpoint.
+// The context error is then returned.
+func (manager *Manager) SimulateGeneration(ctx context.Context) error {
+	manager.logger.Info("STARTING GENERATION", "generation", manager.generationIndex)
+	manager.generationSummary = GenerationSummary{GenerationIndex: manager.generationIndex}
+	manager.notifyGenerationStart()
+	simulateStartTime := time.Now()
+	utilizationReporter, canReportUtilization := manager.batchSimulator.(simulator.UtilizationReporter)
+	var busyDurationBeforeSimulating time.Duration
+	if canReportUtilization {
+		busyDurationBeforeSimulating = utilizationReporter.BusyDuration()
+	}
+	manager.failedAgents = make(map[*agent.Agent]struct{})
+	manager.halvingRounds = make(map[*agent.Agent]int)
+	manager.bestEpisodes = make(map[*agent.Agent]bestEpisode)
+	// Discard any returns left over from a previously cancelled attempt at this generation
+	for _, generationAgent := range manager.currentGeneration {
+		generationAgent.EpisodeReturns = generationAgent.EpisodeReturns[:0]
+	}
+
 	var err error
+	if manager.successiveHalvingConfig != nil {
+		err = manager.simulateSuccessiveHalving(ctx)
+	} else {
+		err = manager.simulateFixedRepetitions(ctx)
+	}
+	if ctx.Err() != nil {
+		manager.handleCancellation(ctx.Err())
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	manager.generationSummary.SimulateDuration = time.Since(simulateStartTime)
+	if canReportUtilization && manager.generationSummary.SimulateDuration > 0 {
+		busyDuration := utilizationReporter.BusyDuration() - busyDurationBeforeSimulating
+		availableDuration := manager.generationSummary.SimulateDuration * time.Duration(utilizationReporter.Capacity())
+		manager.generationSummary.WorkerUtilization = busyDuration.Seconds() / availableDuration.Seconds()
+	}
+	manager.generationSummary.NumFailedAgents = len(manager.failedAgents)
+	if len(manager.failedAgents) > 0 {
+		manager.logger.Warn("DROPPED AGENTS FROM FAILED SIMULATIONS", "generation", manager.generationIndex, "numFailedAgents", len(manager.failedAgents))
+	}
+	manager.totalSimulationSteps += manager.generationSummary.NumSimulationSteps
+	manager.logger.Info("FINISHED SIMULATING GENERATION",
+		"generation", manager.generationIndex,
+		"numSimulations", manager.generationSummary.NumSimulations,
+		"numSimulationSteps", manager.generationSummary.NumSimulationSteps,
+		"numTruncatedSimulations", manager.generationSummary.NumTruncatedSimulations,
+		"simulateDuration", manager.generationSummary.SimulateDuration)
+
+	manager.aggregateFitness(manager.currentGeneration)
+	breedingScores := manager.rankGeneration()
+	manager.summarizeScores(manager.currentGeneration)
+
+	// Let the observers (including the best agent replay and data collectors) see the scored generation
+	manager.notifyScored(ctx)
+	if ctx.Err() != nil {
+		manager.handleCancellation(ctx.Err())
+		return ctx.Err()
+	}
+
+	// Only now may the system apply what it learned from the generation's episodes,
+	// so that every episode of the generation (and its replay) was simulated by the same system
+	if generationalSystem, ok := manager.system.(system.GenerationalSystem); ok {
+		generationalSystem.EndGeneration()
+	}
+
+	breedStartTime := time.Now()
+	manager.currentGeneration = manager.geneticBreeder.NextGenerationWithScores(manager.currentGeneration, breedingScores)
+	manager.generationSummary.BreedDuration = time.Since(breedStartTime)
+	manager.notifyBred()
+	manager.logGenerationSummary(manager.generationSummary)
+	manager.notifyGenerationEnd()
+
+	manager.generationIndex += 1
+	manager.captureGenerationStart()
+	return nil
+}
+
+// Simulate many generations in a loop, until numGenerations have been simulated
+// or one of the stopping criteria given as ManagerOptions is met.
+//
+// If the manager was created with WithWallClockBudget, the run is cancelled once the budget is spent.
+// This is treated as a normal end to the run rather than an error.
+//
+// Returns the reason the run stopped, and the error that stopped the run if there was one.
+// The stop reason is also logged, and is available afterwards from StopReason.
+func (manager *Manager) SimulateManyGenerations(ctx context.Context, numGenerations int) (StopReason, error) {
+	runContext := ctx
+	if manager.wallClockBudget > 0 {
+		var cancel context.CancelFunc
+		runContext, cancel = context.WithTimeout(ctx, manager.wallClockBudget)
+		defer cancel()
+	}
+
+	stopReason, err := manager.simulateUntilStopped(ctx, runContext, numGenerations)
+	manager.stopReason = stopReason
+	manager.logger.Info("STOPPING RUN", "numGenerations", manager.generationIndex, "stopReason", stopReason)
+	manager.finalizeManifest()
+	manager.notifyRunEnd()
+	return stopReason, err
+}
+
+// Simulate generations with the runContext (which may have a wall clock budget),
+// checking the stopping criteria after each generation
+func (manager *Manager) simulateUntilStopped(ctx context.Context, runContext context.Context, numGenerations int) (StopReason, error) {
 	for generationIndex := 0; generationIndex < numGenerations; generationIndex++ {
-		err = manager.SimulateGeneration()
+		err := manager.SimulateGeneration(runContext)
 		if err != nil {
-			break
+			// Only the wall clock budget has run out, and not the context we were given
+			if runContext.Err() != nil && ctx.Err() == nil {
+				return StopReasonWallClockLimit, nil
+			}
+			if ctx.Err() != nil {
+				return StopReasonCancelled, err
+			}
+			return StopReasonError, err
+		}
+
+		if stopReason := manager.checkStoppingCriteria(); stopReason != StopReasonNone {
+			return stopReason, nil
 		}
 	}
+	return StopReasonGenerationLimit, nil
 }
 
-// Flush contents of data collectors to disk and safely close all files
+// Get the reason the most recent call to SimulateManyGenerations stopped,
+// or StopReasonNone if it has not yet been called
+func (manager *Manager) StopReason() StopReason {
+	return manager.stopReason
+}
+
+// Flush contents of data collectors to disk and safely close all files.
+// This also stops the simulation workers, metrics server and dashboard, so the manager cannot be used afterwards.
 func (manager *Manager) WriteStop() {
+	if manager.metricsServer != nil {
+		manager.metricsServer.Close()
+	}
+	if manager.dashboardServer != nil {
+		manager.dashboardServer.Close()
+	}
+	manager.batchSimulator.Close()
 	manager.bestAgentDataCollector.WriteStop()
 	manager.generationEndDataCollector.WriteStop()
 }
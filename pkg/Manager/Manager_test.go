@@ -0,0 +1,602 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	geneticbreeder "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/GeneticBreeder"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+)
+
+// A system in which a single agent perceives a constant 1.0, and is rewarded with the sum of its actions
+// in a single step. The managers under test need a system that is quick to simulate, and easy to improve at.
+//
+// Each episode's reward also has uniform noise of the given width added, drawn from the episode's generator.
+// If ignoreActions is set, the reward is only the noise, so agents cannot improve.
+type actionSumSystem struct {
+	noise         float64
+	ignoreActions bool
+}
+
+func (targetSystem *actionSumSystem) NumPercepts() int            { return 1 }
+func (targetSystem *actionSumSystem) NumActions() int             { return 10 }
+func (targetSystem *actionSumSystem) NumAgentsPerSimulation() int { return 1 }
+func (targetSystem *actionSumSystem) Name() string                { return "actionSum" }
+func (targetSystem *actionSumSystem) Constants() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+func (targetSystem *actionSumSystem) InitializeState() *systemstate.SystemState {
+	return targetSystem.Reset(0)
+}
+func (targetSystem *actionSumSystem) Reset(seed uint64) *systemstate.SystemState {
+	return systemstate.NewSeededState(seed, targetSystem.InitializeSeededState)
+}
+
+// The state is the constant percept followed by the episode's noise
+func (targetSystem *actionSumSystem) InitializeSeededState(randomGenerator *rand.Rand) *systemstate.SystemState {
+	noise := targetSystem.noise * (randomGenerator.Float64() - 0.5)
+	return &systemstate.SystemState{StateVector: mat.NewVecDense(2, []float64{1.0, noise})}
+}
+func (targetSystem *actionSumSystem) Observe(state *systemstate.SystemState, agentIndex int, percepts *mat.VecDense) {
+	percepts.SetVec(0, state.StateVector.AtVec(0))
+}
+func (targetSystem *actionSumSystem) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	rewards[0] = state.StateVector.AtVec(1)
+	if !targetSystem.ignoreActions {
+		rewards[0] += mat.Sum(actions[0])
+	}
+	return true, false, nil
+}
+func (targetSystem *actionSumSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
+	system.AdvanceEnvironmentState(targetSystem, state, agents, system.NewStepBuffers(targetSystem))
+}
+
+// A breeder with the settings used throughout these tests, seeded afresh for each manager
+func newTestBreeder() *geneticbreeder.GeneticBreeder {
+	return newSeededTestBreeder(uint64(time.Now().Nanosecond()))
+}
+
+// A breeder as newTestBreeder, but with the given seed
+func newSeededTestBreeder(seed uint64) *geneticbreeder.GeneticBreeder {
+	return geneticbreeder.NewGeneticBreeder(
+		rand.NewSource(seed),
+		[]float64{0.0, 0.0, 0.5, 0.5},
+		[]float64{0.0, 0.0, 0.0, 0.2, 0.2, 0.2, 0.2, 0.2},
+		0,
+		math.Pow10(-6))
+}
+
+// A manager of 100 agents in the action sum system, writing its run to a temporary directory.
+// The manager must be stopped with WriteStop once the test is done with it.
+func newTestManager(t *testing.T, numSimulationsPerGeneration int, options ...ManagerOption) *Manager {
+	options = append([]ManagerOption{WithOutputRoot(t.TempDir())}, options...)
+	return NewManager(&actionSumSystem{}, 100, numSimulationsPerGeneration, 8, newTestBreeder(), false, options...)
+}
+
+func TestManagerSeedReproducesInitialPopulation(t *testing.T) {
+	firstManager := newTestManager(t, 1, WithSeed(7))
+	defer firstManager.WriteStop()
+	secondManager := newTestManager(t, 1, WithSeed(7))
+	defer secondManager.WriteStop()
+	for agentIndex, firstAgent := range firstManager.currentGeneration {
+		if !mat.Equal(firstAgent.Chromosome, secondManager.currentGeneration[agentIndex].Chromosome) {
+			t.Fatalf("expected managers with the same seed to create the same initial population, agent %v differs", agentIndex)
+		}
+	}
+}
+
+// An actionSumSystem counting the generations it is told have ended
+type generationalActionSumSystem struct {
+	actionSumSystem
+	numGenerationEnds int
+}
+
+func (targetSystem *generationalActionSumSystem) EndGeneration() {
+	targetSystem.numGenerationEnds += 1
+}
+
+func TestManagerEndsGenerationsOfSystem(t *testing.T) {
+	targetSystem := &generationalActionSumSystem{}
+	testManager := NewManager(targetSystem, 100, 1, 8, newTestBreeder(), false, WithOutputRoot(t.TempDir()))
+	defer testManager.WriteStop()
+	if _, err := testManager.SimulateManyGenerations(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+	if targetSystem.numGenerationEnds != 3 {
+		t.Errorf("expected the system to be told of 3 generation ends, got %v", targetSystem.numGenerationEnds)
+	}
+}
+
+func TestManagerCancellation(t *testing.T) {
+	// A run that runs out of wall clock time ends without error
+	budgetManager := newTestManager(t, 100, WithWallClockBudget(time.Millisecond))
+	stopReason, err := budgetManager.SimulateManyGenerations(context.Background(), 1000000)
+	if err != nil || stopReason != StopReasonWallClockLimit {
+		t.Fatalf("expected wall clock budget to end run without error, got %v (%v)", stopReason, err)
+	}
+	budgetManager.WriteStop()
+
+	// A cancelled run returns the context error, and leaves a checkpoint to resume from
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelledManager := newTestManager(t, 100)
+	if _, err := cancelledManager.SimulateManyGenerations(ctx, 10); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	cancelledManager.WriteStop()
+
+	resumedManager := newTestManager(t, 100)
+	if err := resumedManager.LoadCheckpoint(cancelledManager.RunDirectory().CheckpointFilePath()); err != nil {
+		t.Fatalf("could not load checkpoint: %v", err)
+	}
+	if _, err := resumedManager.SimulateManyGenerations(context.Background(), 1); err != nil {
+		t.Fatalf("could not resume from checkpoint: %v", err)
+	}
+	resumedManager.WriteStop()
+}
+
+// An actionSumSystem with some state of its own, which snapshots capture
+type snapshottableActionSumSystem struct {
+	actionSumSystem
+	ownState byte
+}
+
+func (targetSystem *snapshottableActionSumSystem) SnapshotSystem() ([]byte, error) {
+	return []byte{targetSystem.ownState}, nil
+}
+func (targetSystem *snapshottableActionSumSystem) RestoreSystem(data []byte) error {
+	targetSystem.ownState = data[0]
+	return nil
+}
+
+func TestManagerCheckpointResumesExactly(t *testing.T) {
+	checkpointFilePath := path.Join(t.TempDir(), "checkpoint.gob")
+	originalSystem := &snapshottableActionSumSystem{actionSumSystem: actionSumSystem{noise: 1}, ownState: 7}
+	originalManager := NewManager(originalSystem, 100, 2, 8, newSeededTestBreeder(1), false, WithOutputRoot(t.TempDir()), WithSeed(5))
+	defer originalManager.WriteStop()
+	if err := originalManager.SimulateGeneration(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := originalManager.WriteCheckpoint(checkpointFilePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := originalManager.SimulateGeneration(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A manager with different seeds, resumed from the checkpoint, breeds exactly the same next generation
+	resumedSystem := &snapshottableActionSumSystem{actionSumSystem: actionSumSystem{noise: 1}}
+	resumedManager := NewManager(resumedSystem, 100, 2, 8, newSeededTestBreeder(2), false, WithOutputRoot(t.TempDir()), WithSeed(6))
+	defer resumedManager.WriteStop()
+	if err := resumedManager.LoadCheckpoint(checkpointFilePath); err != nil {
+		t.Fatal(err)
+	}
+	if resumedSystem.ownState != 7 || resumedManager.generationIndex != 1 {
+		t.Errorf("expected the system's own state and the generation index to be restored, got %v and %v", resumedSystem.ownState, resumedManager.generationIndex)
+	}
+	if err := resumedManager.SimulateGeneration(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for agentIndex, originalAgent := range originalManager.currentGeneration {
+		if !mat.Equal(originalAgent.Chromosome, resumedManager.currentGeneration[agentIndex].Chromosome) {
+			t.Fatalf("expected the resumed run to breed the same generation, agent %v differs", agentIndex)
+		}
+	}
+}
+
+// An actionSumSystem whose agents perceive a second percept, which is always zero
+type twoPerceptActionSumSystem struct {
+	actionSumSystem
+}
+
+func (targetSystem *twoPerceptActionSumSystem) NumPercepts() int { return 2 }
+func (targetSystem *twoPerceptActionSumSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
+	system.AdvanceEnvironmentState(targetSystem, state, agents, system.StateStepBuffers(targetSystem, state))
+}
+
+func TestManagerCheckpointMustMatch(t *testing.T) {
+	checkpointFilePath := path.Join(t.TempDir(), "checkpoint.gob")
+	checkpointManager := newTestManager(t, 1)
+	defer checkpointManager.WriteStop()
+	if err := checkpointManager.WriteCheckpoint(checkpointFilePath); err != nil {
+		t.Fatal(err)
+	}
+
+	// A different number of agents
+	smallerManager := NewManager(&actionSumSystem{}, 50, 1, 8, newTestBreeder(), false, WithOutputRoot(t.TempDir()))
+	defer smallerManager.WriteStop()
+	if err := smallerManager.LoadCheckpoint(checkpointFilePath); err == nil {
+		t.Errorf("expected an error loading a checkpoint of 100 agents into a manager of 50")
+	}
+
+	// Chromosomes of a different shape
+	otherSystemManager := NewManager(&twoPerceptActionSumSystem{}, 100, 1, 8, newTestBreeder(), false, WithOutputRoot(t.TempDir()))
+	defer otherSystemManager.WriteStop()
+	if err := otherSystemManager.LoadCheckpoint(checkpointFilePath); err == nil {
+		t.Errorf("expected an error loading chromosomes of the wrong shape")
+	}
+}
+
+func TestManagerStoppingCriteria(t *testing.T) {
+	testCases := []struct {
+		targetSystem       *actionSumSystem
+		option             ManagerOption
+		numGenerations     int
+		expectedStopReason StopReason
+		// The number of generations simulated before stopping, or -1 if it depends on timing
+		expectedNumGenerations int
+	}{
+		{&actionSumSystem{}, WithTargetFitness(-math.MaxFloat64), 5, StopReasonTargetFitness, 1},
+		{&actionSumSystem{}, WithMinimumDiversity(math.MaxFloat64), 5, StopReasonLowDiversity, 1},
+		{&actionSumSystem{}, WithSimulationStepBudget(1), 5, StopReasonStepBudget, 1},
+		{&actionSumSystem{}, WithPatience(1000), 5, StopReasonGenerationLimit, 5},
+		// Every agent scores zero, so the first generation's best is never beaten, and two more generations exhaust the patience
+		{&actionSumSystem{ignoreActions: true}, WithPatience(2), 5, StopReasonNoImprovement, 3},
+		// Far more generations than could be simulated in the budget
+		{&actionSumSystem{}, WithWallClockBudget(10 * time.Millisecond), 1000000, StopReasonWallClockLimit, -1},
+	}
+	for _, testCase := range testCases {
+		testManager := NewManager(testCase.targetSystem, 100, 10, 8, newTestBreeder(), false, WithOutputRoot(t.TempDir()), testCase.option)
+		stopReason, err := testManager.SimulateManyGenerations(context.Background(), testCase.numGenerations)
+		testManager.WriteStop()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stopReason != testCase.expectedStopReason || testManager.StopReason() != testCase.expectedStopReason {
+			t.Errorf("expected stop reason %q, got %q", testCase.expectedStopReason, stopReason)
+		}
+		if testCase.expectedNumGenerations >= 0 && testManager.generationIndex != testCase.expectedNumGenerations {
+			t.Errorf("expected to stop with %q after %v generations, stopped after %v",
+				testCase.expectedStopReason, testCase.expectedNumGenerations, testManager.generationIndex)
+		}
+
+		manifest, err := ReadManifest(testManager.RunDirectory().ManifestFilePath())
+		if err != nil {
+			t.Fatalf("could not read manifest: %v", err)
+		}
+		if manifest.StopReason != stopReason || manifest.EndTime == nil || manifest.SystemName != "actionSum" || manifest.Manager.NumAgents != 100 {
+			t.Errorf("manifest does not describe the run: %+v", manifest)
+		}
+	}
+}
+
+// Counts how many times each callback is called
+type countingObserver struct {
+	BaseObserver
+	numGenerationStarts int
+	numRepetitionEnds   int
+	numScored           int
+	numBred             int
+	numGenerationEnds   int
+	numRunEnds          int
+}
+
+func (observer *countingObserver) OnGenerationStart(generationIndex int) {
+	observer.numGenerationStarts += 1
+}
+func (observer *countingObserver) OnRepetitionEnd(generationIndex int, repetitionIndex int) {
+	observer.numRepetitionEnds += 1
+}
+func (observer *countingObserver) OnScored(ctx context.Context, generationIndex int, population []*agent.Agent) {
+	observer.numScored += 1
+}
+func (observer *countingObserver) OnBred(generationIndex int, newPopulation []*agent.Agent) {
+	observer.numBred += 1
+}
+func (observer *countingObserver) OnGenerationEnd(summary GenerationSummary) {
+	observer.numGenerationEnds += 1
+}
+func (observer *countingObserver) OnRunEnd(stopReason StopReason) {
+	observer.numRunEnds += 1
+}
+
+func TestManagerObserver(t *testing.T) {
+
+	observer := &countingObserver{}
+	testManager := newTestManager(t, 3, WithObserver(observer))
+	if _, err := testManager.SimulateManyGenerations(context.Background(), 5); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testManager.WriteStop()
+
+	if observer.numGenerationStarts != 5 || observer.numScored != 5 || observer.numBred != 5 || observer.numGenerationEnds != 5 {
+		t.Errorf("expected each generation callback 5 times, got %+v", observer)
+	}
+	if observer.numRepetitionEnds != 15 {
+		t.Errorf("expected 15 repetitions, got %v", observer.numRepetitionEnds)
+	}
+	if observer.numRunEnds != 1 {
+		t.Errorf("expected a single run end, got %v", observer.numRunEnds)
+	}
+}
+
+func TestManagerJSONLog(t *testing.T) {
+	testManager := newTestManager(t, 3,
+		WithLogFormat(LogFormatJSON),
+		WithLogLevel(slog.LevelDebug))
+	if _, err := testManager.SimulateManyGenerations(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	testManager.WriteStop()
+
+	logFile, err := os.Open(testManager.RunDirectory().LogFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+
+	// Every line of the log must be a JSON record, with one summary per generation
+	numSummaries := 0
+	numRepetitions := 0
+	scanner := bufio.NewScanner(logFile)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", scanner.Text(), err)
+		}
+		switch record["msg"] {
+		case "GENERATION SUMMARY":
+			if record["generation"] != float64(numSummaries) {
+				t.Errorf("expected summary of generation %v, got %v", numSummaries, record["generation"])
+			}
+			if _, ok := record["bestScore"].(float64); !ok {
+				t.Errorf("expected a numeric best score in the summary, got %v", record["bestScore"])
+			}
+			numSummaries += 1
+		case "FINISHED REPETITION":
+			numRepetitions += 1
+		}
+	}
+	if numSummaries != 2 || numRepetitions != 2*3 {
+		t.Errorf("expected 2 generation summaries and 6 repetitions, got %v and %v", numSummaries, numRepetitions)
+	}
+}
+
+func TestManagerMetrics(t *testing.T) {
+	testManager := newTestManager(t, 3,
+		WithMetricsServer("127.0.0.1:0"))
+	defer testManager.WriteStop()
+	if _, err := testManager.SimulateManyGenerations(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Scrape the metrics as Prometheus would, and parse the samples
+	response, err := http.Get("http://" + testManager.MetricsAddress() + METRICS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "#") {
+			continue
+		}
+		fields := strings.Fields(scanner.Text())
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if len(fields) != 2 || err != nil {
+			t.Fatalf("could not parse sample %q", scanner.Text())
+		}
+		samples[fields[0]] = value
+	}
+
+	expectedSamples := map[string]float64{
+		"genetic_learning_generations_total": 2,
+		"genetic_learning_generation_index":  1,
+		"genetic_learning_simulations_total": 2 * 3 * 100,
+	}
+	for name, expected := range expectedSamples {
+		if samples[name] != expected {
+			t.Errorf("expected %v to be %v, got %v", name, expected, samples[name])
+		}
+	}
+	for _, name := range []string{"genetic_learning_best_score", "genetic_learning_worker_utilization", `genetic_learning_phase_duration_seconds{phase="simulate"}`} {
+		if _, exists := samples[name]; !exists {
+			t.Errorf("expected a sample for %v", name)
+		}
+	}
+	if utilization := samples["genetic_learning_worker_utilization"]; utilization <= 0 || utilization > 1 {
+		t.Errorf("expected worker utilization in (0, 1], got %v", utilization)
+	}
+}
+
+func TestManagerDashboard(t *testing.T) {
+	testManager := newTestManager(t, 3,
+		WithDashboard("127.0.0.1:0"))
+	defer testManager.WriteStop()
+	dashboardURL := "http://" + testManager.DashboardAddress()
+
+	// Connect to the event stream before training, so every update is received
+	events, err := http.Get(dashboardURL + DASHBOARD_EVENTS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Body.Close()
+
+	if _, err := testManager.SimulateManyGenerations(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var update DashboardUpdate
+	scanner := bufio.NewScanner(events.Body)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		if data, isData := strings.CutPrefix(scanner.Text(), "data: "); isData {
+			if err := json.Unmarshal([]byte(data), &update); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	if update.Distribution.GenerationIndex != 0 || update.BestChromosome == nil || len(update.Replay) == 0 {
+		t.Errorf("expected an update for generation 0 with a chromosome and replay, got %+v", update.Distribution)
+	}
+
+	response, err := http.Get(dashboardURL + DASHBOARD_STATE_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var state DashboardState
+	if err := json.NewDecoder(response.Body).Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.History) != 2 {
+		t.Fatalf("expected 2 generations of history, got %v", len(state.History))
+	}
+	for _, distribution := range state.History {
+		if distribution.Min > distribution.Median || distribution.Median > distribution.Max {
+			t.Errorf("score distribution out of order: %+v", distribution)
+		}
+		numAgents := 0
+		for _, count := range distribution.Histogram {
+			numAgents += count
+		}
+		if numAgents != 100 {
+			t.Errorf("expected the histogram to count 100 agents, got %v", numAgents)
+		}
+	}
+	if rows, cols := state.BestChromosome.Rows, state.BestChromosome.Cols; len(state.BestChromosome.Data) != rows*cols {
+		t.Errorf("expected %vx%v chromosome values, got %v", rows, cols, len(state.BestChromosome.Data))
+	}
+
+	page, err := http.Get(dashboardURL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.Body.Close()
+	if page.StatusCode != http.StatusOK || !strings.HasPrefix(page.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("expected the dashboard page, got %v %v", page.Status, page.Header.Get("Content-Type"))
+	}
+}
+
+// Records how many episodes each agent of the scored population took part in, its fitness,
+// and the mean of its episode returns, in rank order
+type rankingObserver struct {
+	BaseObserver
+	numEpisodes []int
+	scores      []float64
+	meanReturns []float64
+}
+
+func (observer *rankingObserver) OnScored(ctx context.Context, generationIndex int, population []*agent.Agent) {
+	observer.numEpisodes = observer.numEpisodes[:0]
+	observer.scores = observer.scores[:0]
+	observer.meanReturns = observer.meanReturns[:0]
+	for _, populationAgent := range population {
+		observer.numEpisodes = append(observer.numEpisodes, len(populationAgent.EpisodeReturns))
+		observer.scores = append(observer.scores, populationAgent.Score)
+		observer.meanReturns = append(observer.meanReturns, stat.Mean(populationAgent.EpisodeReturns, nil))
+	}
+}
+
+func TestManagerSuccessiveHalving(t *testing.T) {
+	observer := &rankingObserver{}
+	// Noise much larger than the differences between agents, so agents eliminated early often score more than survivors
+	testManager := NewManager(&actionSumSystem{noise: 100}, 100, 10, 8, newTestBreeder(), false,
+		WithOutputRoot(t.TempDir()),
+		WithObserver(observer),
+		WithSuccessiveHalving(SuccessiveHalvingConfig{
+			InitialRepetitions: 2,
+			KeepFraction:       0.5,
+			EpisodeBudget:      1000,
+		}))
+	defer testManager.WriteStop()
+
+	for generationIndex := 0; generationIndex < 3; generationIndex++ {
+		if err := testManager.SimulateGeneration(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Rounds of 100 agents x 2 episodes, 50 x 4, 25 x 8, 12 x 16 and 6 x 32, after which the budget
+		// allows only 3 x 5 and then 1 x 1 episodes. So each agent's episode count gives the round it was eliminated in.
+		expectedNumAgents := map[int]int{2: 50, 6: 25, 14: 13, 30: 6, 62: 3, 67: 2, 68: 1}
+		numAgents := map[int]int{}
+		totalEpisodes := 0
+		for _, numEpisodes := range observer.numEpisodes {
+			numAgents[numEpisodes] += 1
+			totalEpisodes += numEpisodes
+		}
+		if totalEpisodes != 1000 {
+			t.Errorf("expected the whole budget of 1000 episodes to be spent, got %v", totalEpisodes)
+		}
+		for numEpisodes, expected := range expectedNumAgents {
+			if numAgents[numEpisodes] != expected {
+				t.Errorf("expected %v agents with %v episodes, got %v (%v)", expected, numEpisodes, numAgents[numEpisodes], numAgents)
+			}
+		}
+
+		// Agents that lasted longer rank first, and agents eliminated in the same round are ranked by fitness
+		for agentIndex := 1; agentIndex < len(observer.numEpisodes); agentIndex++ {
+			if observer.numEpisodes[agentIndex] > observer.numEpisodes[agentIndex-1] {
+				t.Fatalf("agent %v lasted %v episodes, but is ranked below an agent eliminated after %v",
+					agentIndex, observer.numEpisodes[agentIndex], observer.numEpisodes[agentIndex-1])
+			}
+			if observer.numEpisodes[agentIndex] == observer.numEpisodes[agentIndex-1] && observer.scores[agentIndex] > observer.scores[agentIndex-1] {
+				t.Fatalf("agent %v has fitness %v, above the fitness %v of the agent eliminated in the same round ranked above it",
+					agentIndex, observer.scores[agentIndex], observer.scores[agentIndex-1])
+			}
+		}
+
+		// The ranking must not change the fitness, which stays the mean of each agent's returns
+		for agentIndex, score := range observer.scores {
+			if math.Abs(score-observer.meanReturns[agentIndex]) > 1e-9 {
+				t.Fatalf("agent %v has fitness %v, but its returns have mean %v", agentIndex, score, observer.meanReturns[agentIndex])
+			}
+		}
+	}
+}
+
+func TestManagerSuccessiveHalvingNeedsBudget(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for an episode budget of 0")
+		}
+	}()
+	WithSuccessiveHalving(SuccessiveHalvingConfig{InitialRepetitions: 2, KeepFraction: 0.5})
+}
+
+// A system whose single step rewards the agent with noise from the global generator, so it ignores any seed
+type unseededNoiseSystem struct{}
+
+func (targetSystem *unseededNoiseSystem) NumPercepts() int            { return 1 }
+func (targetSystem *unseededNoiseSystem) NumActions() int             { return 10 }
+func (targetSystem *unseededNoiseSystem) NumAgentsPerSimulation() int { return 1 }
+func (targetSystem *unseededNoiseSystem) InitializeState() *systemstate.SystemState {
+	return &systemstate.SystemState{StateVector: mat.NewVecDense(1, []float64{1.0})}
+}
+func (targetSystem *unseededNoiseSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
+	agents[0].Score += rand.Float64()
+	state.StateIndex += 1
+	state.TerminalState = true
+}
+
+// Replays are only expected to match for systems that honour the seed
+func TestReplaysExactly(t *testing.T) {
+	if !replaysExactly(&actionSumSystem{noise: 1}) {
+		t.Errorf("Expected an environment to replay exactly")
+	}
+	if !replaysExactly(system.NewEnvironmentSystem(&actionSumSystem{noise: 1})) {
+		t.Errorf("Expected an adapted environment to replay exactly")
+	}
+	if replaysExactly(&unseededNoiseSystem{}) {
+		t.Errorf("Expected a system without seeded episodes not to replay exactly")
+	}
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	geneticbreeder "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/GeneticBreeder"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+)
+
+// The parameters a Manager was created with, including any options
+type ManagerParameters struct {
+	NumAgents                   int
+	NumSimulationsPerGeneration int
+	NumThreads                  int
+	FitnessAggregator           string
+	SuccessiveHalving           *SuccessiveHalvingConfig
+	SimulationErrorPolicy       SimulationErrorPolicy
+	MaximumEpisodeLength        int
+	WallClockBudget             time.Duration
+	TargetFitness               *float64
+	Patience                    int
+	MinimumDiversity            float64
+	SimulationStepBudget        int
+}
+
+// A Manifest records everything needed to know what produced the output of a run.
+// It is written as JSON to the root of the run directory when the manager is created,
+// and rewritten with the end time and stop reason once the run finishes.
+type Manifest struct {
+	RunName string
+
+	SystemName      string
+	SystemConstants map[string]interface{}
+
+	Manager        ManagerParameters
+	GeneticBreeder geneticbreeder.GeneticBreederParameters
+
+	// The seed of the manager random generator (initial population, agent shuffling and episode seeds, see WithSeed)
+	Seed uint64
+
+	GoVersion   string
+	VCSRevision string
+	VCSTime     string
+	VCSModified bool
+	Hostname    string
+
+	StartTime time.Time
+	// EndTime and StopReason are only set once the run has finished
+	EndTime        *time.Time
+	StopReason     StopReason
+	NumGenerations int
+}
+
+// Create the manifest describing this manager's run
+func (manager *Manager) newManifest() Manifest {
+	manifest := Manifest{
+		RunName:    manager.runName,
+		SystemName: fmt.Sprintf("%T", manager.system),
+		Manager: ManagerParameters{
+			NumAgents:                   len(manager.currentGeneration),
+			NumSimulationsPerGeneration: manager.numSimulationsPerGeneration,
+			NumThreads:                  manager.numThreads,
+			FitnessAggregator:           fmt.Sprintf("%T%+v", manager.fitnessAggregator, manager.fitnessAggregator),
+			SuccessiveHalving:           manager.successiveHalvingConfig,
+			SimulationErrorPolicy:       manager.simulationErrorPolicy,
+			MaximumEpisodeLength:        manager.maximumEpisodeLength,
+			WallClockBudget:             manager.wallClockBudget,
+			TargetFitness:               manager.stoppingCriteria.targetFitness,
+			Patience:                    manager.stoppingCriteria.patience,
+			MinimumDiversity:            manager.stoppingCriteria.minimumDiversity,
+			SimulationStepBudget:        manager.stoppingCriteria.simulationStepBudget,
+		},
+		GeneticBreeder: manager.geneticBreeder.Parameters(),
+		Seed:           manager.seed,
+		GoVersion:      runtime.Version(),
+		StartTime:      time.Now(),
+	}
+
+	if describedSystem, ok := manager.system.(system.DescribedSystem); ok {
+		manifest.SystemName = describedSystem.Name()
+		manifest.SystemConstants = describedSystem.Constants()
+	}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				manifest.VCSRevision = setting.Value
+			case "vcs.time":
+				manifest.VCSTime = setting.Value
+			case "vcs.modified":
+				manifest.VCSModified = setting.Value == "true"
+			}
+		}
+	}
+
+	// The hostname is only informative, so an error here is not worth stopping for
+	manifest.Hostname, _ = os.Hostname()
+	return manifest
+}
+
+// Write the manifest to the run directory, replacing any previous version
+func (manager *Manager) writeManifest() error {
+	manifestData, err := json.MarshalIndent(manager.manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manager.runDirectory.ManifestFilePath(), manifestData, 0600)
+}
+
+// Record the end of the run in the manifest and rewrite it
+func (manager *Manager) finalizeManifest() {
+	endTime := time.Now()
+	manager.manifest.EndTime = &endTime
+	manager.manifest.StopReason = manager.stopReason
+	manager.manifest.NumGenerations = manager.generationIndex
+	if err := manager.writeManifest(); err != nil {
+		manager.logger.Warn("COULD NOT WRITE MANIFEST", "error", err)
+	}
+}
+
+// Get the manifest of this manager's run, as last written to disk
+func (manager *Manager) Manifest() Manifest {
+	return manager.manifest
+}
+
+// Read the manifest of a run, e.g. to group the output of many runs by their parameters
+func ReadManifest(manifestFilePath string) (Manifest, error) {
+	var manifest Manifest
+	manifestData, err := os.ReadFile(manifestFilePath)
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(manifestData, &manifest)
+	return manifest, err
+}
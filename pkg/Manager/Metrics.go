@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"net"
+	"net/http"
+
+	metrics "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Metrics"
+)
+
+const (
+	// Every metric name starts with this prefix
+	METRICS_NAMESPACE = "genetic_learning"
+
+	// The path the metrics are served at
+	METRICS_PATH = "/metrics"
+)
+
+// Serve Prometheus metrics describing the run at http://listenAddress/metrics while the manager exists.
+// Pass an address such as ":9090", or "127.0.0.1:0" to pick any free port (see MetricsAddress).
+//
+// The metrics are updated at the start and end of every generation. They include the generation index,
+// the best, mean and median score, population diversity, simulation throughput, worker utilisation,
+// and the time spent in each phase of the latest generation.
+func WithMetricsServer(listenAddress string) ManagerOption {
+	return func(manager *Manager) {
+		manager.metricsListenAddress = listenAddress
+	}
+}
+
+// Updates the metrics registry as each generation starts and ends
+type metricsObserver struct {
+	BaseObserver
+
+	generationIndex        *metrics.Gauge
+	numGenerationsTotal    *metrics.Counter
+	bestScore              *metrics.Gauge
+	meanScore              *metrics.Gauge
+	medianScore            *metrics.Gauge
+	diversity              *metrics.Gauge
+	simulationsPerSecond   *metrics.Gauge
+	stepsPerSecond         *metrics.Gauge
+	workerUtilization      *metrics.Gauge
+	numSimulationsTotal    *metrics.Counter
+	numStepsTotal          *metrics.Counter
+	numFailedAgentsTotal   *metrics.Counter
+	phaseDurationInSeconds *metrics.GaugeVec
+}
+
+func newMetricsObserver(registry *metrics.Registry) *metricsObserver {
+	name := func(suffix string) string { return METRICS_NAMESPACE + "_" + suffix }
+	return &metricsObserver{
+		generationIndex:        registry.NewGauge(name("generation_index"), "Index of the generation currently being simulated."),
+		numGenerationsTotal:    registry.NewCounter(name("generations_total"), "Number of generations completed."),
+		bestScore:              registry.NewGauge(name("best_score"), "Best fitness in the latest completed generation."),
+		meanScore:              registry.NewGauge(name("mean_score"), "Mean fitness of the latest completed generation."),
+		medianScore:            registry.NewGauge(name("median_score"), "Median fitness of the latest completed generation."),
+		diversity:              registry.NewGauge(name("diversity"), "Population diversity of the latest completed generation."),
+		simulationsPerSecond:   registry.NewGauge(name("simulations_per_second"), "Simulations per second during the latest simulate phase."),
+		stepsPerSecond:         registry.NewGauge(name("steps_per_second"), "Simulation steps per second during the latest simulate phase."),
+		workerUtilization:      registry.NewGauge(name("worker_utilization"), "Fraction of simulation worker time spent simulating during the latest simulate phase."),
+		numSimulationsTotal:    registry.NewCounter(name("simulations_total"), "Number of simulations run."),
+		numStepsTotal:          registry.NewCounter(name("simulation_steps_total"), "Number of simulation steps run."),
+		numFailedAgentsTotal:   registry.NewCounter(name("failed_agents_total"), "Number of agents dropped from failed simulations."),
+		phaseDurationInSeconds: registry.NewGaugeVec(name("phase_duration_seconds"), "Time spent in each phase of the latest completed generation.", "phase"),
+	}
+}
+
+func (observer *metricsObserver) OnGenerationStart(generationIndex int) {
+	observer.generationIndex.Set(float64(generationIndex))
+}
+
+func (observer *metricsObserver) OnGenerationEnd(summary GenerationSummary) {
+	observer.numGenerationsTotal.Add(1)
+	observer.bestScore.Set(summary.BestScore)
+	observer.meanScore.Set(summary.MeanScore)
+	observer.medianScore.Set(summary.MedianScore)
+	observer.diversity.Set(summary.Diversity)
+	if simulateSeconds := summary.SimulateDuration.Seconds(); simulateSeconds > 0 {
+		observer.simulationsPerSecond.Set(float64(summary.NumSimulations) / simulateSeconds)
+		observer.stepsPerSecond.Set(float64(summary.NumSimulationSteps) / simulateSeconds)
+	}
+	observer.workerUtilization.Set(summary.WorkerUtilization)
+	observer.numSimulationsTotal.Add(float64(summary.NumSimulations))
+	observer.numStepsTotal.Add(float64(summary.NumSimulationSteps))
+	observer.numFailedAgentsTotal.Add(float64(summary.NumFailedAgents))
+	observer.phaseDurationInSeconds.Set("simulate", summary.SimulateDuration.Seconds())
+	observer.phaseDurationInSeconds.Set("replay", summary.ReplayDuration.Seconds())
+	observer.phaseDurationInSeconds.Set("collect", summary.CollectDuration.Seconds())
+	observer.phaseDurationInSeconds.Set("breed", summary.BreedDuration.Seconds())
+}
+
+// Start serving metrics, returning the observer that keeps them up to date
+func (manager *Manager) startMetricsServer() (*metricsObserver, error) {
+	listener, err := net.Listen("tcp", manager.metricsListenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := metrics.NewRegistry()
+	observer := newMetricsObserver(registry)
+	mux := http.NewServeMux()
+	mux.Handle(METRICS_PATH, registry)
+	manager.metricsListener = listener
+	manager.metricsServer = &http.Server{Handler: mux}
+	go manager.metricsServer.Serve(listener)
+
+	manager.logger.Info("SERVING METRICS", "address", listener.Addr().String(), "path", METRICS_PATH)
+	return observer, nil
+}
+
+// Get the address metrics are served at, or an empty string if the manager was not created with WithMetricsServer
+func (manager *Manager) MetricsAddress() string {
+	if manager.metricsListener == nil {
+		return ""
+	}
+	return manager.metricsListener.Addr().String()
+}
@@ -0,0 +1,268 @@
+package manager
+
+import (
+	"context"
+	"math"
+	"path"
+	"sort"
+	"time"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	datacollector "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/DataCollector"
+	simulator "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Simulator"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+)
+
+// A GenerationObserver is notified by the manager as each generation progresses.
+// This allows for custom loggers, evaluators, checkpointers, visualisers and so on
+// to be added without editing the manager itself. Register observers with WithObserver.
+//
+// Observers are called synchronously, in the order they were registered, from the goroutine
+// running the manager. Slow observers therefore slow down training!
+//
+// Observers must not modify the agents they are given. Embed BaseObserver to
+// only implement the callbacks you are interested in.
+type GenerationObserver interface {
+	// Called before any simulations of a generation are run
+	OnGenerationStart(generationIndex int)
+
+	// Called after each repetition of a generation (i.e. once every agent has been simulated once more)
+	OnRepetitionEnd(generationIndex int, repetitionIndex int)
+
+	// Called once the agents of a generation have been given their fitness, and before breeding.
+	// The population is sorted from best to worst.
+	//
+	// The context is that of the generation, so long running observers should stop if it is cancelled.
+	OnScored(ctx context.Context, generationIndex int, population []*agent.Agent)
+
+	// Called with the new population once the next generation has been bred.
+	// The generationIndex is that of the generation the new population was bred from.
+	OnBred(generationIndex int, newPopulation []*agent.Agent)
+
+	// Called once a generation is completely finished, with a summary of that generation
+	OnGenerationEnd(summary GenerationSummary)
+
+	// Called when SimulateManyGenerations finishes, for any reason
+	OnRunEnd(stopReason StopReason)
+}
+
+// A GenerationObserver that does nothing. Embed this in an observer to avoid
+// implementing the callbacks you do not need.
+type BaseObserver struct{}
+
+func (BaseObserver) OnGenerationStart(generationIndex int)                                        {}
+func (BaseObserver) OnRepetitionEnd(generationIndex int, repetitionIndex int)                     {}
+func (BaseObserver) OnScored(ctx context.Context, generationIndex int, population []*agent.Agent) {}
+func (BaseObserver) OnBred(generationIndex int, newPopulation []*agent.Agent)                     {}
+func (BaseObserver) OnGenerationEnd(summary GenerationSummary)                                    {}
+func (BaseObserver) OnRunEnd(stopReason StopReason)                                               {}
+
+// A summary of the work done, and results found, while simulating a single generation
+type GenerationSummary struct {
+	GenerationIndex int
+
+	// Statistics of the fitness of the generation
+	BestScore   float64
+	MeanScore   float64
+	MedianScore float64
+
+	// How varied the chromosomes of the generation were (see WithMinimumDiversity)
+	Diversity float64
+
+	NumSimulations          int
+	NumSimulationSteps      int
+	NumTruncatedSimulations int
+	NumFailedAgents         int
+
+	// The fraction of the simulation workers' time spent simulating during the simulate phase.
+	// Zero if the batch simulator cannot report this (see simulator.UtilizationReporter).
+	WorkerUtilization float64
+
+	// Time spent in each phase of the generation
+	SimulateDuration time.Duration
+	ReplayDuration   time.Duration
+	CollectDuration  time.Duration
+	BreedDuration    time.Duration
+}
+
+// Register an observer to be notified as each generation progresses.
+// Observers are called in the order they are given, after the built in observers.
+func WithObserver(observer GenerationObserver) ManagerOption {
+	return func(manager *Manager) {
+		manager.observers = append(manager.observers, observer)
+	}
+}
+
+// Fill in the score statistics of the generation summary. The population must be ranked from best to worst,
+// though (with successive halving) its fitness need not be in the same order.
+func (manager *Manager) summarizeScores(population []*agent.Agent) {
+	scores := make([]float64, len(population))
+	for agentIndex, populationAgent := range population {
+		scores[agentIndex] = populationAgent.Score
+	}
+	// stat.Quantile requires increasing data
+	sort.Float64s(scores)
+	manager.generationSummary.BestScore = population[0].Score
+	manager.generationSummary.MeanScore = stat.Mean(scores, nil)
+	manager.generationSummary.MedianScore = stat.Quantile(0.5, stat.Empirical, scores, nil)
+	manager.generationSummary.Diversity = populationDiversity(population)
+}
+
+func (manager *Manager) notifyGenerationStart() {
+	for _, observer := range manager.observers {
+		observer.OnGenerationStart(manager.generationIndex)
+	}
+}
+
+func (manager *Manager) notifyRepetitionEnd(repetitionIndex int) {
+	for _, observer := range manager.observers {
+		observer.OnRepetitionEnd(manager.generationIndex, repetitionIndex)
+	}
+}
+
+func (manager *Manager) notifyScored(ctx context.Context) {
+	for _, observer := range manager.observers {
+		observer.OnScored(ctx, manager.generationIndex, manager.currentGeneration)
+	}
+}
+
+func (manager *Manager) notifyBred() {
+	for _, observer := range manager.observers {
+		observer.OnBred(manager.generationIndex, manager.currentGeneration)
+	}
+}
+
+func (manager *Manager) notifyGenerationEnd() {
+	for _, observer := range manager.observers {
+		observer.OnGenerationEnd(manager.generationSummary)
+	}
+}
+
+func (manager *Manager) notifyRunEnd() {
+	for _, observer := range manager.observers {
+		observer.OnRunEnd(manager.stopReason)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------
+
+// The episode in which an agent earned its highest return of the generation, kept so it can be replayed exactly
+type bestEpisode struct {
+	// Every agent that took part, in order, and the seed of the episode
+	agents []*agent.Agent
+	seed   uint64
+
+	agentIndex  int
+	agentReturn float64
+}
+
+// Remember the episode of a successful job as the best episode of each of its agents, if it beats their best so far
+func (manager *Manager) recordBestEpisodes(job simulator.SimulationJob, result simulator.SimulationResult) {
+	var episodeAgents []*agent.Agent
+	for agentIndex, episodeAgent := range job.Agents {
+		previousBest, exists := manager.bestEpisodes[episodeAgent]
+		if exists && !(result.Returns[agentIndex] > previousBest.agentReturn) {
+			continue
+		}
+		// The job's agent slice is reused by the next repetition, so must be copied
+		if episodeAgents == nil {
+			episodeAgents = append([]*agent.Agent{}, job.Agents...)
+		}
+		manager.bestEpisodes[episodeAgent] = bestEpisode{
+			agents:      episodeAgents,
+			seed:        job.Seed,
+			agentIndex:  agentIndex,
+			agentReturn: result.Returns[agentIndex],
+		}
+	}
+}
+
+// Replays the best episode of the best agent of each generation and saves everything that happened in it,
+// so the behavior of the best agents can be inspected (e.g. by the visualize scripts) and surprising scores debugged.
+//
+// Every state is saved to BestAgentSimulation.pq, and the whole episode to BestAgentEpisode.gob (see simulator.EpisodeRecording).
+// The episode is replayed from the seed it was first simulated with, so for systems that honour the seed
+// (see replaysExactly) it is exactly the episode that earned the score.
+type bestAgentReplayObserver struct {
+	BaseObserver
+	manager *Manager
+}
+
+// Whether simulating the same agents with the same seed always gives the same episode.
+// Other random systems ignore the seed, so their replays are expected to differ.
+func replaysExactly(targetSystem system.System) bool {
+	if _, ok := targetSystem.(system.SeededSystem); ok {
+		return true
+	}
+	_, ok := system.AsEnvironment(targetSystem)
+	return ok
+}
+
+func (observer *bestAgentReplayObserver) OnScored(ctx context.Context, generationIndex int, population []*agent.Agent) {
+	manager := observer.manager
+	replayStartTime := time.Now()
+	defer func() { manager.generationSummary.ReplayDuration = time.Since(replayStartTime) }()
+
+	manager.logger.Debug("SIMULATING BEST AGENTS", "generation", generationIndex)
+	// We simulate copies of the agents so their fitness and episode returns are left untouched.
+	episode, found := manager.bestEpisodes[population[0]]
+	job := simulator.SimulationJob{MaximumEpisodeLength: manager.maximumEpisodeLength}
+	if found {
+		job.Agents = make([]*agent.Agent, len(episode.agents))
+		for agentIndex, episodeAgent := range episode.agents {
+			job.Agents[agentIndex] = agent.NewAgent(episodeAgent.Chromosome)
+		}
+		job.Seed = episode.seed
+		job.Seeded = true
+	} else {
+		// The best agent has no successful episode this generation (e.g. every one of them failed),
+		// so simulate the top n agents, where n is the number of agents needed for the simulation, in a fresh episode
+		job.Agents = make([]*agent.Agent, manager.system.NumAgentsPerSimulation())
+		for bestAgentIndex := range job.Agents {
+			job.Agents[bestAgentIndex] = agent.NewAgent(population[bestAgentIndex].Chromosome)
+		}
+	}
+	// A cancelled replay is noticed (and handled) by the manager once the observers return.
+	recording, result := simulator.RecordEpisode(ctx, manager.system, job)
+	if result.TerminalReason == simulator.TerminalReasonCancelled {
+		return
+	}
+	if found && replaysExactly(manager.system) && math.Float64bits(result.Returns[episode.agentIndex]) != math.Float64bits(episode.agentReturn) {
+		manager.logger.Warn("BEST EPISODE DID NOT REPLAY EXACTLY", "generation", generationIndex,
+			"recordedReturn", episode.agentReturn, "replayedReturn", result.Returns[episode.agentIndex])
+	}
+
+	// Then put every state into the data collector
+	stateNames := system.SchemaOf(manager.system).StateNames(len(recording.InitialStateVector))
+	simulationDataCollector := datacollector.NewSimulationDataCollector(manager.runDirectory, "BestAgentSimulation.pq", stateNames)
+	simulationDataCollector.CollectSimulationData(&systemstate.SystemState{StateVector: mat.NewVecDense(len(recording.InitialStateVector), recording.InitialStateVector)})
+	for stepIndex, step := range recording.Steps {
+		simulationDataCollector.CollectSimulationData(&systemstate.SystemState{
+			StateVector: mat.NewVecDense(len(step.StateVector), step.StateVector),
+			StateIndex:  stepIndex + 1,
+		})
+	}
+	simulationDataCollector.WriteStop()
+	if err := recording.WriteFile(path.Join(manager.runDirectory.DataDirectory(), "BestAgentEpisode.gob")); err != nil {
+		manager.logger.Error("COULD NOT SAVE BEST AGENT EPISODE", "generation", generationIndex, "error", err)
+	}
+	manager.latestReplay = simulationDataCollector.StateVectors()
+	manager.logger.Debug("FINISHED BEST AGENT SIMULATION", "generation", generationIndex)
+}
+
+// Saves the scores of every generation, and the best agent of each generation, to parquet files
+type dataCollectionObserver struct {
+	BaseObserver
+	manager *Manager
+}
+
+func (observer *dataCollectionObserver) OnScored(ctx context.Context, generationIndex int, population []*agent.Agent) {
+	manager := observer.manager
+	collectStartTime := time.Now()
+	manager.generationEndDataCollector.CollectGenerationEndData(population)
+	manager.bestAgentDataCollector.CollectBestAgentData(population[0])
+	manager.generationSummary.CollectDuration = time.Since(collectStartTime)
+}
@@ -0,0 +1,153 @@
+package manager
+
+import (
+	"time"
+
+	fitness "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Fitness"
+	simulator "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Simulator"
+)
+
+// A ManagerOption configures optional behavior of a Manager.
+// Options are passed as trailing arguments to NewManager, and are applied in order.
+type ManagerOption func(*Manager)
+
+// Set how the returns of each agent across all simulations in a generation are combined
+// into the fitness used for breeding. See `pkg/Fitness` for the available aggregators.
+//
+// Defaults to the mean episode return.
+func WithFitnessAggregator(aggregator fitness.Aggregator) ManagerOption {
+	return func(manager *Manager) {
+		manager.fitnessAggregator = aggregator
+	}
+}
+
+// Evaluate each generation adaptively using successive halving, rather than simulating
+// every agent numSimulationsPerGeneration times. See SuccessiveHalvingConfig for details.
+//
+// When this option is used, numSimulationsPerGeneration is ignored.
+func WithSuccessiveHalving(config SuccessiveHalvingConfig) ManagerOption {
+	if config.InitialRepetitions < 1 {
+		panic("SuccessiveHalvingConfig.InitialRepetitions must be a positive integer!")
+	}
+	if config.KeepFraction <= 0.0 || config.KeepFraction >= 1.0 {
+		panic("SuccessiveHalvingConfig.KeepFraction must be in (0, 1)!")
+	}
+	if config.EpisodeBudget < 1 {
+		panic("SuccessiveHalvingConfig.EpisodeBudget must be a positive integer!")
+	}
+	return func(manager *Manager) {
+		manager.successiveHalvingConfig = &config
+	}
+}
+
+// Decides what the manager does when a simulation fails (i.e. the system panics)
+type SimulationErrorPolicy int
+
+const (
+	// Stop simulating, and return the error from SimulateGeneration. This is the default.
+	SimulationErrorPolicyAbort SimulationErrorPolicy = iota
+
+	// Log the error, and give every agent in the failed simulation the minimum fitness
+	// of the generation. The generation then continues as normal.
+	SimulationErrorPolicyDropAgents
+)
+
+// Set how the manager reacts to simulations that fail. See SimulationErrorPolicy.
+func WithSimulationErrorPolicy(policy SimulationErrorPolicy) ManagerOption {
+	return func(manager *Manager) {
+		manager.simulationErrorPolicy = policy
+	}
+}
+
+// Truncate every episode of the run after the given number of steps, overriding the system's own limit
+// (see system.EpisodeLimitedSystem). Truncated episodes are counted in GenerationSummary.NumTruncatedSimulations.
+//
+// Defaults to the system's limit, or simulator.DEFAULT_MAXIMUM_EPISODE_LENGTH if it has none.
+func WithMaximumEpisodeLength(numSteps int) ManagerOption {
+	return func(manager *Manager) {
+		manager.maximumEpisodeLength = numSteps
+	}
+}
+
+// Limit the total time SimulateManyGenerations may run for. Once the budget is spent the current
+// generation is cancelled, a checkpoint is written, and the run ends as if it had finished normally.
+//
+// Defaults to no limit.
+func WithWallClockBudget(budget time.Duration) ManagerOption {
+	return func(manager *Manager) {
+		manager.wallClockBudget = budget
+	}
+}
+
+// Stop SimulateManyGenerations once the best agent of a generation has at least this fitness
+func WithTargetFitness(targetFitness float64) ManagerOption {
+	return func(manager *Manager) {
+		manager.stoppingCriteria.targetFitness = &targetFitness
+	}
+}
+
+// Stop SimulateManyGenerations if the best score of a generation has not beaten
+// the best score so far for this many generations in a row
+func WithPatience(numGenerations int) ManagerOption {
+	return func(manager *Manager) {
+		manager.stoppingCriteria.patience = numGenerations
+	}
+}
+
+// Stop SimulateManyGenerations if the population diversity (the mean standard deviation of each gene
+// across the population) falls below this threshold
+func WithMinimumDiversity(minimumDiversity float64) ManagerOption {
+	return func(manager *Manager) {
+		manager.stoppingCriteria.minimumDiversity = minimumDiversity
+	}
+}
+
+// Stop SimulateManyGenerations once the total number of simulation steps taken in the run reaches this budget.
+// The budget is checked between generations, so the final generation may overshoot it.
+func WithSimulationStepBudget(numSteps int) ManagerOption {
+	return func(manager *Manager) {
+		manager.stoppingCriteria.simulationStepBudget = numSteps
+	}
+}
+
+// Write all output of the run (data, logs, checkpoints and the manifest) under the given directory.
+// The directory must not exist, or must be empty, so an existing run is never overwritten.
+//
+// Defaults to a fresh directory under `runs/`, named from the run name and the time the manager was created.
+func WithOutputRoot(outputRoot string) ManagerOption {
+	return func(manager *Manager) {
+		manager.outputRoot = outputRoot
+	}
+}
+
+// Name the run. Unless WithOutputRoot is also given, output is written to `runs/<name>-<timestamp>`
+//
+// Defaults to DEFAULT_RUN_NAME.
+func WithRunName(runName string) ManagerOption {
+	return func(manager *Manager) {
+		manager.runName = runName
+	}
+}
+
+// Seed the manager's random generator, which draws the initial population, decides which agents share a simulation,
+// and seeds every episode. The seed is recorded in the run manifest.
+//
+// Breeding does not use this generator (see geneticbreeder.NewGeneticBreeder), so later generations
+// are only reproducible from the seed if the breeder is too.
+//
+// Defaults to a seed taken from the current time.
+func WithSeed(seed uint64) ManagerOption {
+	return func(manager *Manager) {
+		manager.seed = seed
+	}
+}
+
+// Run simulations with the given batch simulator instead of a local worker pool of numThreads goroutines.
+// For example, pass a distributed.Coordinator to spread simulations over worker processes.
+//
+// The manager takes ownership of the simulator, closing it in WriteStop.
+func WithBatchSimulator(batchSimulator simulator.BatchSimulator) ManagerOption {
+	return func(manager *Manager) {
+		manager.batchSimulator = batchSimulator
+	}
+}
@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"math"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+)
+
+// Describes why SimulateManyGenerations stopped
+type StopReason string
+
+const (
+	// The run has not stopped yet
+	StopReasonNone StopReason = ""
+	// All requested generations were simulated
+	StopReasonGenerationLimit StopReason = "generation limit reached"
+	// The best agent reached the target fitness (see WithTargetFitness)
+	StopReasonTargetFitness StopReason = "target fitness reached"
+	// The best score did not improve for too many generations (see WithPatience)
+	StopReasonNoImprovement StopReason = "no improvement"
+	// The population became too similar (see WithMinimumDiversity)
+	StopReasonLowDiversity StopReason = "diversity below threshold"
+	// The wall clock budget was spent (see WithWallClockBudget)
+	StopReasonWallClockLimit StopReason = "wall clock limit reached"
+	// The simulation step budget was spent (see WithSimulationStepBudget)
+	StopReasonStepBudget StopReason = "simulation step budget spent"
+	// The context given to SimulateManyGenerations was cancelled
+	StopReasonCancelled StopReason = "cancelled"
+	// A generation returned an error
+	StopReasonError StopReason = "error"
+)
+
+// Optional conditions for ending a run early. A nil or zero field disables that condition.
+type stoppingCriteria struct {
+	targetFitness          *float64
+	patience               int
+	minimumDiversity       float64
+	simulationStepBudget   int
+	hasBestScore           bool
+	bestScore              float64
+	numGenerationsNoChange int
+}
+
+// Check the stopping criteria against the most recently simulated generation,
+// returning the reason to stop or StopReasonNone to continue
+func (manager *Manager) checkStoppingCriteria() StopReason {
+	criteria := &manager.stoppingCriteria
+	summary := manager.generationSummary
+
+	// Keep track of improvement even if patience is not set, so the counter is correct if it ever is
+	if summary.BestScore > criteria.bestScore || !criteria.hasBestScore {
+		criteria.hasBestScore = true
+		criteria.bestScore = summary.BestScore
+		criteria.numGenerationsNoChange = 0
+	} else {
+		criteria.numGenerationsNoChange += 1
+	}
+
+	if criteria.targetFitness != nil && summary.BestScore >= *criteria.targetFitness {
+		return StopReasonTargetFitness
+	}
+	if criteria.patience > 0 && criteria.numGenerationsNoChange >= criteria.patience {
+		return StopReasonNoImprovement
+	}
+	if criteria.minimumDiversity > 0 && summary.Diversity < criteria.minimumDiversity {
+		return StopReasonLowDiversity
+	}
+	if criteria.simulationStepBudget > 0 && manager.totalSimulationSteps >= criteria.simulationStepBudget {
+		return StopReasonStepBudget
+	}
+	return StopReasonNone
+}
+
+// Measure how varied the chromosomes of a population are.
+//
+// This is the standard deviation of each gene across the population, averaged over all genes.
+// A diversity of zero means every agent has an identical chromosome.
+func populationDiversity(population []*agent.Agent) float64 {
+	if len(population) == 0 {
+		return 0.0
+	}
+
+	chromosomeSize := len(population[0].Chromosome.RawMatrix().Data)
+	geneMeans := make([]float64, chromosomeSize)
+	for _, populationAgent := range population {
+		for geneIndex, gene := range populationAgent.Chromosome.RawMatrix().Data {
+			geneMeans[geneIndex] += gene / float64(len(population))
+		}
+	}
+
+	totalStd := 0.0
+	for geneIndex := range geneMeans {
+		squareDifferenceSum := 0.0
+		for _, populationAgent := range population {
+			difference := populationAgent.Chromosome.RawMatrix().Data[geneIndex] - geneMeans[geneIndex]
+			squareDifferenceSum += difference * difference
+		}
+		totalStd += math.Sqrt(squareDifferenceSum / float64(len(population)))
+	}
+	return totalStd / float64(chromosomeSize)
+}
@@ -0,0 +1,220 @@
+// Package metrics is a minimal registry of gauges and counters that can be scraped by Prometheus.
+//
+// Only the features needed to watch a training run are implemented: float valued gauges and counters,
+// optionally split by a single label, written in the Prometheus text exposition format
+// (see https://prometheus.io/docs/instrumenting/exposition_formats/).
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The Content-Type of the Prometheus text exposition format
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// A Registry holds every metric exposed by a single endpoint
+type Registry struct {
+	mutex   sync.Mutex
+	metrics []metric
+}
+
+// A metric writes its own HELP, TYPE and sample lines
+type metric interface {
+	write(writer io.Writer) error
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: []metric{}}
+}
+
+func (registry *Registry) register(newMetric metric) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.metrics = append(registry.metrics, newMetric)
+}
+
+// Write every metric in the text exposition format, in the order they were created
+func (registry *Registry) Write(writer io.Writer) error {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	for _, registeredMetric := range registry.metrics {
+		if err := registeredMetric.write(writer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Serve the metrics, so the registry can be used as the handler of a /metrics endpoint
+func (registry *Registry) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	responseWriter.Header().Set("Content-Type", CONTENT_TYPE)
+	registry.Write(responseWriter)
+}
+
+// A float64 that can be read and written concurrently
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (value *atomicFloat) load() float64 {
+	return math.Float64frombits(value.bits.Load())
+}
+
+func (value *atomicFloat) store(newValue float64) {
+	value.bits.Store(math.Float64bits(newValue))
+}
+
+func (value *atomicFloat) add(delta float64) {
+	for {
+		oldBits := value.bits.Load()
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + delta)
+		if value.bits.CompareAndSwap(oldBits, newBits) {
+			return
+		}
+	}
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func writeHeader(writer io.Writer, name string, help string, metricType string) error {
+	// Backslashes and newlines must be escaped in help text
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	_, err := fmt.Fprintf(writer, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, metricType)
+	return err
+}
+
+// A Gauge is a value that may go up or down, such as the best score of the latest generation
+type Gauge struct {
+	name  string
+	help  string
+	value atomicFloat
+}
+
+// Create a gauge in the registry. Gauges start at zero.
+func (registry *Registry) NewGauge(name string, help string) *Gauge {
+	gauge := &Gauge{name: name, help: help}
+	registry.register(gauge)
+	return gauge
+}
+
+func (gauge *Gauge) Set(value float64) {
+	gauge.value.store(value)
+}
+
+func (gauge *Gauge) Value() float64 {
+	return gauge.value.load()
+}
+
+func (gauge *Gauge) write(writer io.Writer) error {
+	if err := writeHeader(writer, gauge.name, gauge.help, "gauge"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(writer, "%v %v\n", gauge.name, formatValue(gauge.Value()))
+	return err
+}
+
+// A Counter is a total that only increases, such as the number of simulations run
+type Counter struct {
+	name  string
+	help  string
+	value atomicFloat
+}
+
+// Create a counter in the registry. By convention, counter names end in "_total".
+func (registry *Registry) NewCounter(name string, help string) *Counter {
+	counter := &Counter{name: name, help: help}
+	registry.register(counter)
+	return counter
+}
+
+// Increase the counter. Panics if delta is negative, as counters may only increase.
+func (counter *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("Counters cannot decrease!")
+	}
+	counter.value.add(delta)
+}
+
+func (counter *Counter) Value() float64 {
+	return counter.value.load()
+}
+
+func (counter *Counter) write(writer io.Writer) error {
+	if err := writeHeader(writer, counter.name, counter.help, "counter"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(writer, "%v %v\n", counter.name, formatValue(counter.Value()))
+	return err
+}
+
+// A GaugeVec is a set of gauges sharing a name, distinguished by the value of a single label.
+// For example, the duration of each phase of a generation, labelled by phase.
+type GaugeVec struct {
+	name      string
+	help      string
+	labelName string
+
+	mutex  sync.Mutex
+	values map[string]*atomicFloat
+}
+
+// Create a labelled set of gauges in the registry
+func (registry *Registry) NewGaugeVec(name string, help string, labelName string) *GaugeVec {
+	gaugeVec := &GaugeVec{name: name, help: help, labelName: labelName, values: make(map[string]*atomicFloat)}
+	registry.register(gaugeVec)
+	return gaugeVec
+}
+
+// Set the gauge with the given label value, creating it if needed
+func (gaugeVec *GaugeVec) Set(labelValue string, value float64) {
+	gaugeVec.mutex.Lock()
+	labelledValue, exists := gaugeVec.values[labelValue]
+	if !exists {
+		labelledValue = &atomicFloat{}
+		gaugeVec.values[labelValue] = labelledValue
+	}
+	gaugeVec.mutex.Unlock()
+	labelledValue.store(value)
+}
+
+func (gaugeVec *GaugeVec) write(writer io.Writer) error {
+	if err := writeHeader(writer, gaugeVec.name, gaugeVec.help, "gauge"); err != nil {
+		return err
+	}
+
+	gaugeVec.mutex.Lock()
+	defer gaugeVec.mutex.Unlock()
+	labelValues := make([]string, 0, len(gaugeVec.values))
+	for labelValue := range gaugeVec.values {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+
+	labelEscaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for _, labelValue := range labelValues {
+		_, err := fmt.Fprintf(writer, "%v{%v=\"%v\"} %v\n",
+			gaugeVec.name, gaugeVec.labelName, labelEscaper.Replace(labelValue), formatValue(gaugeVec.values[labelValue].load()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"io"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryExpositionFormat(t *testing.T) {
+	registry := NewRegistry()
+	gauge := registry.NewGauge("test_gauge", "A gauge.")
+	counter := registry.NewCounter("test_total", "A counter.")
+	gaugeVec := registry.NewGaugeVec("test_phase_seconds", "Labelled gauges.", "phase")
+
+	gauge.Set(math.Inf(-1))
+	counter.Add(2)
+	counter.Add(0.5)
+	gaugeVec.Set("simulate", 1.5)
+	gaugeVec.Set("breed", 0.25)
+
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	response, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.Header.Get("Content-Type") != CONTENT_TYPE {
+		t.Errorf("Unexpected content type %v", response.Header.Get("Content-Type"))
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"# HELP test_gauge A gauge.",
+		"# TYPE test_gauge gauge",
+		"test_gauge -Inf",
+		"# HELP test_total A counter.",
+		"# TYPE test_total counter",
+		"test_total 2.5",
+		"# HELP test_phase_seconds Labelled gauges.",
+		"# TYPE test_phase_seconds gauge",
+		`test_phase_seconds{phase="breed"} 0.25`,
+		`test_phase_seconds{phase="simulate"} 1.5`,
+		"",
+	}, "\n")
+	if string(body) != expected {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, string(body))
+	}
+}
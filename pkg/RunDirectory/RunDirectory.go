@@ -0,0 +1,134 @@
+package rundirectory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	// The directory that default run directories are created in, relative to the working directory
+	DEFAULT_RUNS_DIRECTORY = "runs"
+
+	dataDirectoryName       = "data"
+	logDirectoryName        = "logs"
+	logFileName             = "log"
+	checkpointDirectoryName = "checkpoints"
+	checkpointFileName      = "checkpoint.gob"
+	manifestFileName        = "manifest.json"
+)
+
+// A RunDirectory is the output root of a single run.
+// Everything a run produces (data, logs, checkpoints and the manifest) is kept under the root,
+// so that runs never interfere with each other.
+//
+// The layout is:
+//
+//	root/
+//	    manifest.json
+//	    data/
+//	    logs/log
+//	    checkpoints/checkpoint.gob
+type RunDirectory struct {
+	root string
+}
+
+// Create a new run directory at the given root, along with all of its subdirectories.
+//
+// To avoid silently overwriting an existing run, an error is returned if the root
+// already exists and is not empty.
+func NewRunDirectory(root string) (*RunDirectory, error) {
+	if err := os.MkdirAll(path.Dir(root), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(root, 0700); errors.Is(err, os.ErrExist) {
+		rootEntries, err := os.ReadDir(root)
+		if err != nil {
+			return nil, err
+		}
+		if len(rootEntries) > 0 {
+			return nil, fmt.Errorf("run directory %v already exists and is not empty", root)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return newRunDirectoryAt(root)
+}
+
+// Create a new run directory under DEFAULT_RUNS_DIRECTORY, named from the given name and the current time.
+//
+// If a run with the same name was started at the same time, a numeric suffix is added
+// so that a fresh directory is always used.
+func NewTimestampedRunDirectory(name string) (*RunDirectory, error) {
+	return newTimestampedRunDirectoryIn(DEFAULT_RUNS_DIRECTORY, name)
+}
+
+// Create a new run directory as NewTimestampedRunDirectory does, but under the given directory.
+//
+// Each root is claimed by creating it, which fails if another run (even one started concurrently) has already
+// claimed it, so two runs can never share a root.
+func newTimestampedRunDirectoryIn(runsDirectory string, name string) (*RunDirectory, error) {
+	if err := os.MkdirAll(runsDirectory, 0700); err != nil {
+		return nil, err
+	}
+	baseRoot := path.Join(runsDirectory, fmt.Sprintf("%v-%v", name, time.Now().Format("20060102-150405")))
+	root := baseRoot
+	for suffix := 1; ; suffix++ {
+		err := os.Mkdir(root, 0700)
+		if err == nil {
+			return newRunDirectoryAt(root)
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		root = fmt.Sprintf("%v-%v", baseRoot, suffix)
+	}
+}
+
+// Create the subdirectories of a run directory whose root has already been created
+func newRunDirectoryAt(root string) (*RunDirectory, error) {
+	runDirectory := &RunDirectory{root: root}
+	for _, directory := range []string{runDirectory.DataDirectory(), runDirectory.LogDirectory(), runDirectory.CheckpointDirectory()} {
+		if err := os.MkdirAll(directory, 0700); err != nil {
+			return nil, err
+		}
+	}
+	return runDirectory, nil
+}
+
+// The root of the run directory
+func (runDirectory *RunDirectory) Root() string {
+	return runDirectory.root
+}
+
+// The directory that data collectors write to
+func (runDirectory *RunDirectory) DataDirectory() string {
+	return path.Join(runDirectory.root, dataDirectoryName)
+}
+
+// The directory holding the log file
+func (runDirectory *RunDirectory) LogDirectory() string {
+	return path.Join(runDirectory.root, logDirectoryName)
+}
+
+// The path of the run log file
+func (runDirectory *RunDirectory) LogFilePath() string {
+	return path.Join(runDirectory.LogDirectory(), logFileName)
+}
+
+// The directory holding checkpoints
+func (runDirectory *RunDirectory) CheckpointDirectory() string {
+	return path.Join(runDirectory.root, checkpointDirectoryName)
+}
+
+// The path of the most recent checkpoint of the run
+func (runDirectory *RunDirectory) CheckpointFilePath() string {
+	return path.Join(runDirectory.CheckpointDirectory(), checkpointFileName)
+}
+
+// The path of the run manifest
+func (runDirectory *RunDirectory) ManifestFilePath() string {
+	return path.Join(runDirectory.root, manifestFileName)
+}
@@ -0,0 +1,83 @@
+package rundirectory
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNewRunDirectory(t *testing.T) {
+	root := path.Join(t.TempDir(), "run")
+	runDirectory, err := NewRunDirectory(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, directory := range []string{runDirectory.DataDirectory(), runDirectory.LogDirectory(), runDirectory.CheckpointDirectory()} {
+		if info, err := os.Stat(directory); err != nil || !info.IsDir() {
+			t.Errorf("expected directory %v to be created, got %v", directory, err)
+		}
+	}
+
+	// The root now holds a run, so must not be used again
+	if _, err := NewRunDirectory(root); err == nil {
+		t.Errorf("expected an error reusing the non-empty root %v", root)
+	}
+
+	// An empty root that already exists may be used
+	emptyRoot := t.TempDir()
+	if _, err := NewRunDirectory(emptyRoot); err != nil {
+		t.Errorf("expected the empty root %v to be used, got %v", emptyRoot, err)
+	}
+}
+
+func TestTimestampedRunDirectoriesAreSuffixed(t *testing.T) {
+	runsDirectory := t.TempDir()
+	// Try a few times, in case the clock ticks over to the next second between the two runs
+	for attempt := 0; attempt < 3; attempt++ {
+		first, err := newTimestampedRunDirectoryIn(runsDirectory, "run")
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := newTimestampedRunDirectoryIn(runsDirectory, "run")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if second.Root() == first.Root()+"-1" {
+			return
+		}
+		if strings.HasPrefix(second.Root(), first.Root()) {
+			t.Fatalf("expected the second run in the same second to be %v-1, got %v", first.Root(), second.Root())
+		}
+	}
+	t.Errorf("expected two runs to be started in the same second")
+}
+
+func TestConcurrentTimestampedRunDirectoriesAreDistinct(t *testing.T) {
+	runsDirectory := t.TempDir()
+	const numRuns = 20
+	roots := make([]string, numRuns)
+	var group sync.WaitGroup
+	for runIndex := range roots {
+		group.Add(1)
+		go func(runIndex int) {
+			defer group.Done()
+			runDirectory, err := newTimestampedRunDirectoryIn(runsDirectory, "run")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			roots[runIndex] = runDirectory.Root()
+		}(runIndex)
+	}
+	group.Wait()
+
+	seen := map[string]bool{}
+	for _, root := range roots {
+		if seen[root] {
+			t.Errorf("expected every run to have its own root, %v was used twice", root)
+		}
+		seen[root] = true
+	}
+}
@@ -0,0 +1,155 @@
+package simulator
+
+import (
+	"context"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Simulate every job at once, advancing all of their episodes in lockstep (see system.BatchedSystem).
+//
+// Each job gives exactly the same result as it would if simulated alone with SimulateSystemWithSeed
+// (or SimulateSystem if it is not seeded), with the result of each job at the same index in the returned slice.
+// As for SimulateSystem, every agent in a successful simulation has its return appended to its EpisodeReturns.
+//
+// Unlike simulations run concurrently, the same agent may take part in many of the jobs (for example to
+// evaluate it over many seeds), in which case its actions in all of them are computed with a single matrix product.
+// Once the batch is finished the agent's Score is the return of whichever of its episodes finished last.
+func SimulateBatchInLockstep(ctx context.Context, batchedSystem system.BatchedSystem, jobs []SimulationJob) []SimulationResult {
+	results := make([]SimulationResult, len(jobs))
+	for jobIndex, job := range jobs {
+		results[jobIndex].Returns = make([]float64, len(job.Agents))
+	}
+	simulateLockstepInto(ctx, batchedSystem, jobs, results)
+	return results
+}
+
+// Simulate the jobs in lockstep, as in SimulateBatchInLockstep, writing the results into the given slice
+// (whose Returns must already be allocated, as for simulateSystemInto).
+//
+// If the system panics, every job not yet finished is simulated again on its own, so that the failure
+// is attributed to the right jobs and reported through the Err of their results.
+func simulateLockstepInto(ctx context.Context, batchedSystem system.BatchedSystem, jobs []SimulationJob, results []SimulationResult) {
+	if len(jobs) == 0 {
+		return
+	}
+	finished := make([]bool, len(jobs))
+	defer func() {
+		if panicValue := recover(); panicValue == nil {
+			return
+		}
+		for jobIndex, job := range jobs {
+			if finished[jobIndex] {
+				continue
+			}
+			var seed *uint64
+			if job.Seeded {
+				seed = &jobs[jobIndex].Seed
+			}
+			results[jobIndex] = simulateSystemInto(ctx, batchedSystem, newStepper(batchedSystem), job.Agents, seed, job.MaximumEpisodeLength, results[jobIndex].Returns, nil)
+		}
+	}()
+
+	numAgents := batchedSystem.NumAgentsPerSimulation()
+	randomGenerators := make([]*rand.Rand, len(jobs))
+	episodeLimits := make([]int, len(jobs))
+	for jobIndex, job := range jobs {
+		episodeLimits[jobIndex] = maximumEpisodeLength(batchedSystem, job.MaximumEpisodeLength)
+		for _, simulationAgent := range job.Agents {
+			simulationAgent.StartEpisode()
+		}
+		results[jobIndex] = SimulationResult{
+			Returns:        results[jobIndex].Returns,
+			TerminalReason: TerminalReasonTruncated,
+		}
+		// Agents may be shared between episodes, so each episode's returns are accumulated in its result
+		for agentIndex := range results[jobIndex].Returns {
+			results[jobIndex].Returns[agentIndex] = 0.0
+		}
+		if job.Seeded {
+			randomGenerators[jobIndex] = rand.New(rand.NewSource(job.Seed))
+		}
+	}
+	batch := batchedSystem.InitializeBatchState(randomGenerators)
+
+	// The percepts and actions of each agent of every episode, with a row per episode
+	percepts := make([]*mat.Dense, numAgents)
+	actions := make([]*mat.Dense, numAgents)
+	policies := make([]*agent.BatchPolicy, numAgents)
+	for agentIndex := range policies {
+		percepts[agentIndex] = mat.NewDense(len(jobs), batchedSystem.NumPercepts(), nil)
+		actions[agentIndex] = mat.NewDense(len(jobs), batchedSystem.NumActions(), nil)
+		agents := make([]*agent.Agent, len(jobs))
+		for jobIndex, job := range jobs {
+			agents[jobIndex] = job.Agents[agentIndex]
+		}
+		policies[agentIndex] = agent.NewBatchPolicy(agents, percepts[agentIndex], actions[agentIndex])
+	}
+	rewards := mat.NewDense(len(jobs), numAgents, nil)
+
+	numUnfinished := len(jobs)
+	finish := func(jobIndex int, terminalReason TerminalReason) {
+		results[jobIndex].TerminalReason = terminalReason
+		if terminalReason == TerminalReasonTruncated {
+			state := batch.State(jobIndex)
+			state.TerminalReason = TerminalReasonTruncated
+			for agentIndex := range results[jobIndex].Returns {
+				results[jobIndex].Returns[agentIndex] += timeoutPenalty(batchedSystem, state, agentIndex)
+			}
+		}
+		for agentIndex, simulationAgent := range jobs[jobIndex].Agents {
+			simulationAgent.Score = results[jobIndex].Returns[agentIndex]
+			simulationAgent.EndEpisode()
+		}
+		finished[jobIndex] = true
+		numUnfinished--
+	}
+	for jobIndex, terminal := range batch.TerminalMask {
+		if terminal {
+			finish(jobIndex, TerminalReasonTerminal)
+		}
+	}
+
+	contextDone := ctx.Done()
+	for numUnfinished > 0 {
+		select {
+		case <-contextDone:
+			for jobIndex := range jobs {
+				if !finished[jobIndex] {
+					results[jobIndex].TerminalReason = TerminalReasonCancelled
+					results[jobIndex].Err = ctx.Err()
+					finished[jobIndex] = true
+				}
+			}
+			return
+		default:
+		}
+
+		for agentIndex, policy := range policies {
+			batchedSystem.ObserveBatch(batch, agentIndex, percepts[agentIndex])
+			policy.GetActions(batch.TerminalMask)
+		}
+		batchedSystem.StepBatch(batch, actions, rewards)
+
+		// The terminal mask matches the finished jobs before each step, so every unfinished job was stepped
+		for jobIndex := range jobs {
+			if finished[jobIndex] {
+				continue
+			}
+			for agentIndex := range results[jobIndex].Returns {
+				results[jobIndex].Returns[agentIndex] += rewards.At(jobIndex, agentIndex)
+			}
+			batch.StateIndices[jobIndex] += 1
+			results[jobIndex].EpisodeLength++
+			if batch.TerminalMask[jobIndex] {
+				finish(jobIndex, TerminalReasonTerminal)
+			} else if results[jobIndex].EpisodeLength >= episodeLimits[jobIndex] {
+				batch.TerminalMask[jobIndex] = true
+				finish(jobIndex, TerminalReasonTruncated)
+			}
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package simulator
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"os"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Everything that happened in a single step of a recorded episode
+type RecordedStep struct {
+	// The action each agent took, in agent order. Only systems implementing system.Environment
+	// reveal their agents' actions, so this is nil for other systems.
+	Actions [][]float64
+
+	// The reward each agent earned during the step, in agent order
+	Rewards []float64
+
+	// The state vector after the step
+	StateVector []float64
+}
+
+// An EpisodeRecording holds everything needed to reproduce a single episode (the seed and the agents' chromosomes),
+// along with everything that happened in it. Recordings are made by RecordEpisode, and checked by ReplayEpisode.
+//
+// Recordings are saved with gob (see WriteFile), so that NaNs and infinities in surprising episodes survive.
+type EpisodeRecording struct {
+	// The name of the system, if it is a system.DescribedSystem, or otherwise its Go type name
+	SystemName string
+
+	// The job the episode was simulated as, see SimulationJob
+	Seed                 uint64
+	Seeded               bool
+	MaximumEpisodeLength int
+
+	// The chromosome of each agent, in agent order. An agent's actions are decided by its chromosome alone.
+	Chromosomes []*mat.Dense
+
+	InitialStateVector []float64
+	Steps              []RecordedStep
+
+	// The outcome of the episode, as in SimulationResult. Returns include any time-out penalty.
+	Returns        []float64
+	EpisodeLength  int
+	TerminalReason TerminalReason
+
+	// The message of the error the episode ended with, if any
+	ErrorMessage string
+
+	// The score of each agent before the current step, so rewards can be found for systems that are not environments
+	previousScores []float64
+}
+
+// Simulate a single job as SimulateJob does, recording everything that happens in the episode.
+//
+// The episode plays out exactly as it does when simulated any other way, so recording an episode
+// with the seed and agents of one simulated earlier (e.g. by the manager) reproduces it.
+func RecordEpisode(ctx context.Context, targetSystem system.System, job SimulationJob) (*EpisodeRecording, SimulationResult) {
+	recording := &EpisodeRecording{
+		SystemName:           systemName(targetSystem),
+		Seed:                 job.Seed,
+		Seeded:               job.Seeded,
+		MaximumEpisodeLength: job.MaximumEpisodeLength,
+		Chromosomes:          make([]*mat.Dense, len(job.Agents)),
+	}
+	for agentIndex, recordedAgent := range job.Agents {
+		recording.Chromosomes[agentIndex] = mat.DenseCopyOf(recordedAgent.Chromosome)
+	}
+
+	var seed *uint64
+	if job.Seeded {
+		seed = &job.Seed
+	}
+	result := simulateSystemInto(ctx, targetSystem, newStepper(targetSystem), job.Agents, seed, job.MaximumEpisodeLength, make([]float64, len(job.Agents)), recording)
+	recording.Returns = append([]float64{}, result.Returns...)
+	recording.EpisodeLength = result.EpisodeLength
+	recording.TerminalReason = result.TerminalReason
+	if result.Err != nil {
+		recording.ErrorMessage = result.Err.Error()
+	}
+	recording.previousScores = nil
+	return recording, result
+}
+
+// Simulate a recorded episode again, with fresh agents made from the recorded chromosomes,
+// and check that it plays out exactly as recorded. Returns the new recording, and a *ReplayMismatchError
+// describing the first difference if the replay does not match (or the context error if it is cancelled).
+//
+// Replays only match if the system is deterministic given its seed (see system.SeededSystem).
+func ReplayEpisode(ctx context.Context, targetSystem system.System, recording *EpisodeRecording) (*EpisodeRecording, error) {
+	job := SimulationJob{
+		Agents:               make([]*agent.Agent, len(recording.Chromosomes)),
+		Seed:                 recording.Seed,
+		Seeded:               recording.Seeded,
+		MaximumEpisodeLength: recording.MaximumEpisodeLength,
+	}
+	for agentIndex, chromosome := range recording.Chromosomes {
+		job.Agents[agentIndex] = agent.NewAgent(mat.DenseCopyOf(chromosome))
+	}
+
+	replayed, result := RecordEpisode(ctx, targetSystem, job)
+	if result.TerminalReason == TerminalReasonCancelled {
+		return replayed, result.Err
+	}
+	if err := recording.compare(replayed); err != nil {
+		return replayed, err
+	}
+	return replayed, nil
+}
+
+// A ReplayMismatchError describes where a replayed episode first differed from its recording
+type ReplayMismatchError struct {
+	// The index of the step that differed, or -1 if the episodes differed before the first step
+	// or only in their outcome
+	StepIndex int
+
+	// What differed, e.g. "Rewards"
+	Quantity string
+
+	Recorded interface{}
+	Replayed interface{}
+}
+
+func (err *ReplayMismatchError) Error() string {
+	if err.StepIndex < 0 {
+		return fmt.Sprintf("replay does not match the recording: %v was %v, but %v when replayed", err.Quantity, err.Recorded, err.Replayed)
+	}
+	return fmt.Sprintf("replay diverged from the recording at step %v: %v was %v, but %v when replayed",
+		err.StepIndex, err.Quantity, err.Recorded, err.Replayed)
+}
+
+// Find the first difference between this recording and a replay of it, or nil if they match exactly
+func (recording *EpisodeRecording) compare(replayed *EpisodeRecording) error {
+	if !identical(recording.InitialStateVector, replayed.InitialStateVector) {
+		return &ReplayMismatchError{StepIndex: -1, Quantity: "InitialStateVector", Recorded: recording.InitialStateVector, Replayed: replayed.InitialStateVector}
+	}
+	for stepIndex := 0; stepIndex < len(recording.Steps) && stepIndex < len(replayed.Steps); stepIndex++ {
+		recordedStep := recording.Steps[stepIndex]
+		replayedStep := replayed.Steps[stepIndex]
+		for agentIndex := 0; agentIndex < len(recordedStep.Actions) && agentIndex < len(replayedStep.Actions); agentIndex++ {
+			if !identical(recordedStep.Actions[agentIndex], replayedStep.Actions[agentIndex]) {
+				return &ReplayMismatchError{StepIndex: stepIndex, Quantity: fmt.Sprintf("Actions[%v]", agentIndex),
+					Recorded: recordedStep.Actions[agentIndex], Replayed: replayedStep.Actions[agentIndex]}
+			}
+		}
+		if !identical(recordedStep.Rewards, replayedStep.Rewards) {
+			return &ReplayMismatchError{StepIndex: stepIndex, Quantity: "Rewards", Recorded: recordedStep.Rewards, Replayed: replayedStep.Rewards}
+		}
+		if !identical(recordedStep.StateVector, replayedStep.StateVector) {
+			return &ReplayMismatchError{StepIndex: stepIndex, Quantity: "StateVector", Recorded: recordedStep.StateVector, Replayed: replayedStep.StateVector}
+		}
+	}
+	if recording.EpisodeLength != replayed.EpisodeLength {
+		return &ReplayMismatchError{StepIndex: -1, Quantity: "EpisodeLength", Recorded: recording.EpisodeLength, Replayed: replayed.EpisodeLength}
+	}
+	if recording.TerminalReason != replayed.TerminalReason {
+		return &ReplayMismatchError{StepIndex: -1, Quantity: "TerminalReason", Recorded: recording.TerminalReason, Replayed: replayed.TerminalReason}
+	}
+	if !identical(recording.Returns, replayed.Returns) {
+		return &ReplayMismatchError{StepIndex: -1, Quantity: "Returns", Recorded: recording.Returns, Replayed: replayed.Returns}
+	}
+	return nil
+}
+
+// Whether two vectors are bit for bit identical, so NaNs match each other but 0 and -0 do not
+func identical(a []float64, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if math.Float64bits(a[index]) != math.Float64bits(b[index]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Record the state an episode starts in. The agents must have just started their episode.
+func (recording *EpisodeRecording) recordInitialState(state *systemstate.SystemState, agents []*agent.Agent) {
+	recording.InitialStateVector = mat.VecDenseCopyOf(state.StateVector).RawVector().Data
+	recording.previousScores = make([]float64, len(agents))
+	for agentIndex, recordedAgent := range agents {
+		recording.previousScores[agentIndex] = recordedAgent.Score
+	}
+}
+
+// Record the step just taken by the stepper
+func (recording *EpisodeRecording) recordStep(stepper *stepper, state *systemstate.SystemState, agents []*agent.Agent) {
+	step := RecordedStep{
+		Rewards:     make([]float64, len(agents)),
+		StateVector: mat.VecDenseCopyOf(state.StateVector).RawVector().Data,
+	}
+	if stepper.environment != nil {
+		// The environment's rewards are used directly, as rewards found from the change in score may be rounded
+		copy(step.Rewards, stepper.buffers.Rewards)
+		step.Actions = make([][]float64, len(agents))
+		for agentIndex, action := range stepper.buffers.Actions {
+			step.Actions[agentIndex] = mat.VecDenseCopyOf(action).RawVector().Data
+		}
+	} else {
+		for agentIndex, recordedAgent := range agents {
+			step.Rewards[agentIndex] = recordedAgent.Score - recording.previousScores[agentIndex]
+		}
+	}
+	for agentIndex, recordedAgent := range agents {
+		recording.previousScores[agentIndex] = recordedAgent.Score
+	}
+	recording.Steps = append(recording.Steps, step)
+}
+
+// Save the recording to the given file
+func (recording *EpisodeRecording) WriteFile(filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(file).Encode(recording); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Read a recording saved with WriteFile
+func ReadEpisodeRecording(filePath string) (*EpisodeRecording, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	recording := &EpisodeRecording{}
+	if err := gob.NewDecoder(file).Decode(recording); err != nil {
+		return nil, err
+	}
+	return recording, nil
+}
+
+// The name of a system, as recorded in an EpisodeRecording
+func systemName(targetSystem system.System) string {
+	if describedSystem, ok := targetSystem.(system.DescribedSystem); ok {
+		return describedSystem.Name()
+	}
+	return fmt.Sprintf("%T", targetSystem)
+}
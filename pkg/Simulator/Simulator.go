@@ -1,61 +1,295 @@
 package simulator
 
 import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
 	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
 	datacollector "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/DataCollector"
 	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"gonum.org/v1/gonum/mat"
+)
+
+// The maximum number of steps in an episode, unless the system (see system.EpisodeLimitedSystem)
+// or the job (see SimulationJob.MaximumEpisodeLength) gives another limit.
+// Episodes reaching the limit are truncated.
+const DEFAULT_MAXIMUM_EPISODE_LENGTH = 5000
+
+// Describes why a simulation came to an end, see systemstate.TerminalReason
+type TerminalReason = systemstate.TerminalReason
+
+const (
+	// The system reported the state as terminal
+	TerminalReasonTerminal = systemstate.TerminalReasonTerminal
+	// The episode was truncated by the system or by hitting its maximum episode length
+	TerminalReasonTruncated = systemstate.TerminalReasonTruncated
+	// The simulation panicked, see SimulationResult.Err
+	TerminalReasonError = systemstate.TerminalReasonError
+	// The context of the simulation was cancelled before the state became terminal
+	TerminalReasonCancelled = systemstate.TerminalReasonCancelled
 )
 
-const MAXIMUM_SIMULATION_ITERATIONS = 5000
+// Get the maximum length of an episode of the given system. A positive jobLimit takes precedence,
+// then the system's own limit if it gives one, and otherwise DEFAULT_MAXIMUM_EPISODE_LENGTH.
+func maximumEpisodeLength(targetSystem system.System, jobLimit int) int {
+	if jobLimit > 0 {
+		return jobLimit
+	}
+	if limitedSystem, ok := targetSystem.(system.EpisodeLimitedSystem); ok && limitedSystem.MaximumEpisodeLength() > 0 {
+		return limitedSystem.MaximumEpisodeLength()
+	}
+	return DEFAULT_MAXIMUM_EPISODE_LENGTH
+}
+
+// Get the reward given to the agent with the given index when its episode is truncated at the given state.
+// This is zero unless the system applies a time-out penalty (see system.TimeoutPenalizedSystem).
+func timeoutPenalty(targetSystem system.System, state *systemstate.SystemState, agentIndex int) float64 {
+	if penalizedSystem, ok := targetSystem.(system.TimeoutPenalizedSystem); ok {
+		return penalizedSystem.TimeoutPenalty(state, agentIndex)
+	}
+	return 0.0
+}
+
+// The outcome of a single simulation
+type SimulationResult struct {
+	// The return each agent earned in this simulation, in the same order as the agents were given.
+	// If Err is not nil these are only partial returns, and have not been recorded in the agents' EpisodeReturns.
+	Returns []float64
+
+	// The number of times the state was advanced
+	EpisodeLength int
+
+	TerminalReason TerminalReason
+
+	// Any error raised during the simulation. This is either a *SimulationError if the system panicked,
+	// or the error of the context if the simulation was cancelled.
+	Err error
+}
+
+// A SimulationError is created when a system panics during a simulation.
+// It records enough information to reproduce the failure.
+type SimulationError struct {
+	// The IDs of the agents taking part in the simulation
+	AgentIDs []uint64
+
+	// The index and state vector of the last state before the panic.
+	// StateVector is nil if the panic occurred while initializing the state.
+	StateIndex  int
+	StateVector []float64
 
-// Define a wrapper around the simulation functions to allow for easy concurrency
+	// The value passed to panic, and the stack trace at the point of the panic
+	PanicValue interface{}
+	Stack      []byte
+}
+
+func (err *SimulationError) Error() string {
+	return fmt.Sprintf("simulation of agents %v panicked at state index %v (state vector %v): %v",
+		err.AgentIDs, err.StateIndex, err.StateVector, err.PanicValue)
+}
+
+// Simulate the given system until the state is found to be terminal,
+// or the episode is truncated at its maximum length (see DEFAULT_MAXIMUM_EPISODE_LENGTH)
 //
-// This wrapper function is intended to be run as a goroutine, with the agentChannel
-// getting the agents for each simulation.
+// # Each agent has the return it earned during this simulation appended to its EpisodeReturns
 //
-// Note that because the simulation affects the agents and state directly, we do not have
-// to return anything from this routine through another channel!
-// Instead we send back only a simple signal through the simulationFinishedSignalChannel.
-// This allows for the manager to count how many simulations have passed
-func ConcurrentSimulationRoutine(system system.System, agentChannel <-chan []*agent.Agent, simulationFinishedSignalChannel chan<- struct{}) {
-	// This loop will take items out of the agentChannel
-	//
-	// Once the agent channel is closed (done by the manager, once all agents are sent),
-	// this loop will exit and the goroutine will terminate
-	for agents := range agentChannel {
-		SimulateSystem(system, agents)
-		simulationFinishedSignalChannel <- struct{}{}
-	}
-}
-
-// Simulate the given system until the state is found to be terminal
-func SimulateSystem(system system.System, agents []*agent.Agent) {
-	state := system.InitializeState()
+// If the context is cancelled the simulation stops part way through, and the agents do not record a return
+func SimulateSystem(ctx context.Context, system system.System, agents []*agent.Agent) SimulationResult {
+	return simulateSystemInto(ctx, system, newStepper(system), agents, nil, 0, make([]float64, len(agents)), nil)
+}
+
+// Simulate the given system as in SimulateSystem, but with the episode seeded by the given seed.
+//
+// If the system implements SeededSystem, simulating the same agents with the same seed
+// always gives the same result. Otherwise the seed is ignored.
+func SimulateSystemWithSeed(ctx context.Context, system system.System, agents []*agent.Agent, seed uint64) SimulationResult {
+	return simulateSystemInto(ctx, system, newStepper(system), agents, &seed, 0, make([]float64, len(agents)), nil)
+}
 
-	// Loop forever (until very large value)
-	// or until the state is found to be terminal
-	for sanityCheck := 0; sanityCheck < MAXIMUM_SIMULATION_ITERATIONS; sanityCheck++ {
-		if state.TerminalState {
+// Simulate a single job as a WorkerPool would, honouring its seed and maximum episode length
+func SimulateJob(ctx context.Context, system system.System, job SimulationJob) SimulationResult {
+	var seed *uint64
+	if job.Seeded {
+		seed = &job.Seed
+	}
+	return simulateSystemInto(ctx, system, newStepper(system), job.Agents, seed, job.MaximumEpisodeLength, make([]float64, len(job.Agents)), nil)
+}
+
+// Create the initial state of a simulation, seeding it if a seed is given and the system supports it
+func initializeState(targetSystem system.System, seed *uint64) *systemstate.SystemState {
+	if seededSystem, ok := targetSystem.(system.SeededSystem); ok && seed != nil {
+		return systemstate.NewSeededState(*seed, seededSystem.InitializeSeededState)
+	}
+	return targetSystem.InitializeState()
+}
+
+// Advances the states of a single simulation, reusing the same memory for every step where the system allows
+type stepper struct {
+	targetSystem system.System
+
+	// Only set if the system is an environment (and is not a ContextualSystem),
+	// in which case it is stepped directly with buffers reused for every step
+	environment system.Environment
+	buffers     *system.StepBuffers
+}
+
+// Create a stepper for the given system. A stepper may be reused for any number of simulations of the system,
+// one at a time, so that callers running many simulations (such as the workers of a WorkerPool) reuse its buffers.
+func newStepper(targetSystem system.System) *stepper {
+	if _, ok := targetSystem.(system.ContextualSystem); ok {
+		return &stepper{targetSystem: targetSystem}
+	}
+	environment, ok := system.AsEnvironment(targetSystem)
+	if !ok {
+		return &stepper{targetSystem: targetSystem}
+	}
+	return &stepper{
+		targetSystem: targetSystem,
+		environment:  environment,
+		buffers:      system.NewStepBuffers(environment),
+	}
+}
+
+// Advance the state a single step, letting the system observe the context if it is able to
+func (stepper *stepper) advanceState(ctx context.Context, state *systemstate.SystemState, agents []*agent.Agent) {
+	if stepper.environment != nil {
+		system.AdvanceEnvironmentState(stepper.environment, state, agents, stepper.buffers)
+	} else if contextualSystem, ok := stepper.targetSystem.(system.ContextualSystem); ok {
+		contextualSystem.AdvanceStateContext(ctx, state, agents)
+	} else {
+		stepper.targetSystem.AdvanceState(state, agents)
+	}
+}
+
+// Simulate the given system, as in SimulateSystem, writing the agent returns into the given slice.
+// This allows callers running many simulations to reuse the memory for the returns.
+// The episode is seeded if seed is not nil, and limited to jobLimit steps if it is positive (see maximumEpisodeLength).
+// Every step is recorded in recording if it is not nil (see RecordEpisode).
+// The system is stepped by the given stepper, which must have been made for it by newStepper.
+//
+// Any panic raised by the system is recovered, and reported through the Err field of the result.
+func simulateSystemInto(ctx context.Context, system system.System, stepper *stepper, agents []*agent.Agent, seed *uint64, jobLimit int, returns []float64, recording *EpisodeRecording) (result SimulationResult) {
+	for _, simulationAgent := range agents {
+		simulationAgent.StartEpisode()
+	}
+
+	result = SimulationResult{
+		Returns:        returns,
+		TerminalReason: TerminalReasonTruncated,
+	}
+
+	var state *systemstate.SystemState
+	defer func() {
+		panicValue := recover()
+		if panicValue == nil {
+			return
+		}
+		simulationError := &SimulationError{
+			AgentIDs:   make([]uint64, len(agents)),
+			PanicValue: panicValue,
+			Stack:      debug.Stack(),
+		}
+		for agentIndex, simulationAgent := range agents {
+			simulationError.AgentIDs[agentIndex] = simulationAgent.ID
+			returns[agentIndex] = simulationAgent.Score
+		}
+		if state != nil {
+			state.TerminalState = true
+			state.TerminalReason = TerminalReasonError
+			simulationError.StateIndex = state.StateIndex
+			if state.StateVector != nil {
+				simulationError.StateVector = mat.VecDenseCopyOf(state.StateVector).RawVector().Data
+			}
+		}
+		result.TerminalReason = TerminalReasonError
+		result.Err = simulationError
+	}()
+
+	state = initializeState(system, seed)
+	episodeLimit := maximumEpisodeLength(system, jobLimit)
+	if recording != nil {
+		recording.recordInitialState(state, agents)
+	}
+
+	// Loop until the state is found to be terminal,
+	// or the episode runs out of time
+	contextDone := ctx.Done()
+	for !state.TerminalState {
+		if result.EpisodeLength >= episodeLimit {
+			state.TerminalState = true
+			state.TerminalReason = TerminalReasonTruncated
 			break
 		}
-		system.AdvanceState(state, agents)
+		select {
+		case <-contextDone:
+			state.TerminalState = true
+			state.TerminalReason = TerminalReasonCancelled
+			result.TerminalReason = TerminalReasonCancelled
+			result.Err = ctx.Err()
+			return result
+		default:
+		}
+		stepper.advanceState(ctx, state, agents)
+		result.EpisodeLength++
+		if recording != nil {
+			recording.recordStep(stepper, state, agents)
+		}
+	}
+	result.TerminalReason = state.TerminalReason
+
+	for agentIndex, simulationAgent := range agents {
+		if state.TerminalReason == TerminalReasonTruncated {
+			simulationAgent.Score += timeoutPenalty(system, state, agentIndex)
+		}
+		simulationAgent.EndEpisode()
+		returns[agentIndex] = simulationAgent.Score
 	}
+	return result
 }
 
-// Simulate the given system until state is terminal
+// Simulate the given system until state is terminal (or truncated, as in SimulateJob with the given maximumLength)
 // Save each state to a file for easy inspection
-func SimulateSystemWithSave(system system.System, agents []*agent.Agent, simulationDataCollector *datacollector.SimulationDataCollector) {
+//
+// The episode starts from a fresh (unseeded) initial state, so cannot be reproduced.
+// Use RecordEpisode to record an episode that can be replayed exactly.
+//
+// As with SimulateSystem, the agents have the return of this simulation appended to their EpisodeReturns.
+// Pass copies of the agents if this is undesirable.
+//
+// Returns the error of the context if it is cancelled before the simulation finishes.
+// The states up to that point are still saved, but the agents do not record a return.
+func SimulateSystemWithSave(ctx context.Context, system system.System, agents []*agent.Agent, maximumLength int, simulationDataCollector *datacollector.SimulationDataCollector) error {
+	for _, simulationAgent := range agents {
+		simulationAgent.StartEpisode()
+	}
 
 	state := system.InitializeState()
 	simulationDataCollector.CollectSimulationData(state)
+	stepper := newStepper(system)
+	episodeLimit := maximumEpisodeLength(system, maximumLength)
 
-	// Loop forever (until very large value)
-	// or until the state is found to be terminal
-	for sanityCheck := 0; sanityCheck < MAXIMUM_SIMULATION_ITERATIONS; sanityCheck++ {
-		if state.TerminalState {
+	// Loop until the state is found to be terminal,
+	// or the episode runs out of time
+	for stepIndex := 0; !state.TerminalState; stepIndex++ {
+		if stepIndex >= episodeLimit {
+			state.TerminalState = true
+			state.TerminalReason = TerminalReasonTruncated
 			break
 		}
-		system.AdvanceState(state, agents)
+		if err := ctx.Err(); err != nil {
+			// As in SimulateSystem, the agents do not record a return for a cancelled episode
+			return err
+		}
+		stepper.advanceState(ctx, state, agents)
 		simulationDataCollector.CollectSimulationData(state.DeepCopyState())
 	}
+
+	for agentIndex, simulationAgent := range agents {
+		if state.TerminalReason == TerminalReasonTruncated {
+			simulationAgent.Score += timeoutPenalty(system, state, agentIndex)
+		}
+		simulationAgent.EndEpisode()
+	}
+	return nil
 }
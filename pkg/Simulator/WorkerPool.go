@@ -0,0 +1,230 @@
+package simulator
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+)
+
+// A single simulation to be run by a WorkerPool
+type SimulationJob struct {
+	// The agents taking part in this simulation.
+	// There must be exactly system.NumAgentsPerSimulation of them.
+	Agents []*agent.Agent
+
+	// The seed of the simulation's episode, see SimulateSystemWithSeed.
+	// Ignored unless Seeded is true.
+	Seed   uint64
+	Seeded bool
+
+	// The number of steps after which the episode is truncated, overriding the system's own limit.
+	// If this is not positive, the system's limit (or DEFAULT_MAXIMUM_EPISODE_LENGTH) is used.
+	MaximumEpisodeLength int
+}
+
+// A BatchSimulator runs many independent simulations of a single system.
+//
+// WorkerPool runs simulations on local goroutines, while `pkg/Distributed` provides a Coordinator
+// that hands them out to worker processes, possibly on other machines.
+type BatchSimulator interface {
+	// Simulate every job, blocking until all are finished (or the context is cancelled),
+	// with the result of each job at the same index in the returned slice.
+	//
+	// As for SimulateSystem, every agent in a successful simulation has its return appended to its EpisodeReturns.
+	SimulateBatch(ctx context.Context, jobs []SimulationJob) []SimulationResult
+
+	// Release any resources held by the simulator. It cannot be used after this is called.
+	Close()
+}
+
+// Batch simulators that can report how busy they are implement UtilizationReporter,
+// allowing the Manager to report worker utilisation (see GenerationSummary.WorkerUtilization)
+type UtilizationReporter interface {
+	// The total time spent simulating, summed over every worker, since the simulator was created
+	BusyDuration() time.Duration
+
+	// The number of simulations that can run at once
+	Capacity() int
+}
+
+// A contiguous range of jobs within the current batch, [startIndex, endIndex)
+type jobChunk struct {
+	startIndex int
+	endIndex   int
+}
+
+// Number of chunks each worker should receive (on average) from a batch.
+// More chunks balance the load better when simulations have very different lengths,
+// fewer chunks mean less channel traffic.
+const chunksPerWorker = 4
+
+// A WorkerPool is a set of long lived goroutines that run simulations of a single system.
+//
+// The pool is created once (typically by the Manager) and reused for every repetition of every generation,
+// avoiding creating new goroutines and channels each time. Jobs are handed to workers in chunks
+// rather than one at a time, and results are written directly into memory owned by the pool.
+//
+// Systems implementing system.BatchedSystem have each chunk of jobs simulated in lockstep.
+//
+// A WorkerPool runs only one batch at a time, and SimulateBatch must not be called concurrently.
+// Call Close once the pool is no longer needed to stop the workers.
+type WorkerPool struct {
+	system system.System
+	// Set if the system can simulate a chunk of jobs in lockstep
+	batchedSystem system.BatchedSystem
+	numWorkers    int
+	chunkChannel  chan jobChunk
+	batchGroup    sync.WaitGroup
+
+	// State of the batch currently being simulated.
+	// These are written before any chunks are sent, and only read by the workers.
+	currentContext context.Context
+	currentJobs    []SimulationJob
+	results        []SimulationResult
+	returns        []float64
+
+	// Total time the workers have spent simulating, see BusyDuration
+	busyNanoseconds atomic.Int64
+}
+
+// Create a new WorkerPool of numWorkers goroutines simulating the given system
+func NewWorkerPool(targetSystem system.System, numWorkers int) *WorkerPool {
+	if numWorkers <= 0 {
+		panic("Number of workers must be a positive integer!")
+	}
+
+	pool := &WorkerPool{
+		system:       targetSystem,
+		numWorkers:   numWorkers,
+		chunkChannel: make(chan jobChunk, chunksPerWorker*numWorkers),
+		results:      []SimulationResult{},
+		returns:      []float64{},
+	}
+	pool.batchedSystem, _ = targetSystem.(system.BatchedSystem)
+	for workerIndex := 0; workerIndex < numWorkers; workerIndex++ {
+		go pool.workerRoutine()
+	}
+	return pool
+}
+
+// Simulate every job, blocking until all are finished.
+//
+// If the context is cancelled, running simulations stop at their next step and any jobs not yet started
+// are skipped. These jobs have a TerminalReason of TerminalReasonCancelled and the context error as Err.
+//
+// The result of each job is at the same index in the returned slice.
+// The returned slice (and the Returns of each result) is owned by the pool and is only
+// valid until the next call to SimulateBatch. Copy anything that must be kept longer.
+func (pool *WorkerPool) SimulateBatch(ctx context.Context, jobs []SimulationJob) []SimulationResult {
+	numReturns := 0
+	for _, job := range jobs {
+		numReturns += len(job.Agents)
+	}
+
+	// Grow the result buffers only if this batch is larger than any we have seen
+	if cap(pool.results) < len(jobs) {
+		pool.results = make([]SimulationResult, len(jobs))
+	}
+	if cap(pool.returns) < numReturns {
+		pool.returns = make([]float64, numReturns)
+	}
+	pool.results = pool.results[:len(jobs)]
+	pool.returns = pool.returns[:numReturns]
+
+	// Assign each job its section of the returns buffer before any worker starts
+	returnsIndex := 0
+	for jobIndex, job := range jobs {
+		pool.results[jobIndex].Returns = pool.returns[returnsIndex : returnsIndex+len(job.Agents)]
+		returnsIndex += len(job.Agents)
+	}
+	pool.currentContext = ctx
+	pool.currentJobs = jobs
+
+	chunkSize := len(jobs) / (chunksPerWorker * pool.numWorkers)
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+	for startIndex := 0; startIndex < len(jobs); startIndex += chunkSize {
+		endIndex := startIndex + chunkSize
+		if endIndex > len(jobs) {
+			endIndex = len(jobs)
+		}
+		pool.batchGroup.Add(1)
+		pool.chunkChannel <- jobChunk{startIndex: startIndex, endIndex: endIndex}
+	}
+	pool.batchGroup.Wait()
+
+	pool.currentContext = nil
+	pool.currentJobs = nil
+	return pool.results
+}
+
+// The total time spent simulating, summed over every worker, since the pool was created
+func (pool *WorkerPool) BusyDuration() time.Duration {
+	return time.Duration(pool.busyNanoseconds.Load())
+}
+
+// The number of workers in the pool
+func (pool *WorkerPool) Capacity() int {
+	return pool.numWorkers
+}
+
+// Stop all workers in the pool. The pool cannot be used after this is called.
+func (pool *WorkerPool) Close() {
+	close(pool.chunkChannel)
+}
+
+// The main loop of each worker, taking chunks of jobs until the pool is closed.
+// Each worker owns a single stepper, whose buffers are reused for every job it simulates.
+func (pool *WorkerPool) workerRoutine() {
+	var workerStepper *stepper
+	if pool.batchedSystem == nil {
+		workerStepper = newStepper(pool.system)
+	}
+	for chunk := range pool.chunkChannel {
+		chunkStartTime := time.Now()
+		if pool.batchedSystem != nil {
+			pool.simulateChunkInLockstep(chunk)
+			pool.busyNanoseconds.Add(int64(time.Since(chunkStartTime)))
+			pool.batchGroup.Done()
+			continue
+		}
+		for jobIndex := chunk.startIndex; jobIndex < chunk.endIndex; jobIndex++ {
+			if err := pool.currentContext.Err(); err != nil {
+				pool.results[jobIndex] = SimulationResult{
+					Returns:        pool.results[jobIndex].Returns,
+					TerminalReason: TerminalReasonCancelled,
+					Err:            err,
+				}
+				continue
+			}
+			job := &pool.currentJobs[jobIndex]
+			var seed *uint64
+			if job.Seeded {
+				seed = &job.Seed
+			}
+			pool.results[jobIndex] = simulateSystemInto(pool.currentContext, pool.system, workerStepper, job.Agents, seed, job.MaximumEpisodeLength, pool.results[jobIndex].Returns, nil)
+		}
+		pool.busyNanoseconds.Add(int64(time.Since(chunkStartTime)))
+		pool.batchGroup.Done()
+	}
+}
+
+// Simulate a chunk of jobs in lockstep, unless the batch has already been cancelled
+func (pool *WorkerPool) simulateChunkInLockstep(chunk jobChunk) {
+	if err := pool.currentContext.Err(); err != nil {
+		for jobIndex := chunk.startIndex; jobIndex < chunk.endIndex; jobIndex++ {
+			pool.results[jobIndex] = SimulationResult{
+				Returns:        pool.results[jobIndex].Returns,
+				TerminalReason: TerminalReasonCancelled,
+				Err:            err,
+			}
+		}
+		return
+	}
+	simulateLockstepInto(pool.currentContext, pool.batchedSystem, pool.currentJobs[chunk.startIndex:chunk.endIndex], pool.results[chunk.startIndex:chunk.endIndex])
+}
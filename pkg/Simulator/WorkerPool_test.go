@@ -0,0 +1,236 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	datacollector "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/DataCollector"
+	rundirectory "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/RunDirectory"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// A system that panics on the given step, and terminates on the step after
+type panickingSystem struct {
+	panicStateIndex int
+}
+
+func (system *panickingSystem) NumPercepts() int            { return 1 }
+func (system *panickingSystem) NumActions() int             { return 1 }
+func (system *panickingSystem) NumAgentsPerSimulation() int { return 2 }
+
+func (system *panickingSystem) InitializeState() *systemstate.SystemState {
+	return &systemstate.SystemState{
+		StateVector: mat.NewVecDense(1, []float64{1.0}),
+	}
+}
+
+func (system *panickingSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
+	if state.StateIndex == system.panicStateIndex {
+		panic("index out of range")
+	}
+	for _, simulationAgent := range agents {
+		simulationAgent.Score += 1.0
+	}
+	state.StateIndex += 1
+	state.TerminalState = state.StateIndex > system.panicStateIndex
+}
+
+func TestWorkerPoolRecoversPanics(t *testing.T) {
+	pool := NewWorkerPool(&panickingSystem{panicStateIndex: 3}, 4)
+	defer pool.Close()
+
+	jobs := make([]SimulationJob, 10)
+	for jobIndex := range jobs {
+		jobs[jobIndex].Agents = []*agent.Agent{
+			agent.NewRandomGaussianAgent(1, 1),
+			agent.NewRandomGaussianAgent(1, 1),
+		}
+	}
+
+	results := pool.SimulateBatch(context.Background(), jobs)
+	if len(results) != len(jobs) {
+		t.Fatalf("expected %v results, got %v", len(jobs), len(results))
+	}
+	for jobIndex, result := range results {
+		var simulationError *SimulationError
+		if !errors.As(result.Err, &simulationError) {
+			t.Fatalf("expected a SimulationError, got %v", result.Err)
+		}
+		if result.TerminalReason != TerminalReasonError {
+			t.Errorf("expected terminal reason %v, got %v", TerminalReasonError, result.TerminalReason)
+		}
+		if simulationError.StateIndex != 3 || len(simulationError.StateVector) != 1 {
+			t.Errorf("expected error at state index 3 with the state vector, got %v", simulationError)
+		}
+		if simulationError.AgentIDs[0] != jobs[jobIndex].Agents[0].ID || simulationError.AgentIDs[1] != jobs[jobIndex].Agents[1].ID {
+			t.Errorf("expected agent IDs of job %v, got %v", jobIndex, simulationError.AgentIDs)
+		}
+		if len(jobs[jobIndex].Agents[0].EpisodeReturns) != 0 {
+			t.Errorf("failed simulations should not record episode returns")
+		}
+	}
+
+	// A system that never panics should terminate normally, and record the agent returns
+	pool = NewWorkerPool(&panickingSystem{panicStateIndex: -1}, 4)
+	defer pool.Close()
+	results = pool.SimulateBatch(context.Background(), jobs)
+	for jobIndex, result := range results {
+		if result.Err != nil || result.TerminalReason != TerminalReasonTerminal {
+			t.Errorf("expected terminal simulation without error, got %v (%v)", result.TerminalReason, result.Err)
+		}
+		if len(jobs[jobIndex].Agents[0].EpisodeReturns) != 1 || result.Returns[0] != 1.0 {
+			t.Errorf("expected a single recorded return of 1.0, got %v", jobs[jobIndex].Agents[0].EpisodeReturns)
+		}
+	}
+}
+
+// The panicking system, simulated in lockstep
+type panickingBatchedSystem struct {
+	panickingSystem
+}
+
+func (system *panickingBatchedSystem) InitializeSeededState(randomGenerator *rand.Rand) *systemstate.SystemState {
+	return system.InitializeState()
+}
+
+func (batchedSystem *panickingBatchedSystem) InitializeBatchState(randomGenerators []*rand.Rand) *systemstate.BatchState {
+	return system.InitializeBatchStateFromEpisodes(batchedSystem, randomGenerators)
+}
+
+func (system *panickingBatchedSystem) ObserveBatch(batch *systemstate.BatchState, agentIndex int, percepts *mat.Dense) {
+}
+
+func (system *panickingBatchedSystem) StepBatch(batch *systemstate.BatchState, actions []*mat.Dense, rewards *mat.Dense) {
+	for episodeIndex, terminal := range batch.TerminalMask {
+		if terminal {
+			continue
+		}
+		if batch.StateIndices[episodeIndex] == system.panicStateIndex {
+			panic("index out of range")
+		}
+		rewards.Set(episodeIndex, 0, 1.0)
+		rewards.Set(episodeIndex, 1, 1.0)
+		batch.TerminalMask[episodeIndex] = batch.StateIndices[episodeIndex]+1 > system.panicStateIndex
+	}
+}
+
+// A panic part way through a lockstep batch must be attributed to each job, as if they were simulated alone
+func TestLockstepRecoversPanics(t *testing.T) {
+	jobs := make([]SimulationJob, 5)
+	for jobIndex := range jobs {
+		jobs[jobIndex].Agents = []*agent.Agent{
+			agent.NewRandomGaussianAgent(1, 1),
+			agent.NewRandomGaussianAgent(1, 1),
+		}
+	}
+
+	results := SimulateBatchInLockstep(context.Background(), &panickingBatchedSystem{panickingSystem{panicStateIndex: 3}}, jobs)
+	for jobIndex, result := range results {
+		var simulationError *SimulationError
+		if !errors.As(result.Err, &simulationError) || simulationError.StateIndex != 3 {
+			t.Errorf("job %v: expected a SimulationError at state index 3, got %v", jobIndex, result.Err)
+		}
+		if len(jobs[jobIndex].Agents[0].EpisodeReturns) != 0 {
+			t.Errorf("failed simulations should not record episode returns")
+		}
+	}
+
+	results = SimulateBatchInLockstep(context.Background(), &panickingBatchedSystem{panickingSystem{panicStateIndex: -1}}, jobs)
+	for jobIndex, result := range results {
+		if result.Err != nil || result.TerminalReason != TerminalReasonTerminal || result.EpisodeLength != 1 {
+			t.Errorf("expected a single step terminal simulation without error, got %v steps (%v, %v)", result.EpisodeLength, result.TerminalReason, result.Err)
+		}
+		if len(jobs[jobIndex].Agents[0].EpisodeReturns) != 1 || result.Returns[0] != 1.0 {
+			t.Errorf("expected a single recorded return of 1.0, got %v", jobs[jobIndex].Agents[0].EpisodeReturns)
+		}
+	}
+}
+
+// A system that never terminates (in practice), limiting its own episodes to 10 steps and penalising agents that run out of time
+type limitedSystem struct {
+	panickingBatchedSystem
+}
+
+func (system *limitedSystem) MaximumEpisodeLength() int {
+	return 10
+}
+
+func (system *limitedSystem) TimeoutPenalty(state *systemstate.SystemState, agentIndex int) float64 {
+	return -5.0 * float64(agentIndex+1)
+}
+
+// Episodes must be truncated at the job's limit if it has one, and otherwise at the system's,
+// with the time-out penalty applied the same way whether simulated alone or in lockstep
+func TestEpisodeLimits(t *testing.T) {
+	targetSystem := &limitedSystem{panickingBatchedSystem{panickingSystem{panicStateIndex: 1 << 30}}}
+	for _, maximumLength := range []int{0, 3} {
+		expectedLength := 10
+		if maximumLength > 0 {
+			expectedLength = maximumLength
+		}
+
+		jobs := make([]SimulationJob, 3)
+		for jobIndex := range jobs {
+			jobs[jobIndex] = SimulationJob{
+				Agents:               []*agent.Agent{agent.NewRandomGaussianAgent(1, 1), agent.NewRandomGaussianAgent(1, 1)},
+				MaximumEpisodeLength: maximumLength,
+			}
+		}
+		results := append(SimulateBatchInLockstep(context.Background(), targetSystem, jobs), SimulateJob(context.Background(), targetSystem, jobs[0]))
+		for resultIndex, result := range results {
+			if result.Err != nil || result.TerminalReason != TerminalReasonTruncated || result.EpisodeLength != expectedLength {
+				t.Errorf("limit %v, result %v: expected a truncated simulation of %v steps, got %v steps (%v, %v)",
+					maximumLength, resultIndex, expectedLength, result.EpisodeLength, result.TerminalReason, result.Err)
+			}
+			if result.Returns[0] != float64(expectedLength)-5.0 || result.Returns[1] != float64(expectedLength)-10.0 {
+				t.Errorf("limit %v, result %v: expected the time-out penalty in the returns, got %v", maximumLength, resultIndex, result.Returns)
+			}
+		}
+		if episodeReturns := jobs[0].Agents[1].EpisodeReturns; len(episodeReturns) != 2 || episodeReturns[1] != float64(expectedLength)-10.0 {
+			t.Errorf("limit %v: expected the penalised return to be recorded, got %v", maximumLength, episodeReturns)
+		}
+	}
+}
+
+// Systems that are not environments hide their agents' actions, but their rewards must still be recorded
+func TestRecordingWithoutEnvironment(t *testing.T) {
+	job := SimulationJob{Agents: []*agent.Agent{agent.NewRandomGaussianAgent(1, 1), agent.NewRandomGaussianAgent(1, 1)}}
+	recording, result := RecordEpisode(context.Background(), &panickingSystem{panicStateIndex: 2}, job)
+	if result.Err == nil || recording.ErrorMessage == "" || recording.TerminalReason != TerminalReasonError {
+		t.Errorf("expected the panic to be recorded, got %v (%q)", recording.TerminalReason, recording.ErrorMessage)
+	}
+	if len(recording.Steps) != 2 || recording.Steps[1].Actions != nil || recording.Steps[1].Rewards[1] != 1.0 {
+		t.Errorf("expected 2 steps with rewards of 1 and no actions, got %+v", recording.Steps)
+	}
+	if _, err := ReplayEpisode(context.Background(), &panickingSystem{panicStateIndex: 2}, recording); err != nil {
+		t.Errorf("expected the replay to match, got %v", err)
+	}
+}
+
+// A cancelled episode must not leave a partial return, whether or not its states are saved
+func TestCancelledEpisodesRecordNoReturn(t *testing.T) {
+	runDirectory, err := rundirectory.NewRunDirectory(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := datacollector.NewSimulationDataCollector(runDirectory, "cancelled.parquet", []string{"State0"})
+	defer collector.WriteStop()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	agents := []*agent.Agent{agent.NewRandomGaussianAgent(1, 1), agent.NewRandomGaussianAgent(1, 1)}
+	if err := SimulateSystemWithSave(ctx, &panickingSystem{panicStateIndex: 1 << 30}, agents, 0, collector); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context error, got %v", err)
+	}
+	SimulateSystem(ctx, &panickingSystem{panicStateIndex: 1 << 30}, agents)
+	for agentIndex, simulationAgent := range agents {
+		if len(simulationAgent.EpisodeReturns) != 0 {
+			t.Errorf("agent %v: expected no returns from cancelled episodes, got %v", agentIndex, simulationAgent.EpisodeReturns)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package sweep
+
+import (
+	"errors"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Candidate hyperparameters of the Gaussian process kernel. The pair with the highest marginal
+// likelihood is chosen each time the process is fitted. Inputs are points in the unit hypercube
+// and outputs are standardised, so the same candidates suit every parameter space.
+var (
+	gaussianProcessLengthScales   = []float64{0.05, 0.1, 0.2, 0.4, 0.8, 1.6}
+	gaussianProcessNoiseVariances = []float64{1e-4, 1e-2, 1e-1, 0.5}
+)
+
+// A Gaussian process regression model with a squared exponential kernel, used as a cheap
+// surrogate for the (expensive) outcome of a training run.
+type GaussianProcess struct {
+	inputs [][]float64
+
+	// Outputs are standardised to zero mean and unit variance before fitting
+	outputMean   float64
+	outputStdDev float64
+
+	lengthScale   float64
+	noiseVariance float64
+
+	// Cholesky factorisation of the kernel matrix (plus noise) of the inputs
+	cholesky mat.Cholesky
+	// The kernel matrix inverse multiplied by the standardised outputs
+	alpha *mat.VecDense
+}
+
+// Fit a Gaussian process to the given observations. Inputs should lie in the unit hypercube.
+func FitGaussianProcess(inputs [][]float64, outputs []float64) (*GaussianProcess, error) {
+	if len(inputs) == 0 || len(inputs) != len(outputs) {
+		return nil, errors.New("a Gaussian process needs the same, non-zero, number of inputs and outputs")
+	}
+
+	outputMean, outputStdDev := stat.MeanStdDev(outputs, nil)
+	if len(outputs) < 2 || outputStdDev == 0 || math.IsNaN(outputStdDev) {
+		outputStdDev = 1.0
+	}
+	standardisedOutputs := make([]float64, len(outputs))
+	for outputIndex, output := range outputs {
+		standardisedOutputs[outputIndex] = (output - outputMean) / outputStdDev
+	}
+
+	var bestProcess *GaussianProcess
+	bestLogLikelihood := math.Inf(-1)
+	for _, lengthScale := range gaussianProcessLengthScales {
+		for _, noiseVariance := range gaussianProcessNoiseVariances {
+			process := &GaussianProcess{
+				inputs:        inputs,
+				outputMean:    outputMean,
+				outputStdDev:  outputStdDev,
+				lengthScale:   lengthScale,
+				noiseVariance: noiseVariance,
+			}
+			logLikelihood, ok := process.fit(standardisedOutputs)
+			if ok && logLikelihood > bestLogLikelihood {
+				bestProcess = process
+				bestLogLikelihood = logLikelihood
+			}
+		}
+	}
+	if bestProcess == nil {
+		return nil, errors.New("could not factorise the Gaussian process kernel matrix")
+	}
+	return bestProcess, nil
+}
+
+func (process *GaussianProcess) kernel(a, b []float64) float64 {
+	squaredDistance := 0.0
+	for dimensionIndex := range a {
+		difference := a[dimensionIndex] - b[dimensionIndex]
+		squaredDistance += difference * difference
+	}
+	return math.Exp(-squaredDistance / (2 * process.lengthScale * process.lengthScale))
+}
+
+// Factorise the kernel matrix and return the log marginal likelihood of the outputs
+func (process *GaussianProcess) fit(standardisedOutputs []float64) (float64, bool) {
+	numInputs := len(process.inputs)
+	kernelMatrix := mat.NewSymDense(numInputs, nil)
+	for i := 0; i < numInputs; i++ {
+		for j := i; j < numInputs; j++ {
+			kernelMatrix.SetSym(i, j, process.kernel(process.inputs[i], process.inputs[j]))
+		}
+		kernelMatrix.SetSym(i, i, kernelMatrix.At(i, i)+process.noiseVariance)
+	}
+	if ok := process.cholesky.Factorize(kernelMatrix); !ok {
+		return 0.0, false
+	}
+
+	outputVector := mat.NewVecDense(numInputs, standardisedOutputs)
+	process.alpha = mat.NewVecDense(numInputs, nil)
+	if err := process.cholesky.SolveVecTo(process.alpha, outputVector); err != nil {
+		return 0.0, false
+	}
+
+	logLikelihood := -0.5*mat.Dot(outputVector, process.alpha) -
+		0.5*process.cholesky.LogDet() -
+		0.5*float64(numInputs)*math.Log(2*math.Pi)
+	return logLikelihood, true
+}
+
+// Get the predicted mean and standard deviation of the output at the given input
+func (process *GaussianProcess) Predict(input []float64) (float64, float64) {
+	numInputs := len(process.inputs)
+	kernelVector := mat.NewVecDense(numInputs, nil)
+	for inputIndex, trainingInput := range process.inputs {
+		kernelVector.SetVec(inputIndex, process.kernel(input, trainingInput))
+	}
+
+	mean := mat.Dot(kernelVector, process.alpha)
+
+	solved := mat.NewVecDense(numInputs, nil)
+	variance := 1.0
+	if err := process.cholesky.SolveVecTo(solved, kernelVector); err == nil {
+		variance -= mat.Dot(kernelVector, solved)
+	}
+	variance = math.Max(variance, 1e-12)
+
+	return mean*process.outputStdDev + process.outputMean, math.Sqrt(variance) * process.outputStdDev
+}
+
+// The expected amount by which an output drawn from N(mean, stdDev²) exceeds bestOutput,
+// used to pick the most promising configuration to try next (for maximisation).
+//
+// exploration is a small margin that must be exceeded before an improvement counts, trading
+// off refining the current best against exploring uncertain regions.
+func ExpectedImprovement(mean, stdDev, bestOutput, exploration float64) float64 {
+	improvement := mean - bestOutput - exploration
+	if stdDev <= 0 {
+		return math.Max(improvement, 0.0)
+	}
+	z := improvement / stdDev
+	return improvement*distuv.UnitNormal.CDF(z) + stdDev*distuv.UnitNormal.Prob(z)
+}
+
+// The largest output among the given outputs, ignoring NaNs
+func maxIgnoringNaN(outputs []float64) float64 {
+	best := math.Inf(-1)
+	for _, output := range outputs {
+		if !math.IsNaN(output) {
+			best = math.Max(best, output)
+		}
+	}
+	return best
+}
@@ -0,0 +1,226 @@
+package sweep
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"golang.org/x/exp/rand"
+)
+
+// A single parameter to be varied in a sweep.
+//
+// A dimension is either discrete, in which case Values lists every value to try, or continuous
+// over [Min, Max]. Continuous dimensions may be sampled on a log scale (useful for rates spanning
+// several orders of magnitude) and may be restricted to integers.
+type Dimension struct {
+	// The name of the parameter. See TrialSettings.Apply for the names that are understood.
+	Name string
+
+	// If given, the dimension takes only these values and Min, Max, LogScale are ignored
+	Values []float64
+
+	Min float64
+	Max float64
+
+	// Sample uniformly in log(value) rather than value. Min and Max must then be positive.
+	LogScale bool
+
+	// Round sampled values to the nearest integer
+	Integer bool
+}
+
+// The set of parameters varied by a sweep
+type ParameterSpace []Dimension
+
+// A Configuration is a single point in a parameter space, giving a value for each named parameter
+type Configuration map[string]float64
+
+// Check every dimension of the parameter space is well formed
+func (space ParameterSpace) Validate() error {
+	seenNames := make(map[string]bool)
+	for _, dimension := range space {
+		if dimension.Name == "" {
+			return fmt.Errorf("parameter space dimension has no name")
+		}
+		if seenNames[dimension.Name] {
+			return fmt.Errorf("parameter %q appears more than once", dimension.Name)
+		}
+		seenNames[dimension.Name] = true
+		if len(dimension.Values) > 0 {
+			continue
+		}
+		if dimension.Min > dimension.Max {
+			return fmt.Errorf("parameter %q has Min greater than Max", dimension.Name)
+		}
+		if dimension.LogScale && dimension.Min <= 0 {
+			return fmt.Errorf("parameter %q is log scaled, so Min must be positive", dimension.Name)
+		}
+	}
+	return nil
+}
+
+// Map a unit value u in [0, 1] onto this dimension
+func (dimension Dimension) FromUnit(u float64) float64 {
+	if len(dimension.Values) > 0 {
+		valueIndex := int(u * float64(len(dimension.Values)))
+		if valueIndex >= len(dimension.Values) {
+			valueIndex = len(dimension.Values) - 1
+		}
+		return dimension.Values[valueIndex]
+	}
+
+	var value float64
+	switch {
+	case u <= 0.0:
+		// Hit the ends of the range exactly, rather than relying on floating point
+		value = dimension.Min
+	case u >= 1.0:
+		value = dimension.Max
+	case dimension.LogScale:
+		logMin, logMax := math.Log(dimension.Min), math.Log(dimension.Max)
+		value = math.Exp(logMin + u*(logMax-logMin))
+	default:
+		value = dimension.Min + u*(dimension.Max-dimension.Min)
+	}
+	if dimension.Integer {
+		value = math.Round(value)
+	}
+	return value
+}
+
+// Map a value of this dimension back onto [0, 1]. This is the inverse of FromUnit
+// (up to rounding of integer and discrete dimensions).
+func (dimension Dimension) ToUnit(value float64) float64 {
+	if len(dimension.Values) > 0 {
+		for valueIndex, dimensionValue := range dimension.Values {
+			if dimensionValue == value {
+				return (float64(valueIndex) + 0.5) / float64(len(dimension.Values))
+			}
+		}
+		return 0.0
+	}
+	if dimension.Max == dimension.Min {
+		return 0.5
+	}
+	if dimension.LogScale {
+		logMin, logMax := math.Log(dimension.Min), math.Log(dimension.Max)
+		return (math.Log(value) - logMin) / (logMax - logMin)
+	}
+	return (value - dimension.Min) / (dimension.Max - dimension.Min)
+}
+
+// Create a configuration from a point in the unit hypercube, with one coordinate per dimension
+func (space ParameterSpace) FromUnit(unitPoint []float64) Configuration {
+	configuration := make(Configuration, len(space))
+	for dimensionIndex, dimension := range space {
+		configuration[dimension.Name] = dimension.FromUnit(unitPoint[dimensionIndex])
+	}
+	return configuration
+}
+
+// Map a configuration onto a point in the unit hypercube. This is the inverse of FromUnit.
+func (space ParameterSpace) ToUnit(configuration Configuration) []float64 {
+	unitPoint := make([]float64, len(space))
+	for dimensionIndex, dimension := range space {
+		unitPoint[dimensionIndex] = dimension.ToUnit(configuration[dimension.Name])
+	}
+	return unitPoint
+}
+
+// Get every combination of values in the parameter space.
+//
+// Discrete dimensions contribute each of their values. Continuous dimensions contribute
+// numPointsPerDimension evenly spaced values from Min to Max (duplicates, e.g. from rounding
+// integer dimensions, are removed).
+func (space ParameterSpace) GridConfigurations(numPointsPerDimension int) []Configuration {
+	configurations := []Configuration{{}}
+	for _, dimension := range space {
+		dimensionValues := dimension.gridValues(numPointsPerDimension)
+		expandedConfigurations := make([]Configuration, 0, len(configurations)*len(dimensionValues))
+		for _, configuration := range configurations {
+			for _, value := range dimensionValues {
+				expandedConfiguration := make(Configuration, len(configuration)+1)
+				for name, configurationValue := range configuration {
+					expandedConfiguration[name] = configurationValue
+				}
+				expandedConfiguration[dimension.Name] = value
+				expandedConfigurations = append(expandedConfigurations, expandedConfiguration)
+			}
+		}
+		configurations = expandedConfigurations
+	}
+	return configurations
+}
+
+func (dimension Dimension) gridValues(numPoints int) []float64 {
+	if len(dimension.Values) > 0 {
+		return dimension.Values
+	}
+	if numPoints < 2 {
+		return []float64{dimension.FromUnit(0.5)}
+	}
+
+	values := []float64{}
+	for pointIndex := 0; pointIndex < numPoints; pointIndex++ {
+		value := dimension.FromUnit(float64(pointIndex) / float64(numPoints-1))
+		if len(values) == 0 || values[len(values)-1] != value {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Sample configurations uniformly at random from the parameter space
+func (space ParameterSpace) RandomConfigurations(numConfigurations int, randomGenerator *rand.Rand) []Configuration {
+	configurations := make([]Configuration, numConfigurations)
+	unitPoint := make([]float64, len(space))
+	for configurationIndex := range configurations {
+		for dimensionIndex := range unitPoint {
+			unitPoint[dimensionIndex] = randomGenerator.Float64()
+		}
+		configurations[configurationIndex] = space.FromUnit(unitPoint)
+	}
+	return configurations
+}
+
+// Sample configurations from the parameter space with a Latin hypercube design.
+//
+// Each dimension is split into numConfigurations equally likely strata, and every stratum of every
+// dimension is sampled exactly once. This covers each parameter's range far more evenly than
+// random sampling with the same number of configurations.
+func (space ParameterSpace) LatinHypercubeConfigurations(numConfigurations int, randomGenerator *rand.Rand) []Configuration {
+	unitPoints := make([][]float64, numConfigurations)
+	for configurationIndex := range unitPoints {
+		unitPoints[configurationIndex] = make([]float64, len(space))
+	}
+
+	strata := make([]int, numConfigurations)
+	for dimensionIndex := range space {
+		for stratumIndex := range strata {
+			strata[stratumIndex] = stratumIndex
+		}
+		randomGenerator.Shuffle(len(strata), func(i, j int) {
+			strata[i], strata[j] = strata[j], strata[i]
+		})
+		for configurationIndex, stratum := range strata {
+			unitPoints[configurationIndex][dimensionIndex] = (float64(stratum) + randomGenerator.Float64()) / float64(numConfigurations)
+		}
+	}
+
+	configurations := make([]Configuration, numConfigurations)
+	for configurationIndex, unitPoint := range unitPoints {
+		configurations[configurationIndex] = space.FromUnit(unitPoint)
+	}
+	return configurations
+}
+
+// Get the names of the parameters in a configuration, in sorted order
+func (configuration Configuration) Names() []string {
+	names := make([]string, 0, len(configuration))
+	for name := range configuration {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,357 @@
+package sweep
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/stat"
+
+	geneticbreeder "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/GeneticBreeder"
+	manager "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Manager"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+)
+
+const (
+	RESULTS_FILE_NAME = "results.csv"
+	TRIALS_FILE_NAME  = "trials.csv"
+)
+
+// A hyperparameter sweep: every configuration is run once for each seed, and the
+// final and best fitness of each run is compared across configurations.
+type Sweep struct {
+	// The name of the system to train, as registered with system.Register
+	SystemName string
+
+	// The configurations to compare, for example from ParameterSpace.GridConfigurations
+	Configurations []Configuration
+
+	// Every configuration is run once with each of these seeds
+	Seeds []uint64
+
+	// Settings for parameters not given in a configuration
+	BaseSettings TrialSettings
+
+	// The maximum number of simulation threads in use across all concurrent runs.
+	// Each run uses BaseSettings.NumThreads threads, so up to ThreadBudget / NumThreads
+	// runs execute at once.
+	ThreadBudget int
+
+	// Each run is written to its own directory within OutputRoot, and the results tables are
+	// written to OutputRoot itself
+	OutputRoot string
+}
+
+// The outcome of a single run of a configuration
+type TrialResult struct {
+	ConfigurationIndex int
+	Seed               uint64
+
+	// The best score in the final generation
+	FinalBestScore float64
+
+	// The best score in any generation
+	BestScore float64
+
+	NumGenerations int
+	StopReason     manager.StopReason
+
+	// Non-nil if the run could not be performed or failed part way through
+	Err error
+}
+
+// The outcomes of every run of a single configuration
+type ConfigurationResult struct {
+	ConfigurationIndex int
+	Configuration      Configuration
+	Trials             []TrialResult
+
+	// Statistics over the successful trials
+	NumFailedTrials      int
+	MeanFinalBestScore   float64
+	StdDevFinalBestScore float64
+	MeanBestScore        float64
+	MaxBestScore         float64
+}
+
+// Run every trial of the sweep, write the results tables, and return the results
+// in the same order as the configurations.
+//
+// Trials that fail are recorded (and counted in the results table) rather than stopping the sweep.
+// An error is returned only if the sweep itself is invalid or its results cannot be written.
+// Cancelling the context stops all running trials, and no further trials are started;
+// those are recorded as failed with the context's error and have no run directory.
+func (sweep *Sweep) Run(ctx context.Context) ([]ConfigurationResult, error) {
+	if err := sweep.validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(sweep.OutputRoot, 0755); err != nil {
+		return nil, err
+	}
+
+	numConcurrentTrials := sweep.ThreadBudget / sweep.BaseSettings.NumThreads
+	trialSemaphore := make(chan struct{}, numConcurrentTrials)
+	trialResults := make([][]TrialResult, len(sweep.Configurations))
+	waitGroup := sync.WaitGroup{}
+	for configurationIndex := range sweep.Configurations {
+		trialResults[configurationIndex] = make([]TrialResult, len(sweep.Seeds))
+		for seedIndex, seed := range sweep.Seeds {
+			// Once cancelled, the remaining trials are recorded as never started rather than
+			// creating their run directories
+			if ctx.Err() != nil {
+				trialResults[configurationIndex][seedIndex] = cancelledTrial(ctx, configurationIndex, seed)
+				continue
+			}
+			select {
+			case trialSemaphore <- struct{}{}:
+			case <-ctx.Done():
+				trialResults[configurationIndex][seedIndex] = cancelledTrial(ctx, configurationIndex, seed)
+				continue
+			}
+			waitGroup.Add(1)
+			go func(configurationIndex, seedIndex int, seed uint64) {
+				defer waitGroup.Done()
+				defer func() { <-trialSemaphore }()
+				trialResults[configurationIndex][seedIndex] = sweep.runTrial(ctx, configurationIndex, seed)
+			}(configurationIndex, seedIndex, seed)
+		}
+	}
+	waitGroup.Wait()
+
+	results := make([]ConfigurationResult, len(sweep.Configurations))
+	for configurationIndex, configuration := range sweep.Configurations {
+		results[configurationIndex] = summarizeTrials(configurationIndex, configuration, trialResults[configurationIndex])
+	}
+
+	if err := sweep.writeResults(results); err != nil {
+		return results, err
+	}
+	return results, sweep.writeTrials(results)
+}
+
+func (sweep *Sweep) validate() error {
+	targetSystem, err := system.NewSystem(sweep.SystemName)
+	if err != nil {
+		return err
+	}
+	// Each run creates a fresh directory within the output root, so reusing a previous
+	// sweep's output would clash
+	if entries, err := os.ReadDir(sweep.OutputRoot); err == nil && len(entries) > 0 {
+		return fmt.Errorf("sweep output directory %v is not empty", sweep.OutputRoot)
+	}
+	if len(sweep.Configurations) == 0 {
+		return fmt.Errorf("sweep has no configurations")
+	}
+	if len(sweep.Seeds) == 0 {
+		return fmt.Errorf("sweep has no seeds")
+	}
+	if sweep.BaseSettings.NumThreads < 1 || sweep.ThreadBudget < sweep.BaseSettings.NumThreads {
+		return fmt.Errorf("thread budget (%v) must allow at least one run of %v threads", sweep.ThreadBudget, sweep.BaseSettings.NumThreads)
+	}
+	for configurationIndex, configuration := range sweep.Configurations {
+		settings, err := sweep.BaseSettings.Apply(configuration)
+		if err != nil {
+			return fmt.Errorf("configuration %v: %w", configurationIndex, err)
+		}
+		if settings.NumAgents%targetSystem.NumAgentsPerSimulation() != 0 {
+			return fmt.Errorf("configuration %v: %s must be divisible by %v for system %v",
+				configurationIndex, PARAMETER_NUM_AGENTS, targetSystem.NumAgentsPerSimulation(), sweep.SystemName)
+		}
+	}
+	return nil
+}
+
+// Tracks the best scores of a run as each generation ends
+type scoreTracker struct {
+	manager.BaseObserver
+	finalBestScore float64
+	bestScore      float64
+	numGenerations int
+}
+
+func (tracker *scoreTracker) OnGenerationEnd(summary manager.GenerationSummary) {
+	tracker.finalBestScore = summary.BestScore
+	tracker.bestScore = math.Max(tracker.bestScore, summary.BestScore)
+	tracker.numGenerations += 1
+}
+
+// The result of a trial that was never started because the sweep was cancelled
+func cancelledTrial(ctx context.Context, configurationIndex int, seed uint64) TrialResult {
+	result := newTrialResult(configurationIndex, seed)
+	result.StopReason = manager.StopReasonCancelled
+	result.Err = ctx.Err()
+	return result
+}
+
+func newTrialResult(configurationIndex int, seed uint64) TrialResult {
+	return TrialResult{
+		ConfigurationIndex: configurationIndex,
+		Seed:               seed,
+		FinalBestScore:     math.NaN(),
+		BestScore:          math.NaN(),
+	}
+}
+
+func (sweep *Sweep) runTrial(ctx context.Context, configurationIndex int, seed uint64) TrialResult {
+	result := newTrialResult(configurationIndex, seed)
+
+	// Both errors have already been checked in validate
+	settings, _ := sweep.BaseSettings.Apply(sweep.Configurations[configurationIndex])
+	targetSystem, _ := system.NewSystem(sweep.SystemName)
+
+	geneticBreeder := geneticbreeder.NewGeneticBreeder(
+		rand.NewSource(breederSeed(seed)),
+		settings.numParentsWeights(),
+		settings.kCrossoverWeights(),
+		settings.NumCarryover,
+		settings.MutationRate)
+	tracker := &scoreTracker{bestScore: math.Inf(-1)}
+	trialManager := manager.NewManager(targetSystem,
+		settings.NumAgents,
+		settings.NumSimulationsPerGeneration,
+		settings.NumThreads,
+		geneticBreeder,
+		false,
+		manager.WithOutputRoot(filepath.Join(sweep.OutputRoot, trialDirectoryName(configurationIndex, seed))),
+		manager.WithSeed(seed),
+		manager.WithObserver(tracker))
+	defer trialManager.WriteStop()
+
+	result.StopReason, result.Err = trialManager.SimulateManyGenerations(ctx, settings.NumGenerations)
+	result.NumGenerations = tracker.numGenerations
+	if tracker.numGenerations > 0 {
+		result.FinalBestScore = tracker.finalBestScore
+		result.BestScore = tracker.bestScore
+	}
+	return result
+}
+
+// Derive the breeder's seed from the trial seed so the breeder and the manager, which
+// is seeded with the trial seed itself, do not draw the same random stream.
+// This is the SplitMix64 output function, which maps nearby seeds to unrelated values.
+func breederSeed(seed uint64) uint64 {
+	seed += 0x9e3779b97f4a7c15
+	seed = (seed ^ (seed >> 30)) * 0xbf58476d1ce4e5b9
+	seed = (seed ^ (seed >> 27)) * 0x94d049bb133111eb
+	return seed ^ (seed >> 31)
+}
+
+func trialDirectoryName(configurationIndex int, seed uint64) string {
+	return fmt.Sprintf("config-%03d-seed-%v", configurationIndex, seed)
+}
+
+func summarizeTrials(configurationIndex int, configuration Configuration, trials []TrialResult) ConfigurationResult {
+	result := ConfigurationResult{
+		ConfigurationIndex: configurationIndex,
+		Configuration:      configuration,
+		Trials:             trials,
+		MaxBestScore:       math.NaN(),
+	}
+
+	finalBestScores := []float64{}
+	bestScores := []float64{}
+	for _, trial := range trials {
+		if trial.Err != nil || trial.NumGenerations == 0 {
+			result.NumFailedTrials += 1
+			continue
+		}
+		finalBestScores = append(finalBestScores, trial.FinalBestScore)
+		bestScores = append(bestScores, trial.BestScore)
+		if math.IsNaN(result.MaxBestScore) || trial.BestScore > result.MaxBestScore {
+			result.MaxBestScore = trial.BestScore
+		}
+	}
+
+	result.MeanFinalBestScore, result.StdDevFinalBestScore = math.NaN(), math.NaN()
+	result.MeanBestScore = math.NaN()
+	if len(finalBestScores) > 0 {
+		result.MeanFinalBestScore, result.StdDevFinalBestScore = stat.MeanStdDev(finalBestScores, nil)
+		result.MeanBestScore = stat.Mean(bestScores, nil)
+	}
+	if len(finalBestScores) == 1 {
+		result.StdDevFinalBestScore = 0.0
+	}
+	return result
+}
+
+// The parameter names used across all configurations, in sorted order
+func (sweep *Sweep) parameterNames() []string {
+	allNames := Configuration{}
+	for _, configuration := range sweep.Configurations {
+		for name := range configuration {
+			allNames[name] = 0
+		}
+	}
+	return allNames.Names()
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Write the results table, with one row per configuration
+func (sweep *Sweep) writeResults(results []ConfigurationResult) error {
+	parameterNames := sweep.parameterNames()
+	header := append([]string{"configuration"}, parameterNames...)
+	header = append(header, "numTrials", "numFailedTrials", "meanFinalBestScore", "stdDevFinalBestScore", "meanBestScore", "maxBestScore")
+
+	rows := [][]string{header}
+	for _, result := range results {
+		row := []string{strconv.Itoa(result.ConfigurationIndex)}
+		for _, name := range parameterNames {
+			row = append(row, formatFloat(result.Configuration[name]))
+		}
+		row = append(row,
+			strconv.Itoa(len(result.Trials)),
+			strconv.Itoa(result.NumFailedTrials),
+			formatFloat(result.MeanFinalBestScore),
+			formatFloat(result.StdDevFinalBestScore),
+			formatFloat(result.MeanBestScore),
+			formatFloat(result.MaxBestScore))
+		rows = append(rows, row)
+	}
+	return writeCSV(filepath.Join(sweep.OutputRoot, RESULTS_FILE_NAME), rows)
+}
+
+// Write the individual trial outcomes, with one row per run
+func (sweep *Sweep) writeTrials(results []ConfigurationResult) error {
+	rows := [][]string{{"configuration", "seed", "directory", "numGenerations", "finalBestScore", "bestScore", "stopReason", "error"}}
+	for _, result := range results {
+		for _, trial := range result.Trials {
+			errorMessage := ""
+			if trial.Err != nil {
+				errorMessage = trial.Err.Error()
+			}
+			rows = append(rows, []string{
+				strconv.Itoa(trial.ConfigurationIndex),
+				strconv.FormatUint(trial.Seed, 10),
+				trialDirectoryName(trial.ConfigurationIndex, trial.Seed),
+				strconv.Itoa(trial.NumGenerations),
+				formatFloat(trial.FinalBestScore),
+				formatFloat(trial.BestScore),
+				string(trial.StopReason),
+				errorMessage,
+			})
+		}
+	}
+	return writeCSV(filepath.Join(sweep.OutputRoot, TRIALS_FILE_NAME), rows)
+}
+
+func writeCSV(path string, rows [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	if err := writer.WriteAll(rows); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
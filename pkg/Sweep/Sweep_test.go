@@ -0,0 +1,261 @@
+package sweep
+
+import (
+	"context"
+	"encoding/csv"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/rand"
+
+	manager "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Manager"
+
+	_ "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/cmd/main/basicSystem"
+)
+
+func TestLatinHypercubeCoversEveryStratum(t *testing.T) {
+	const numConfigurations = 8
+	space := ParameterSpace{
+		{Name: PARAMETER_MUTATION_RATE, Min: 0.0, Max: 1.0},
+		{Name: PARAMETER_NUM_CARRYOVER, Min: 0.0, Max: 8.0},
+	}
+	configurations := space.LatinHypercubeConfigurations(numConfigurations, rand.New(rand.NewSource(1)))
+
+	for _, dimension := range space {
+		strataSeen := make([]bool, numConfigurations)
+		for _, configuration := range configurations {
+			stratum := int(dimension.ToUnit(configuration[dimension.Name]) * numConfigurations)
+			if strataSeen[stratum] {
+				t.Errorf("Dimension %v sampled stratum %v more than once", dimension.Name, stratum)
+			}
+			strataSeen[stratum] = true
+		}
+	}
+}
+
+func TestGridConfigurations(t *testing.T) {
+	space := ParameterSpace{
+		{Name: PARAMETER_MUTATION_RATE, Min: 1e-6, Max: 1e-2, LogScale: true},
+		{Name: PARAMETER_NUM_CARRYOVER, Values: []float64{0, 1}},
+		// Rounding gives only 2 distinct values from the 3 grid points
+		{Name: PARAMETER_MAX_NUM_PARENTS, Min: 2, Max: 3, Integer: true},
+	}
+	if err := space.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	configurations := space.GridConfigurations(3)
+	if len(configurations) != 3*2*2 {
+		t.Fatalf("Expected %v configurations, got %v", 3*2*2, len(configurations))
+	}
+	if configurations[0][PARAMETER_MUTATION_RATE] != 1e-6 {
+		t.Errorf("Expected grid to start at Min, got %v", configurations[0][PARAMETER_MUTATION_RATE])
+	}
+}
+
+func TestSweep(t *testing.T) {
+	outputRoot := t.TempDir()
+	baseSettings := DefaultTrialSettings()
+	baseSettings.NumAgents = 10
+	baseSettings.NumSimulationsPerGeneration = 2
+	baseSettings.NumGenerations = 3
+
+	parameterSweep := &Sweep{
+		SystemName: "basic",
+		Configurations: []Configuration{
+			{PARAMETER_NUM_CARRYOVER: 0},
+			{PARAMETER_NUM_CARRYOVER: 2},
+		},
+		Seeds:        []uint64{1, 2},
+		BaseSettings: baseSettings,
+		ThreadBudget: 2,
+		OutputRoot:   outputRoot,
+	}
+	results, err := parameterSweep.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		if result.NumFailedTrials != 0 {
+			t.Errorf("Configuration %v had %v failed trials", result.ConfigurationIndex, result.NumFailedTrials)
+		}
+		for _, trial := range result.Trials {
+			if trial.NumGenerations != baseSettings.NumGenerations {
+				t.Errorf("Expected %v generations, got %v", baseSettings.NumGenerations, trial.NumGenerations)
+			}
+			if trial.BestScore < trial.FinalBestScore {
+				t.Errorf("Best score %v is below the final best score %v", trial.BestScore, trial.FinalBestScore)
+			}
+		}
+	}
+
+	resultsFile, err := os.Open(filepath.Join(outputRoot, RESULTS_FILE_NAME))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resultsFile.Close()
+	rows, err := csv.NewReader(resultsFile).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1+len(parameterSweep.Configurations) {
+		t.Errorf("Expected a header and %v rows in the results table, got %v rows", len(parameterSweep.Configurations), len(rows))
+	}
+
+	// Running again into the same directory would clash with the existing runs
+	if _, err := parameterSweep.Run(context.Background()); err == nil {
+		t.Errorf("Expected an error when reusing a sweep output directory")
+	}
+}
+
+func TestSweepCancellation(t *testing.T) {
+	outputRoot := t.TempDir()
+	baseSettings := DefaultTrialSettings()
+	baseSettings.NumAgents = 10
+	baseSettings.NumSimulationsPerGeneration = 2
+	// Long enough that the first trial is still running when the sweep is cancelled
+	baseSettings.NumGenerations = 1000000
+
+	parameterSweep := &Sweep{
+		SystemName:     "basic",
+		Configurations: []Configuration{{PARAMETER_NUM_CARRYOVER: 0}, {PARAMETER_NUM_CARRYOVER: 2}},
+		Seeds:          []uint64{1, 2, 3},
+		BaseSettings:   baseSettings,
+		// Only one trial runs at a time
+		ThreadBudget: baseSettings.NumThreads,
+		OutputRoot:   outputRoot,
+	}
+
+	// Cancel once the first trial has created its run directory
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			if entries, err := os.ReadDir(outputRoot); err == nil && len(entries) > 0 {
+				cancel()
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	results, err := parameterSweep.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	numTrials := 0
+	for _, result := range results {
+		numTrials += len(result.Trials)
+		if result.NumFailedTrials != len(result.Trials) {
+			t.Errorf("Configuration %v had %v failed trials out of %v", result.ConfigurationIndex, result.NumFailedTrials, len(result.Trials))
+		}
+		for _, trial := range result.Trials {
+			if trial.StopReason != manager.StopReasonCancelled {
+				t.Errorf("Expected trial %v of configuration %v to be cancelled, stopped with %q", trial.Seed, trial.ConfigurationIndex, trial.StopReason)
+			}
+		}
+	}
+	if numTrials != len(parameterSweep.Configurations)*len(parameterSweep.Seeds) {
+		t.Errorf("Expected a result for every trial, got %v", numTrials)
+	}
+
+	for configurationIndex := range parameterSweep.Configurations {
+		for _, seed := range parameterSweep.Seeds {
+			_, err := os.Stat(filepath.Join(outputRoot, trialDirectoryName(configurationIndex, seed)))
+			started := configurationIndex == 0 && seed == parameterSweep.Seeds[0]
+			if started && err != nil {
+				t.Errorf("Expected the first trial's run directory: %v", err)
+			}
+			if !started && err == nil {
+				t.Errorf("Trial %v of configuration %v was never started but has a run directory", seed, configurationIndex)
+			}
+		}
+	}
+}
+
+func TestBreederSeedDiffersFromTrialSeed(t *testing.T) {
+	for _, seed := range []uint64{0, 1, 2, 42} {
+		if breederSeed(seed) == seed {
+			t.Errorf("Breeder seed for trial seed %v is the trial seed", seed)
+		}
+	}
+	if breederSeed(1) == breederSeed(2) {
+		t.Errorf("Distinct trial seeds gave the same breeder seed")
+	}
+}
+
+func TestGaussianProcessInterpolates(t *testing.T) {
+	inputs := [][]float64{{0.0}, {0.25}, {0.5}, {0.75}, {1.0}}
+	outputs := []float64{0.0, 1.0, 0.0, -1.0, 0.0}
+	process, err := FitGaussianProcess(inputs, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for inputIndex, input := range inputs {
+		mean, stdDev := process.Predict(input)
+		if math.Abs(mean-outputs[inputIndex]) > 0.2 {
+			t.Errorf("Predicted %v at %v, expected close to %v", mean, input, outputs[inputIndex])
+		}
+		_, farStdDev := process.Predict([]float64{input[0] + 5.0})
+		if stdDev >= farStdDev {
+			t.Errorf("Expected less uncertainty at an observed input (%v) than far from any (%v)", stdDev, farStdDev)
+		}
+	}
+
+	if ExpectedImprovement(0.0, 1.0, 0.0, 0.0) <= 0.0 {
+		t.Errorf("Expected an uncertain prediction to have positive expected improvement")
+	}
+}
+
+func TestTunerResumes(t *testing.T) {
+	outputRoot := t.TempDir()
+	baseSettings := DefaultTrialSettings()
+	baseSettings.NumAgents = 10
+	baseSettings.NumSimulationsPerGeneration = 2
+	baseSettings.NumGenerations = 2
+
+	tuner := &Tuner{
+		SystemName: "basic",
+		Space: ParameterSpace{
+			{Name: PARAMETER_MUTATION_RATE, Min: 1e-6, Max: 1e-1, LogScale: true},
+			{Name: PARAMETER_NUM_CARRYOVER, Min: 0, Max: 4, Integer: true},
+		},
+		Seeds:                 []uint64{1},
+		BaseSettings:          baseSettings,
+		ThreadBudget:          1,
+		NumInitialEvaluations: 2,
+		NumEvaluations:        3,
+		NumCandidates:         50,
+		OutputRoot:            outputRoot,
+	}
+	history, err := tuner.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || !history[0].Initial || history[2].Initial {
+		t.Fatalf("Expected 2 initial evaluations then 1 proposed, got %+v", history)
+	}
+
+	tuner.NumEvaluations = 4
+	resumedHistory, err := tuner.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumedHistory) != 4 {
+		t.Fatalf("Expected the resumed tuner to add a single evaluation, got %v evaluations", len(resumedHistory))
+	}
+	for evaluationIndex := range history {
+		if resumedHistory[evaluationIndex].Objective != history[evaluationIndex].Objective {
+			t.Errorf("Evaluation %v changed on resume", evaluationIndex)
+		}
+	}
+	if _, ok := BestEvaluation(resumedHistory); !ok {
+		t.Errorf("Expected a best evaluation")
+	}
+}
@@ -0,0 +1,119 @@
+package sweep
+
+import (
+	"fmt"
+	"math"
+)
+
+// The names of the parameters a sweep can vary. See TrialSettings.Apply.
+const (
+	PARAMETER_NUM_AGENTS                     = "numAgents"
+	PARAMETER_NUM_SIMULATIONS_PER_GENERATION = "numSimulationsPerGeneration"
+	PARAMETER_NUM_CARRYOVER                  = "numCarryover"
+	PARAMETER_MUTATION_RATE                  = "mutationRate"
+	PARAMETER_MAX_NUM_PARENTS                = "maxNumParents"
+	PARAMETER_MAX_NUM_CROSSOVERS             = "maxNumCrossovers"
+)
+
+// Everything needed to set up a single run of a sweep (other than the system and seed)
+type TrialSettings struct {
+	NumAgents                   int
+	NumSimulationsPerGeneration int
+	NumGenerations              int
+
+	// Number of simulation threads used by each run. Runs are executed concurrently
+	// so that the total number of threads stays within the sweep's thread budget.
+	NumThreads int
+
+	// The number of parents during breeding is chosen uniformly from 2 to MaxNumParents
+	MaxNumParents int
+
+	// The number of crossovers during breeding is chosen uniformly from 1 to MaxNumCrossovers
+	MaxNumCrossovers int
+
+	NumCarryover int
+	MutationRate float64
+}
+
+// Get trial settings matching those used by the main program, but with a much smaller population
+// so that many trials can be run
+func DefaultTrialSettings() TrialSettings {
+	return TrialSettings{
+		NumAgents:                   100,
+		NumSimulationsPerGeneration: 5,
+		NumGenerations:              20,
+		NumThreads:                  1,
+		MaxNumParents:               4,
+		MaxNumCrossovers:            3,
+		NumCarryover:                1,
+		MutationRate:                math.Pow10(-6),
+	}
+}
+
+// Get a copy of these settings with the parameters in the configuration overridden.
+//
+// Returns an error if the configuration names an unknown parameter, or if the resulting
+// settings are invalid.
+func (settings TrialSettings) Apply(configuration Configuration) (TrialSettings, error) {
+	for _, name := range configuration.Names() {
+		value := configuration[name]
+		switch name {
+		case PARAMETER_NUM_AGENTS:
+			settings.NumAgents = int(math.Round(value))
+		case PARAMETER_NUM_SIMULATIONS_PER_GENERATION:
+			settings.NumSimulationsPerGeneration = int(math.Round(value))
+		case PARAMETER_NUM_CARRYOVER:
+			settings.NumCarryover = int(math.Round(value))
+		case PARAMETER_MUTATION_RATE:
+			settings.MutationRate = value
+		case PARAMETER_MAX_NUM_PARENTS:
+			settings.MaxNumParents = int(math.Round(value))
+		case PARAMETER_MAX_NUM_CROSSOVERS:
+			settings.MaxNumCrossovers = int(math.Round(value))
+		default:
+			return settings, fmt.Errorf("unknown sweep parameter %q", name)
+		}
+	}
+	return settings, settings.Validate()
+}
+
+// Check the settings describe a run that can actually be performed
+func (settings TrialSettings) Validate() error {
+	switch {
+	case settings.NumAgents < 1:
+		return fmt.Errorf("%s must be at least 1, got %v", PARAMETER_NUM_AGENTS, settings.NumAgents)
+	case settings.NumSimulationsPerGeneration < 1:
+		return fmt.Errorf("%s must be at least 1, got %v", PARAMETER_NUM_SIMULATIONS_PER_GENERATION, settings.NumSimulationsPerGeneration)
+	case settings.NumGenerations < 1:
+		return fmt.Errorf("number of generations must be at least 1, got %v", settings.NumGenerations)
+	case settings.NumThreads < 1:
+		return fmt.Errorf("number of threads must be at least 1, got %v", settings.NumThreads)
+	case settings.MaxNumParents < 2:
+		return fmt.Errorf("%s must be at least 2, got %v", PARAMETER_MAX_NUM_PARENTS, settings.MaxNumParents)
+	case settings.MaxNumCrossovers < 1:
+		return fmt.Errorf("%s must be at least 1, got %v", PARAMETER_MAX_NUM_CROSSOVERS, settings.MaxNumCrossovers)
+	case settings.NumCarryover < 0 || settings.NumCarryover > settings.NumAgents:
+		return fmt.Errorf("%s must be between 0 and the number of agents, got %v", PARAMETER_NUM_CARRYOVER, settings.NumCarryover)
+	case settings.MutationRate < 0 || settings.MutationRate > 1:
+		return fmt.Errorf("%s must be between 0 and 1, got %v", PARAMETER_MUTATION_RATE, settings.MutationRate)
+	}
+	return nil
+}
+
+// The weights for the number of parents, as expected by geneticbreeder.NewGeneticBreeder
+func (settings TrialSettings) numParentsWeights() []float64 {
+	weights := make([]float64, settings.MaxNumParents+1)
+	for numParents := 2; numParents <= settings.MaxNumParents; numParents++ {
+		weights[numParents] = 1.0
+	}
+	return weights
+}
+
+// The weights for the number of crossovers, as expected by geneticbreeder.NewGeneticBreeder
+func (settings TrialSettings) kCrossoverWeights() []float64 {
+	weights := make([]float64, settings.MaxNumCrossovers+1)
+	for numCrossovers := 1; numCrossovers <= settings.MaxNumCrossovers; numCrossovers++ {
+		weights[numCrossovers] = 1.0
+	}
+	return weights
+}
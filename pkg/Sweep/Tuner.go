@@ -0,0 +1,354 @@
+package sweep
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/exp/rand"
+)
+
+const (
+	HISTORY_FILE_NAME = "history.jsonl"
+
+	DEFAULT_NUM_CANDIDATES = 2000
+	DEFAULT_EXPLORATION    = 0.01
+)
+
+// A Bayesian optimisation tuner for breeder and Manager hyperparameters.
+//
+// The objective of a configuration is the mean best score in the final generation of a short
+// training run, averaged over Seeds. The tuner first evaluates a Latin hypercube design of
+// configurations, then repeatedly fits a Gaussian process to every evaluation so far and
+// evaluates the configuration with the greatest expected improvement.
+//
+// Every evaluation is appended to a history file in OutputRoot, and a tuner run with the same
+// OutputRoot resumes from that history rather than repeating evaluations.
+type Tuner struct {
+	// The name of the system to train, as registered with system.Register
+	SystemName string
+
+	// The parameters to tune
+	Space ParameterSpace
+
+	// Every configuration is run once with each of these seeds, and the objective is the mean
+	// over the seeds
+	Seeds []uint64
+
+	// Settings for parameters not in the space, and the length of each training run
+	BaseSettings TrialSettings
+
+	// The maximum number of simulation threads in use, as for Sweep
+	ThreadBudget int
+
+	// Configurations chosen by Latin hypercube before the surrogate is used
+	NumInitialEvaluations int
+
+	// Total number of evaluations, including the initial ones and any in the resumed history
+	NumEvaluations int
+
+	// Number of random candidate configurations scored by expected improvement each iteration.
+	// Defaults to DEFAULT_NUM_CANDIDATES.
+	NumCandidates int
+
+	// The margin an improvement must exceed, in units of the objective's standard deviation.
+	// Defaults to DEFAULT_EXPLORATION.
+	Exploration float64
+
+	// Seed for the tuner's own choices of configuration
+	Seed uint64
+
+	// Evaluation n is written to OutputRoot/evaluation-n, and the history to OutputRoot/HISTORY_FILE_NAME
+	OutputRoot string
+}
+
+// A single evaluated configuration, as recorded in the history file
+type Evaluation struct {
+	EvaluationIndex int
+	Configuration   Configuration
+
+	// The mean best score in the final generation. NaN (stored as null) if every trial failed.
+	Objective float64
+
+	StdDevFinalBestScore float64
+	MaxBestScore         float64
+	NumFailedTrials      int
+
+	// Whether the configuration came from the initial design or from expected improvement
+	Initial             bool
+	ExpectedImprovement float64
+
+	Duration time.Duration
+}
+
+// NaN is not valid JSON, so failed objectives are stored as null
+type evaluationJSON struct {
+	EvaluationIndex      int
+	Configuration        Configuration
+	Objective            *float64
+	StdDevFinalBestScore *float64
+	MaxBestScore         *float64
+	NumFailedTrials      int
+	Initial              bool
+	ExpectedImprovement  float64
+	Duration             time.Duration
+}
+
+func nullableFloat(value float64) *float64 {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+	return &value
+}
+
+func fromNullableFloat(value *float64) float64 {
+	if value == nil {
+		return math.NaN()
+	}
+	return *value
+}
+
+func (evaluation Evaluation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(evaluationJSON{
+		EvaluationIndex:      evaluation.EvaluationIndex,
+		Configuration:        evaluation.Configuration,
+		Objective:            nullableFloat(evaluation.Objective),
+		StdDevFinalBestScore: nullableFloat(evaluation.StdDevFinalBestScore),
+		MaxBestScore:         nullableFloat(evaluation.MaxBestScore),
+		NumFailedTrials:      evaluation.NumFailedTrials,
+		Initial:              evaluation.Initial,
+		ExpectedImprovement:  evaluation.ExpectedImprovement,
+		Duration:             evaluation.Duration,
+	})
+}
+
+func (evaluation *Evaluation) UnmarshalJSON(data []byte) error {
+	var decoded evaluationJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*evaluation = Evaluation{
+		EvaluationIndex:      decoded.EvaluationIndex,
+		Configuration:        decoded.Configuration,
+		Objective:            fromNullableFloat(decoded.Objective),
+		StdDevFinalBestScore: fromNullableFloat(decoded.StdDevFinalBestScore),
+		MaxBestScore:         fromNullableFloat(decoded.MaxBestScore),
+		NumFailedTrials:      decoded.NumFailedTrials,
+		Initial:              decoded.Initial,
+		ExpectedImprovement:  decoded.ExpectedImprovement,
+		Duration:             decoded.Duration,
+	}
+	return nil
+}
+
+// Get the path of the tuner's history file
+func (tuner *Tuner) HistoryFilePath() string {
+	return filepath.Join(tuner.OutputRoot, HISTORY_FILE_NAME)
+}
+
+// Read the evaluations recorded in a tuner history file
+func ReadHistory(path string) ([]Evaluation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	history := []Evaluation{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var evaluation Evaluation
+		if err := json.Unmarshal(scanner.Bytes(), &evaluation); err != nil {
+			return nil, fmt.Errorf("history entry %v: %w", len(history), err)
+		}
+		history = append(history, evaluation)
+	}
+	return history, scanner.Err()
+}
+
+func (tuner *Tuner) appendHistory(evaluation Evaluation) error {
+	line, err := json.Marshal(evaluation)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(tuner.HistoryFilePath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Get the evaluation with the highest objective, and false if no evaluation succeeded
+func BestEvaluation(history []Evaluation) (Evaluation, bool) {
+	bestIndex := -1
+	for evaluationIndex, evaluation := range history {
+		if math.IsNaN(evaluation.Objective) {
+			continue
+		}
+		if bestIndex < 0 || evaluation.Objective > history[bestIndex].Objective {
+			bestIndex = evaluationIndex
+		}
+	}
+	if bestIndex < 0 {
+		return Evaluation{}, false
+	}
+	return history[bestIndex], true
+}
+
+// Run the tuner until NumEvaluations configurations have been evaluated, resuming from the history
+// file if one exists. Returns the full history, including resumed evaluations.
+//
+// Cancelling the context abandons the current evaluation (it is not recorded, so will be
+// repeated on resume) and returns the history so far along with the context's error.
+func (tuner *Tuner) Run(ctx context.Context) ([]Evaluation, error) {
+	if err := tuner.validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(tuner.OutputRoot, 0755); err != nil {
+		return nil, err
+	}
+
+	history, err := ReadHistory(tuner.HistoryFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		history = []Evaluation{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// The initial design depends only on the tuner's seed, so a resumed tuner continues the same design
+	randomGenerator := rand.New(rand.NewSource(tuner.Seed))
+	initialConfigurations := tuner.Space.LatinHypercubeConfigurations(tuner.NumInitialEvaluations, randomGenerator)
+
+	for evaluationIndex := len(history); evaluationIndex < tuner.NumEvaluations; evaluationIndex++ {
+		evaluation := Evaluation{EvaluationIndex: evaluationIndex}
+		if evaluationIndex < len(initialConfigurations) {
+			evaluation.Configuration = initialConfigurations[evaluationIndex]
+			evaluation.Initial = true
+		} else {
+			// Seed each proposal separately, so a resumed tuner makes the same choices as an uninterrupted one
+			randomGenerator.Seed(tuner.Seed + uint64(evaluationIndex))
+			evaluation.Configuration, evaluation.ExpectedImprovement, err = tuner.proposeConfiguration(history, randomGenerator)
+			if err != nil {
+				return history, err
+			}
+		}
+
+		if err := tuner.evaluate(ctx, &evaluation); err != nil {
+			return history, err
+		}
+		if err := tuner.appendHistory(evaluation); err != nil {
+			return history, err
+		}
+		history = append(history, evaluation)
+	}
+	return history, nil
+}
+
+func (tuner *Tuner) validate() error {
+	if err := tuner.Space.Validate(); err != nil {
+		return err
+	}
+	if len(tuner.Space) == 0 {
+		return errors.New("the tuner's parameter space is empty")
+	}
+	if tuner.NumInitialEvaluations < 1 {
+		return errors.New("the tuner needs at least one initial evaluation")
+	}
+	if tuner.NumCandidates == 0 {
+		tuner.NumCandidates = DEFAULT_NUM_CANDIDATES
+	}
+	if tuner.Exploration == 0 {
+		tuner.Exploration = DEFAULT_EXPLORATION
+	}
+	if tuner.NumCandidates < 1 || tuner.Exploration < 0 {
+		return errors.New("the tuner's candidate count and exploration must be positive")
+	}
+	return nil
+}
+
+// Pick the configuration with the greatest expected improvement among random candidates
+func (tuner *Tuner) proposeConfiguration(history []Evaluation, randomGenerator *rand.Rand) (Configuration, float64, error) {
+	inputs := [][]float64{}
+	outputs := []float64{}
+	for _, evaluation := range history {
+		if !math.IsNaN(evaluation.Objective) {
+			inputs = append(inputs, tuner.Space.ToUnit(evaluation.Configuration))
+			outputs = append(outputs, evaluation.Objective)
+		}
+	}
+	// Without any successful evaluations there is nothing to model, so explore at random
+	if len(inputs) == 0 {
+		return tuner.Space.RandomConfigurations(1, randomGenerator)[0], 0.0, nil
+	}
+
+	process, err := FitGaussianProcess(inputs, outputs)
+	if err != nil {
+		return nil, 0.0, err
+	}
+	bestOutput := maxIgnoringNaN(outputs)
+	exploration := tuner.Exploration * process.outputStdDev
+
+	var bestCandidate Configuration
+	bestExpectedImprovement := math.Inf(-1)
+	for _, candidate := range tuner.Space.RandomConfigurations(tuner.NumCandidates, randomGenerator) {
+		// Score the candidate as it will actually be run, after rounding of integer and discrete dimensions
+		mean, stdDev := process.Predict(tuner.Space.ToUnit(candidate))
+		expectedImprovement := ExpectedImprovement(mean, stdDev, bestOutput, exploration)
+		if expectedImprovement > bestExpectedImprovement {
+			bestCandidate = candidate
+			bestExpectedImprovement = expectedImprovement
+		}
+	}
+	return bestCandidate, bestExpectedImprovement, nil
+}
+
+// Run a configuration with every seed and record the outcome in the evaluation
+func (tuner *Tuner) evaluate(ctx context.Context, evaluation *Evaluation) error {
+	evaluationDirectory := filepath.Join(tuner.OutputRoot, fmt.Sprintf("evaluation-%03d", evaluation.EvaluationIndex))
+	// An interrupted evaluation leaves partial output behind. It is kept for inspection, but moved aside
+	// so the evaluation can be repeated.
+	if _, err := os.Stat(evaluationDirectory); err == nil {
+		interruptedDirectory := fmt.Sprintf("%v-interrupted-%v", evaluationDirectory, time.Now().Format("20060102-150405"))
+		if err := os.Rename(evaluationDirectory, interruptedDirectory); err != nil {
+			return err
+		}
+	}
+
+	startTime := time.Now()
+	evaluationSweep := &Sweep{
+		SystemName:     tuner.SystemName,
+		Configurations: []Configuration{evaluation.Configuration},
+		Seeds:          tuner.Seeds,
+		BaseSettings:   tuner.BaseSettings,
+		ThreadBudget:   tuner.ThreadBudget,
+		OutputRoot:     evaluationDirectory,
+	}
+	results, err := evaluationSweep.Run(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	result := results[0]
+	evaluation.Objective = result.MeanFinalBestScore
+	evaluation.StdDevFinalBestScore = result.StdDevFinalBestScore
+	evaluation.MaxBestScore = result.MaxBestScore
+	evaluation.NumFailedTrials = result.NumFailedTrials
+	evaluation.Duration = time.Since(startTime)
+	return nil
+}
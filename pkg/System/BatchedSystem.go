@@ -0,0 +1,53 @@
+package system
+
+import (
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+)
+
+// Systems can also implement BatchedSystem to simulate many episodes at once, in lockstep.
+//
+// The states of every episode are held in the rows of a single matrix (see systemstate.BatchState),
+// and the percepts and actions of each agent are exchanged as matrices with a row per episode. This lets
+// the simulator compute the actions of every episode sharing an agent in a single matrix product, and
+// reuse the same memory for every step (see simulator.SimulateBatchInLockstep). The WorkerPool
+// simulates batched systems in lockstep automatically.
+//
+// Episodes whose TerminalMask is set must be left untouched. Simulating an episode in a batch must give
+// exactly the same result as simulating it alone with the same seed.
+type BatchedSystem interface {
+	SeededSystem
+
+	// Create the initial state of one episode per generator, as InitializeSeededState does for each.
+	// A nil generator means the episode is not seeded, as for InitializeState.
+	InitializeBatchState(randomGenerators []*rand.Rand) *systemstate.BatchState
+
+	// Write the percepts of the agent with the given index in every unfinished episode to the
+	// corresponding row of percepts (of size NumEpisodes x NumPercepts).
+	ObserveBatch(batch *systemstate.BatchState, agentIndex int, percepts *mat.Dense)
+
+	// Advance every unfinished episode a single step, given the actions of each agent
+	// (actions[agentIndex] is of size NumEpisodes x NumActions, with a row per episode).
+	//
+	// The reward of each agent in each unfinished episode is written to rewards (of size NumEpisodes x
+	// NumAgentsPerSimulation), and the TerminalMask set for every episode that has ended.
+	// The state indices are maintained by the caller, so should not be touched.
+	StepBatch(batch *systemstate.BatchState, actions []*mat.Dense, rewards *mat.Dense)
+}
+
+// Create a batch of initial states one episode at a time, with InitializeSeededState for each
+// generator (or InitializeState if the generator is nil). Batched systems whose initial states
+// are not expensive to create can implement InitializeBatchState with this.
+func InitializeBatchStateFromEpisodes(targetSystem SeededSystem, randomGenerators []*rand.Rand) *systemstate.BatchState {
+	states := make([]*systemstate.SystemState, len(randomGenerators))
+	for episodeIndex, randomGenerator := range randomGenerators {
+		if randomGenerator == nil {
+			states[episodeIndex] = targetSystem.InitializeState()
+		} else {
+			states[episodeIndex] = targetSystem.InitializeSeededState(randomGenerator)
+		}
+	}
+	return systemstate.NewBatchState(states)
+}
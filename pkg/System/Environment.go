@@ -0,0 +1,292 @@
+package system
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+)
+
+// Extra information about a step, for debugging and analysis (e.g. which agent scored).
+// Environments may return nil, and may return the same info from many steps, so callers must not modify it.
+// The simulator never reads this.
+type StepInfo map[string]interface{}
+
+// An Environment is an alternative to System in the style of a reinforcement learning "gym".
+//
+// Rather than fetching the agents' actions and updating their scores itself (as System.AdvanceState must),
+// an environment is told the actions and returns the reward each agent earned. Environments never
+// see the agents, and agents never see the state, which makes environments simpler to write and test,
+// and lets them be driven by policies other than agents (see `pkg/EnvironmentServer`).
+//
+// Use NewEnvironmentSystem to simulate an environment with the simulator and manager.
+type Environment interface {
+	// Gets the number of percepts each agent observes
+	NumPercepts() int
+
+	// Gets the number of actions each agent takes
+	NumActions() int
+
+	// Gets the number of agents per simulation for this environment
+	NumAgentsPerSimulation() int
+
+	// Create the initial state of an episode, drawing all randomness from the given seed.
+	// Resetting with the same seed must always give the same episode, given the same actions.
+	Reset(seed uint64) *systemstate.SystemState
+
+	// Write the percepts of the agent with the given index in the given state to percepts,
+	// a vector of length NumPercepts. The state must not be modified.
+	Observe(state *systemstate.SystemState, agentIndex int, percepts *mat.VecDense)
+
+	// Advance the state a single step, given the action of every agent (in agent order, each of length NumActions).
+	//
+	// The reward each agent earned during the step is written to rewards (of length NumAgentsPerSimulation).
+	// Returns whether the state is now terminal (the episode has reached a natural end), whether the episode
+	// was truncated (cut short, e.g. by a time limit), and any extra information about the step.
+	//
+	// The state vector should be updated in place. The state index and terminal flag are maintained
+	// by the caller, so should not be touched.
+	//
+	// Stepping is the hot path of every simulation, so should not allocate (see StepBuffers).
+	Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (terminal bool, truncated bool, info StepInfo)
+}
+
+// The memory needed to step an environment: the percepts, actions and rewards of every agent.
+// Buffers are reused for every step of an episode, so that stepping does not allocate.
+// Episodes simulated concurrently each need their own buffers.
+type StepBuffers struct {
+	Percepts []*mat.VecDense
+	Actions  []*mat.VecDense
+	Rewards  []float64
+}
+
+// Create buffers sized for the given environment
+func NewStepBuffers(environment Environment) *StepBuffers {
+	numAgents := environment.NumAgentsPerSimulation()
+	buffers := &StepBuffers{
+		Percepts: make([]*mat.VecDense, numAgents),
+		Actions:  make([]*mat.VecDense, numAgents),
+		Rewards:  make([]float64, numAgents),
+	}
+	for agentIndex := 0; agentIndex < numAgents; agentIndex++ {
+		buffers.Percepts[agentIndex] = mat.NewVecDense(environment.NumPercepts(), nil)
+		buffers.Actions[agentIndex] = mat.NewVecDense(environment.NumActions(), nil)
+	}
+	return buffers
+}
+
+// The buffers for stepping the episode of the given state, kept in the state's StepBuffers, so that systems implementing
+// AdvanceState with AdvanceEnvironmentState do not allocate every step. The state's Scratch is left to the environment's
+// own memory (as for the wrappers in `pkg/Wrappers`).
+func StateStepBuffers(environment Environment, state *systemstate.SystemState) *StepBuffers {
+	if buffers, ok := state.StepBuffers.(*StepBuffers); ok {
+		return buffers
+	}
+	buffers := NewStepBuffers(environment)
+	state.StepBuffers = buffers
+	return buffers
+}
+
+// Advance the state of an environment a single step, in the manner of System.AdvanceState.
+//
+// Each agent's action is taken from its observation, the environment is stepped,
+// and each agent's reward is added to its score. The state becomes terminal if the
+// environment reports the episode as terminal or truncated, with its TerminalReason
+// recording which. Nothing is allocated,
+// as the given buffers are used for the percepts, actions and rewards.
+//
+// Systems can implement AdvanceState with this, so they only need to implement the Environment methods.
+// The simulator steps environments with this directly, reusing the same buffers for the whole episode.
+func AdvanceEnvironmentState(environment Environment, state *systemstate.SystemState, agents []*agent.Agent, buffers *StepBuffers) {
+	for agentIndex, environmentAgent := range agents {
+		environment.Observe(state, agentIndex, buffers.Percepts[agentIndex])
+		environmentAgent.GetActionInto(buffers.Percepts[agentIndex], buffers.Actions[agentIndex])
+	}
+
+	terminal, truncated, _ := environment.Step(state, buffers.Actions, buffers.Rewards)
+	for agentIndex, environmentAgent := range agents {
+		environmentAgent.Score += buffers.Rewards[agentIndex]
+	}
+	state.StateIndex += 1
+	state.TerminalState = terminal || truncated
+	if truncated && !terminal {
+		state.TerminalReason = systemstate.TerminalReasonTruncated
+	}
+}
+
+// Get the environment a system simulates, if it is an environment (or an EnvironmentSystem adapting one).
+// Other systems fetch their agents' actions themselves, so cannot be driven by actions from elsewhere.
+func AsEnvironment(targetSystem System) (Environment, bool) {
+	switch environment := targetSystem.(type) {
+	case *EnvironmentSystem:
+		return environment.Environment, true
+	case Environment:
+		return environment, true
+	default:
+		return nil, false
+	}
+}
+
+// Adapts an Environment to a System, so it can be simulated with the simulator and trained with the manager.
+//
+// The adapter is a SeededSystem, with every episode seeded from the adapter's own generator
+// unless a seed is given. It is also a DescribedSystem, taking its name and constants from the
+// environment if the environment has Name and Constants methods (as in DescribedSystem).
+// Likewise its schema, maximum episode length and time-out penalty are those of the environment, if it has them.
+type EnvironmentSystem struct {
+	Environment Environment
+
+	// Only used to seed each episode when none is given, see InitializeState
+	randomGenerator      *rand.Rand
+	randomSource         *rand.PCGSource
+	randomGeneratorMutex sync.Mutex
+}
+
+// Create a system that simulates the given environment
+func NewEnvironmentSystem(environment Environment) *EnvironmentSystem {
+	if environment == nil {
+		panic("Environment must not be nil!")
+	}
+	randomSource := &rand.PCGSource{}
+	randomSource.Seed(uint64(time.Now().UnixNano()))
+	return &EnvironmentSystem{
+		Environment:     environment,
+		randomGenerator: rand.New(randomSource),
+		randomSource:    randomSource,
+	}
+}
+
+func (system *EnvironmentSystem) NumPercepts() int {
+	return system.Environment.NumPercepts()
+}
+func (system *EnvironmentSystem) NumActions() int {
+	return system.Environment.NumActions()
+}
+func (system *EnvironmentSystem) NumAgentsPerSimulation() int {
+	return system.Environment.NumAgentsPerSimulation()
+}
+
+// The name of the environment if it has one, or otherwise its Go type name
+func (system *EnvironmentSystem) Name() string {
+	if namedEnvironment, ok := system.Environment.(interface{ Name() string }); ok {
+		return namedEnvironment.Name()
+	}
+	return fmt.Sprintf("%T", system.Environment)
+}
+
+// The constants of the environment if it has them, or otherwise no constants
+func (system *EnvironmentSystem) Constants() map[string]interface{} {
+	if describedEnvironment, ok := system.Environment.(interface{ Constants() map[string]interface{} }); ok {
+		return describedEnvironment.Constants()
+	}
+	return map[string]interface{}{}
+}
+
+// The schema of the environment if it has one (as in SchemaSystem), or otherwise the generic schema of SchemaOf
+func (system *EnvironmentSystem) Schema() Schema {
+	if schemaEnvironment, ok := system.Environment.(interface{ Schema() Schema }); ok {
+		return schemaEnvironment.Schema()
+	}
+	return Schema{
+		Percepts: genericFields("Percept", system.NumPercepts()),
+		Actions:  genericFields("Action", system.NumActions()),
+	}
+}
+
+// Reset the environment with a seed drawn from the adapter's own generator
+func (system *EnvironmentSystem) InitializeState() *systemstate.SystemState {
+	// Simulations run concurrently, so the shared generator must be locked
+	system.randomGeneratorMutex.Lock()
+	episodeSeed := system.randomGenerator.Uint64()
+	system.randomGeneratorMutex.Unlock()
+	return system.Environment.Reset(episodeSeed)
+}
+
+// Reset the environment with a seed drawn from the given generator
+func (system *EnvironmentSystem) InitializeSeededState(randomGenerator *rand.Rand) *systemstate.SystemState {
+	return system.Environment.Reset(randomGenerator.Uint64())
+}
+
+// The adapter's own state, as captured by SnapshotSystem
+type environmentSystemSnapshot struct {
+	RandomSource []byte
+
+	// Only set if the environment is a SnapshottableEnvironment
+	Environment []byte
+}
+
+// Captures the position of the adapter's own generator, and the environment's own state if it is
+// a SnapshottableEnvironment, see SnapshottableSystem
+func (system *EnvironmentSystem) SnapshotSystem() ([]byte, error) {
+	system.randomGeneratorMutex.Lock()
+	randomSource, err := system.randomSource.MarshalBinary()
+	system.randomGeneratorMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := environmentSystemSnapshot{RandomSource: randomSource}
+	if snapshottableEnvironment, ok := system.Environment.(SnapshottableEnvironment); ok {
+		if snapshot.Environment, err = snapshottableEnvironment.SnapshotSystem(); err != nil {
+			return nil, err
+		}
+	}
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(snapshot); err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// Returns the adapter (and environment) to a state captured by SnapshotSystem, see SnapshottableSystem
+func (system *EnvironmentSystem) RestoreSystem(data []byte) error {
+	var snapshot environmentSystemSnapshot
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot); err != nil {
+		return err
+	}
+	if snapshottableEnvironment, ok := system.Environment.(SnapshottableEnvironment); ok && snapshot.Environment != nil {
+		if err := snapshottableEnvironment.RestoreSystem(snapshot.Environment); err != nil {
+			return err
+		}
+	}
+	system.randomGeneratorMutex.Lock()
+	defer system.randomGeneratorMutex.Unlock()
+	return system.randomSource.UnmarshalBinary(snapshot.RandomSource)
+}
+
+// The maximum episode length of the environment if it has one (as in EpisodeLimitedSystem), or otherwise 0
+func (system *EnvironmentSystem) MaximumEpisodeLength() int {
+	if limitedEnvironment, ok := system.Environment.(interface{ MaximumEpisodeLength() int }); ok {
+		return limitedEnvironment.MaximumEpisodeLength()
+	}
+	return 0
+}
+
+// The time-out penalty of the environment if it has one (as in TimeoutPenalizedSystem), or otherwise 0
+func (system *EnvironmentSystem) TimeoutPenalty(state *systemstate.SystemState, agentIndex int) float64 {
+	if penalizedEnvironment, ok := system.Environment.(interface {
+		TimeoutPenalty(*systemstate.SystemState, int) float64
+	}); ok {
+		return penalizedEnvironment.TimeoutPenalty(state, agentIndex)
+	}
+	return 0
+}
+
+// Applies what the environment has learned, if it is a GenerationalEnvironment, see GenerationalSystem
+func (system *EnvironmentSystem) EndGeneration() {
+	if generationalEnvironment, ok := system.Environment.(GenerationalEnvironment); ok {
+		generationalEnvironment.EndGeneration()
+	}
+}
+
+// Advance the state a single step, with the buffers kept in the state (see StateStepBuffers).
+// The simulator steps environments directly with its own reused buffers, so this is only used by callers outside the simulator.
+func (system *EnvironmentSystem) AdvanceState(state *systemstate.SystemState, agents []*agent.Agent) {
+	AdvanceEnvironmentState(system.Environment, state, agents, StateStepBuffers(system.Environment, state))
+}
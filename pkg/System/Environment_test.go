@@ -0,0 +1,76 @@
+package system
+
+import (
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+)
+
+// A two agent environment where each agent is rewarded with its action,
+// ending after a number of steps set by the seed
+type countingEnvironment struct{}
+
+func (countingEnvironment) NumPercepts() int            { return 1 }
+func (countingEnvironment) NumActions() int             { return 1 }
+func (countingEnvironment) NumAgentsPerSimulation() int { return 2 }
+
+func (countingEnvironment) Reset(seed uint64) *systemstate.SystemState {
+	return &systemstate.SystemState{StateVector: mat.NewVecDense(1, []float64{float64(seed)})}
+}
+
+func (countingEnvironment) Observe(state *systemstate.SystemState, agentIndex int, percepts *mat.VecDense) {
+	percepts.SetVec(0, float64(agentIndex+1))
+}
+
+func (countingEnvironment) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, StepInfo) {
+	stepsRemaining := state.StateVector.AtVec(0) - 1
+	state.StateVector.SetVec(0, stepsRemaining)
+	rewards[0] = actions[0].AtVec(0)
+	rewards[1] = actions[1].AtVec(0)
+	return stepsRemaining <= 0, false, nil
+}
+
+func TestEnvironmentSystem(t *testing.T) {
+	environmentSystem := NewEnvironmentSystem(countingEnvironment{})
+	if environmentSystem.Name() != "system.countingEnvironment" {
+		t.Errorf("expected the environment's type name, got %q", environmentSystem.Name())
+	}
+
+	// Each agent doubles its percept, so agent 0 earns 2 and agent 1 earns 4 each step
+	agents := []*agent.Agent{
+		agent.NewAgent(mat.NewDense(1, 1, []float64{2})),
+		agent.NewAgent(mat.NewDense(1, 1, []float64{2})),
+	}
+	state := environmentSystem.Environment.Reset(3)
+	for !state.TerminalState {
+		environmentSystem.AdvanceState(state, agents)
+	}
+	if state.StateIndex != 3 {
+		t.Errorf("expected the episode to last 3 steps, got %v", state.StateIndex)
+	}
+	if agents[0].Score != 6 || agents[1].Score != 12 {
+		t.Errorf("expected scores 6 and 12, got %v and %v", agents[0].Score, agents[1].Score)
+	}
+}
+
+func TestStateStepBuffers(t *testing.T) {
+	// Buffers are kept in the state, and reused for every step of its episode
+	state := countingEnvironment{}.Reset(3)
+	buffers := StateStepBuffers(countingEnvironment{}, state)
+	if state.StepBuffers != buffers || StateStepBuffers(countingEnvironment{}, state) != buffers {
+		t.Errorf("expected the buffers to be kept in the state's StepBuffers and reused")
+	}
+
+	// Memory the environment keeps in Scratch does not displace the buffers, nor is it displaced by them
+	ownScratch := []float64{1}
+	state.Scratch = ownScratch
+	if StateStepBuffers(countingEnvironment{}, state) != buffers {
+		t.Errorf("expected the buffers to be reused when the Scratch holds other memory")
+	}
+	if scratch, ok := state.Scratch.([]float64); !ok || &scratch[0] != &ownScratch[0] {
+		t.Errorf("expected the environment's own Scratch to be left alone, got %v", state.Scratch)
+	}
+}
@@ -0,0 +1,33 @@
+package system
+
+import "fmt"
+
+// Environments implement ParameterizedEnvironment to allow their physical parameters (e.g. gravity or the size
+// of a paddle) to differ between instances, and so between episodes (see wrappers.ParameterRandomization).
+type ParameterizedEnvironment interface {
+	Environment
+
+	// Describes each of the environment's parameters, in a fixed order.
+	// The bounds of each field are the values the parameter may take.
+	ParameterFields() []Field
+
+	// The value of each of the environment's parameters, in the order of ParameterFields
+	ParameterValues() []float64
+
+	// Create an environment like this one, but with the given value of each parameter, in the order of ParameterFields.
+	// Panics if there is not one value per parameter, or any value is out of its bounds.
+	WithParameterValues(values []float64) ParameterizedEnvironment
+}
+
+// Panic unless there is exactly one value per parameter field, within the field's bounds.
+// ParameterizedEnvironment implementations use this to check the values given to WithParameterValues.
+func CheckParameterValues(fields []Field, values []float64) {
+	if len(values) != len(fields) {
+		panic(fmt.Sprintf("Expected %v parameter values, got %v!", len(fields), len(values)))
+	}
+	for index, field := range fields {
+		if !(field.Minimum <= values[index] && values[index] <= field.Maximum) {
+			panic(fmt.Sprintf("Parameter %v must be in [%v, %v], got %v!", field.Name, field.Minimum, field.Maximum, values[index]))
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package system
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A SystemFactory creates a new, independent instance of a system
+type SystemFactory func() System
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make(map[string]SystemFactory)
+)
+
+// Register a system under the given name, so it can be created by name with NewSystem.
+// This allows tools (sweeps, workers and so on) to be told which system to use on the command line.
+//
+// Systems typically register themselves in an init function, so importing the system package
+// (perhaps only for side effects) is enough to make it available.
+//
+// Panics if a system is already registered with this name.
+func Register(name string, factory SystemFactory) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, exists := registry[name]; exists {
+		panic("A system is already registered with the name " + name)
+	}
+	registry[name] = factory
+}
+
+// Create a new instance of the system registered with the given name
+func NewSystem(name string) (System, error) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	factory, exists := registry[name]
+	if !exists {
+		return nil, fmt.Errorf("no system registered with the name %q (registered systems are %v)", name, registeredNamesLocked())
+	}
+	return factory(), nil
+}
+
+// Get the names of all registered systems, in sorted order
+func RegisteredNames() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	return registeredNamesLocked()
+}
+
+func registeredNamesLocked() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,142 @@
+package system
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Describes a single element of a state, percept or action vector
+type Field struct {
+	// A name for the element, unique within its vector, e.g. "BallX".
+	// Names are used as column names (see datacollector.SimulationDataCollector), so should be identifiers.
+	Name string
+
+	// The unit the element is measured in, e.g. "units/s", or empty if it has none
+	Unit string
+
+	// The range the element is expected to lie in. Either bound is infinite if the element is unbounded in that direction.
+	Minimum float64
+	Maximum float64
+}
+
+// Create a field with no bounds
+func UnboundedField(name string, unit string) Field {
+	return Field{
+		Name:    name,
+		Unit:    unit,
+		Minimum: math.Inf(-1),
+		Maximum: math.Inf(1),
+	}
+}
+
+// A Schema gives the meaning of each element of a system's state, percept and action vectors, in order
+type Schema struct {
+	State    []Field
+	Percepts []Field
+	Actions  []Field
+}
+
+// Systems implement SchemaSystem to name the elements of their state, percept and action vectors,
+// so that saved simulations and printed states are labelled rather than only indexed.
+type SchemaSystem interface {
+	System
+
+	// The schema of the system. The percepts and actions must have NumPercepts and NumActions fields respectively.
+	Schema() Schema
+}
+
+// Get the schema of a system if it is a SchemaSystem, or otherwise a schema of unbounded fields with
+// generic names (e.g. "Percept0"). The length of the state vector of other systems is not known,
+// so their schema has no state fields, and their states are labelled by index alone (see Schema.StateNames).
+func SchemaOf(targetSystem System) Schema {
+	if schemaSystem, ok := targetSystem.(SchemaSystem); ok {
+		return schemaSystem.Schema()
+	}
+	return Schema{
+		Percepts: genericFields("Percept", targetSystem.NumPercepts()),
+		Actions:  genericFields("Action", targetSystem.NumActions()),
+	}
+}
+
+// Check that the schema describes the given system, returning an error describing any mismatch
+func (schema Schema) Check(targetSystem System) error {
+	if len(schema.Percepts) != targetSystem.NumPercepts() {
+		return fmt.Errorf("schema has %v percept fields, but the system has %v percepts", len(schema.Percepts), targetSystem.NumPercepts())
+	}
+	if len(schema.Actions) != targetSystem.NumActions() {
+		return fmt.Errorf("schema has %v action fields, but the system has %v actions", len(schema.Actions), targetSystem.NumActions())
+	}
+	for _, fields := range [][]Field{schema.State, schema.Percepts, schema.Actions} {
+		names := map[string]bool{}
+		for _, field := range fields {
+			if field.Name == "" {
+				return fmt.Errorf("schema fields must be named")
+			}
+			if names[field.Name] {
+				return fmt.Errorf("schema field name %v is used more than once", field.Name)
+			}
+			names[field.Name] = true
+			if field.Minimum > field.Maximum {
+				return fmt.Errorf("schema field %v has minimum %v above its maximum %v", field.Name, field.Minimum, field.Maximum)
+			}
+		}
+	}
+	return nil
+}
+
+// The name of each element of a state vector of the given length.
+// Elements beyond the schema's state fields are given generic names, e.g. "State6".
+func (schema Schema) StateNames(length int) []string {
+	return fieldNames(schema.State, "State", length)
+}
+
+// Format a state vector with each element labelled by its name and unit, e.g. "BallX=0.25 units"
+func (schema Schema) FormatState(stateVector []float64) string {
+	return formatLabelled(schema.State, "State", stateVector)
+}
+
+// Format a percept vector as in FormatState
+func (schema Schema) FormatPercepts(percepts []float64) string {
+	return formatLabelled(schema.Percepts, "Percept", percepts)
+}
+
+// Format an action vector as in FormatState
+func (schema Schema) FormatActions(actions []float64) string {
+	return formatLabelled(schema.Actions, "Action", actions)
+}
+
+// Unbounded fields named by the prefix followed by their index
+func genericFields(prefix string, length int) []Field {
+	fields := make([]Field, length)
+	for index := range fields {
+		fields[index] = UnboundedField(fmt.Sprintf("%v%v", prefix, index), "")
+	}
+	return fields
+}
+
+// The names of the given fields, followed by generic names up to the given length
+func fieldNames(fields []Field, prefix string, length int) []string {
+	names := make([]string, length)
+	for index := range names {
+		if index < len(fields) {
+			names[index] = fields[index].Name
+		} else {
+			names[index] = fmt.Sprintf("%v%v", prefix, index)
+		}
+	}
+	return names
+}
+
+// Format a vector as comma separated "name=value unit" pairs
+func formatLabelled(fields []Field, prefix string, vector []float64) string {
+	names := fieldNames(fields, prefix, len(vector))
+	labelledElements := make([]string, len(vector))
+	for index, value := range vector {
+		labelledElements[index] = fmt.Sprintf("%v=%v", names[index], value)
+		if index < len(fields) && fields[index].Unit != "" {
+			labelledElements[index] += " " + fields[index].Unit
+		}
+	}
+	return strings.Join(labelledElements, ", ")
+}
@@ -0,0 +1,37 @@
+package system
+
+import (
+	"testing"
+)
+
+// Systems without a schema are labelled with generic names
+func TestSchemaOfSystemWithoutSchema(t *testing.T) {
+	schema := SchemaOf(NewEnvironmentSystem(countingEnvironment{}))
+	if err := schema.Check(NewEnvironmentSystem(countingEnvironment{})); err != nil {
+		t.Fatal(err)
+	}
+	if schema.Percepts[0].Name != "Percept0" || schema.Actions[0].Name != "Action0" || len(schema.State) != 0 {
+		t.Errorf("expected generic percept and action fields and no state fields, got %+v", schema)
+	}
+	if formatted := schema.FormatState([]float64{1, 2}); formatted != "State0=1, State1=2" {
+		t.Errorf("expected states to be labelled by index, got %q", formatted)
+	}
+}
+
+// Declared fields are labelled by name and unit, with any elements beyond them labelled by index
+func TestSchemaFormatsLabelledVectors(t *testing.T) {
+	schema := Schema{State: []Field{
+		{Name: "Position", Unit: "m", Minimum: -1, Maximum: 1},
+		UnboundedField("Count", ""),
+	}}
+	if formatted := schema.FormatState([]float64{0.5, 3, 7}); formatted != "Position=0.5 m, Count=3, State2=7" {
+		t.Errorf("unexpected labelled state %q", formatted)
+	}
+
+	schema.State[1].Name = "Position"
+	schema.Percepts = []Field{UnboundedField("Percept0", "")}
+	schema.Actions = []Field{UnboundedField("Action0", "")}
+	if err := schema.Check(NewEnvironmentSystem(countingEnvironment{})); err == nil {
+		t.Error("expected repeated state field names to be caught")
+	}
+}
@@ -0,0 +1,66 @@
+package system
+
+import (
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+)
+
+// Systems with state of their own, beyond the state of each episode, implement SnapshottableSystem so that
+// snapshots (see TakeSnapshot) capture it too. For most systems this is the generator seeding each new
+// episode, so that restoring a snapshot also restores which episodes InitializeState gives next.
+type SnapshottableSystem interface {
+	System
+
+	// Capture the system's own state, safely with respect to concurrent simulations
+	SnapshotSystem() ([]byte, error)
+
+	// Return the system's own state to one captured by SnapshotSystem
+	RestoreSystem(data []byte) error
+}
+
+// Environments with state of their own implement SnapshottableEnvironment, so that snapshots of the
+// EnvironmentSystem adapting them capture it too (see SnapshottableSystem)
+type SnapshottableEnvironment interface {
+	Environment
+
+	SnapshotSystem() ([]byte, error)
+	RestoreSystem(data []byte) error
+}
+
+// A Snapshot captures a system and the state of one of its episodes at a single point,
+// so that the episode can be forked (for example to see what difference a single action makes)
+// by restoring the snapshot as many times as needed.
+type Snapshot struct {
+	// The system's own state, or nil if it is not a SnapshottableSystem
+	System []byte `json:",omitempty"`
+
+	State systemstate.StateSnapshot
+}
+
+// Capture the given system and state. The state must have been initialized by the system.
+// See systemstate.SystemState.Snapshot for when the state cannot be captured.
+func TakeSnapshot(targetSystem System, state *systemstate.SystemState) (*Snapshot, error) {
+	stateSnapshot, err := state.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{State: stateSnapshot}
+	if snapshottableSystem, ok := targetSystem.(SnapshottableSystem); ok {
+		snapshot.System, err = snapshottableSystem.SnapshotSystem()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// Return the given system (which must be the system the snapshot was taken of, or an identical one)
+// to the point the snapshot was taken, and create a new state exactly as the captured state was.
+// Restored states are independent of each other, so each can be advanced without affecting the rest.
+func (snapshot *Snapshot) Restore(targetSystem System) (*systemstate.SystemState, error) {
+	if snapshottableSystem, ok := targetSystem.(SnapshottableSystem); ok && snapshot.System != nil {
+		if err := snapshottableSystem.RestoreSystem(snapshot.System); err != nil {
+			return nil, err
+		}
+	}
+	return snapshot.State.Restore()
+}
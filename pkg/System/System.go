@@ -1,6 +1,10 @@
 package system
 
 import (
+	"context"
+
+	"golang.org/x/exp/rand"
+
 	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
 	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
 )
@@ -40,3 +44,83 @@ type System interface {
 	// so we can have flexibility in the number of agents involved in a system.
 	AdvanceState(*systemstate.SystemState, []*agent.Agent)
 }
+
+// Systems whose steps may take a long time can also implement ContextualSystem.
+// The simulator then calls AdvanceStateContext instead of AdvanceState, allowing the system
+// to stop part way through a step when the simulation is cancelled.
+//
+// The simulator always checks the context between steps, so most systems need not implement this.
+type ContextualSystem interface {
+	System
+
+	// Behaves exactly as AdvanceState, but should return promptly once the context is done.
+	// The state may be left part way through a step in this case, as the simulation is discarded.
+	AdvanceStateContext(context.Context, *systemstate.SystemState, []*agent.Agent)
+}
+
+// Systems whose episodes should be cut short after a particular number of steps implement EpisodeLimitedSystem.
+// Episodes of other systems are limited to simulator.DEFAULT_MAXIMUM_EPISODE_LENGTH steps,
+// and any run may set its own limit (see simulator.SimulationJob).
+type EpisodeLimitedSystem interface {
+	System
+
+	// The number of steps after which an episode is truncated, or 0 to use the simulator's default
+	MaximumEpisodeLength() int
+}
+
+// Systems that penalise agents for running out of time implement TimeoutPenalizedSystem.
+// Without a penalty, agents can learn to stall until the episode is truncated rather than risk losing.
+type TimeoutPenalizedSystem interface {
+	System
+
+	// The reward (usually negative) added to the return of the agent with the given index when the episode
+	// is truncated at the given state, whether by reaching its maximum length or by the system itself.
+	// The state must not be modified.
+	TimeoutPenalty(state *systemstate.SystemState, agentIndex int) float64
+}
+
+// Systems can also implement DescribedSystem to record their name and constants in the manifest of each run.
+// Systems that do not are recorded by their Go type name only.
+type DescribedSystem interface {
+	System
+
+	// A short name for the system, e.g. "pong"
+	Name() string
+
+	// The constants (physics, scoring and so on) the system runs with, keyed by name
+	Constants() map[string]interface{}
+}
+
+// Systems with random initial states or dynamics should implement SeededSystem, so that every simulation
+// can be reproduced (for example on another machine, see `pkg/Distributed`) from a single seed.
+// Systems that do not are always initialized with InitializeState.
+type SeededSystem interface {
+	System
+
+	// Behaves as InitializeState, but draws all randomness from the given generator.
+	// The generator should be stored in the state's RandomGenerator, and AdvanceState should
+	// draw from state.RandomGenerator rather than from any generator of its own.
+	// Systems seeding episodes themselves (e.g. in InitializeState) should do so with systemstate.NewSeededState,
+	// so that their states can be snapshot part way through (see TakeSnapshot).
+	InitializeSeededState(randomGenerator *rand.Rand) *systemstate.SystemState
+}
+
+// Systems that learn from the episodes they simulate (such as wrappers.PerceptNormalization, which learns the scale
+// of each percept) implement GenerationalSystem. What they learn during a generation is only applied in EndGeneration,
+// so that every episode of a generation is simulated by the same system, and stays reproducible from its seed.
+type GenerationalSystem interface {
+	System
+
+	// Apply what has been learned from the episodes simulated since the last call.
+	// The manager calls this once every episode of a generation (including its replay) is finished,
+	// and it must not be called while any episode is being simulated.
+	EndGeneration()
+}
+
+// Environments that learn from the episodes they simulate implement GenerationalEnvironment,
+// so that the EndGeneration of the EnvironmentSystem adapting them reaches them (see GenerationalSystem)
+type GenerationalEnvironment interface {
+	Environment
+
+	EndGeneration()
+}
@@ -0,0 +1,61 @@
+package systemstate
+
+import (
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// The states of many episodes of the same system, advanced in lockstep (see system.BatchedSystem)
+type BatchState struct {
+	// Row k is the state vector of episode k
+	StateMatrix *mat.Dense
+
+	// The state index of each episode
+	StateIndices []int
+
+	// TerminalMask[k] is true once episode k is over, after which its row is no longer advanced
+	TerminalMask []bool
+
+	// The source of randomness for each episode, as for SystemState.RandomGenerator
+	RandomGenerators []*rand.Rand
+}
+
+// Gather the given states (which must all have state vectors of the same length) into a batch.
+// The state vectors are copied, so the states are not affected as the batch is advanced.
+func NewBatchState(states []*SystemState) *BatchState {
+	if len(states) == 0 {
+		panic("A batch must have at least one state!")
+	}
+	batch := &BatchState{
+		StateMatrix:      mat.NewDense(len(states), states[0].StateVector.Len(), nil),
+		StateIndices:     make([]int, len(states)),
+		TerminalMask:     make([]bool, len(states)),
+		RandomGenerators: make([]*rand.Rand, len(states)),
+	}
+	for episodeIndex, state := range states {
+		for stateIndex := 0; stateIndex < state.StateVector.Len(); stateIndex++ {
+			batch.StateMatrix.Set(episodeIndex, stateIndex, state.StateVector.AtVec(stateIndex))
+		}
+		batch.StateIndices[episodeIndex] = state.StateIndex
+		batch.TerminalMask[episodeIndex] = state.TerminalState
+		batch.RandomGenerators[episodeIndex] = state.RandomGenerator
+	}
+	return batch
+}
+
+// The number of episodes in the batch
+func (batch *BatchState) NumEpisodes() int {
+	return len(batch.StateIndices)
+}
+
+// Get the state of a single episode. The state vector is a view of the episode's row of StateMatrix,
+// so changes to either are seen by the other, but the state index and terminal flag are copies.
+func (batch *BatchState) State(episodeIndex int) *SystemState {
+	stateRow := batch.StateMatrix.RawRowView(episodeIndex)
+	return &SystemState{
+		StateVector:     mat.NewVecDense(len(stateRow), stateRow),
+		StateIndex:      batch.StateIndices[episodeIndex],
+		TerminalState:   batch.TerminalMask[episodeIndex],
+		RandomGenerator: batch.RandomGenerators[episodeIndex],
+	}
+}
@@ -0,0 +1,94 @@
+package systemstate
+
+import (
+	"errors"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Returned by Snapshot for states whose generator cannot be captured, as its source is not known
+// (see SystemState.RandomSource)
+var ErrRandomSourceUnknown = errors.New("the state's random generator cannot be snapshot, as its source is not known")
+
+// Everything about a state part way through an episode, from which it can be restored exactly (see Restore).
+//
+// Snapshots hold no references to the state they were taken of, so a state can be forked by restoring
+// the same snapshot many times, for example to try alternative actions from the same point of an episode.
+// Snapshots can be saved with gob or JSON.
+type StateSnapshot struct {
+	StateVector    []float64
+	StateIndex     int
+	TerminalState  bool
+	TerminalReason TerminalReason
+
+	// The position of the state's random generator (see rand.PCGSource.MarshalBinary),
+	// or nil if the state has no generator
+	RandomSource []byte `json:",omitempty"`
+
+	// The snapshot of the inner state, if the state has one (see SystemState.Inner)
+	Inner *StateSnapshot `json:",omitempty"`
+}
+
+// Capture the state, so that it can be restored later (see StateSnapshot).
+//
+// Returns ErrRandomSourceUnknown if the state (or any inner state) has a generator but its source is not known,
+// as a snapshot without it would not continue the episode as the state would.
+// Bytes buffered by RandomGenerator.Read are not captured, so systems should not draw with Read.
+func (state *SystemState) Snapshot() (StateSnapshot, error) {
+	snapshot := StateSnapshot{
+		StateVector:    mat.VecDenseCopyOf(state.StateVector).RawVector().Data,
+		StateIndex:     state.StateIndex,
+		TerminalState:  state.TerminalState,
+		TerminalReason: state.TerminalReason,
+	}
+	if state.RandomGenerator != nil {
+		if state.RandomSource == nil {
+			return StateSnapshot{}, ErrRandomSourceUnknown
+		}
+		randomSource, err := state.RandomSource.MarshalBinary()
+		if err != nil {
+			return StateSnapshot{}, err
+		}
+		snapshot.RandomSource = randomSource
+	}
+	if state.Inner != nil {
+		innerSnapshot, err := state.Inner.Snapshot()
+		if err != nil {
+			return StateSnapshot{}, err
+		}
+		snapshot.Inner = &innerSnapshot
+	}
+	return snapshot, nil
+}
+
+// Create a new state exactly as the state was when the snapshot was taken, with its own generator if it had one.
+// Each restored state is independent of every other, and of the state the snapshot was taken of.
+func (snapshot StateSnapshot) Restore() (*SystemState, error) {
+	return snapshot.restoreOnto(append([]float64{}, snapshot.StateVector...))
+}
+
+// Restore the state with its vector (and those of any inner states) viewing the start of the given data
+func (snapshot StateSnapshot) restoreOnto(stateData []float64) (*SystemState, error) {
+	state := &SystemState{
+		StateVector:    mat.NewVecDense(len(snapshot.StateVector), stateData[:len(snapshot.StateVector)]),
+		StateIndex:     snapshot.StateIndex,
+		TerminalState:  snapshot.TerminalState,
+		TerminalReason: snapshot.TerminalReason,
+	}
+	if snapshot.RandomSource != nil {
+		state.RandomSource = &rand.PCGSource{}
+		if err := state.RandomSource.UnmarshalBinary(snapshot.RandomSource); err != nil {
+			return nil, err
+		}
+		state.RandomGenerator = rand.New(state.RandomSource)
+	}
+	if snapshot.Inner != nil {
+		inner, err := snapshot.Inner.restoreOnto(stateData)
+		if err != nil {
+			return nil, err
+		}
+		state.Inner = inner
+	}
+	return state, nil
+}
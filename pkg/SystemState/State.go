@@ -1,16 +1,132 @@
 package systemstate
 
-import "gonum.org/v1/gonum/mat"
+import (
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Describes why an episode came to an end
+type TerminalReason int
+
+const (
+	// The system reported the state as terminal (the episode reached a natural end)
+	TerminalReasonTerminal TerminalReason = iota
+	// The episode was cut short before it reached a natural end, either by the system
+	// or by hitting its maximum episode length (see system.EpisodeLimitedSystem)
+	TerminalReasonTruncated
+	// The simulation panicked
+	TerminalReasonError
+	// The context of the simulation was cancelled before the state became terminal
+	TerminalReasonCancelled
+)
+
+func (reason TerminalReason) String() string {
+	switch reason {
+	case TerminalReasonTerminal:
+		return "terminal"
+	case TerminalReasonTruncated:
+		return "truncated"
+	case TerminalReasonError:
+		return "error"
+	case TerminalReasonCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
 
 type SystemState struct {
 	StateVector   *mat.VecDense
 	StateIndex    int
 	TerminalState bool
+
+	// Why the episode ended. Only meaningful once TerminalState is set.
+	// Systems setting TerminalState need only set this if the episode was truncated,
+	// as the zero value is TerminalReasonTerminal.
+	TerminalReason TerminalReason
+
+	// The source of randomness for this episode, for systems with random dynamics (see system.SeededSystem).
+	// Keeping this in the state rather than the system lets simulations run concurrently,
+	// and lets any simulation be reproduced from its seed. Nil for systems without randomness.
+	RandomGenerator *rand.Rand
+
+	// The source RandomGenerator draws from, if known. A generator does not reveal its source,
+	// so states can only be copied or snapshot part way through an episode (see Snapshot)
+	// if the source is kept here too. States initialized with NewSeededState always have it.
+	RandomSource *rand.PCGSource
+
+	// For systems wrapping another system (see `pkg/Wrappers`), the state of the wrapped system.
+	// Its state vector is a view of the start of this state's vector (see WrapState), so the wrapped
+	// system sees only its own state, while copies and snapshots of this state capture both.
+	Inner *SystemState
+
+	// Memory a system keeps with the state so that stepping does not allocate, such as reused buffers.
+	// It is not part of the state proper, so is neither copied (see DeepCopyState) nor snapshot (see Snapshot),
+	// and systems using it must recreate it whenever it is nil.
+	Scratch interface{}
+
+	// The reused buffers for stepping the episode with system.AdvanceEnvironmentState (see system.StateStepBuffers).
+	// These are kept apart from Scratch, which wrappers use for memory of their own. Like Scratch,
+	// they are neither copied nor snapshot, and are recreated whenever nil.
+	StepBuffers interface{}
 }
 
-func (state *SystemState) DeepCopyState() *SystemState {
+// Create the state of a system wrapping another, around the wrapped system's state inner.
+// The new state's vector holds the inner state's vector followed by numExtraElements more, which start as zero.
+// The inner state (and any state it wraps in turn) is changed to view the start of the new vector.
+func WrapState(inner *SystemState, numExtraElements int) *SystemState {
+	innerLength := inner.StateVector.Len()
+	stateData := make([]float64, innerLength+numExtraElements)
+	copy(stateData, inner.StateVector.RawVector().Data)
+	for wrappedState := inner; wrappedState != nil; wrappedState = wrappedState.Inner {
+		wrappedState.StateVector = mat.NewVecDense(wrappedState.StateVector.Len(), stateData[:wrappedState.StateVector.Len()])
+	}
 	return &SystemState{
-		StateIndex:  state.StateIndex,
-		StateVector: mat.VecDenseCopyOf(state.StateVector),
+		StateVector:   mat.NewVecDense(len(stateData), stateData),
+		StateIndex:    inner.StateIndex,
+		TerminalState: inner.TerminalState,
+		Inner:         inner,
+	}
+}
+
+// Create the initial state of an episode from a new generator seeded with the given seed, which is passed to
+// initialize (for example a system.SeededSystem's InitializeSeededState). If the state keeps the generator
+// as its RandomGenerator, the generator's source is kept as its RandomSource, so the state can be snapshot.
+func NewSeededState(seed uint64, initialize func(randomGenerator *rand.Rand) *SystemState) *SystemState {
+	randomSource := &rand.PCGSource{}
+	randomSource.Seed(seed)
+	randomGenerator := rand.New(randomSource)
+	state := initialize(randomGenerator)
+	if state.RandomGenerator == randomGenerator {
+		state.RandomSource = randomSource
+	}
+	return state
+}
+
+// Copy the state, so that the copy can be advanced independently of the original.
+//
+// If the state's RandomSource is known the copy has its own generator, starting from the same point
+// as the original's, so both draw the same numbers from then on. Otherwise the copy has no generator.
+// Any inner state is copied too, viewing the start of the copy's vector as the original does.
+func (state *SystemState) DeepCopyState() *SystemState {
+	return state.copyOnto(mat.VecDenseCopyOf(state.StateVector).RawVector().Data)
+}
+
+// Copy the state with its vector (and those of any inner states) viewing the start of the given data
+func (state *SystemState) copyOnto(stateData []float64) *SystemState {
+	stateCopy := &SystemState{
+		StateIndex:     state.StateIndex,
+		StateVector:    mat.NewVecDense(state.StateVector.Len(), stateData[:state.StateVector.Len()]),
+		TerminalState:  state.TerminalState,
+		TerminalReason: state.TerminalReason,
+	}
+	if state.RandomSource != nil {
+		stateCopy.RandomSource = &rand.PCGSource{}
+		*stateCopy.RandomSource = *state.RandomSource
+		stateCopy.RandomGenerator = rand.New(stateCopy.RandomSource)
+	}
+	if state.Inner != nil {
+		stateCopy.Inner = state.Inner.copyOnto(stateData)
 	}
+	return stateCopy
 }
@@ -0,0 +1,96 @@
+package wrappers
+
+import (
+	"fmt"
+
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Delays every action by a number of steps, as from a slow control loop.
+//
+// The actions chosen in each step reach the wrapped environment that many steps later,
+// and until the first actions arrive the wrapped environment is given zero actions.
+// The pending actions are kept in the state, in the order they will arrive.
+type ActionLatency struct {
+	wrapper
+	numSteps int
+}
+
+// Wrap the environment, delaying every action by the given number of steps (at least one)
+func NewActionLatency(environment system.Environment, numSteps int) *ActionLatency {
+	if numSteps < 1 {
+		panic("Action latency must be at least one step!")
+	}
+	return &ActionLatency{
+		wrapper:  newWrapper(environment),
+		numSteps: numSteps,
+	}
+}
+
+func (latency *ActionLatency) Name() string {
+	return latency.name("actionLatency")
+}
+func (latency *ActionLatency) Constants() map[string]interface{} {
+	return latency.constants(map[string]interface{}{
+		"ACTION_LATENCY_STEPS": latency.numSteps,
+	})
+}
+
+// The schema of the wrapped environment, with the pending actions in the state
+func (latency *ActionLatency) Schema() system.Schema {
+	schema := latency.innerSchema()
+	if len(schema.State) > 0 {
+		for stepIndex := 0; stepIndex < latency.numSteps; stepIndex++ {
+			for agentIndex := 0; agentIndex < latency.NumAgentsPerSimulation(); agentIndex++ {
+				for _, action := range schema.Actions {
+					pendingAction := action
+					pendingAction.Name = fmt.Sprintf("Agent%vPending%vStep%v", agentIndex, action.Name, stepIndex)
+					schema.State = append(schema.State, pendingAction)
+				}
+			}
+		}
+	}
+	return schema
+}
+
+// Reset the wrapped environment, with no actions pending
+func (latency *ActionLatency) Reset(seed uint64) *systemstate.SystemState {
+	return systemstate.WrapState(latency.environment.Reset(seed), latency.numSteps*latency.actionsPerStep())
+}
+
+// Steps the wrapped environment with the oldest pending actions, then queues the given actions
+func (latency *ActionLatency) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	terminal, truncated, info := latency.stepInner(state, latency.arrivingActions(state), rewards)
+
+	pendingActions := state.StateVector.RawVector().Data[state.Inner.StateVector.Len():]
+	copy(pendingActions, pendingActions[latency.actionsPerStep():])
+	newestActions := pendingActions[(latency.numSteps-1)*latency.actionsPerStep():]
+	for agentIndex, action := range actions {
+		for actionIndex := 0; actionIndex < latency.NumActions(); actionIndex++ {
+			newestActions[agentIndex*latency.NumActions()+actionIndex] = action.AtVec(actionIndex)
+		}
+	}
+	return terminal, truncated, info
+}
+
+// The number of elements of the state holding the actions of a single step
+func (latency *ActionLatency) actionsPerStep() int {
+	return latency.NumAgentsPerSimulation() * latency.NumActions()
+}
+
+// Views of the actions arriving this step (the oldest pending), one per agent, kept in the state's Scratch
+func (latency *ActionLatency) arrivingActions(state *systemstate.SystemState) []*mat.VecDense {
+	if arrivingActions, ok := state.Scratch.([]*mat.VecDense); ok {
+		return arrivingActions
+	}
+	pendingActions := state.StateVector.RawVector().Data[state.Inner.StateVector.Len():]
+	arrivingActions := make([]*mat.VecDense, latency.NumAgentsPerSimulation())
+	for agentIndex := range arrivingActions {
+		start := agentIndex * latency.NumActions()
+		arrivingActions[agentIndex] = mat.NewVecDense(latency.NumActions(), pendingActions[start:start+latency.NumActions()])
+	}
+	state.Scratch = arrivingActions
+	return arrivingActions
+}
@@ -0,0 +1,51 @@
+package wrappers
+
+import (
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Adds Gaussian noise to every action before it reaches the wrapped environment, as from imperfect actuators
+type ActionNoise struct {
+	wrapper
+	standardDeviations []float64
+}
+
+// Wrap the environment, adding noise with the given standard deviation (one per action) to each action
+func NewActionNoise(environment system.Environment, standardDeviations []float64) *ActionNoise {
+	noise := &ActionNoise{
+		wrapper:            newWrapper(environment),
+		standardDeviations: append([]float64{}, standardDeviations...),
+	}
+	checkLength(standardDeviations, noise.NumActions(), "action standard deviations")
+	return noise
+}
+
+func (noise *ActionNoise) Name() string {
+	return noise.name("actionNoise")
+}
+func (noise *ActionNoise) Constants() map[string]interface{} {
+	return noise.constants(map[string]interface{}{
+		"ACTION_NOISE_STANDARD_DEVIATIONS": noise.standardDeviations,
+	})
+}
+func (noise *ActionNoise) Schema() system.Schema {
+	return noise.innerSchema()
+}
+
+// Reset the wrapped environment, seeding the noise of the episode
+func (noise *ActionNoise) Reset(seed uint64) *systemstate.SystemState {
+	return noise.resetWithGenerator(seed, 0)
+}
+
+// Steps the wrapped environment with noise added to every action. The given actions are not modified.
+func (noise *ActionNoise) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	noisyActions := noise.actionBuffers(state)
+	for agentIndex, action := range actions {
+		for actionIndex, standardDeviation := range noise.standardDeviations {
+			noisyActions[agentIndex].SetVec(actionIndex, action.AtVec(actionIndex)+standardDeviation*state.RandomGenerator.NormFloat64())
+		}
+	}
+	return noise.stepInner(state, noisyActions, rewards)
+}
@@ -0,0 +1,121 @@
+package wrappers
+
+import (
+	"math"
+
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Transforms every action before it reaches the wrapped environment, scaling and offsetting it
+// and then clipping it to bounds: each action becomes min(maximum, max(minimum, offset + scale * action)).
+//
+// Scaling lets agents act in a convenient range (e.g. [-1, 1]) whatever the range of the actuators,
+// while clipping enforces the limits of the actuators. See NewActionScaling and NewActionClipping.
+type ActionTransform struct {
+	wrapper
+	suffix string
+
+	scale   []float64
+	offset  []float64
+	minimum []float64
+	maximum []float64
+}
+
+// Wrap the environment, giving it offset + scale * action for each action (one scale and offset per action)
+func NewActionScaling(environment system.Environment, scale []float64, offset []float64) *ActionTransform {
+	transform := &ActionTransform{
+		wrapper: newWrapper(environment),
+		suffix:  "actionScaling",
+		scale:   append([]float64{}, scale...),
+		offset:  append([]float64{}, offset...),
+	}
+	checkLength(scale, transform.NumActions(), "action scales")
+	checkLength(offset, transform.NumActions(), "action offsets")
+	transform.minimum = constantSlice(transform.NumActions(), math.Inf(-1))
+	transform.maximum = constantSlice(transform.NumActions(), math.Inf(1))
+	return transform
+}
+
+// Wrap the environment, clipping each action to the given bounds (one minimum and maximum per action).
+// The bounds of an environment's actions are given by its schema, see system.SchemaOf.
+func NewActionClipping(environment system.Environment, minimum []float64, maximum []float64) *ActionTransform {
+	transform := &ActionTransform{
+		wrapper: newWrapper(environment),
+		suffix:  "actionClipping",
+		minimum: append([]float64{}, minimum...),
+		maximum: append([]float64{}, maximum...),
+	}
+	checkLength(minimum, transform.NumActions(), "action minimums")
+	checkLength(maximum, transform.NumActions(), "action maximums")
+	for actionIndex := range minimum {
+		if minimum[actionIndex] > maximum[actionIndex] {
+			panic("Action minimums must not be above their maximums!")
+		}
+	}
+	transform.scale = constantSlice(transform.NumActions(), 1.0)
+	transform.offset = constantSlice(transform.NumActions(), 0.0)
+	return transform
+}
+
+func (transform *ActionTransform) Name() string {
+	return transform.name(transform.suffix)
+}
+func (transform *ActionTransform) Constants() map[string]interface{} {
+	return transform.constants(map[string]interface{}{
+		"ACTION_SCALE":   transform.scale,
+		"ACTION_OFFSET":  transform.offset,
+		"ACTION_MINIMUM": transform.minimum,
+		"ACTION_MAXIMUM": transform.maximum,
+	})
+}
+
+// The schema of the wrapped environment, with the bounds of each action being those of the agents' actions
+// that reach the bounds of the wrapped environment's actions (after scaling), narrowed by any clipping
+func (transform *ActionTransform) Schema() system.Schema {
+	schema := transform.innerSchema()
+	actions := make([]system.Field, len(schema.Actions))
+	for actionIndex, action := range schema.Actions {
+		minimum := math.Max(action.Minimum, transform.minimum[actionIndex])
+		maximum := math.Min(action.Maximum, transform.maximum[actionIndex])
+		scale, offset := transform.scale[actionIndex], transform.offset[actionIndex]
+		actions[actionIndex] = system.UnboundedField(action.Name, "")
+		if scale > 0 {
+			actions[actionIndex].Minimum, actions[actionIndex].Maximum = (minimum-offset)/scale, (maximum-offset)/scale
+		} else if scale < 0 {
+			actions[actionIndex].Minimum, actions[actionIndex].Maximum = (maximum-offset)/scale, (minimum-offset)/scale
+		}
+		if scale == 1 && offset == 0 {
+			actions[actionIndex].Unit = action.Unit
+		}
+	}
+	schema.Actions = actions
+	return schema
+}
+
+func (transform *ActionTransform) Reset(seed uint64) *systemstate.SystemState {
+	return systemstate.WrapState(transform.environment.Reset(seed), 0)
+}
+
+// Steps the wrapped environment with every action transformed. The given actions are not modified.
+func (transform *ActionTransform) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	transformedActions := transform.actionBuffers(state)
+	for agentIndex, action := range actions {
+		for actionIndex := 0; actionIndex < transform.NumActions(); actionIndex++ {
+			transformedAction := transform.offset[actionIndex] + transform.scale[actionIndex]*action.AtVec(actionIndex)
+			transformedAction = math.Max(transform.minimum[actionIndex], math.Min(transform.maximum[actionIndex], transformedAction))
+			transformedActions[agentIndex].SetVec(actionIndex, transformedAction)
+		}
+	}
+	return transform.stepInner(state, transformedActions, rewards)
+}
+
+// A slice of the given length holding the given value throughout
+func constantSlice(length int, value float64) []float64 {
+	values := make([]float64, length)
+	for index := range values {
+		values[index] = value
+	}
+	return values
+}
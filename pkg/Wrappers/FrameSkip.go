@@ -0,0 +1,77 @@
+package wrappers
+
+import (
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Repeats every action for a number of steps of the wrapped environment, so agents decide less often.
+//
+// Each agent's reward is the sum of its rewards over the repeated steps. Repetition stops early
+// if the wrapped environment's episode ends.
+type FrameSkip struct {
+	wrapper
+	numFrames int
+}
+
+// Wrap the environment, repeating every action for the given number of steps (at least one)
+func NewFrameSkip(environment system.Environment, numFrames int) *FrameSkip {
+	if numFrames < 1 {
+		panic("Frame skip must repeat each action at least once!")
+	}
+	return &FrameSkip{
+		wrapper:   newWrapper(environment),
+		numFrames: numFrames,
+	}
+}
+
+func (frameSkip *FrameSkip) Name() string {
+	return frameSkip.name("frameSkip")
+}
+func (frameSkip *FrameSkip) Constants() map[string]interface{} {
+	return frameSkip.constants(map[string]interface{}{
+		"FRAME_SKIP_FRAMES": frameSkip.numFrames,
+	})
+}
+func (frameSkip *FrameSkip) Schema() system.Schema {
+	return frameSkip.innerSchema()
+}
+
+// The maximum episode length of the wrapped environment in repeated steps, rounded up, see system.EpisodeLimitedSystem
+func (frameSkip *FrameSkip) MaximumEpisodeLength() int {
+	innerLength := frameSkip.wrapper.MaximumEpisodeLength()
+	return (innerLength + frameSkip.numFrames - 1) / frameSkip.numFrames
+}
+
+func (frameSkip *FrameSkip) Reset(seed uint64) *systemstate.SystemState {
+	return systemstate.WrapState(frameSkip.environment.Reset(seed), 0)
+}
+
+// Steps the wrapped environment repeatedly with the same actions, summing the rewards.
+// Returns the information of the last step taken.
+func (frameSkip *FrameSkip) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	frameRewards := frameSkip.rewardBuffer(state)
+	for agentIndex := range rewards {
+		rewards[agentIndex] = 0.0
+	}
+	var terminal, truncated bool
+	var info system.StepInfo
+	for frameIndex := 0; frameIndex < frameSkip.numFrames && !(terminal || truncated); frameIndex++ {
+		terminal, truncated, info = frameSkip.stepInner(state, actions, frameRewards)
+		for agentIndex, frameReward := range frameRewards {
+			rewards[agentIndex] += frameReward
+		}
+	}
+	return terminal, truncated, info
+}
+
+// The reused rewards of a single frame, kept in the state's Scratch
+func (frameSkip *FrameSkip) rewardBuffer(state *systemstate.SystemState) []float64 {
+	if frameRewards, ok := state.Scratch.([]float64); ok {
+		return frameRewards
+	}
+	frameRewards := make([]float64, frameSkip.NumAgentsPerSimulation())
+	state.Scratch = frameRewards
+	return frameRewards
+}
@@ -0,0 +1,135 @@
+package wrappers
+
+import (
+	"fmt"
+	"math"
+
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// The range a randomised parameter is drawn from, uniformly
+type ParameterRange struct {
+	Minimum float64
+	Maximum float64
+}
+
+// Draws the physical parameters of the wrapped environment afresh for every episode, each uniformly from
+// a configured range, so that agents are evolved to cope with a family of environments rather than overfitting
+// one exact setup. Parameters without a range keep the wrapped environment's value.
+//
+// The parameters of an episode are drawn from its seed, and kept at the end of its state vector, so episodes
+// stay reproducible and their states can be copied and snapshot. Each episode is simulated by an environment
+// made with its parameters (see system.ParameterizedEnvironment), kept in the state's Scratch.
+type ParameterRandomization struct {
+	wrapper
+	parameterizedEnvironment system.ParameterizedEnvironment
+	ranges                   map[string]ParameterRange
+
+	// The range of every parameter, in the order of the wrapped environment's parameter fields.
+	// Parameters without a configured range have a range of only the wrapped environment's value.
+	minimums []float64
+	maximums []float64
+}
+
+// Wrap the environment, drawing each parameter named in ranges from its range every episode.
+// Other wrappers are not parameterized environments, so this must be the innermost wrapper of a stack.
+// Panics if a name is not one of the environment's parameters, or a range is not within the parameter's bounds.
+func NewParameterRandomization(environment system.ParameterizedEnvironment, ranges map[string]ParameterRange) *ParameterRandomization {
+	randomization := &ParameterRandomization{
+		wrapper:                  newWrapper(environment),
+		parameterizedEnvironment: environment,
+		ranges:                   map[string]ParameterRange{},
+		minimums:                 environment.ParameterValues(),
+		maximums:                 environment.ParameterValues(),
+	}
+	fields := environment.ParameterFields()
+	for name, parameterRange := range ranges {
+		parameterIndex := -1
+		for fieldIndex, field := range fields {
+			if field.Name == name {
+				parameterIndex = fieldIndex
+			}
+		}
+		if parameterIndex < 0 {
+			panic(fmt.Sprintf("The environment has no parameter %v!", name))
+		}
+		field := fields[parameterIndex]
+		if !(field.Minimum <= parameterRange.Minimum && parameterRange.Minimum <= parameterRange.Maximum && parameterRange.Maximum <= field.Maximum) {
+			panic(fmt.Sprintf("The range of parameter %v must be within [%v, %v], got [%v, %v]!",
+				name, field.Minimum, field.Maximum, parameterRange.Minimum, parameterRange.Maximum))
+		}
+		randomization.ranges[name] = parameterRange
+		randomization.minimums[parameterIndex] = parameterRange.Minimum
+		randomization.maximums[parameterIndex] = parameterRange.Maximum
+	}
+	return randomization
+}
+
+func (randomization *ParameterRandomization) Name() string {
+	return randomization.name("parameterRandomization")
+}
+func (randomization *ParameterRandomization) Constants() map[string]interface{} {
+	return randomization.constants(map[string]interface{}{
+		"PARAMETER_RANGES": randomization.ranges,
+	})
+}
+
+// The schema of the wrapped environment, with the parameters of the episode in the state.
+// Bounds that depend on the parameters (e.g. on the actions) are those of the wrapped environment.
+func (randomization *ParameterRandomization) Schema() system.Schema {
+	schema := randomization.innerSchema()
+	if len(schema.State) > 0 {
+		schema.State = append(schema.State, randomization.parameterizedEnvironment.ParameterFields()...)
+	}
+	return schema
+}
+
+// Draw the parameters of a new episode from the seed, and reset an environment with those parameters
+func (randomization *ParameterRandomization) Reset(seed uint64) *systemstate.SystemState {
+	randomSource := &rand.PCGSource{}
+	randomSource.Seed(seed)
+	randomGenerator := rand.New(randomSource)
+	parameters := make([]float64, len(randomization.minimums))
+	for parameterIndex, minimum := range randomization.minimums {
+		maximum := randomization.maximums[parameterIndex]
+		// Rounding must not take the parameter beyond its range
+		parameters[parameterIndex] = math.Min(maximum, minimum+(maximum-minimum)*randomGenerator.Float64())
+	}
+
+	episodeEnvironment := randomization.parameterizedEnvironment.WithParameterValues(parameters)
+	state := systemstate.WrapState(episodeEnvironment.Reset(randomGenerator.Uint64()), len(parameters))
+	copy(randomization.ParametersOf(state), parameters)
+	state.Scratch = episodeEnvironment
+	return state
+}
+
+// Writes the percepts of the episode's environment
+func (randomization *ParameterRandomization) Observe(state *systemstate.SystemState, agentIndex int, percepts *mat.VecDense) {
+	randomization.episodeEnvironment(state).Observe(state.Inner, agentIndex, percepts)
+}
+
+// Steps the episode's environment
+func (randomization *ParameterRandomization) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	return stepWrapped(randomization.episodeEnvironment(state), state, actions, rewards)
+}
+
+// The parameters of the episode, in the order of the wrapped environment's parameter fields.
+// They follow the wrapped environment's state in the state vector.
+func (randomization *ParameterRandomization) ParametersOf(state *systemstate.SystemState) []float64 {
+	return state.StateVector.RawVector().Data[state.Inner.StateVector.Len():]
+}
+
+// The environment simulating the episode, made again from the episode's parameters
+// if the state has been copied or restored since it was reset
+func (randomization *ParameterRandomization) episodeEnvironment(state *systemstate.SystemState) system.Environment {
+	if environment, ok := state.Scratch.(system.ParameterizedEnvironment); ok {
+		return environment
+	}
+	parameters := append([]float64{}, randomization.ParametersOf(state)...)
+	environment := randomization.parameterizedEnvironment.WithParameterValues(parameters)
+	state.Scratch = environment
+	return environment
+}
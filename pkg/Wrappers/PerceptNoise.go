@@ -0,0 +1,93 @@
+package wrappers
+
+import (
+	"fmt"
+
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Adds Gaussian noise to every percept, as from imperfect sensors.
+//
+// Fresh noise is drawn for every agent after each step, and kept in the state so that observing
+// the same state twice gives the same percepts.
+type PerceptNoise struct {
+	wrapper
+	standardDeviations []float64
+}
+
+// Wrap the environment, adding noise with the given standard deviation (one per percept) to each percept
+func NewPerceptNoise(environment system.Environment, standardDeviations []float64) *PerceptNoise {
+	noise := &PerceptNoise{
+		wrapper:            newWrapper(environment),
+		standardDeviations: append([]float64{}, standardDeviations...),
+	}
+	checkLength(standardDeviations, noise.NumPercepts(), "percept standard deviations")
+	return noise
+}
+
+func (noise *PerceptNoise) Name() string {
+	return noise.name("perceptNoise")
+}
+func (noise *PerceptNoise) Constants() map[string]interface{} {
+	return noise.constants(map[string]interface{}{
+		"PERCEPT_NOISE_STANDARD_DEVIATIONS": noise.standardDeviations,
+	})
+}
+
+// The schema of the wrapped environment, with noisy percepts unbounded and the noise of each percept in the state
+func (noise *PerceptNoise) Schema() system.Schema {
+	schema := noise.innerSchema()
+	percepts := make([]system.Field, len(schema.Percepts))
+	for perceptIndex, percept := range schema.Percepts {
+		percepts[perceptIndex] = system.UnboundedField(percept.Name, percept.Unit)
+	}
+	if len(schema.State) > 0 {
+		for agentIndex := 0; agentIndex < noise.NumAgentsPerSimulation(); agentIndex++ {
+			for _, percept := range schema.Percepts {
+				schema.State = append(schema.State, system.UnboundedField(fmt.Sprintf("Agent%v%vNoise", agentIndex, percept.Name), percept.Unit))
+			}
+		}
+	}
+	schema.Percepts = percepts
+	return schema
+}
+
+// Reset the wrapped environment, and draw the noise of the first observations
+func (noise *PerceptNoise) Reset(seed uint64) *systemstate.SystemState {
+	state := noise.resetWithGenerator(seed, noise.NumAgentsPerSimulation()*noise.NumPercepts())
+	noise.drawNoise(state)
+	return state
+}
+
+// Writes the percepts of the wrapped environment, with the noise drawn for this state added
+func (noise *PerceptNoise) Observe(state *systemstate.SystemState, agentIndex int, percepts *mat.VecDense) {
+	noise.environment.Observe(state.Inner, agentIndex, percepts)
+	for perceptIndex, perceptNoise := range noise.noiseOf(state, agentIndex) {
+		percepts.SetVec(perceptIndex, percepts.AtVec(perceptIndex)+perceptNoise)
+	}
+}
+
+// Steps the wrapped environment, then draws the noise of the next observations
+func (noise *PerceptNoise) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	terminal, truncated, info := noise.stepInner(state, actions, rewards)
+	noise.drawNoise(state)
+	return terminal, truncated, info
+}
+
+// Draw fresh noise for the percepts of every agent
+func (noise *PerceptNoise) drawNoise(state *systemstate.SystemState) {
+	for agentIndex := 0; agentIndex < noise.NumAgentsPerSimulation(); agentIndex++ {
+		perceptNoise := noise.noiseOf(state, agentIndex)
+		for perceptIndex := range perceptNoise {
+			perceptNoise[perceptIndex] = noise.standardDeviations[perceptIndex] * state.RandomGenerator.NormFloat64()
+		}
+	}
+}
+
+// The noise of the given agent's percepts, which follows the wrapped environment's state in the state vector
+func (noise *PerceptNoise) noiseOf(state *systemstate.SystemState, agentIndex int) []float64 {
+	start := state.Inner.StateVector.Len() + agentIndex*noise.NumPercepts()
+	return state.StateVector.RawVector().Data[start : start+noise.NumPercepts()]
+}
@@ -0,0 +1,238 @@
+package wrappers
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	// Normalised percepts are clipped to this many standard deviations either side of the mean,
+	// so that percepts which have barely varied so far cannot produce enormous values
+	NORMALIZED_PERCEPT_BOUND = 10.0
+
+	// Added to the variance of each percept before normalising, so constant percepts are not divided by zero
+	NORMALIZATION_EPSILON = 1e-8
+)
+
+// Normalises every percept to zero mean and unit variance, using the mean and variance of every percept
+// observed in previous generations (by any agent, in any episode). Agents then need not learn the scale of each percept.
+//
+// The statistics only change between generations (see system.GenerationalSystem): each episode collects the percepts
+// it observes on its own, and these are merged into the statistics by EndGeneration. So every episode of a generation
+// is normalised by the same statistics, episodes stay reproducible from their seed, and concurrent episodes do not
+// contend for the statistics. Until the first EndGeneration, percepts are passed through unchanged.
+// Freeze the statistics (e.g. once training is over) to stop collecting percepts. The statistics are captured
+// by snapshots (see system.SnapshottableEnvironment) so they can be saved with a trained agent.
+type PerceptNormalization struct {
+	wrapper
+
+	// The statistics percepts are normalised by. They are replaced (never modified) by EndGeneration and RestoreSystem,
+	// so concurrent simulations read them without locking.
+	statistics atomic.Pointer[normalizationStatistics]
+	frozen     atomic.Bool
+
+	// Guards collectedStatistics, to which each new episode adds its own statistics
+	collectedMutex      sync.Mutex
+	collectedStatistics []*normalizationStatistics
+}
+
+// The statistics of a set of percepts, updated with Welford's algorithm
+type normalizationStatistics struct {
+	Count float64
+	Mean  []float64
+
+	// The sum of squared differences from the mean of each percept
+	SumSquaredDifferences []float64
+}
+
+// Wrap the environment, normalising its percepts
+func NewPerceptNormalization(environment system.Environment) *PerceptNormalization {
+	normalization := &PerceptNormalization{wrapper: newWrapper(environment)}
+	normalization.statistics.Store(newNormalizationStatistics(normalization.NumPercepts()))
+	return normalization
+}
+
+func (normalization *PerceptNormalization) Name() string {
+	return normalization.name("perceptNormalization")
+}
+func (normalization *PerceptNormalization) Constants() map[string]interface{} {
+	return normalization.constants(map[string]interface{}{
+		"NORMALIZED_PERCEPT_BOUND": NORMALIZED_PERCEPT_BOUND,
+		"NORMALIZATION_EPSILON":    NORMALIZATION_EPSILON,
+	})
+}
+
+// The schema of the wrapped environment, with every percept measured in standard deviations from its mean
+func (normalization *PerceptNormalization) Schema() system.Schema {
+	schema := normalization.innerSchema()
+	percepts := make([]system.Field, len(schema.Percepts))
+	for perceptIndex, percept := range schema.Percepts {
+		percepts[perceptIndex] = system.Field{Name: percept.Name, Minimum: -NORMALIZED_PERCEPT_BOUND, Maximum: NORMALIZED_PERCEPT_BOUND}
+	}
+	schema.Percepts = percepts
+	return schema
+}
+
+func (normalization *PerceptNormalization) Reset(seed uint64) *systemstate.SystemState {
+	return systemstate.WrapState(normalization.environment.Reset(seed), 0)
+}
+
+// Writes the percepts of the wrapped environment, normalised by the statistics of previous generations,
+// and collects them for the next (unless the statistics are frozen)
+func (normalization *PerceptNormalization) Observe(state *systemstate.SystemState, agentIndex int, percepts *mat.VecDense) {
+	normalization.environment.Observe(state.Inner, agentIndex, percepts)
+	if !normalization.frozen.Load() {
+		normalization.episodeStatistics(state).add(percepts)
+	}
+	normalization.statistics.Load().normalize(percepts)
+}
+
+func (normalization *PerceptNormalization) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	return normalization.stepInner(state, actions, rewards)
+}
+
+// Merge the percepts collected by every episode since the last call into the statistics, see system.GenerationalSystem
+func (normalization *PerceptNormalization) EndGeneration() {
+	normalization.collectedMutex.Lock()
+	collectedStatistics := normalization.collectedStatistics
+	normalization.collectedStatistics = nil
+	normalization.collectedMutex.Unlock()
+
+	statistics := normalization.statistics.Load().copy()
+	for _, episodeStatistics := range collectedStatistics {
+		statistics.merge(episodeStatistics)
+	}
+	normalization.statistics.Store(statistics)
+	normalization.wrapper.EndGeneration()
+}
+
+// Stop (or with false, resume) collecting the percepts observed, so that the statistics stay as they are.
+// Percepts already collected are still merged by the next EndGeneration.
+func (normalization *PerceptNormalization) Freeze(frozen bool) {
+	normalization.frozen.Store(frozen)
+}
+
+// The mean and standard deviation of every percept percepts are normalised by
+func (normalization *PerceptNormalization) Statistics() (means []float64, standardDeviations []float64) {
+	statistics := normalization.statistics.Load()
+	means = append([]float64{}, statistics.Mean...)
+	standardDeviations = make([]float64, len(means))
+	if statistics.Count > 0 {
+		for perceptIndex, sumSquaredDifferences := range statistics.SumSquaredDifferences {
+			standardDeviations[perceptIndex] = math.Sqrt(sumSquaredDifferences / statistics.Count)
+		}
+	}
+	return means, standardDeviations
+}
+
+// The statistics of the percepts observed in the episode, kept in the state's Scratch.
+// The statistics of each new episode are added to those merged by EndGeneration, so locking once per episode.
+func (normalization *PerceptNormalization) episodeStatistics(state *systemstate.SystemState) *normalizationStatistics {
+	if statistics, ok := state.Scratch.(*normalizationStatistics); ok {
+		return statistics
+	}
+	statistics := newNormalizationStatistics(normalization.NumPercepts())
+	normalization.collectedMutex.Lock()
+	normalization.collectedStatistics = append(normalization.collectedStatistics, statistics)
+	normalization.collectedMutex.Unlock()
+	state.Scratch = statistics
+	return statistics
+}
+
+// The wrapper's own state, as captured by SnapshotSystem
+type normalizationSnapshot struct {
+	Statistics normalizationStatistics
+	Frozen     bool
+
+	// The wrapped environment's own state, if it has any
+	Environment []byte
+}
+
+// Captures the statistics (but not the percepts collected since the last EndGeneration),
+// along with the wrapped environment's own state, see system.SnapshottableEnvironment
+func (normalization *PerceptNormalization) SnapshotSystem() ([]byte, error) {
+	environmentData, err := normalization.wrapper.SnapshotSystem()
+	if err != nil {
+		return nil, err
+	}
+	var data bytes.Buffer
+	err = gob.NewEncoder(&data).Encode(normalizationSnapshot{
+		Statistics:  *normalization.statistics.Load(),
+		Frozen:      normalization.frozen.Load(),
+		Environment: environmentData,
+	})
+	return data.Bytes(), err
+}
+
+// Returns the statistics (and the wrapped environment) to a state captured by SnapshotSystem
+func (normalization *PerceptNormalization) RestoreSystem(data []byte) error {
+	var snapshot normalizationSnapshot
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot); err != nil {
+		return err
+	}
+	if err := normalization.wrapper.RestoreSystem(snapshot.Environment); err != nil {
+		return err
+	}
+	normalization.statistics.Store(&snapshot.Statistics)
+	normalization.frozen.Store(snapshot.Frozen)
+	return nil
+}
+
+func newNormalizationStatistics(numPercepts int) *normalizationStatistics {
+	return &normalizationStatistics{
+		Mean:                  make([]float64, numPercepts),
+		SumSquaredDifferences: make([]float64, numPercepts),
+	}
+}
+
+func (statistics *normalizationStatistics) copy() *normalizationStatistics {
+	return &normalizationStatistics{
+		Count:                 statistics.Count,
+		Mean:                  append([]float64{}, statistics.Mean...),
+		SumSquaredDifferences: append([]float64{}, statistics.SumSquaredDifferences...),
+	}
+}
+
+// Add a single observation of the percepts
+func (statistics *normalizationStatistics) add(percepts *mat.VecDense) {
+	statistics.Count += 1
+	for perceptIndex, mean := range statistics.Mean {
+		difference := percepts.AtVec(perceptIndex) - mean
+		statistics.Mean[perceptIndex] += difference / statistics.Count
+		statistics.SumSquaredDifferences[perceptIndex] += difference * (percepts.AtVec(perceptIndex) - statistics.Mean[perceptIndex])
+	}
+}
+
+// Add every observation of the other statistics, with Chan et al.'s parallel form of Welford's algorithm
+func (statistics *normalizationStatistics) merge(other *normalizationStatistics) {
+	if other.Count == 0 {
+		return
+	}
+	count := statistics.Count + other.Count
+	for perceptIndex, mean := range statistics.Mean {
+		difference := other.Mean[perceptIndex] - mean
+		statistics.Mean[perceptIndex] += difference * other.Count / count
+		statistics.SumSquaredDifferences[perceptIndex] += other.SumSquaredDifferences[perceptIndex] +
+			difference*difference*statistics.Count*other.Count/count
+	}
+	statistics.Count = count
+}
+
+// Normalise the percepts in place, clipped to NORMALIZED_PERCEPT_BOUND, leaving them unchanged if nothing has been observed
+func (statistics *normalizationStatistics) normalize(percepts *mat.VecDense) {
+	if statistics.Count == 0 {
+		return
+	}
+	for perceptIndex, mean := range statistics.Mean {
+		variance := statistics.SumSquaredDifferences[perceptIndex] / statistics.Count
+		normalizedPercept := (percepts.AtVec(perceptIndex) - mean) / math.Sqrt(variance+NORMALIZATION_EPSILON)
+		percepts.SetVec(perceptIndex, math.Max(-NORMALIZED_PERCEPT_BOUND, math.Min(NORMALIZED_PERCEPT_BOUND, normalizedPercept)))
+	}
+}
@@ -0,0 +1,175 @@
+// Package wrappers holds composable wrappers that change how agents perceive and act on an environment,
+// without modifying the environment itself: sensor noise, action noise and latency, frame-skip,
+// percept normalisation, action clipping and scaling, and randomised physical parameters.
+// A controller that copes with these in simulation is far more likely to cope with a physical table.
+//
+// Every wrapper is itself a system.Environment, so wrappers can be stacked, e.g.
+//
+//	wrapped := wrappers.NewPerceptNoise(wrappers.NewActionLatency(pongsystem.NewPongSystem(), 2), standardDeviations)
+//	targetSystem := system.NewEnvironmentSystem(wrapped)
+//
+// The order matters: each wrapper acts on the actions and percepts as the wrappers outside it leave them
+// (so noise added inside a clipping wrapper is not clipped, for instance). No wrapper is a
+// system.ParameterizedEnvironment, so ParameterRandomization must be innermost, wrapping the environment itself.
+//
+// Any system that is an environment (see system.AsEnvironment) can be wrapped. Episodes stay reproducible from
+// their seed, and wrapped states can be copied and snapshot, as anything a wrapper must remember during an
+// episode (pending actions, sensor noise, physical parameters and so on) is kept in its state, which wraps the environment's state
+// (see systemstate.WrapState), and anything a wrapper learns across episodes (the statistics of PerceptNormalization)
+// only changes between generations (see system.GenerationalSystem). The name, constants, schema, episode limit and
+// time-out penalty of the wrapped environment are passed through, amended where the wrapper changes them.
+package wrappers
+
+import (
+	"fmt"
+
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// The behaviour shared by every wrapper, which passes everything through to the wrapped environment unchanged
+type wrapper struct {
+	environment system.Environment
+}
+
+func newWrapper(environment system.Environment) wrapper {
+	if environment == nil {
+		panic("Wrapped environment must not be nil!")
+	}
+	return wrapper{environment: environment}
+}
+
+func (wrapper wrapper) NumPercepts() int {
+	return wrapper.environment.NumPercepts()
+}
+func (wrapper wrapper) NumActions() int {
+	return wrapper.environment.NumActions()
+}
+func (wrapper wrapper) NumAgentsPerSimulation() int {
+	return wrapper.environment.NumAgentsPerSimulation()
+}
+
+// Writes the percepts of the wrapped environment unchanged
+func (wrapper wrapper) Observe(state *systemstate.SystemState, agentIndex int, percepts *mat.VecDense) {
+	wrapper.environment.Observe(state.Inner, agentIndex, percepts)
+}
+
+// The maximum episode length of the wrapped environment, see system.EpisodeLimitedSystem
+func (wrapper wrapper) MaximumEpisodeLength() int {
+	if limitedEnvironment, ok := wrapper.environment.(interface{ MaximumEpisodeLength() int }); ok {
+		return limitedEnvironment.MaximumEpisodeLength()
+	}
+	return 0
+}
+
+// The time-out penalty of the wrapped environment, see system.TimeoutPenalizedSystem
+func (wrapper wrapper) TimeoutPenalty(state *systemstate.SystemState, agentIndex int) float64 {
+	if penalizedEnvironment, ok := wrapper.environment.(interface {
+		TimeoutPenalty(*systemstate.SystemState, int) float64
+	}); ok {
+		return penalizedEnvironment.TimeoutPenalty(state.Inner, agentIndex)
+	}
+	return 0
+}
+
+// Captures the wrapped environment's own state, see system.SnapshottableEnvironment
+func (wrapper wrapper) SnapshotSystem() ([]byte, error) {
+	if snapshottableEnvironment, ok := wrapper.environment.(system.SnapshottableEnvironment); ok {
+		return snapshottableEnvironment.SnapshotSystem()
+	}
+	return nil, nil
+}
+
+// Returns the wrapped environment to a state captured by SnapshotSystem, see system.SnapshottableEnvironment
+func (wrapper wrapper) RestoreSystem(data []byte) error {
+	if snapshottableEnvironment, ok := wrapper.environment.(system.SnapshottableEnvironment); ok && data != nil {
+		return snapshottableEnvironment.RestoreSystem(data)
+	}
+	return nil
+}
+
+// Applies what the wrapped environment has learned, if it is a system.GenerationalEnvironment
+func (wrapper wrapper) EndGeneration() {
+	if generationalEnvironment, ok := wrapper.environment.(system.GenerationalEnvironment); ok {
+		generationalEnvironment.EndGeneration()
+	}
+}
+
+// The name of the wrapped environment followed by the given suffix, e.g. "pong+actionLatency"
+func (wrapper wrapper) name(suffix string) string {
+	if namedEnvironment, ok := wrapper.environment.(interface{ Name() string }); ok {
+		return namedEnvironment.Name() + "+" + suffix
+	}
+	return fmt.Sprintf("%T+%v", wrapper.environment, suffix)
+}
+
+// The constants of the wrapped environment along with the given constants of the wrapper
+func (wrapper wrapper) constants(wrapperConstants map[string]interface{}) map[string]interface{} {
+	constants := map[string]interface{}{}
+	if describedEnvironment, ok := wrapper.environment.(interface{ Constants() map[string]interface{} }); ok {
+		for name, value := range describedEnvironment.Constants() {
+			constants[name] = value
+		}
+	}
+	for name, value := range wrapperConstants {
+		constants[name] = value
+	}
+	return constants
+}
+
+// The schema of the wrapped environment, see system.SchemaOf
+func (wrapper wrapper) innerSchema() system.Schema {
+	return system.SchemaOf(system.NewEnvironmentSystem(wrapper.environment))
+}
+
+// Advance the wrapped environment's state a single step, maintaining its state index and terminal flag
+// as AdvanceEnvironmentState would, so that wrappers can be stacked
+func (wrapper wrapper) stepInner(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	return stepWrapped(wrapper.environment, state, actions, rewards)
+}
+
+// Advance the wrapped state a single step with the given environment, as stepInner does
+func stepWrapped(environment system.Environment, state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	terminal, truncated, info := environment.Step(state.Inner, actions, rewards)
+	state.Inner.StateIndex += 1
+	state.Inner.TerminalState = terminal || truncated
+	if truncated && !terminal {
+		state.Inner.TerminalReason = systemstate.TerminalReasonTruncated
+	}
+	return terminal, truncated, info
+}
+
+// Reset the wrapped environment for wrappers with randomness of their own. The wrapper's generator is seeded
+// with the given seed, and the wrapped environment with the first number it draws, so stacked wrappers each
+// draw different numbers. The wrapper's state has numExtraElements (see systemstate.WrapState) and the generator.
+func (wrapper wrapper) resetWithGenerator(seed uint64, numExtraElements int) *systemstate.SystemState {
+	randomSource := &rand.PCGSource{}
+	randomSource.Seed(seed)
+	randomGenerator := rand.New(randomSource)
+	state := systemstate.WrapState(wrapper.environment.Reset(randomGenerator.Uint64()), numExtraElements)
+	state.RandomGenerator = randomGenerator
+	state.RandomSource = randomSource
+	return state
+}
+
+// The reused action vectors of an episode, one per agent, kept in the state's Scratch
+func (wrapper wrapper) actionBuffers(state *systemstate.SystemState) []*mat.VecDense {
+	if buffers, ok := state.Scratch.([]*mat.VecDense); ok {
+		return buffers
+	}
+	buffers := make([]*mat.VecDense, wrapper.NumAgentsPerSimulation())
+	for agentIndex := range buffers {
+		buffers[agentIndex] = mat.NewVecDense(wrapper.NumActions(), nil)
+	}
+	state.Scratch = buffers
+	return buffers
+}
+
+// Panic unless there is exactly one value per element of a vector of the given length
+func checkLength(values []float64, length int, description string) {
+	if len(values) != length {
+		panic(fmt.Sprintf("Expected %v %v, got %v!", length, description, len(values)))
+	}
+}
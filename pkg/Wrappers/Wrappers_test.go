@@ -0,0 +1,387 @@
+package wrappers
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	agent "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Agent"
+	simulator "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/Simulator"
+	system "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/System"
+	systemstate "github.com/Otago-Computer-Science-Society/FoosballGeneticLearning/pkg/SystemState"
+	"gonum.org/v1/gonum/mat"
+)
+
+// An environment whose only state is the sum of agent 0's first actions so far, starting from the seed.
+// Each agent perceives the sum and its own index, and is rewarded with its first action.
+// The episode ends once the sum reaches 1000.
+type sumEnvironment struct{}
+
+func (sumEnvironment) NumPercepts() int            { return 2 }
+func (sumEnvironment) NumActions() int             { return 2 }
+func (sumEnvironment) NumAgentsPerSimulation() int { return 2 }
+
+func (sumEnvironment) Schema() system.Schema {
+	return system.Schema{
+		State:    []system.Field{system.UnboundedField("Sum", "")},
+		Percepts: []system.Field{system.UnboundedField("Sum", ""), system.UnboundedField("AgentIndex", "")},
+		Actions:  []system.Field{{Name: "Push", Minimum: -1, Maximum: 1}, {Name: "Unused", Minimum: -1, Maximum: 1}},
+	}
+}
+
+func (sumEnvironment) Reset(seed uint64) *systemstate.SystemState {
+	return &systemstate.SystemState{StateVector: mat.NewVecDense(1, []float64{float64(seed % 100)})}
+}
+
+func (sumEnvironment) Observe(state *systemstate.SystemState, agentIndex int, percepts *mat.VecDense) {
+	percepts.SetVec(0, state.StateVector.AtVec(0))
+	percepts.SetVec(1, float64(agentIndex))
+}
+
+func (sumEnvironment) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	state.StateVector.SetVec(0, state.StateVector.AtVec(0)+actions[0].AtVec(0))
+	for agentIndex, action := range actions {
+		rewards[agentIndex] = action.AtVec(0)
+	}
+	return state.StateVector.AtVec(0) >= 1000, false, nil
+}
+
+// Actions in which every agent's first action is the given value
+func constantActions(value float64) []*mat.VecDense {
+	return []*mat.VecDense{mat.NewVecDense(2, []float64{value, 0}), mat.NewVecDense(2, []float64{value, 0})}
+}
+
+func TestActionLatencyDelaysActions(t *testing.T) {
+	latency := NewActionLatency(sumEnvironment{}, 2)
+	if err := system.SchemaOf(system.NewEnvironmentSystem(latency)).Check(system.NewEnvironmentSystem(latency)); err != nil {
+		t.Fatal(err)
+	}
+	state := latency.Reset(0)
+	if numStateFields := len(latency.Schema().State); numStateFields != state.StateVector.Len() {
+		t.Errorf("expected a schema field for each of the %v state elements, got %v", state.StateVector.Len(), numStateFields)
+	}
+
+	rewards := make([]float64, 2)
+	for stepIndex, expectedReward := range []float64{0, 0, 1, 2, 3} {
+		latency.Step(state, constantActions(float64(stepIndex+1)), rewards)
+		if rewards[0] != expectedReward {
+			t.Errorf("step %v: expected the actions of two steps earlier (reward %v), got reward %v", stepIndex, expectedReward, rewards[0])
+		}
+	}
+	if state.Inner.StateVector.AtVec(0) != 6 || state.Inner.StateIndex != 5 {
+		t.Errorf("expected the wrapped state to have summed 1+2+3 over 5 steps, got %v after %v steps",
+			state.Inner.StateVector.AtVec(0), state.Inner.StateIndex)
+	}
+}
+
+func TestFrameSkipRepeatsActions(t *testing.T) {
+	frameSkip := NewFrameSkip(sumEnvironment{}, 3)
+	state := frameSkip.Reset(0)
+	rewards := make([]float64, 2)
+	frameSkip.Step(state, constantActions(2), rewards)
+	if rewards[0] != 6 || state.Inner.StateVector.AtVec(0) != 6 || state.Inner.StateIndex != 3 {
+		t.Errorf("expected three steps with total reward 6, got %v steps with reward %v", state.Inner.StateIndex, rewards[0])
+	}
+
+	// Repetition stops as soon as the episode ends
+	terminal, _, _ := frameSkip.Step(state, constantActions(1000), rewards)
+	if !terminal || state.Inner.StateIndex != 4 || rewards[0] != 1000 {
+		t.Errorf("expected the episode to end after a single more step, ended %v after %v steps with reward %v",
+			terminal, state.Inner.StateIndex, rewards[0])
+	}
+}
+
+func TestPerceptNoiseIsReproducible(t *testing.T) {
+	noise := NewPerceptNoise(sumEnvironment{}, []float64{0.5, 0})
+	state := noise.Reset(1)
+	sameSeedState := noise.Reset(1)
+	percepts := mat.NewVecDense(2, nil)
+	repeatPercepts := mat.NewVecDense(2, nil)
+	rewards := make([]float64, 2)
+
+	noiseSum, noiseSquaredSum := 0.0, 0.0
+	numSteps := 2000
+	for stepIndex := 0; stepIndex < numSteps; stepIndex++ {
+		noise.Observe(state, 0, percepts)
+		noise.Observe(sameSeedState, 0, repeatPercepts)
+		if !mat.Equal(percepts, repeatPercepts) {
+			t.Fatalf("step %v: expected episodes with the same seed to have the same noise, got %v and %v",
+				stepIndex, percepts.RawVector().Data, repeatPercepts.RawVector().Data)
+		}
+		if percepts.AtVec(1) != 0 {
+			t.Fatalf("expected no noise on a percept with zero standard deviation, got %v", percepts.AtVec(1))
+		}
+		perceptNoise := percepts.AtVec(0) - state.Inner.StateVector.AtVec(0)
+		noiseSum += perceptNoise
+		noiseSquaredSum += perceptNoise * perceptNoise
+		noise.Step(state, constantActions(0), rewards)
+		noise.Step(sameSeedState, constantActions(0), rewards)
+	}
+	mean := noiseSum / float64(numSteps)
+	standardDeviation := math.Sqrt(noiseSquaredSum/float64(numSteps) - mean*mean)
+	if math.Abs(mean) > 0.05 || math.Abs(standardDeviation-0.5) > 0.05 {
+		t.Errorf("expected noise with mean 0 and standard deviation 0.5, got mean %v and standard deviation %v", mean, standardDeviation)
+	}
+}
+
+func TestPerceptNormalizationStatistics(t *testing.T) {
+	normalization := NewPerceptNormalization(sumEnvironment{})
+	percepts := mat.NewVecDense(2, nil)
+	for seed := uint64(0); seed < 100; seed++ {
+		normalization.Observe(normalization.Reset(seed), 0, percepts)
+	}
+	// Percepts are only collected until the generation ends, so are not yet normalised
+	if percepts.AtVec(0) != 99 {
+		t.Errorf("expected the last sum of 99 to be passed through before the first generation ends, got %v", percepts.AtVec(0))
+	}
+
+	normalization.EndGeneration()
+	means, standardDeviations := normalization.Statistics()
+	// The sums 0, ..., 99 have mean 49.5 and variance (100^2 - 1) / 12
+	if math.Abs(means[0]-49.5) > 1e-9 || math.Abs(standardDeviations[0]-math.Sqrt(9999.0/12)) > 1e-9 {
+		t.Errorf("expected mean 49.5 and standard deviation %v, got %v and %v", math.Sqrt(9999.0/12), means[0], standardDeviations[0])
+	}
+	normalization.Observe(normalization.Reset(99), 0, percepts)
+	if percepts.AtVec(0) < 1.7 || percepts.AtVec(0) > 1.8 {
+		t.Errorf("expected the sum of 99 to be normalised to about 1.71, got %v", percepts.AtVec(0))
+	}
+
+	// Frozen statistics are not changed by observing, and survive a snapshot
+	normalization.EndGeneration()
+	means, _ = normalization.Statistics()
+	normalization.Freeze(true)
+	data, err := normalization.SnapshotSystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewPerceptNormalization(sumEnvironment{})
+	if err := restored.RestoreSystem(data); err != nil {
+		t.Fatal(err)
+	}
+	restoredPercepts := mat.NewVecDense(2, nil)
+	for repeat := 0; repeat < 2; repeat++ {
+		normalization.Observe(normalization.Reset(7), 0, percepts)
+		restored.Observe(restored.Reset(7), 0, restoredPercepts)
+		if !mat.Equal(percepts, restoredPercepts) {
+			t.Errorf("expected the restored statistics to normalise as the original, got %v and %v",
+				percepts.RawVector().Data, restoredPercepts.RawVector().Data)
+		}
+	}
+	normalization.EndGeneration()
+	if frozenMeans, _ := normalization.Statistics(); frozenMeans[0] != means[0] {
+		t.Errorf("expected frozen statistics not to change, mean went from %v to %v", means[0], frozenMeans[0])
+	}
+}
+
+// Episodes of the same generation are normalised by the same statistics, however many are simulated in between
+func TestPerceptNormalizationIsReproducibleWithinGeneration(t *testing.T) {
+	normalization := NewPerceptNormalization(sumEnvironment{})
+	for seed := uint64(0); seed < 10; seed++ {
+		normalization.Observe(normalization.Reset(seed), 0, mat.NewVecDense(2, nil))
+	}
+	normalization.EndGeneration()
+
+	percepts := mat.NewVecDense(2, nil)
+	normalization.Observe(normalization.Reset(5), 0, percepts)
+	for seed := uint64(100); seed < 200; seed++ {
+		normalization.Observe(normalization.Reset(seed), 0, mat.NewVecDense(2, nil))
+	}
+	repeatPercepts := mat.NewVecDense(2, nil)
+	normalization.Observe(normalization.Reset(5), 0, repeatPercepts)
+	if !mat.Equal(percepts, repeatPercepts) {
+		t.Errorf("expected the same percepts within a generation, got %v and %v", percepts.RawVector().Data, repeatPercepts.RawVector().Data)
+	}
+}
+
+func TestActionTransform(t *testing.T) {
+	scaling := NewActionScaling(sumEnvironment{}, []float64{2, 1}, []float64{1, 0})
+	if push := scaling.Schema().Actions[0]; push.Minimum != -1 || push.Maximum != 0 {
+		t.Errorf("expected agent actions in [-1, 0] to reach the bounds of [-1, 1], got [%v, %v]", push.Minimum, push.Maximum)
+	}
+	state := scaling.Reset(0)
+	rewards := make([]float64, 2)
+	scaling.Step(state, constantActions(3), rewards)
+	if rewards[0] != 7 {
+		t.Errorf("expected the action 3 to be scaled to 7, got %v", rewards[0])
+	}
+
+	clipping := NewActionClipping(sumEnvironment{}, []float64{-1, -1}, []float64{1, 1})
+	state = clipping.Reset(0)
+	actions := constantActions(3)
+	clipping.Step(state, actions, rewards)
+	if rewards[0] != 1 || actions[0].AtVec(0) != 3 {
+		t.Errorf("expected the action 3 to be clipped to 1 without changing the given action, got %v and %v", rewards[0], actions[0].AtVec(0))
+	}
+}
+
+// Stack every wrapper, as a controller for a physical table might be trained
+func newWrapperStack() *system.EnvironmentSystem {
+	var environment system.Environment = sumEnvironment{}
+	environment = NewActionClipping(environment, []float64{-1, -1}, []float64{1, 1})
+	environment = NewActionLatency(environment, 2)
+	environment = NewActionNoise(environment, []float64{0.1, 0.1})
+	environment = NewFrameSkip(environment, 2)
+	environment = NewPerceptNoise(environment, []float64{0.1, 0})
+	environment = NewPerceptNormalization(environment)
+	return system.NewEnvironmentSystem(environment)
+}
+
+func newStackAgents() []*agent.Agent {
+	return []*agent.Agent{
+		agent.NewAgent(mat.NewDense(2, 2, []float64{0.01, 1, 0, 0})),
+		agent.NewAgent(mat.NewDense(2, 2, []float64{-0.01, 0, 0, 1})),
+	}
+}
+
+func TestWrapperStackIsReproducible(t *testing.T) {
+	stack := newWrapperStack()
+	if name := stack.Name(); name != "wrappers.sumEnvironment+actionClipping+actionLatency+actionNoise+frameSkip+perceptNoise+perceptNormalization" {
+		t.Errorf("unexpected name %v", name)
+	}
+
+	// Let the percept normalisation learn from an episode first, as it would in the previous generation
+	job := simulator.SimulationJob{Agents: newStackAgents(), Seed: 2, Seeded: true, MaximumEpisodeLength: 50}
+	simulator.SimulateJob(context.Background(), stack, job)
+	stack.EndGeneration()
+
+	job = simulator.SimulationJob{Agents: newStackAgents(), Seed: 3, Seeded: true, MaximumEpisodeLength: 50}
+	result := simulator.SimulateJob(context.Background(), stack, job)
+	job.Agents = newStackAgents()
+	repeatResult := simulator.SimulateJob(context.Background(), stack, job)
+	if result.EpisodeLength != 50 || result.Returns[0] != repeatResult.Returns[0] || result.Returns[1] != repeatResult.Returns[1] {
+		t.Errorf("expected the same 50 step episode twice, got returns %v after %v steps and %v after %v steps",
+			result.Returns, result.EpisodeLength, repeatResult.Returns, repeatResult.EpisodeLength)
+	}
+}
+
+// Copies and snapshots of a wrapped state, taken part way through an episode, must carry on exactly as the original
+func TestWrappedStatesCanBeForked(t *testing.T) {
+	stack := newWrapperStack()
+	agents := newStackAgents()
+	buffers := system.NewStepBuffers(stack.Environment)
+	state := stack.Environment.Reset(11)
+	for stepIndex := 0; stepIndex < 5; stepIndex++ {
+		system.AdvanceEnvironmentState(stack.Environment, state, agents, buffers)
+	}
+
+	snapshot, err := system.TakeSnapshot(stack, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoredState, err := snapshot.Restore(stack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copiedState := state.DeepCopyState()
+	for stepIndex := 0; stepIndex < 20; stepIndex++ {
+		system.AdvanceEnvironmentState(stack.Environment, state, agents, buffers)
+		system.AdvanceEnvironmentState(stack.Environment, restoredState, agents, buffers)
+		system.AdvanceEnvironmentState(stack.Environment, copiedState, agents, buffers)
+	}
+	if !mat.Equal(restoredState.StateVector, state.StateVector) || !mat.Equal(copiedState.StateVector, state.StateVector) {
+		t.Errorf("expected the restored and copied states to end as %v, got %v and %v", state.StateVector.RawVector().Data,
+			restoredState.StateVector.RawVector().Data, copiedState.StateVector.RawVector().Data)
+	}
+	for innerState, innerCopy := state.Inner, copiedState.Inner; innerState != nil; innerState, innerCopy = innerState.Inner, innerCopy.Inner {
+		if innerState.StateIndex != innerCopy.StateIndex || innerCopy.StateVector.AtVec(0) != copiedState.StateVector.AtVec(0) {
+			t.Errorf("expected every inner state of the copy to view its vector and match the original")
+		}
+	}
+}
+
+// Wrappers must not make stepping allocate, once each episode's reused buffers are made
+func TestWrapperStackStepDoesNotAllocate(t *testing.T) {
+	stack := newWrapperStack()
+	agents := newStackAgents()
+	buffers := system.NewStepBuffers(stack.Environment)
+	state := stack.Environment.Reset(5)
+	system.AdvanceEnvironmentState(stack.Environment, state, agents, buffers)
+	allocations := testing.AllocsPerRun(1000, func() {
+		system.AdvanceEnvironmentState(stack.Environment, state, agents, buffers)
+	})
+	if allocations != 0 {
+		t.Errorf("expected no allocations per step, got %v", allocations)
+	}
+
+	// Stepping through the adapter keeps its buffers in the state, apart from the wrappers' Scratch
+	state = stack.Environment.Reset(5)
+	stack.AdvanceState(state, agents)
+	allocations = testing.AllocsPerRun(1000, func() {
+		stack.AdvanceState(state, agents)
+	})
+	if allocations != 0 {
+		t.Errorf("expected no allocations per step of the adapter, got %v", allocations)
+	}
+}
+
+// A sumEnvironment in which each action is multiplied by a parameter before being summed
+type scaledSumEnvironment struct {
+	sumEnvironment
+	scale float64
+}
+
+func (environment scaledSumEnvironment) ParameterFields() []system.Field {
+	return []system.Field{{Name: "Scale", Minimum: 0, Maximum: 10}, {Name: "Unused", Minimum: -1, Maximum: 1}}
+}
+func (environment scaledSumEnvironment) ParameterValues() []float64 {
+	return []float64{environment.scale, 0}
+}
+func (environment scaledSumEnvironment) WithParameterValues(values []float64) system.ParameterizedEnvironment {
+	system.CheckParameterValues(environment.ParameterFields(), values)
+	return scaledSumEnvironment{scale: values[0]}
+}
+
+func (environment scaledSumEnvironment) Step(state *systemstate.SystemState, actions []*mat.VecDense, rewards []float64) (bool, bool, system.StepInfo) {
+	state.StateVector.SetVec(0, state.StateVector.AtVec(0)+environment.scale*actions[0].AtVec(0))
+	return false, false, nil
+}
+
+func TestParameterRandomizationDrawsParametersPerEpisode(t *testing.T) {
+	randomization := NewParameterRandomization(scaledSumEnvironment{scale: 1}, map[string]ParameterRange{"Scale": {Minimum: 2, Maximum: 3}})
+	if err := system.NewEnvironmentSystem(randomization).Schema().Check(system.NewEnvironmentSystem(randomization)); err != nil {
+		t.Fatal(err)
+	}
+	rewards := make([]float64, 2)
+	scales := map[float64]bool{}
+	for seed := uint64(0); seed < 20; seed++ {
+		state := randomization.Reset(seed)
+		parameters := randomization.ParametersOf(state)
+		if parameters[0] < 2 || parameters[0] > 3 || parameters[1] != 0 {
+			t.Fatalf("expected a scale in [2, 3] and the unranged parameter left at 0, got %v", parameters)
+		}
+		if repeatParameters := randomization.ParametersOf(randomization.Reset(seed)); repeatParameters[0] != parameters[0] {
+			t.Fatalf("expected the same parameters from the same seed, got %v and %v", parameters, repeatParameters)
+		}
+		scales[parameters[0]] = true
+
+		// Copies of the state are simulated with the episode's parameters too
+		initialSum := state.Inner.StateVector.AtVec(0)
+		copiedState := state.DeepCopyState()
+		for _, steppedState := range []*systemstate.SystemState{state, copiedState} {
+			randomization.Step(steppedState, constantActions(1), rewards)
+			if sum := steppedState.Inner.StateVector.AtVec(0); sum != initialSum+parameters[0] {
+				t.Fatalf("expected the action to be scaled by %v, got a sum of %v from %v", parameters[0], sum, initialSum)
+			}
+		}
+	}
+	if len(scales) < 20 {
+		t.Errorf("expected different parameters in each episode, got %v different scales in 20 episodes", len(scales))
+	}
+}
+
+func TestParameterRandomizationChecksRanges(t *testing.T) {
+	for name, ranges := range map[string]map[string]ParameterRange{
+		"unknown parameter": {"Gravity": {Minimum: 0, Maximum: 1}},
+		"empty range":       {"Scale": {Minimum: 2, Maximum: 1}},
+		"out of bounds":     {"Scale": {Minimum: -1, Maximum: 1}},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%v: expected a panic", name)
+				}
+			}()
+			NewParameterRandomization(scaledSumEnvironment{scale: 1}, ranges)
+		}()
+	}
+}
@@ -127,3 +127,29 @@ func NewParquetWriter[T interface{}](dataFilePath string, dataStruct T) (*source
 
 	return &dataFileWriter, parquetDataWriter
 }
+
+// Create a new parquet writer to a given file path, with columns given at runtime rather than by a struct.
+//
+// Each column is described as in a struct tag, e.g. "name=StateIndex, type=INT32",
+// and each row is written as a []interface{} holding a value of the right type for every column, in order.
+//
+// # Arguments
+//
+// dataFilePath string: The path to the data file required
+//
+// columns []string: The description of each column
+//
+// # Returns
+//
+// A ParquetWriter to the data file in question.
+func NewParquetColumnWriter(dataFilePath string, columns []string) (*source.ParquetFile, *writer.CSVWriter) {
+	os.Remove(dataFilePath)
+	dataFileWriter, _ := local.NewLocalFileWriter(dataFilePath)
+	parquetDataWriter, _ := writer.NewCSVWriter(columns, dataFileWriter, 4)
+	parquetDataWriter.RowGroupSize = 128 * 1024 * 1024 //128MB
+	parquetDataWriter.PageSize = 8 * 1024              //8K
+	parquetDataWriter.CompressionType = parquet.CompressionCodec_SNAPPY
+	parquetDataWriter.Flush(true)
+
+	return &dataFileWriter, parquetDataWriter
+}